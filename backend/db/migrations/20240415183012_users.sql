@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+Create Table User (
+    id integer primary key not null,
+    username text not null unique,
+    password_hash text not null,
+    is_admin boolean not null default false,
+    created_at int not null
+);
+
+Create Table Session (
+    id text primary key not null,
+    user_id int not null,
+    created_at int not null,
+    expires_at int not null,
+
+    foreign key(user_id) references User(id) on delete cascade
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+Drop Table Session;
+Drop Table User;
+-- +goose StatementEnd
@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+Create Table PlaybackProgress (
+    user_id int not null,
+    audiobook_id int not null,
+    chapter_numbering int not null,
+    offset_seconds float not null,
+    finished boolean not null default false,
+    updated_at int not null,
+
+    primary key(user_id, audiobook_id),
+    foreign key(user_id) references User(id) on delete cascade,
+    foreign key(audiobook_id) references Audiobook(id) on delete cascade
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+Drop Table PlaybackProgress;
+-- +goose StatementEnd
@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+Create Table Bookmark (
+    id integer primary key not null,
+    user_id int not null,
+    audiobook_id int not null,
+    chapter_numbering int not null,
+    offset_seconds float not null,
+    name text not null,
+    note text not null,
+    created_at int not null,
+    updated_at int not null,
+
+    foreign key(user_id) references User(id) on delete cascade,
+    foreign key(audiobook_id) references Audiobook(id) on delete cascade
+);
+
+Create Index BookmarkUserAudiobook On Bookmark(user_id, audiobook_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+Drop Index BookmarkUserAudiobook;
+Drop Table Bookmark;
+-- +goose StatementEnd
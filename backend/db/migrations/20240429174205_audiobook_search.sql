@@ -0,0 +1,64 @@
+-- +goose Up
+-- +goose StatementBegin
+Create Virtual Table AudiobookSearch Using fts5(
+    title,
+    author,
+    narrator,
+    description,
+    genre,
+    chapters,
+    tokenize="unicode61 remove_diacritics 1"
+);
+
+Insert Into AudiobookSearch (rowid, title, author, narrator, description, genre, chapters)
+Select a.id, a.title, a.author, a.narrator, a.description, a.genre,
+    Coalesce((Select group_concat(c.title, ' ') From Chapter c Where c.audiobook_id = a.id), '')
+From Audiobook a;
+
+Create Trigger AudiobookSearchInsert After Insert On Audiobook Begin
+    Insert Into AudiobookSearch (rowid, title, author, narrator, description, genre, chapters)
+    Values (new.id, new.title, new.author, new.narrator, new.description, new.genre, '');
+End;
+
+Create Trigger AudiobookSearchUpdate After Update On Audiobook Begin
+    Update AudiobookSearch
+    Set title = new.title, author = new.author, narrator = new.narrator, description = new.description, genre = new.genre
+    Where rowid = new.id;
+End;
+
+Create Trigger AudiobookSearchDelete After Delete On Audiobook Begin
+    Delete From AudiobookSearch Where rowid = old.id;
+End;
+
+Create Trigger ChapterSearchInsert After Insert On Chapter Begin
+    Update AudiobookSearch
+    Set chapters = Coalesce((Select group_concat(c.title, ' ') From Chapter c Where c.audiobook_id = new.audiobook_id), '')
+    Where rowid = new.audiobook_id;
+End;
+
+Create Trigger ChapterSearchUpdate After Update Of title, audiobook_id On Chapter Begin
+    Update AudiobookSearch
+    Set chapters = Coalesce((Select group_concat(c.title, ' ') From Chapter c Where c.audiobook_id = old.audiobook_id), '')
+    Where rowid = old.audiobook_id;
+    Update AudiobookSearch
+    Set chapters = Coalesce((Select group_concat(c.title, ' ') From Chapter c Where c.audiobook_id = new.audiobook_id), '')
+    Where rowid = new.audiobook_id;
+End;
+
+Create Trigger ChapterSearchDelete After Delete On Chapter Begin
+    Update AudiobookSearch
+    Set chapters = Coalesce((Select group_concat(c.title, ' ') From Chapter c Where c.audiobook_id = old.audiobook_id), '')
+    Where rowid = old.audiobook_id;
+End;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+Drop Trigger ChapterSearchDelete;
+Drop Trigger ChapterSearchUpdate;
+Drop Trigger ChapterSearchInsert;
+Drop Trigger AudiobookSearchDelete;
+Drop Trigger AudiobookSearchUpdate;
+Drop Trigger AudiobookSearchInsert;
+Drop Table AudiobookSearch;
+-- +goose StatementEnd
@@ -0,0 +1,82 @@
+-- +goose Up
+-- +goose StatementBegin
+Create Table Person (
+    id integer primary key not null,
+    name text not null unique collate nocase
+);
+
+Create Table Series (
+    id integer primary key not null,
+    name text not null unique collate nocase
+);
+
+Create Table Genre (
+    id integer primary key not null,
+    name text not null unique collate nocase
+);
+
+Create Table AudiobookAuthor (
+    audiobook_id int not null,
+    person_id int not null,
+    position int not null,
+
+    primary key(audiobook_id, person_id),
+    foreign key(audiobook_id) references Audiobook(id) on delete cascade,
+    foreign key(person_id) references Person(id) on delete cascade
+);
+
+Create Table AudiobookNarrator (
+    audiobook_id int not null,
+    person_id int not null,
+    position int not null,
+
+    primary key(audiobook_id, person_id),
+    foreign key(audiobook_id) references Audiobook(id) on delete cascade,
+    foreign key(person_id) references Person(id) on delete cascade
+);
+
+Create Table AudiobookGenre (
+    audiobook_id int not null,
+    genre_id int not null,
+
+    primary key(audiobook_id, genre_id),
+    foreign key(audiobook_id) references Audiobook(id) on delete cascade,
+    foreign key(genre_id) references Genre(id) on delete cascade
+);
+
+Create Table AudiobookSeries (
+    audiobook_id int not null,
+    series_id int not null,
+    position text not null,
+
+    primary key(audiobook_id, series_id),
+    foreign key(audiobook_id) references Audiobook(id) on delete cascade,
+    foreign key(series_id) references Series(id) on delete cascade
+);
+
+Create Index AudiobookAuthorPerson On AudiobookAuthor(person_id);
+Create Index AudiobookNarratorPerson On AudiobookNarrator(person_id);
+Create Index AudiobookGenreGenre On AudiobookGenre(genre_id);
+Create Index AudiobookSeriesSeries On AudiobookSeries(series_id);
+
+Insert Or Ignore Into Person (name) Select author From Audiobook Where author != '';
+Insert Or Ignore Into Person (name) Select narrator From Audiobook Where narrator != '';
+Insert Or Ignore Into Genre (name) Select genre From Audiobook Where genre != '';
+Insert Or Ignore Into AudiobookAuthor (audiobook_id, person_id, position)
+Select a.id, p.id, 0 From Audiobook a Join Person p On p.name = a.author;
+Insert Or Ignore Into AudiobookNarrator (audiobook_id, person_id, position)
+Select a.id, p.id, 0 From Audiobook a Join Person p On p.name = a.narrator;
+Insert Or Ignore Into AudiobookGenre (audiobook_id, genre_id)
+Select a.id, g.id From Audiobook a Join Genre g On g.name = a.genre;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+Drop Table AudiobookSeries;
+Drop Table AudiobookGenre;
+Drop Table AudiobookNarrator;
+Drop Table AudiobookAuthor;
+Drop Table Genre;
+Drop Table Series;
+Drop Table Person;
+-- +goose StatementEnd
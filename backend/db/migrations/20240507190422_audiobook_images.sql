@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+Create Table AudiobookImage (
+    audiobook_id int not null,
+    kind text not null,
+    file_path text not null,
+    content_type text not null,
+    width int not null,
+    height int not null,
+
+    primary key(audiobook_id, kind),
+    foreign key(audiobook_id) references Audiobook(id) on delete cascade
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+Drop Table AudiobookImage;
+-- +goose StatementEnd
@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Audiobooks are located relative to the configured library root from now on.
+-- Absolute paths of existing rows are rewritten on startup by AudiobookRepositoryService.RelativizeAudiobookPaths.
+Alter Table Audiobook Rename Column dir_path To relative_path;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+Alter Table Audiobook Rename Column relative_path To dir_path;
+-- +goose StatementEnd
@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+Create Table SourceFile (
+    id integer primary key not null,
+    -- Audio file relative to the library root
+    path text not null unique,
+    -- Audiobook source the file belongs to; the file itself or the folder of a multi-file audiobook
+    source_path text not null,
+    size int not null,
+    mod_time int not null,
+    hash text not null,
+    audiobook_id int,
+    status text not null,
+    last_error text not null default '',
+    updated_at int not null,
+
+    foreign key(audiobook_id) references Audiobook(id) on delete set null
+);
+
+Create Index SourceFileSourcePath On SourceFile(source_path);
+Create Index SourceFileAudiobook On SourceFile(audiobook_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+Drop Index SourceFileAudiobook;
+Drop Index SourceFileSourcePath;
+Drop Table SourceFile;
+-- +goose StatementEnd
@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Set when the source of an audiobook disappeared from the library; the audiobook is purged after a grace period
+Alter Table Audiobook Add Column missing_since int;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+Alter Table Audiobook Drop Column missing_since;
+-- +goose StatementEnd
@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Audiobooks are identified by their source when processed again
+Create Index AudiobookRelativePath On Audiobook(relative_path);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+Drop Index AudiobookRelativePath;
+-- +goose StatementEnd
@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Failed sources are retried with backoff and quarantined after too many attempts
+Alter Table SourceFile Add Column attempts int not null default 0;
+Alter Table SourceFile Add Column failed_stage text not null default '';
+Alter Table SourceFile Add Column retry_at int;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+Alter Table SourceFile Drop Column retry_at;
+Alter Table SourceFile Drop Column failed_stage;
+Alter Table SourceFile Drop Column attempts;
+-- +goose StatementEnd
@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+Create Table Job (
+    id integer primary key not null,
+    -- Audiobook source processed by the job; a source has at most one job
+    source_path text not null unique,
+    -- Hashes of the source files when the job was queued; a changed source starts over
+    content_key text not null,
+    -- Last completed stage
+    stage text not null,
+    state text not null,
+    -- Results of completed stages as JSON object keyed by stage to resume from
+    results text not null default '',
+    error text not null default '',
+    created_at int not null,
+    updated_at int not null
+);
+
+Create Index JobUpdatedAt On Job(updated_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+Drop Index JobUpdatedAt;
+Drop Table Job;
+-- +goose StatementEnd
@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+Create Table AudiobookLoudness (
+    audiobook_id int primary key not null,
+    -- Measured over all chapters before any gain is applied
+    integrated_lufs real not null,
+    true_peak real not null,
+    -- In dB, reaching the configured target without clipping
+    gain real not null,
+    -- Set if gain is already applied to the chapter files
+    normalized boolean not null default false,
+
+    foreign key(audiobook_id) references Audiobook(id) on delete cascade
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+Drop Table AudiobookLoudness;
+-- +goose StatementEnd
@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Set for chapters proposed at long silences of a source without chapter markers
+Alter Table Chapter Add Column auto_detected boolean not null default false;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+Alter Table Chapter Drop Column auto_detected;
+-- +goose StatementEnd
@@ -0,0 +1,33 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Values edited by users, applied over the values extracted from the source whenever it is processed; Null keeps the extracted value
+Create Table AudiobookOverride (
+    audiobook_id int primary key not null,
+    title text,
+    -- Names as JSON arrays
+    authors text,
+    narrators text,
+    description text,
+    genres text,
+    series text,
+    series_position text,
+
+    foreign key(audiobook_id) references Audiobook(id) on delete cascade
+);
+
+Create Table ChapterOverride (
+    audiobook_id int not null,
+    numbering int not null,
+    title text,
+    end_time real,
+
+    primary key(audiobook_id, numbering),
+    foreign key(audiobook_id) references Audiobook(id) on delete cascade
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+Drop Table ChapterOverride;
+Drop Table AudiobookOverride;
+-- +goose StatementEnd
@@ -0,0 +1,88 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Chapters referenced a table that does not exist; rebuilt to reference Audiobook now that foreign keys are enforced.
+-- Chapters left behind by deleted audiobooks are not copied
+Create Table ChapterRebuilt (
+    id integer primary key not null,
+    audiobook_id int not null,
+    numbering int not null,
+    title text not null,
+    start_time float not null,
+    end_time float not null,
+    file_path text not null,
+    auto_detected boolean not null default false,
+
+    foreign key(audiobook_id) references Audiobook(id) on delete cascade
+);
+
+Insert Into ChapterRebuilt (id, audiobook_id, numbering, title, start_time, end_time, file_path, auto_detected)
+Select id, audiobook_id, numbering, title, start_time, end_time, file_path, auto_detected From Chapter
+Where audiobook_id In (Select id From Audiobook);
+
+Drop Table Chapter;
+Alter Table ChapterRebuilt Rename To Chapter;
+
+Create Trigger ChapterSearchInsert After Insert On Chapter Begin
+    Update AudiobookSearch
+    Set chapters = Coalesce((Select group_concat(c.title, ' ') From Chapter c Where c.audiobook_id = new.audiobook_id), '')
+    Where rowid = new.audiobook_id;
+End;
+
+Create Trigger ChapterSearchUpdate After Update Of title, audiobook_id On Chapter Begin
+    Update AudiobookSearch
+    Set chapters = Coalesce((Select group_concat(c.title, ' ') From Chapter c Where c.audiobook_id = old.audiobook_id), '')
+    Where rowid = old.audiobook_id;
+    Update AudiobookSearch
+    Set chapters = Coalesce((Select group_concat(c.title, ' ') From Chapter c Where c.audiobook_id = new.audiobook_id), '')
+    Where rowid = new.audiobook_id;
+End;
+
+Create Trigger ChapterSearchDelete After Delete On Chapter Begin
+    Update AudiobookSearch
+    Set chapters = Coalesce((Select group_concat(c.title, ' ') From Chapter c Where c.audiobook_id = old.audiobook_id), '')
+    Where rowid = old.audiobook_id;
+End;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+Create Table ChapterRebuilt (
+    id integer primary key not null,
+    audiobook_id int not null,
+    numbering int not null,
+    title text not null,
+    start_time float not null,
+    end_time float not null,
+    file_path text not null,
+    auto_detected boolean not null default false,
+
+    foreign key(audiobook_id) references Audiobooks(id)
+);
+
+Insert Into ChapterRebuilt (id, audiobook_id, numbering, title, start_time, end_time, file_path, auto_detected)
+Select id, audiobook_id, numbering, title, start_time, end_time, file_path, auto_detected From Chapter;
+
+Drop Table Chapter;
+Alter Table ChapterRebuilt Rename To Chapter;
+
+Create Trigger ChapterSearchInsert After Insert On Chapter Begin
+    Update AudiobookSearch
+    Set chapters = Coalesce((Select group_concat(c.title, ' ') From Chapter c Where c.audiobook_id = new.audiobook_id), '')
+    Where rowid = new.audiobook_id;
+End;
+
+Create Trigger ChapterSearchUpdate After Update Of title, audiobook_id On Chapter Begin
+    Update AudiobookSearch
+    Set chapters = Coalesce((Select group_concat(c.title, ' ') From Chapter c Where c.audiobook_id = old.audiobook_id), '')
+    Where rowid = old.audiobook_id;
+    Update AudiobookSearch
+    Set chapters = Coalesce((Select group_concat(c.title, ' ') From Chapter c Where c.audiobook_id = new.audiobook_id), '')
+    Where rowid = new.audiobook_id;
+End;
+
+Create Trigger ChapterSearchDelete After Delete On Chapter Begin
+    Update AudiobookSearch
+    Set chapters = Coalesce((Select group_concat(c.title, ' ') From Chapter c Where c.audiobook_id = old.audiobook_id), '')
+    Where rowid = old.audiobook_id;
+End;
+-- +goose StatementEnd
@@ -1,9 +1,9 @@
 
 -- name: InsertAudiobook :execresult
-Insert Into Audiobook (title, author, narrator, description, duration, dir_path, chapter_count, genre) Values (?, ?, ?, ?, ?, ?, ?, ?);
+Insert Into Audiobook (title, author, narrator, description, duration, relative_path, chapter_count, genre) Values (?, ?, ?, ?, ?, ?, ?, ?);
 
 -- name: InsertChapter :exec
-Insert Into Chapter (audiobook_id, title, numbering, start_time, end_time, file_path) Values (?, ?, ?, ?, ?, ?);
+Insert Into Chapter (audiobook_id, title, numbering, start_time, end_time, file_path, auto_detected) Values (?, ?, ?, ?, ?, ?, ?);
 
 -- name: GetAllAudiobooks :many
 Select *
@@ -15,8 +15,404 @@ From Chapter c
 Where c.audiobook_id = ?
 Order By numbering Asc;
 
--- name: GetAudiobookById :many
-Select sqlc.embed(a), sqlc.embed(c)
+-- name: GetAudiobooks :many
+Select *
+From Audiobook a
+Order By a.title Asc, a.id Asc
+Limit ? Offset ?;
+
+-- name: CountAudiobooks :one
+Select Count(*)
+From Audiobook a;
+
+-- name: GetAudiobook :one
+Select *
+From Audiobook a
+Where a.id = ?;
+
+-- name: GetAudiobookChapter :one
+Select *
+From Chapter c
+Where c.audiobook_id = ? And c.numbering = ?;
+
+-- name: InsertUser :execresult
+Insert Into User (username, password_hash, is_admin, created_at) Values (?, ?, ?, ?);
+
+-- name: GetUserById :one
+Select *
+From User u
+Where u.id = ?;
+
+-- name: GetUserByUsername :one
+Select *
+From User u
+Where u.username = ?;
+
+-- name: CountUsers :one
+Select Count(*)
+From User u;
+
+-- name: InsertSession :exec
+Insert Into Session (id, user_id, created_at, expires_at) Values (?, ?, ?, ?);
+
+-- name: GetSession :one
+Select *
+From Session s
+Where s.id = ?;
+
+-- name: DeleteSession :exec
+Delete From Session
+Where id = ?;
+
+-- name: DeleteExpiredSessions :exec
+Delete From Session
+Where expires_at <= ?;
+
+-- name: UpsertPlaybackProgress :execrows
+Insert Into PlaybackProgress (user_id, audiobook_id, chapter_numbering, offset_seconds, finished, updated_at)
+Values (?, ?, ?, ?, ?, ?)
+On Conflict (user_id, audiobook_id) Do Update Set
+    chapter_numbering = excluded.chapter_numbering,
+    offset_seconds = excluded.offset_seconds,
+    finished = excluded.finished,
+    updated_at = excluded.updated_at
+Where excluded.updated_at > PlaybackProgress.updated_at;
+
+-- name: GetPlaybackProgress :one
+Select *
+From PlaybackProgress p
+Where p.user_id = ? And p.audiobook_id = ?;
+
+-- name: GetUserPlaybackProgress :many
+Select *
+From PlaybackProgress p
+Where p.user_id = ?
+Order By p.updated_at Desc;
+
+-- name: InsertBookmark :execresult
+Insert Into Bookmark (user_id, audiobook_id, chapter_numbering, offset_seconds, name, note, created_at, updated_at) Values (?, ?, ?, ?, ?, ?, ?, ?);
+
+-- name: GetBookmark :one
+Select *
+From Bookmark b
+Where b.id = ? And b.user_id = ?;
+
+-- name: GetBookmarks :many
+Select *
+From Bookmark b
+Where b.user_id = ? And b.audiobook_id = ?
+Order By b.chapter_numbering Asc, b.offset_seconds Asc;
+
+-- name: UpdateBookmark :execrows
+Update Bookmark
+Set chapter_numbering = ?, offset_seconds = ?, name = ?, note = ?, updated_at = ?
+Where id = ? And user_id = ?;
+
+-- name: DeleteBookmark :execrows
+Delete From Bookmark
+Where id = ? And user_id = ?;
+
+-- name: SearchAudiobooks :many
+Select sqlc.embed(a), snippet(AudiobookSearch, -1, char(2), char(3), '…', 16) As snippet, bm25(AudiobookSearch, 10.0, 5.0, 3.0, 1.0, 2.0, 2.0) As rank
+From AudiobookSearch
+Join Audiobook a On a.id = AudiobookSearch.rowid
+Where AudiobookSearch Match ?
+Order By rank, a.id
+Limit ? Offset ?;
+
+-- name: CountSearchAudiobooks :one
+Select Count(*) From AudiobookSearch
+Where AudiobookSearch Match ?;
+
+-- name: UpsertPerson :one
+Insert Into Person (name) Values (?)
+On Conflict (name) Do Update Set name = Person.name
+Returning id;
+
+-- name: UpsertSeries :one
+Insert Into Series (name) Values (?)
+On Conflict (name) Do Update Set name = Series.name
+Returning id;
+
+-- name: UpsertGenre :one
+Insert Into Genre (name) Values (?)
+On Conflict (name) Do Update Set name = Genre.name
+Returning id;
+
+-- name: InsertAudiobookAuthor :exec
+Insert Or Ignore Into AudiobookAuthor (audiobook_id, person_id, position) Values (?, ?, ?);
+
+-- name: InsertAudiobookNarrator :exec
+Insert Or Ignore Into AudiobookNarrator (audiobook_id, person_id, position) Values (?, ?, ?);
+
+-- name: InsertAudiobookGenre :exec
+Insert Or Ignore Into AudiobookGenre (audiobook_id, genre_id) Values (?, ?);
+
+-- name: InsertAudiobookSeries :exec
+Insert Or Ignore Into AudiobookSeries (audiobook_id, series_id, position) Values (?, ?, ?);
+
+-- name: GetAudiobookAuthors :many
+Select p.name
+From Person p
+Join AudiobookAuthor aa On aa.person_id = p.id
+Where aa.audiobook_id = ?
+Order By aa.position Asc;
+
+-- name: GetAudiobookNarrators :many
+Select p.name
+From Person p
+Join AudiobookNarrator an On an.person_id = p.id
+Where an.audiobook_id = ?
+Order By an.position Asc;
+
+-- name: GetAudiobookGenres :many
+Select g.name
+From Genre g
+Join AudiobookGenre ag On ag.genre_id = g.id
+Where ag.audiobook_id = ?
+Order By g.name Asc;
+
+-- name: GetAudiobookSeries :many
+Select s.name, aseries.position
+From Series s
+Join AudiobookSeries aseries On aseries.series_id = s.id
+Where aseries.audiobook_id = ?
+Order By s.name Asc;
+
+-- name: GetAuthors :many
+Select p.id, p.name, Count(aa.audiobook_id) As audiobook_count
+From Person p
+Join AudiobookAuthor aa On aa.person_id = p.id
+Group By p.id, p.name
+Order By p.name Asc;
+
+-- name: GetNarrators :many
+Select p.id, p.name, Count(an.audiobook_id) As audiobook_count
+From Person p
+Join AudiobookNarrator an On an.person_id = p.id
+Group By p.id, p.name
+Order By p.name Asc;
+
+-- name: GetSeries :many
+Select s.id, s.name, Count(aseries.audiobook_id) As audiobook_count
+From Series s
+Join AudiobookSeries aseries On aseries.series_id = s.id
+Group By s.id, s.name
+Order By s.name Asc;
+
+-- name: GetAudiobooksByAuthor :many
+Select a.*
+From Audiobook a
+Join AudiobookAuthor aa On aa.audiobook_id = a.id
+Where aa.person_id = ?
+Order By a.title Asc;
+
+-- name: GetAudiobooksByNarrator :many
+Select a.*
+From Audiobook a
+Join AudiobookNarrator an On an.audiobook_id = a.id
+Where an.person_id = ?
+Order By a.title Asc;
+
+-- name: GetAudiobooksBySeries :many
+Select a.*
+From Audiobook a
+Join AudiobookSeries aseries On aseries.audiobook_id = a.id
+Where aseries.series_id = ?
+Order By Cast(aseries.position As Real) Asc, a.title Asc;
+
+-- name: InsertAudiobookImage :exec
+Insert Or Replace Into AudiobookImage (audiobook_id, kind, file_path, content_type, width, height) Values (?, ?, ?, ?, ?, ?);
+
+-- name: GetAudiobookImage :one
+Select * From AudiobookImage Where audiobook_id = ? And kind = ?;
+
+-- name: GetAudiobookImages :many
+Select * From AudiobookImage Where audiobook_id = ? Order By width Asc;
+
+-- name: InsertAudiobookLoudness :exec
+Insert Or Replace Into AudiobookLoudness (audiobook_id, integrated_lufs, true_peak, gain, normalized) Values (?, ?, ?, ?, ?);
+
+-- name: GetAudiobookLoudness :one
+Select * From AudiobookLoudness Where audiobook_id = ?;
+
+-- name: GetSourceFilesBySource :many
+Select * From SourceFile Where source_path = ? Order By path;
+
+-- name: GetSourceFilesByAudiobook :many
+Select * From SourceFile Where audiobook_id = ? Order By path;
+
+-- name: UpsertSourceFile :exec
+Insert Into SourceFile (path, source_path, size, mod_time, hash, status, last_error, updated_at)
+Values (?, ?, ?, ?, ?, ?, '', ?)
+On Conflict (path) Do Update Set
+    source_path = excluded.source_path,
+    size = excluded.size,
+    mod_time = excluded.mod_time,
+    hash = excluded.hash,
+    status = excluded.status,
+    last_error = '',
+    attempts = Case When hash = excluded.hash Then attempts Else 0 End,
+    failed_stage = Case When hash = excluded.hash Then failed_stage Else '' End,
+    retry_at = Null,
+    updated_at = excluded.updated_at;
+
+-- name: DeleteSourceFile :exec
+Delete From SourceFile Where path = ?;
+
+-- name: UpdateSourceStatus :execrows
+Update SourceFile Set status = ?, last_error = ?, updated_at = ? Where source_path = ?;
+
+-- name: SetSourceAudiobook :execrows
+Update SourceFile Set status = ?, audiobook_id = ?, last_error = '', attempts = 0, failed_stage = '', retry_at = Null, updated_at = ? Where source_path = ?;
+
+-- name: UpdateSourceFileStat :exec
+Update SourceFile Set size = ?, mod_time = ? Where path = ?;
+
+-- name: GetAllSourceFiles :many
+Select * From SourceFile Order By source_path, path;
+
+-- name: DeleteSourceFilesBySource :exec
+Delete From SourceFile Where source_path = ?;
+
+-- name: DeleteAudiobookSourceFiles :exec
+Delete From SourceFile Where audiobook_id = ?;
+
+-- name: SetAudiobookMissing :exec
+Update Audiobook Set missing_since = ? Where id = ? And missing_since Is Null;
+
+-- name: UpdateAudiobookRelativePath :exec
+Update Audiobook Set relative_path = ?, missing_since = Null Where id = ?;
+
+-- name: GetAudiobooksWithAbsolutePath :many
+Select *
+From Audiobook a
+Where a.relative_path Like '/%'
+Order By a.id Asc;
+
+-- name: GetMissingAudiobooks :many
+Select *
 From Audiobook a
-Join Chapter c On a.id = c.audiobook_id
-Where a.id = ?
\ No newline at end of file
+Where a.missing_since <= ?
+Order By a.missing_since Asc;
+
+-- name: DeleteAudiobook :exec
+Delete From Audiobook Where id = ?;
+
+-- name: DeleteAudiobookChapters :exec
+Delete From Chapter Where audiobook_id = ?;
+
+-- name: DeleteAudiobookAuthors :exec
+Delete From AudiobookAuthor Where audiobook_id = ?;
+
+-- name: DeleteAudiobookNarrators :exec
+Delete From AudiobookNarrator Where audiobook_id = ?;
+
+-- name: DeleteAudiobookGenres :exec
+Delete From AudiobookGenre Where audiobook_id = ?;
+
+-- name: DeleteAudiobookSeries :exec
+Delete From AudiobookSeries Where audiobook_id = ?;
+
+-- name: DeleteAudiobookImages :exec
+Delete From AudiobookImage Where audiobook_id = ?;
+
+-- name: DeleteAudiobookLoudness :exec
+Delete From AudiobookLoudness Where audiobook_id = ?;
+
+-- name: GetAudiobookByRelativePath :one
+Select *
+From Audiobook a
+Where a.relative_path = ?
+Order By a.id Asc
+Limit 1;
+
+-- name: UpdateAudiobook :exec
+Update Audiobook
+Set title = ?, author = ?, narrator = ?, description = ?, duration = ?, chapter_count = ?, genre = ?, missing_since = Null
+Where id = ?;
+
+-- name: RecordSourceFailure :execrows
+Update SourceFile
+Set status = ?, last_error = ?, failed_stage = ?, attempts = ?, retry_at = ?, updated_at = ?
+Where source_path = ?;
+
+-- name: GetNextSourceRetry :one
+Select retry_at
+From SourceFile
+Where status = ? And retry_at > ?
+Order By retry_at Asc
+Limit 1;
+
+-- name: GetJobs :many
+Select * From Job Order By updated_at Desc, id Desc;
+
+-- name: GetJob :one
+Select * From Job Where id = ?;
+
+-- name: GetJobBySource :one
+Select * From Job Where source_path = ?;
+
+-- name: QueueJob :exec
+Insert Into Job (source_path, content_key, stage, state, results, error, created_at, updated_at)
+Values (?, ?, ?, ?, '', '', ?, ?)
+On Conflict (source_path) Do Update Set
+    stage = Case When content_key = excluded.content_key And state != 'done' Then stage Else excluded.stage End,
+    results = Case When content_key = excluded.content_key And state != 'done' Then results Else '' End,
+    content_key = excluded.content_key,
+    state = excluded.state,
+    error = '',
+    updated_at = excluded.updated_at;
+
+-- name: RestartJob :exec
+Insert Into Job (source_path, content_key, stage, state, results, error, created_at, updated_at)
+Values (?, ?, ?, ?, '', '', ?, ?)
+On Conflict (source_path) Do Update Set
+    stage = excluded.stage,
+    results = '',
+    content_key = excluded.content_key,
+    state = excluded.state,
+    error = '',
+    updated_at = excluded.updated_at;
+
+-- name: AdvanceJob :execrows
+Update Job Set stage = ?, state = ?, results = ?, updated_at = ? Where source_path = ? And state = ?;
+
+-- name: FailJob :execrows
+Update Job Set state = ?, error = ?, updated_at = ? Where source_path = ? And state = ?;
+
+-- name: UpdateJobState :exec
+Update Job Set state = ?, error = '', updated_at = ? Where id = ?;
+
+-- name: DeleteJobBySource :exec
+Delete From Job Where source_path = ?;
+
+-- name: DeleteAudiobookJobs :exec
+Delete From Job Where source_path In (Select source_path From SourceFile Where audiobook_id = ?);
+
+-- name: ResetSourceFailures :exec
+Update SourceFile Set status = ?, last_error = '', attempts = 0, retry_at = Null, updated_at = ? Where source_path = ?;
+
+-- name: GetAudiobookOverride :one
+Select * From AudiobookOverride Where audiobook_id = ?;
+
+-- name: UpsertAudiobookOverride :exec
+Insert Or Replace Into AudiobookOverride (audiobook_id, title, authors, narrators, description, genres, series, series_position) Values (?, ?, ?, ?, ?, ?, ?, ?);
+
+-- name: DeleteAudiobookOverride :exec
+Delete From AudiobookOverride Where audiobook_id = ?;
+
+-- name: GetChapterOverrides :many
+Select * From ChapterOverride Where audiobook_id = ? Order By numbering Asc;
+
+-- name: UpsertChapterOverride :exec
+Insert Or Replace Into ChapterOverride (audiobook_id, numbering, title, end_time) Values (?, ?, ?, ?);
+
+-- name: DeleteChapterOverrides :exec
+Delete From ChapterOverride Where audiobook_id = ?;
+
+-- name: UpdateAudiobookDetails :exec
+Update Audiobook Set title = ?, author = ?, narrator = ?, description = ?, genre = ? Where id = ?;
+
+-- name: UpdateChapterTitle :exec
+Update Chapter Set title = ? Where audiobook_id = ? And numbering = ?;
@@ -1,29 +1,143 @@
 package api
 
 import (
+	"context"
 	"net/http"
 
 	"github.com/bongofriend/bookplayer/backend/lib/api/middleware"
+	"github.com/bongofriend/bookplayer/backend/lib/auth"
 	"github.com/bongofriend/bookplayer/backend/lib/config"
+	"github.com/bongofriend/bookplayer/backend/lib/data/repo"
+	"github.com/bongofriend/bookplayer/backend/lib/events"
+	"github.com/bongofriend/bookplayer/backend/lib/models"
 )
 
-/*
-Custom http.ServeMux with additional methods
-TODO: Add additional methods for authentication and routes requiring a authenticated request
-*/
+// Custom http.ServeMux with additional methods for routes requiring an authenticated request
 type ServiceMux struct {
 	http.ServeMux
 }
 
+// Dependencies of the API handlers
+type Services struct {
+	AudiobookRepo  repo.AudiobookRepository
+	ProgressRepo   repo.ProgressRepository
+	BookmarkRepo   repo.BookmarkRepository
+	CatalogRepo    repo.CatalogRepository
+	SourceFileRepo repo.SourceFileRepository
+	JobRepo        repo.JobRepository
+	OverrideRepo   repo.OverrideRepository
+	EventBus       *events.Bus
+	Auth           *auth.Service
+	Commands       PipelineCommands
+}
+
+// Commands to the processing pipeline; implemented by processing.Pipeline
+type PipelineCommands interface {
+	// Send a command of one of the models.Command* types, limited to sourcePath unless empty
+	DispatchCommand(context context.Context, commandType string, sourcePath string) (*models.Command, error)
+	// Recently dispatched command; ErrNotFound once forgotten
+	GetCommand(id int64) (*models.Command, error)
+}
+
 func newServiceMux() *ServiceMux {
 	return &ServiceMux{
 		ServeMux: *http.NewServeMux(),
 	}
 }
 
-func GetApiHandler(c config.Config) http.Handler {
-	middlewareStack := middleware.CreateMiddlewareStack(middleware.Logging(c))
+// Register handler for requests with a user attached by middleware.Authentication; others are rejected
+func (m *ServiceMux) HandleAuthenticated(pattern string, handler http.HandlerFunc) {
+	m.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := middleware.UserFromContext(r.Context()); !ok {
+			writeError(w, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
+			return
+		}
+		handler(w, r)
+	})
+}
+
+// Register handler for requests by an authenticated admin
+func (m *ServiceMux) HandleAdmin(pattern string, handler http.HandlerFunc) {
+	m.HandleAuthenticated(pattern, func(w http.ResponseWriter, r *http.Request) {
+		if user, _ := middleware.UserFromContext(r.Context()); !user.IsAdmin {
+			writeError(w, http.StatusForbidden, http.StatusText(http.StatusForbidden))
+			return
+		}
+		handler(w, r)
+	})
+}
+
+func GetApiHandler(c config.Config, services Services) http.Handler {
+	middlewareStack := middleware.CreateMiddlewareStack(
+		middleware.Logging(c),
+		middleware.Authentication(services.Auth),
+	)
 	mux := newServiceMux()
 
+	authentication := newAuthHandler(services.Auth)
+	mux.HandleFunc("POST /auth/login", authentication.login)
+	mux.HandleAuthenticated("POST /auth/logout", authentication.logout)
+	mux.HandleAuthenticated("GET /users/me", authentication.currentUser)
+	mux.HandleFunc("POST /users", authentication.createUser)
+
+	audiobooks := newAudiobookHandler(services.AudiobookRepo)
+	mux.HandleAuthenticated("GET /audiobooks", audiobooks.listAudiobooks)
+	mux.HandleAuthenticated("GET /audiobooks/{id}", audiobooks.getAudiobook)
+	mux.HandleAuthenticated("GET /audiobooks/{id}/chapters/{numbering}", audiobooks.getChapter)
+	mux.HandleAuthenticated("GET /search", audiobooks.searchAudiobooks)
+
+	sources := newSourceHandler(services.AudiobookRepo, services.SourceFileRepo)
+	mux.HandleAuthenticated("GET /audiobooks/{id}/sources", sources.listSourceFiles)
+
+	jobs := newJobHandler(services.JobRepo, services.Commands)
+	mux.HandleAdmin("GET /jobs", jobs.listJobs)
+	mux.HandleAdmin("GET /jobs/{id}", jobs.getJob)
+	mux.HandleAdmin("POST /jobs/{id}/retry", jobs.retryJob)
+	mux.HandleAdmin("POST /jobs/{id}/cancel", jobs.cancelJob)
+
+	processingEvents := newEventHandler(services.EventBus)
+	mux.HandleAuthenticated("GET /events", processingEvents.listEvents)
+	mux.HandleAuthenticated("GET /events/stream", processingEvents.streamEvents)
+
+	pipeline := newPipelineHandler(services.Commands, services.AudiobookRepo, services.SourceFileRepo)
+	mux.HandleAdmin("POST /pipeline/scan", pipeline.dispatch(models.CommandScan))
+	mux.HandleAdmin("POST /pipeline/rescan", pipeline.dispatch(models.CommandRescan))
+	mux.HandleAdmin("POST /pipeline/rehash", pipeline.dispatch(models.CommandRehash))
+	mux.HandleAdmin("POST /pipeline/pause", pipeline.dispatch(models.CommandPause))
+	mux.HandleAdmin("POST /pipeline/resume", pipeline.dispatch(models.CommandResume))
+	mux.HandleAdmin("GET /pipeline/commands/{id}", pipeline.getCommand)
+	mux.HandleAdmin("POST /audiobooks/{id}/reprocess", pipeline.dispatchForAudiobook(models.CommandReprocess))
+	mux.HandleAdmin("POST /audiobooks/{id}/rehash", pipeline.dispatchForAudiobook(models.CommandRehash))
+
+	overrides := newOverrideHandler(c, services.AudiobookRepo, services.OverrideRepo, services.SourceFileRepo, services.Commands)
+	mux.HandleAdmin("PATCH /audiobooks/{id}", overrides.patchAudiobook)
+	mux.HandleAdmin("PATCH /audiobooks/{id}/chapters/{numbering}", overrides.patchChapter)
+	mux.HandleAdmin("GET /audiobooks/{id}/overrides", overrides.getOverrides)
+	mux.HandleAdmin("DELETE /audiobooks/{id}/overrides", overrides.deleteOverrides)
+	mux.HandleAdmin("POST /audiobooks/{id}/write-back", overrides.writeBack)
+
+	catalog := newCatalogHandler(services.CatalogRepo)
+	mux.HandleAuthenticated("GET /authors", catalog.listAuthors)
+	mux.HandleAuthenticated("GET /authors/{id}/audiobooks", catalog.listAuthorAudiobooks)
+	mux.HandleAuthenticated("GET /narrators", catalog.listNarrators)
+	mux.HandleAuthenticated("GET /narrators/{id}/audiobooks", catalog.listNarratorAudiobooks)
+	mux.HandleAuthenticated("GET /series", catalog.listSeries)
+	mux.HandleAuthenticated("GET /series/{id}/audiobooks", catalog.listSeriesAudiobooks)
+
+	progress := newProgressHandler(services.AudiobookRepo, services.ProgressRepo)
+	mux.HandleAuthenticated("GET /progress", progress.listProgress)
+	mux.HandleAuthenticated("GET /audiobooks/{id}/progress", progress.getProgress)
+	mux.HandleAuthenticated("PUT /audiobooks/{id}/progress", progress.putProgress)
+
+	bookmarks := newBookmarkHandler(services.AudiobookRepo, services.BookmarkRepo)
+	mux.HandleAuthenticated("GET /audiobooks/{id}/bookmarks", bookmarks.listBookmarks)
+	mux.HandleAuthenticated("POST /audiobooks/{id}/bookmarks", bookmarks.createBookmark)
+	mux.HandleAuthenticated("PUT /bookmarks/{bookmarkId}", bookmarks.updateBookmark)
+	mux.HandleAuthenticated("DELETE /bookmarks/{bookmarkId}", bookmarks.deleteBookmark)
+
+	stream := newStreamHandler(c, services.AudiobookRepo)
+	mux.HandleAuthenticated("GET /audiobooks/{id}/chapters/{numbering}/stream", stream.streamChapter)
+	mux.HandleAuthenticated("GET /audiobooks/{id}/cover", stream.getCover)
+
 	return middlewareStack(mux)
 }
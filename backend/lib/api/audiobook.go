@@ -0,0 +1,145 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/bongofriend/bookplayer/backend/lib/data/repo"
+	"github.com/bongofriend/bookplayer/backend/lib/models"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 200
+)
+
+type audiobookHandler struct {
+	audiobookRepo repo.AudiobookRepository
+}
+
+type audiobookResponse struct {
+	Id int64 `json:"Id"`
+	models.AudiobookCommon
+	ChapterCount int               `json:"ChapterCount"`
+	Chapters     []chapterResponse `json:"Chapters,omitempty"`
+	// Available cover sizes; fetched from /audiobooks/{id}/cover
+	Images []models.AudiobookImage `json:"Images,omitempty"`
+	// Gain for players to apply so audiobooks play at a similar volume; missing unless measured
+	Loudness *models.Loudness `json:"Loudness,omitempty"`
+	// Set while the source file is gone from the library; the audiobook is removed after a grace period
+	MissingSince *time.Time `json:"MissingSince,omitempty"`
+}
+
+type chapterResponse struct {
+	Id          int64 `json:"Id"`
+	AudiobookId int64 `json:"AudiobookId"`
+	models.ChapterCommon
+}
+
+type audiobookPageResponse struct {
+	Items  []audiobookResponse `json:"Items"`
+	Total  int64               `json:"Total"`
+	Limit  int64               `json:"Limit"`
+	Offset int64               `json:"Offset"`
+}
+
+func newAudiobookHandler(audiobookRepo repo.AudiobookRepository) audiobookHandler {
+	return audiobookHandler{
+		audiobookRepo: audiobookRepo,
+	}
+}
+
+func asAudiobookResponse(a models.AudiobookProcessed) audiobookResponse {
+	chapters := make([]chapterResponse, len(a.ProcessedChapters))
+	for idx, ch := range a.ProcessedChapters {
+		chapters[idx] = asChapterResponse(a.Id, ch)
+	}
+	return audiobookResponse{
+		Id:              a.Id,
+		AudiobookCommon: a.AudiobookCommon,
+		ChapterCount:    len(a.ProcessedChapters),
+		Chapters:        chapters,
+		Images:          a.Images,
+		Loudness:        a.Loudness,
+		MissingSince:    a.MissingSince,
+	}
+}
+
+func asChapterResponse(audiobookId int64, c models.ProcessedChapter) chapterResponse {
+	return chapterResponse{
+		Id:            c.Id,
+		AudiobookId:   audiobookId,
+		ChapterCommon: c.ChapterCommon,
+	}
+}
+
+// GET /audiobooks?limit=&offset=
+func (h audiobookHandler) listAudiobooks(w http.ResponseWriter, r *http.Request) {
+	limit, err := queryInt64(r, "limit", defaultPageLimit)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	limit = min(max(limit, 1), maxPageLimit)
+	offset, err := queryInt64(r, "offset", 0)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	total, err := h.audiobookRepo.CountAudiobooks(r.Context())
+	if err != nil {
+		writeRepoError(w, err)
+		return
+	}
+	audiobooks, err := h.audiobookRepo.GetAudiobooks(r.Context(), limit, offset)
+	if err != nil {
+		writeRepoError(w, err)
+		return
+	}
+	items := make([]audiobookResponse, len(audiobooks))
+	for idx, a := range audiobooks {
+		items[idx] = asAudiobookResponse(a)
+	}
+	writeJson(w, http.StatusOK, audiobookPageResponse{
+		Items:  items,
+		Total:  total,
+		Limit:  limit,
+		Offset: offset,
+	})
+}
+
+// GET /audiobooks/{id}
+func (h audiobookHandler) getAudiobook(w http.ResponseWriter, r *http.Request) {
+	id, err := pathInt64(r, "id")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	audiobook, err := h.audiobookRepo.GetAudiobookById(r.Context(), id)
+	if err != nil {
+		writeRepoError(w, err)
+		return
+	}
+	writeJson(w, http.StatusOK, asAudiobookResponse(*audiobook))
+}
+
+// GET /audiobooks/{id}/chapters/{numbering}
+func (h audiobookHandler) getChapter(w http.ResponseWriter, r *http.Request) {
+	id, err := pathInt64(r, "id")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	numbering, err := pathInt64(r, "numbering")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	chapter, err := h.audiobookRepo.GetAudiobookChapter(r.Context(), id, int(numbering))
+	if err != nil {
+		writeRepoError(w, err)
+		return
+	}
+	writeJson(w, http.StatusOK, asChapterResponse(id, *chapter))
+}
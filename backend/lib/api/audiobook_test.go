@@ -0,0 +1,191 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/bongofriend/bookplayer/backend/lib/api"
+	"github.com/bongofriend/bookplayer/backend/lib/auth"
+	"github.com/bongofriend/bookplayer/backend/lib/config"
+	"github.com/bongofriend/bookplayer/backend/lib/data/repo"
+	"github.com/bongofriend/bookplayer/backend/lib/events"
+	"github.com/bongofriend/bookplayer/backend/lib/models"
+)
+
+type testApi struct {
+	handler        http.Handler
+	audiobookRepo  repo.AudiobookRepository
+	sourceFileRepo repo.SourceFileRepository
+	jobRepo        repo.JobRepository
+	overrideRepo   repo.OverrideRepository
+	eventBus       *events.Bus
+	commands       *commandMock
+	authService    *auth.Service
+	token          string
+}
+
+// Set up API backed by a fresh database and log in as admin
+func prepareApi(t *testing.T, testConfig config.Config) testApi {
+	dbConfig := config.DatabaseConfig{
+		Path:   path.Join(t.TempDir(), "test.db"),
+		Driver: "sqlite3",
+	}
+	if err := repo.ApplyDatabaseMigrations(dbConfig); err != nil {
+		t.Fatal(err)
+	}
+	client, err := repo.NewDbClient(dbConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	testConfig.Auth.SessionSecret = "test-secret"
+	testConfig.Auth.SessionLifetime = time.Hour
+	authService, err := auth.NewService(testConfig, repo.NewUserRepository(client))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := authService.CreateUser(context.Background(), "admin", "password123", true); err != nil {
+		t.Fatal(err)
+	}
+	login, err := authService.Login(context.Background(), "admin", "password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	commands := &commandMock{}
+	services := api.Services{
+		AudiobookRepo:  repo.NewAudiobookRepository(client),
+		ProgressRepo:   repo.NewProgressRepository(client),
+		BookmarkRepo:   repo.NewBookmarkRepository(client),
+		CatalogRepo:    repo.NewCatalogRepository(client),
+		SourceFileRepo: repo.NewSourceFileRepository(client),
+		JobRepo:        repo.NewJobRepository(client),
+		OverrideRepo:   repo.NewOverrideRepository(client),
+		EventBus:       events.NewBus(10),
+		Auth:           authService,
+		Commands:       commands,
+	}
+	return testApi{
+		handler:        api.GetApiHandler(testConfig, services),
+		audiobookRepo:  services.AudiobookRepo,
+		sourceFileRepo: services.SourceFileRepo,
+		jobRepo:        services.JobRepo,
+		overrideRepo:   services.OverrideRepo,
+		eventBus:       services.EventBus,
+		commands:       commands,
+		authService:    authService,
+		token:          login.Token,
+	}
+}
+
+func (a testApi) serve(req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	a.handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func (a testApi) authorizedRequest(method string, target string, body io.Reader) *http.Request {
+	req := httptest.NewRequest(method, target, body)
+	req.Header.Set("Authorization", "Bearer "+a.token)
+	return req
+}
+
+func insertTestAudiobook(t *testing.T, audiobookRepo repo.AudiobookRepository, title string) int64 {
+	audiobook := models.AudiobookProcessed{
+		AudiobookCommon: models.AudiobookCommon{
+			Title:    title,
+			Author:   "Sun Tzu",
+			Duration: 30,
+		},
+		FilePath: "/audiobooks/test.m4b",
+		ProcessedChapters: []models.ProcessedChapter{
+			{ChapterCommon: models.ChapterCommon{Title: "Opening Credits", StartTime: 0, EndTime: 10, Numbering: 0}, FilePath: "/processed/0.m4b"},
+			{ChapterCommon: models.ChapterCommon{Title: "Laying Plans", StartTime: 10, EndTime: 30, Numbering: 1}, FilePath: "/processed/1.m4b"},
+		},
+	}
+	id, err := audiobookRepo.InsertAudiobook(context.Background(), audiobook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestAudiobookApi(t *testing.T) {
+	testApi := prepareApi(t, config.Config{})
+	id := insertTestAudiobook(t, testApi.audiobookRepo, "The Art of War")
+	insertTestAudiobook(t, testApi.audiobookRepo, "On War")
+
+	t.Run("should list audiobooks", func(t *testing.T) {
+		rec := testApi.serve(testApi.authorizedRequest(http.MethodGet, "/audiobooks?limit=1", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status %d; received: %d", http.StatusOK, rec.Code)
+		}
+		var page struct {
+			Items []struct{ Title string }
+			Total int64
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&page); err != nil {
+			t.Fatal(err)
+		}
+		if page.Total != 2 || len(page.Items) != 1 || page.Items[0].Title != "On War" {
+			t.Fatalf("Unexpected page: %+v", page)
+		}
+	})
+	t.Run("should fetch audiobook with chapters", func(t *testing.T) {
+		rec := testApi.serve(testApi.authorizedRequest(http.MethodGet, "/audiobooks/1", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status %d; received: %d", http.StatusOK, rec.Code)
+		}
+		var audiobook struct {
+			Id       int64
+			Chapters []struct{ Title string }
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&audiobook); err != nil {
+			t.Fatal(err)
+		}
+		if audiobook.Id != id || len(audiobook.Chapters) != 2 {
+			t.Fatalf("Unexpected audiobook: %+v", audiobook)
+		}
+	})
+	t.Run("should fetch chapter", func(t *testing.T) {
+		rec := testApi.serve(testApi.authorizedRequest(http.MethodGet, "/audiobooks/1/chapters/1", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status %d; received: %d", http.StatusOK, rec.Code)
+		}
+		var chapter struct{ Title string }
+		if err := json.NewDecoder(rec.Body).Decode(&chapter); err != nil {
+			t.Fatal(err)
+		}
+		if chapter.Title != "Laying Plans" {
+			t.Fatalf("Unexpected chapter: %+v", chapter)
+		}
+	})
+	t.Run("should respond with not found", func(t *testing.T) {
+		for _, target := range []string{"/audiobooks/42", "/audiobooks/1/chapters/5"} {
+			rec := testApi.serve(testApi.authorizedRequest(http.MethodGet, target, nil))
+			if rec.Code != http.StatusNotFound {
+				t.Fatalf("%s: expected status %d; received: %d", target, http.StatusNotFound, rec.Code)
+			}
+		}
+	})
+	t.Run("should reject unauthenticated requests", func(t *testing.T) {
+		rec := testApi.serve(httptest.NewRequest(http.MethodGet, "/audiobooks", nil))
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("Expected status %d; received: %d", http.StatusUnauthorized, rec.Code)
+		}
+	})
+	t.Run("should reject invalid parameters", func(t *testing.T) {
+		for _, target := range []string{"/audiobooks/abc", "/audiobooks?offset=-1"} {
+			rec := testApi.serve(testApi.authorizedRequest(http.MethodGet, target, nil))
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("%s: expected status %d; received: %d", target, http.StatusBadRequest, rec.Code)
+			}
+		}
+	})
+}
@@ -0,0 +1,134 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/bongofriend/bookplayer/backend/lib/api/middleware"
+	"github.com/bongofriend/bookplayer/backend/lib/auth"
+	"github.com/bongofriend/bookplayer/backend/lib/data/repo"
+	"github.com/bongofriend/bookplayer/backend/lib/models"
+)
+
+type authHandler struct {
+	authService *auth.Service
+}
+
+type credentialsRequest struct {
+	Username string `json:"Username"`
+	Password string `json:"Password"`
+}
+
+type createUserRequest struct {
+	credentialsRequest
+	IsAdmin bool `json:"IsAdmin"`
+}
+
+type loginResponse struct {
+	Token     string      `json:"Token"`
+	ExpiresAt time.Time   `json:"ExpiresAt"`
+	User      models.User `json:"User"`
+}
+
+func newAuthHandler(authService *auth.Service) authHandler {
+	return authHandler{
+		authService: authService,
+	}
+}
+
+// POST /auth/login
+func (h authHandler) login(w http.ResponseWriter, r *http.Request) {
+	var credentials credentialsRequest
+	if err := decodeJson(r, &credentials); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	result, err := h.authService.Login(r.Context(), credentials.Username, credentials.Password)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidCredentials) {
+			writeError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		writeRepoError(w, err)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     middleware.SessionCookieName,
+		Value:    result.Token,
+		Path:     "/",
+		Expires:  result.Session.ExpiresAt,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+	writeJson(w, http.StatusOK, loginResponse{
+		Token:     result.Token,
+		ExpiresAt: result.Session.ExpiresAt,
+		User:      result.User,
+	})
+}
+
+// POST /auth/logout
+func (h authHandler) logout(w http.ResponseWriter, r *http.Request) {
+	if err := h.authService.Logout(r.Context(), middleware.TokenFromRequest(r)); err != nil {
+		writeRepoError(w, err)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     middleware.SessionCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GET /users/me
+func (h authHandler) currentUser(w http.ResponseWriter, r *http.Request) {
+	user, _ := middleware.UserFromContext(r.Context())
+	writeJson(w, http.StatusOK, user)
+}
+
+/*
+POST /users
+Open to anyone as long as no user exists; the first user becomes admin.
+Afterwards only admins may create users
+*/
+func (h authHandler) createUser(w http.ResponseWriter, r *http.Request) {
+	needsSetup, err := h.authService.NeedsSetup(r.Context())
+	if err != nil {
+		writeRepoError(w, err)
+		return
+	}
+	if !needsSetup {
+		user, ok := middleware.UserFromContext(r.Context())
+		if !ok {
+			writeError(w, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
+			return
+		}
+		if !user.IsAdmin {
+			writeError(w, http.StatusForbidden, http.StatusText(http.StatusForbidden))
+			return
+		}
+	}
+	var body createUserRequest
+	if err := decodeJson(r, &body); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	user, err := h.authService.CreateUser(r.Context(), body.Username, body.Password, body.IsAdmin || needsSetup)
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrInvalidUser):
+			writeError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, repo.ErrConflict):
+			writeError(w, http.StatusConflict, err.Error())
+		default:
+			writeRepoError(w, err)
+		}
+		return
+	}
+	writeJson(w, http.StatusCreated, user)
+}
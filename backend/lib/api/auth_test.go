@@ -0,0 +1,79 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bongofriend/bookplayer/backend/lib/config"
+)
+
+func TestAuthApi(t *testing.T) {
+	testApi := prepareApi(t, config.Config{})
+
+	t.Run("should log in and out", func(t *testing.T) {
+		rec := testApi.serve(httptest.NewRequest(http.MethodPost, "/auth/login", strings.NewReader(`{"Username":"admin","Password":"password123"}`)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status %d; received: %d", http.StatusOK, rec.Code)
+		}
+		var login struct{ Token string }
+		if err := json.NewDecoder(rec.Body).Decode(&login); err != nil {
+			t.Fatal(err)
+		}
+		if len(rec.Result().Cookies()) == 0 {
+			t.Fatal("No session cookie set")
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/users/me", nil)
+		req.Header.Set("Authorization", "Bearer "+login.Token)
+		if rec := testApi.serve(req); rec.Code != http.StatusOK {
+			t.Fatalf("Expected status %d; received: %d", http.StatusOK, rec.Code)
+		}
+		req = httptest.NewRequest(http.MethodPost, "/auth/logout", nil)
+		req.Header.Set("Authorization", "Bearer "+login.Token)
+		if rec := testApi.serve(req); rec.Code != http.StatusNoContent {
+			t.Fatalf("Expected status %d; received: %d", http.StatusNoContent, rec.Code)
+		}
+		req = httptest.NewRequest(http.MethodGet, "/users/me", nil)
+		req.Header.Set("Authorization", "Bearer "+login.Token)
+		if rec := testApi.serve(req); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("Expected status %d after logout; received: %d", http.StatusUnauthorized, rec.Code)
+		}
+	})
+	t.Run("should reject invalid credentials", func(t *testing.T) {
+		for _, body := range []string{`{"Username":"admin","Password":"wrong-password"}`, `{"Username":"nobody","Password":"password123"}`} {
+			rec := testApi.serve(httptest.NewRequest(http.MethodPost, "/auth/login", strings.NewReader(body)))
+			if rec.Code != http.StatusUnauthorized {
+				t.Fatalf("Expected status %d; received: %d", http.StatusUnauthorized, rec.Code)
+			}
+		}
+	})
+	t.Run("should let admins create users", func(t *testing.T) {
+		body := `{"Username":"listener","Password":"password456"}`
+		rec := testApi.serve(httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(body)))
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("Expected status %d; received: %d", http.StatusUnauthorized, rec.Code)
+		}
+		rec = testApi.serve(testApi.authorizedRequest(http.MethodPost, "/users", strings.NewReader(body)))
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("Expected status %d; received: %d", http.StatusCreated, rec.Code)
+		}
+		rec = testApi.serve(testApi.authorizedRequest(http.MethodPost, "/users", strings.NewReader(body)))
+		if rec.Code != http.StatusConflict {
+			t.Fatalf("Expected status %d; received: %d", http.StatusConflict, rec.Code)
+		}
+
+		rec = testApi.serve(httptest.NewRequest(http.MethodPost, "/auth/login", strings.NewReader(body)))
+		var login struct{ Token string }
+		if err := json.NewDecoder(rec.Body).Decode(&login); err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(`{"Username":"another","Password":"password789"}`))
+		req.Header.Set("Authorization", "Bearer "+login.Token)
+		if rec := testApi.serve(req); rec.Code != http.StatusForbidden {
+			t.Fatalf("Expected status %d; received: %d", http.StatusForbidden, rec.Code)
+		}
+	})
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bongofriend/bookplayer/backend/lib/data/repo"
+	"github.com/bongofriend/bookplayer/backend/lib/models"
+)
+
+type bookmarkHandler struct {
+	audiobookRepo repo.AudiobookRepository
+	bookmarkRepo  repo.BookmarkRepository
+}
+
+type bookmarkRequest struct {
+	ChapterNumbering int     `json:"ChapterNumbering"`
+	Offset           float32 `json:"Offset"`
+	Name             string  `json:"Name"`
+	Note             string  `json:"Note"`
+}
+
+func newBookmarkHandler(audiobookRepo repo.AudiobookRepository, bookmarkRepo repo.BookmarkRepository) bookmarkHandler {
+	return bookmarkHandler{
+		audiobookRepo: audiobookRepo,
+		bookmarkRepo:  bookmarkRepo,
+	}
+}
+
+func (h bookmarkHandler) decodeBookmark(w http.ResponseWriter, r *http.Request, audiobookId int64) (*bookmarkRequest, bool) {
+	var body bookmarkRequest
+	if err := decodeJson(r, &body); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+	body.Name = strings.TrimSpace(body.Name)
+	if len(body.Name) == 0 {
+		writeError(w, http.StatusBadRequest, "bookmark name must not be empty")
+		return nil, false
+	}
+	if err := validateChapterOffset(r, h.audiobookRepo, audiobookId, body.ChapterNumbering, body.Offset); err != nil {
+		writePositionError(w, err)
+		return nil, false
+	}
+	return &body, true
+}
+
+// GET /audiobooks/{id}/bookmarks
+func (h bookmarkHandler) listBookmarks(w http.ResponseWriter, r *http.Request) {
+	id, err := pathInt64(r, "id")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	bookmarks, err := h.bookmarkRepo.GetBookmarks(r.Context(), requestUser(r).Id, id)
+	if err != nil {
+		writeRepoError(w, err)
+		return
+	}
+	writeJson(w, http.StatusOK, bookmarks)
+}
+
+// POST /audiobooks/{id}/bookmarks
+func (h bookmarkHandler) createBookmark(w http.ResponseWriter, r *http.Request) {
+	id, err := pathInt64(r, "id")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	body, ok := h.decodeBookmark(w, r, id)
+	if !ok {
+		return
+	}
+	now := time.Now()
+	bookmark := models.Bookmark{
+		UserId:           requestUser(r).Id,
+		AudiobookId:      id,
+		ChapterNumbering: body.ChapterNumbering,
+		Offset:           body.Offset,
+		Name:             body.Name,
+		Note:             body.Note,
+		CreatedAt:        now,
+		UpdatedAt:        now,
+	}
+	bookmarkId, err := h.bookmarkRepo.InsertBookmark(r.Context(), bookmark)
+	if err != nil {
+		writeRepoError(w, err)
+		return
+	}
+	bookmark.Id = bookmarkId
+	writeJson(w, http.StatusCreated, bookmark)
+}
+
+// PUT /bookmarks/{bookmarkId}
+func (h bookmarkHandler) updateBookmark(w http.ResponseWriter, r *http.Request) {
+	bookmarkId, err := pathInt64(r, "bookmarkId")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	user := requestUser(r)
+	bookmark, err := h.bookmarkRepo.GetBookmark(r.Context(), user.Id, bookmarkId)
+	if err != nil {
+		writeRepoError(w, err)
+		return
+	}
+	body, ok := h.decodeBookmark(w, r, bookmark.AudiobookId)
+	if !ok {
+		return
+	}
+	bookmark.ChapterNumbering = body.ChapterNumbering
+	bookmark.Offset = body.Offset
+	bookmark.Name = body.Name
+	bookmark.Note = body.Note
+	bookmark.UpdatedAt = time.Now()
+	if err := h.bookmarkRepo.UpdateBookmark(r.Context(), *bookmark); err != nil {
+		writeRepoError(w, err)
+		return
+	}
+	writeJson(w, http.StatusOK, bookmark)
+}
+
+// DELETE /bookmarks/{bookmarkId}
+func (h bookmarkHandler) deleteBookmark(w http.ResponseWriter, r *http.Request) {
+	bookmarkId, err := pathInt64(r, "bookmarkId")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := h.bookmarkRepo.DeleteBookmark(r.Context(), requestUser(r).Id, bookmarkId); err != nil {
+		writeRepoError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
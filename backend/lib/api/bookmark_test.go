@@ -0,0 +1,80 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/bongofriend/bookplayer/backend/lib/config"
+)
+
+func TestBookmarkApi(t *testing.T) {
+	testApi := prepareApi(t, config.Config{})
+	id := insertTestAudiobook(t, testApi.audiobookRepo, "The Art of War")
+	target := fmt.Sprintf("/audiobooks/%d/bookmarks", id)
+
+	rec := testApi.serve(testApi.authorizedRequest(http.MethodPost, target, strings.NewReader(`{"ChapterNumbering":1,"Offset":5,"Name":"Laying Plans","Note":"Five factors"}`)))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d; received: %d", http.StatusCreated, rec.Code)
+	}
+	var created struct{ Id int64 }
+	if err := json.NewDecoder(rec.Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+	bookmarkTarget := fmt.Sprintf("/bookmarks/%d", created.Id)
+
+	t.Run("should list bookmarks", func(t *testing.T) {
+		rec := testApi.serve(testApi.authorizedRequest(http.MethodGet, target, nil))
+		var bookmarks []struct{ Name string }
+		if err := json.NewDecoder(rec.Body).Decode(&bookmarks); err != nil {
+			t.Fatal(err)
+		}
+		if len(bookmarks) != 1 || bookmarks[0].Name != "Laying Plans" {
+			t.Fatalf("Unexpected bookmarks %+v", bookmarks)
+		}
+	})
+	t.Run("should validate bookmarks", func(t *testing.T) {
+		for body, status := range map[string]int{
+			`{"ChapterNumbering":1,"Offset":5,"Name":" "}`:   http.StatusBadRequest,
+			`{"ChapterNumbering":1,"Offset":500,"Name":"x"}`: http.StatusBadRequest,
+			`{"ChapterNumbering":9,"Offset":0,"Name":"x"}`:   http.StatusNotFound,
+		} {
+			rec := testApi.serve(testApi.authorizedRequest(http.MethodPost, target, strings.NewReader(body)))
+			if rec.Code != status {
+				t.Fatalf("%s: expected status %d; received: %d", body, status, rec.Code)
+			}
+		}
+	})
+	t.Run("should hide bookmarks of other users", func(t *testing.T) {
+		ctx := context.Background()
+		if _, err := testApi.authService.CreateUser(ctx, "listener", "password456", false); err != nil {
+			t.Fatal(err)
+		}
+		login, err := testApi.authService.Login(ctx, "listener", "password456")
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := testApi.authorizedRequest(http.MethodDelete, bookmarkTarget, nil)
+		req.Header.Set("Authorization", "Bearer "+login.Token)
+		if rec := testApi.serve(req); rec.Code != http.StatusNotFound {
+			t.Fatalf("Expected status %d; received: %d", http.StatusNotFound, rec.Code)
+		}
+	})
+	t.Run("should update and delete bookmark", func(t *testing.T) {
+		rec := testApi.serve(testApi.authorizedRequest(http.MethodPut, bookmarkTarget, strings.NewReader(`{"ChapterNumbering":0,"Offset":2,"Name":"Credits"}`)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status %d; received: %d", http.StatusOK, rec.Code)
+		}
+		rec = testApi.serve(testApi.authorizedRequest(http.MethodDelete, bookmarkTarget, nil))
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("Expected status %d; received: %d", http.StatusNoContent, rec.Code)
+		}
+		rec = testApi.serve(testApi.authorizedRequest(http.MethodDelete, bookmarkTarget, nil))
+		if rec.Code != http.StatusNotFound {
+			t.Fatalf("Expected status %d; received: %d", http.StatusNotFound, rec.Code)
+		}
+	})
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/bongofriend/bookplayer/backend/lib/data/repo"
+	"github.com/bongofriend/bookplayer/backend/lib/models"
+)
+
+type catalogHandler struct {
+	catalogRepo repo.CatalogRepository
+}
+
+func newCatalogHandler(catalogRepo repo.CatalogRepository) catalogHandler {
+	return catalogHandler{
+		catalogRepo: catalogRepo,
+	}
+}
+
+// GET /authors
+func (h catalogHandler) listAuthors(w http.ResponseWriter, r *http.Request) {
+	entries, err := h.catalogRepo.GetAuthors(r.Context())
+	writeCatalogEntries(w, entries, err)
+}
+
+// GET /narrators
+func (h catalogHandler) listNarrators(w http.ResponseWriter, r *http.Request) {
+	entries, err := h.catalogRepo.GetNarrators(r.Context())
+	writeCatalogEntries(w, entries, err)
+}
+
+// GET /series
+func (h catalogHandler) listSeries(w http.ResponseWriter, r *http.Request) {
+	entries, err := h.catalogRepo.GetSeries(r.Context())
+	writeCatalogEntries(w, entries, err)
+}
+
+// GET /authors/{id}/audiobooks
+func (h catalogHandler) listAuthorAudiobooks(w http.ResponseWriter, r *http.Request) {
+	id, err := pathInt64(r, "id")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	audiobooks, err := h.catalogRepo.GetAudiobooksByAuthor(r.Context(), id)
+	writeCatalogAudiobooks(w, audiobooks, err)
+}
+
+// GET /narrators/{id}/audiobooks
+func (h catalogHandler) listNarratorAudiobooks(w http.ResponseWriter, r *http.Request) {
+	id, err := pathInt64(r, "id")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	audiobooks, err := h.catalogRepo.GetAudiobooksByNarrator(r.Context(), id)
+	writeCatalogAudiobooks(w, audiobooks, err)
+}
+
+// GET /series/{id}/audiobooks; ordered by position within the series
+func (h catalogHandler) listSeriesAudiobooks(w http.ResponseWriter, r *http.Request) {
+	id, err := pathInt64(r, "id")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	audiobooks, err := h.catalogRepo.GetAudiobooksBySeries(r.Context(), id)
+	writeCatalogAudiobooks(w, audiobooks, err)
+}
+
+func writeCatalogEntries(w http.ResponseWriter, entries []models.CatalogEntry, err error) {
+	if err != nil {
+		writeRepoError(w, err)
+		return
+	}
+	if entries == nil {
+		entries = []models.CatalogEntry{}
+	}
+	writeJson(w, http.StatusOK, entries)
+}
+
+func writeCatalogAudiobooks(w http.ResponseWriter, audiobooks []models.AudiobookProcessed, err error) {
+	if err != nil {
+		writeRepoError(w, err)
+		return
+	}
+	items := make([]audiobookResponse, len(audiobooks))
+	for idx, a := range audiobooks {
+		items[idx] = asAudiobookResponse(a)
+	}
+	writeJson(w, http.StatusOK, items)
+}
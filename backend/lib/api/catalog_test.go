@@ -0,0 +1,74 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/bongofriend/bookplayer/backend/lib/config"
+	"github.com/bongofriend/bookplayer/backend/lib/models"
+)
+
+func TestCatalogApi(t *testing.T) {
+	testApi := prepareApi(t, config.Config{})
+	for _, position := range []string{"2", "1"} {
+		_, err := testApi.audiobookRepo.InsertAudiobook(context.Background(), models.AudiobookProcessed{
+			AudiobookCommon: models.AudiobookCommon{
+				Title:          "The Expanse " + position,
+				Authors:        []string{"Daniel Abraham", "Ty Franck"},
+				Narrators:      []string{"Jefferson Mays"},
+				Series:         "The Expanse",
+				SeriesPosition: position,
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("should list authors", func(t *testing.T) {
+		rec := testApi.serve(testApi.authorizedRequest(http.MethodGet, "/authors", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status %d; received: %d", http.StatusOK, rec.Code)
+		}
+		var authors []models.CatalogEntry
+		if err := json.NewDecoder(rec.Body).Decode(&authors); err != nil {
+			t.Fatal(err)
+		}
+		if len(authors) != 2 || authors[0].Name != "Daniel Abraham" || authors[0].AudiobookCount != 2 {
+			t.Fatalf("Unexpected authors: %+v", authors)
+		}
+	})
+	t.Run("should list audiobooks of series in order", func(t *testing.T) {
+		rec := testApi.serve(testApi.authorizedRequest(http.MethodGet, "/series", nil))
+		var series []models.CatalogEntry
+		if err := json.NewDecoder(rec.Body).Decode(&series); err != nil {
+			t.Fatal(err)
+		}
+		if len(series) != 1 {
+			t.Fatalf("Expected 1 series; received: %d", len(series))
+		}
+		rec = testApi.serve(testApi.authorizedRequest(http.MethodGet, fmt.Sprintf("/series/%d/audiobooks", series[0].Id), nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status %d; received: %d", http.StatusOK, rec.Code)
+		}
+		var audiobooks []struct {
+			SeriesPosition string
+			Authors        []string
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&audiobooks); err != nil {
+			t.Fatal(err)
+		}
+		if len(audiobooks) != 2 || audiobooks[0].SeriesPosition != "1" || len(audiobooks[0].Authors) != 2 {
+			t.Fatalf("Unexpected audiobooks: %+v", audiobooks)
+		}
+	})
+	t.Run("should return empty list for unknown narrator", func(t *testing.T) {
+		rec := testApi.serve(testApi.authorizedRequest(http.MethodGet, "/narrators/999/audiobooks", nil))
+		if rec.Code != http.StatusOK || rec.Body.String() != "[]\n" {
+			t.Fatalf("Unexpected response %d: %s", rec.Code, rec.Body.String())
+		}
+	})
+}
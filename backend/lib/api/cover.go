@@ -0,0 +1,44 @@
+package api
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/bongofriend/bookplayer/backend/lib/models"
+)
+
+// Covers only change when an audiobook is processed again, which also changes the ETag
+const coverCacheControl = "private, max-age=604800"
+
+var coverSizes = map[string]string{
+	"":       models.ImageKindCover,
+	"full":   models.ImageKindCover,
+	"small":  models.ImageKindSmall,
+	"medium": models.ImageKindMedium,
+}
+
+// GET /audiobooks/{id}/cover?size=small|medium|full
+func (h streamHandler) getCover(w http.ResponseWriter, r *http.Request) {
+	id, err := pathInt64(r, "id")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	kind, ok := coverSizes[r.URL.Query().Get("size")]
+	if !ok {
+		writeError(w, http.StatusBadRequest, "size must be one of small, medium or full")
+		return
+	}
+	image, err := h.audiobookRepo.GetAudiobookImage(r.Context(), id, kind)
+	if err != nil {
+		writeRepoError(w, err)
+		return
+	}
+	if !isWithinDirectory(h.config.ProcessedAudiobookPath, image.FilePath) {
+		log.Printf("Refusing to serve %s outside of %s", image.FilePath, h.config.ProcessedAudiobookPath)
+		writeError(w, http.StatusNotFound, "file not found")
+		return
+	}
+	w.Header().Set("Cache-Control", coverCacheControl)
+	serveFile(w, r, image.FilePath, image.ContentType)
+}
@@ -0,0 +1,84 @@
+package api_test
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bongofriend/bookplayer/backend/lib/config"
+	"github.com/bongofriend/bookplayer/backend/lib/models"
+)
+
+func TestCover(t *testing.T) {
+	testConfig := config.Config{
+		ProcessedAudiobookPath: filepath.Join(t.TempDir(), "processed_audiobook"),
+	}
+	testApi := prepareApi(t, testConfig)
+	coverDir := filepath.Join(testConfig.ProcessedAudiobookPath, "The Art of War")
+	if err := os.MkdirAll(coverDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	coverPath := filepath.Join(coverDir, "cover.png")
+	smallPath := filepath.Join(coverDir, "cover_small.jpg")
+	for _, p := range []string{coverPath, smallPath} {
+		if err := os.WriteFile(p, []byte(filepath.Base(p)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := testApi.audiobookRepo.InsertAudiobook(context.Background(), models.AudiobookProcessed{
+		AudiobookCommon: models.AudiobookCommon{Title: "The Art of War"},
+		Images: []models.AudiobookImage{
+			{Kind: models.ImageKindCover, FilePath: coverPath, ContentType: "image/png", Width: 1000, Height: 1000},
+			{Kind: models.ImageKindSmall, FilePath: smallPath, ContentType: "image/jpeg", Width: 160, Height: 160},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("should serve full cover with cache headers", func(t *testing.T) {
+		rec := testApi.serve(testApi.authorizedRequest(http.MethodGet, "/audiobooks/1/cover", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status %d; received: %d", http.StatusOK, rec.Code)
+		}
+		if contentType := rec.Header().Get("Content-Type"); contentType != "image/png" {
+			t.Fatalf("Unexpected Content-Type %s", contentType)
+		}
+		if rec.Header().Get("Cache-Control") == "" || rec.Header().Get("ETag") == "" {
+			t.Fatal("Missing Cache-Control or ETag header")
+		}
+		if body := rec.Body.String(); body != "cover.png" {
+			t.Fatalf("Unexpected body %q", body)
+		}
+	})
+	t.Run("should serve thumbnail", func(t *testing.T) {
+		rec := testApi.serve(testApi.authorizedRequest(http.MethodGet, "/audiobooks/1/cover?size=small", nil))
+		if rec.Code != http.StatusOK || rec.Body.String() != "cover_small.jpg" {
+			t.Fatalf("Unexpected response %d: %s", rec.Code, rec.Body.String())
+		}
+	})
+	t.Run("should return 404 for missing thumbnail", func(t *testing.T) {
+		rec := testApi.serve(testApi.authorizedRequest(http.MethodGet, "/audiobooks/1/cover?size=medium", nil))
+		if rec.Code != http.StatusNotFound {
+			t.Fatalf("Expected status %d; received: %d", http.StatusNotFound, rec.Code)
+		}
+	})
+	t.Run("should reject unknown size", func(t *testing.T) {
+		rec := testApi.serve(testApi.authorizedRequest(http.MethodGet, "/audiobooks/1/cover?size=huge", nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("Expected status %d; received: %d", http.StatusBadRequest, rec.Code)
+		}
+	})
+	t.Run("should list images of audiobook", func(t *testing.T) {
+		rec := testApi.serve(testApi.authorizedRequest(http.MethodGet, "/audiobooks/1", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status %d; received: %d", http.StatusOK, rec.Code)
+		}
+		if body := rec.Body.String(); !strings.Contains(body, `"Kind":"small"`) || strings.Contains(body, "cover_small.jpg") {
+			t.Fatalf("Unexpected body %s", body)
+		}
+	})
+}
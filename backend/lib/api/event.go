@@ -0,0 +1,104 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bongofriend/bookplayer/backend/lib/events"
+)
+
+// Comment sent on idle streams so proxies do not close them
+const keepAliveInterval = 15 * time.Second
+
+type eventHandler struct {
+	eventBus *events.Bus
+}
+
+func newEventHandler(eventBus *events.Bus) eventHandler {
+	return eventHandler{
+		eventBus: eventBus,
+	}
+}
+
+// GET /events?after=42
+func (h eventHandler) listEvents(w http.ResponseWriter, r *http.Request) {
+	after, err := queryInt64(r, "after", 0)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJson(w, http.StatusOK, h.eventBus.History(after))
+}
+
+/*
+GET /events/stream
+Server-Sent Events of processing progress. Recorded events after the Last-Event-ID header, or the after
+query parameter on the first connection, are sent before new ones so clients do not miss any while reconnecting
+*/
+func (h eventHandler) streamEvents(w http.ResponseWriter, r *http.Request) {
+	after, err := queryInt64(r, "after", -1)
+	if lastEventId := r.Header.Get("Last-Event-ID"); len(lastEventId) > 0 {
+		after, err = strconv.ParseInt(lastEventId, 10, 64)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid last event id")
+		return
+	}
+	// Subscribe before reading history so no event is lost in between; duplicates are skipped by Id
+	subscription, unsubscribe := h.eventBus.Subscribe()
+	defer unsubscribe()
+
+	controller := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if after >= 0 {
+		for _, event := range h.eventBus.History(after) {
+			if err := writeEvent(w, event); err != nil {
+				return
+			}
+			after = event.Id
+		}
+	}
+	if err := controller.Flush(); err != nil {
+		return
+	}
+
+	ticker := time.NewTicker(keepAliveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-subscription:
+			if !ok {
+				return
+			}
+			if event.Id <= after {
+				continue
+			}
+			if err := writeEvent(w, event); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		}
+		if err := controller.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event events.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.Id, event.Type, data)
+	return err
+}
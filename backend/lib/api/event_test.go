@@ -0,0 +1,81 @@
+package api_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bongofriend/bookplayer/backend/lib/config"
+	"github.com/bongofriend/bookplayer/backend/lib/events"
+)
+
+func TestEventApi(t *testing.T) {
+	testApi := prepareApi(t, config.Config{})
+	testApi.eventBus.Publish(events.Event{Type: events.TypeDiscovered, SourcePath: "Sun Tzu/The Art of War.m4b"})
+	testApi.eventBus.Publish(events.Event{Type: events.TypeProbing, SourcePath: "Sun Tzu/The Art of War.m4b"})
+
+	t.Run("should list recent events", func(t *testing.T) {
+		rec := testApi.serve(testApi.authorizedRequest(http.MethodGet, "/events?after=1", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status %d; received: %d", http.StatusOK, rec.Code)
+		}
+		var received []events.Event
+		if err := json.NewDecoder(rec.Body).Decode(&received); err != nil {
+			t.Fatal(err)
+		}
+		if len(received) != 1 || received[0].Id != 2 || received[0].Type != events.TypeProbing {
+			t.Fatalf("Unexpected events: %+v", received)
+		}
+		if rec := testApi.serve(testApi.authorizedRequest(http.MethodGet, "/events?after=last", nil)); rec.Code != http.StatusBadRequest {
+			t.Fatalf("Expected status %d; received: %d", http.StatusBadRequest, rec.Code)
+		}
+	})
+	t.Run("should stream events after last event id", func(t *testing.T) {
+		server := httptest.NewServer(testApi.handler)
+		defer server.Close()
+		req := testApi.authorizedRequest(http.MethodGet, server.URL+"/events/stream", nil)
+		req.RequestURI = ""
+		req.Header.Set("Last-Event-ID", "1")
+		rsp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rsp.Body.Close()
+		if contentType := rsp.Header.Get("Content-Type"); contentType != "text/event-stream" {
+			t.Fatalf("Unexpected content type %s", contentType)
+		}
+		reader := bufio.NewReader(rsp.Body)
+		readEvent := func() string {
+			lines := []string{}
+			for {
+				line, err := reader.ReadString('\n')
+				if err != nil {
+					t.Fatal(err)
+				}
+				if line == "\n" {
+					return strings.Join(lines, "")
+				}
+				lines = append(lines, line)
+			}
+		}
+
+		if event := readEvent(); !strings.HasPrefix(event, "id: 2\nevent: probing\ndata: {") {
+			t.Fatalf("Expected recorded event 2; received: %q", event)
+		}
+		// Subscribed before recorded events were sent
+		testApi.eventBus.Publish(events.Event{Type: events.TypeSplitting, SourcePath: "Sun Tzu/The Art of War.m4b", Progress: 0.5})
+		event := readEvent()
+		if !strings.HasPrefix(event, "id: 3\nevent: splitting\n") || !strings.Contains(event, `"Progress":0.5`) {
+			t.Fatalf("Expected published event 3; received: %q", event)
+		}
+	})
+	t.Run("should reject unauthenticated requests", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/events/stream", nil)
+		if rec := testApi.serve(req); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("Expected status %d; received: %d", http.StatusUnauthorized, rec.Code)
+		}
+	})
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"slices"
+
+	"github.com/bongofriend/bookplayer/backend/lib/data/repo"
+	"github.com/bongofriend/bookplayer/backend/lib/models"
+)
+
+type jobHandler struct {
+	jobRepo  repo.JobRepository
+	commands PipelineCommands
+}
+
+func newJobHandler(jobRepo repo.JobRepository, commands PipelineCommands) jobHandler {
+	return jobHandler{
+		jobRepo:  jobRepo,
+		commands: commands,
+	}
+}
+
+// GET /jobs?state=failed
+func (h jobHandler) listJobs(w http.ResponseWriter, r *http.Request) {
+	state := r.URL.Query().Get("state")
+	states := []string{models.JobStateActive, models.JobStateFailed, models.JobStateCanceled, models.JobStateDone}
+	if len(state) > 0 && !slices.Contains(states, state) {
+		writeError(w, http.StatusBadRequest, "invalid query parameter state")
+		return
+	}
+	jobs, err := h.jobRepo.GetJobs(r.Context())
+	if err != nil {
+		writeRepoError(w, err)
+		return
+	}
+	if len(state) > 0 {
+		jobs = slices.DeleteFunc(jobs, func(j models.Job) bool { return j.State != state })
+	}
+	writeJson(w, http.StatusOK, jobs)
+}
+
+// GET /jobs/{id}
+func (h jobHandler) getJob(w http.ResponseWriter, r *http.Request) {
+	id, err := pathInt64(r, "id")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	job, err := h.jobRepo.GetJob(r.Context(), id)
+	if err != nil {
+		writeRepoError(w, err)
+		return
+	}
+	writeJson(w, http.StatusOK, job)
+}
+
+// POST /jobs/{id}/retry
+func (h jobHandler) retryJob(w http.ResponseWriter, r *http.Request) {
+	id, err := pathInt64(r, "id")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := h.jobRepo.RetryJob(r.Context(), id); err != nil {
+		writeRepoError(w, err)
+		return
+	}
+	// The job is picked up by the next scan anyway; requesting one only saves waiting for it
+	if _, err := h.commands.DispatchCommand(r.Context(), models.CommandScan, ""); err != nil {
+		log.Println(err)
+	}
+	h.getJob(w, r)
+}
+
+// POST /jobs/{id}/cancel
+func (h jobHandler) cancelJob(w http.ResponseWriter, r *http.Request) {
+	id, err := pathInt64(r, "id")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := h.jobRepo.CancelJob(r.Context(), id); err != nil {
+		writeRepoError(w, err)
+		return
+	}
+	h.getJob(w, r)
+}
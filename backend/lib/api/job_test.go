@@ -0,0 +1,93 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bongofriend/bookplayer/backend/lib/config"
+	"github.com/bongofriend/bookplayer/backend/lib/models"
+)
+
+func TestJobApi(t *testing.T) {
+	testApi := prepareApi(t, config.Config{})
+	ctx := context.Background()
+	files := []models.SourceFile{{Path: "Sun Tzu/The Art of War.m4b", Size: 1024, ModTime: time.Now(), Hash: "abc"}}
+	if err := testApi.sourceFileRepo.SaveSourceFiles(ctx, files[0].Path, files); err != nil {
+		t.Fatal(err)
+	}
+	if err := testApi.jobRepo.QueueJob(ctx, files[0].Path, "abc"); err != nil {
+		t.Fatal(err)
+	}
+
+	decodeJob := func(t *testing.T, method string, target string, status int) models.Job {
+		rec := testApi.serve(testApi.authorizedRequest(method, target, nil))
+		if rec.Code != status {
+			t.Fatalf("Expected status %d; received: %d", status, rec.Code)
+		}
+		var job models.Job
+		if err := json.NewDecoder(rec.Body).Decode(&job); err != nil {
+			t.Fatal(err)
+		}
+		return job
+	}
+
+	t.Run("should list jobs by state", func(t *testing.T) {
+		rec := testApi.serve(testApi.authorizedRequest(http.MethodGet, "/jobs?state=active", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status %d; received: %d", http.StatusOK, rec.Code)
+		}
+		var jobs []models.Job
+		if err := json.NewDecoder(rec.Body).Decode(&jobs); err != nil {
+			t.Fatal(err)
+		}
+		if len(jobs) != 1 || jobs[0].SourcePath != files[0].Path || jobs[0].Stage != models.JobStageDiscovered {
+			t.Fatalf("Unexpected jobs: %+v", jobs)
+		}
+		rec = testApi.serve(testApi.authorizedRequest(http.MethodGet, "/jobs?state=failed", nil))
+		if err := json.NewDecoder(rec.Body).Decode(&jobs); err != nil {
+			t.Fatal(err)
+		}
+		if len(jobs) != 0 {
+			t.Fatalf("Expected no failed jobs: %+v", jobs)
+		}
+		if rec := testApi.serve(testApi.authorizedRequest(http.MethodGet, "/jobs?state=paused", nil)); rec.Code != http.StatusBadRequest {
+			t.Fatalf("Expected status %d; received: %d", http.StatusBadRequest, rec.Code)
+		}
+	})
+	t.Run("should cancel and retry job", func(t *testing.T) {
+		if job := decodeJob(t, http.MethodPost, "/jobs/1/cancel", http.StatusOK); job.State != models.JobStateCanceled {
+			t.Fatalf("Expected canceled job; received: %+v", job)
+		}
+		if rec := testApi.serve(testApi.authorizedRequest(http.MethodPost, "/jobs/1/cancel", nil)); rec.Code != http.StatusConflict {
+			t.Fatalf("Expected status %d; received: %d", http.StatusConflict, rec.Code)
+		}
+		if job := decodeJob(t, http.MethodPost, "/jobs/1/retry", http.StatusOK); job.State != models.JobStateActive {
+			t.Fatalf("Expected active job; received: %+v", job)
+		}
+		if command := testApi.commands.last(); command == nil || command.Type != models.CommandScan {
+			t.Fatal("Expected retry to request a scan")
+		}
+	})
+	t.Run("should return 404 for unknown job", func(t *testing.T) {
+		if rec := testApi.serve(testApi.authorizedRequest(http.MethodPost, "/jobs/99/retry", nil)); rec.Code != http.StatusNotFound {
+			t.Fatalf("Expected status %d; received: %d", http.StatusNotFound, rec.Code)
+		}
+	})
+	t.Run("should reject users other than admins", func(t *testing.T) {
+		if _, err := testApi.authService.CreateUser(ctx, "listener", "password456", false); err != nil {
+			t.Fatal(err)
+		}
+		login, err := testApi.authService.Login(ctx, "listener", "password456")
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := testApi.authorizedRequest(http.MethodGet, "/jobs", nil)
+		req.Header.Set("Authorization", "Bearer "+login.Token)
+		if rec := testApi.serve(req); rec.Code != http.StatusForbidden {
+			t.Fatalf("Expected status %d; received: %d", http.StatusForbidden, rec.Code)
+		}
+	})
+}
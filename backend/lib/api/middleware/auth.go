@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/bongofriend/bookplayer/backend/lib/models"
+)
+
+// Name of the cookie holding the session token for browser clients
+const SessionCookieName = "bookplayer_session"
+
+type Authenticator interface {
+	// Resolve the user a session token belongs to
+	Authenticate(ctx context.Context, token string) (*models.User, error)
+}
+
+type userContextKey struct{}
+
+/*
+Middleware to resolve the user of a request.
+The session token is read from the Authorization header (Bearer scheme) or the session cookie.
+Requests without a valid token are passed on without a user; rejecting them is up to the route
+*/
+func Authentication(authenticator Authenticator) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := TokenFromRequest(r)
+			if len(token) > 0 {
+				if user, err := authenticator.Authenticate(r.Context(), token); err == nil {
+					r = r.WithContext(context.WithValue(r.Context(), userContextKey{}, user))
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TokenFromRequest(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); len(header) > 0 {
+		scheme, token, found := strings.Cut(header, " ")
+		if found && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+		return ""
+	}
+	if cookie, err := r.Cookie(SessionCookieName); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+// User attached by the Authentication middleware
+func UserFromContext(ctx context.Context) (*models.User, bool) {
+	user, ok := ctx.Value(userContextKey{}).(*models.User)
+	return user, ok && user != nil
+}
@@ -20,6 +20,11 @@ func (r *responseWriterStatusCode) WriteHeader(status int) {
 	r.statusCode = status
 }
 
+// Lets http.ResponseController reach the wrapped writer, e.g. to flush streamed events
+func (r *responseWriterStatusCode) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
 /*
 Middleware to log information about incoming requests
 TODO: Add log levels for development and production
@@ -0,0 +1,241 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/bongofriend/bookplayer/backend/lib/config"
+	"github.com/bongofriend/bookplayer/backend/lib/data/repo"
+	"github.com/bongofriend/bookplayer/backend/lib/models"
+)
+
+type overrideHandler struct {
+	config         config.Config
+	audiobookRepo  repo.AudiobookRepository
+	overrideRepo   repo.OverrideRepository
+	sourceFileRepo repo.SourceFileRepository
+	pipeline       pipelineHandler
+}
+
+// Chapter fields to change; boundaries move the end of the previous or the start of the next chapter along
+type chapterPatchRequest struct {
+	Title     *string  `json:"Title"`
+	StartTime *float32 `json:"StartTime"`
+	EndTime   *float32 `json:"EndTime"`
+}
+
+func newOverrideHandler(c config.Config, audiobookRepo repo.AudiobookRepository, overrideRepo repo.OverrideRepository, sourceFileRepo repo.SourceFileRepository, commands PipelineCommands) overrideHandler {
+	return overrideHandler{
+		config:         c,
+		audiobookRepo:  audiobookRepo,
+		overrideRepo:   overrideRepo,
+		sourceFileRepo: sourceFileRepo,
+		pipeline:       newPipelineHandler(commands, audiobookRepo, sourceFileRepo),
+	}
+}
+
+// GET /audiobooks/{id}/overrides
+func (h overrideHandler) getOverrides(w http.ResponseWriter, r *http.Request) {
+	id, err := pathInt64(r, "id")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	overrides, err := h.overrideRepo.GetOverrides(r.Context(), id)
+	if err != nil {
+		writeRepoError(w, err)
+		return
+	}
+	writeJson(w, http.StatusOK, overrides)
+}
+
+// PATCH /audiobooks/{id}; fields left out keep their values, edits are kept when the source is processed again
+func (h overrideHandler) patchAudiobook(w http.ResponseWriter, r *http.Request) {
+	id, err := pathInt64(r, "id")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var body models.AudiobookOverride
+	if err := decodeJson(r, &body); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if body.Title != nil {
+		title := strings.TrimSpace(*body.Title)
+		if len(title) == 0 {
+			writeError(w, http.StatusBadRequest, "title must not be empty")
+			return
+		}
+		body.Title = &title
+	}
+	body.Authors = trimNames(body.Authors)
+	body.Narrators = trimNames(body.Narrators)
+	body.Genres = trimNames(body.Genres)
+	if err := h.overrideRepo.SaveAudiobookOverride(r.Context(), id, body); err != nil {
+		writeRepoError(w, err)
+		return
+	}
+	audiobook, err := h.audiobookRepo.GetAudiobookById(r.Context(), id)
+	if err != nil {
+		writeRepoError(w, err)
+		return
+	}
+	writeJson(w, http.StatusOK, asAudiobookResponse(*audiobook))
+}
+
+// Names without surrounding spaces and empty names; nil stays nil so the names are left unchanged
+func trimNames(names []string) []string {
+	if names == nil {
+		return nil
+	}
+	trimmed := []string{}
+	for _, name := range names {
+		if name = strings.TrimSpace(name); len(name) > 0 {
+			trimmed = append(trimmed, name)
+		}
+	}
+	return trimmed
+}
+
+/*
+PATCH /audiobooks/{id}/chapters/{numbering}. A new title applies right away and responds with the chapter;
+moved boundaries need the source to be split again, so the reprocess command to follow is returned instead
+*/
+func (h overrideHandler) patchChapter(w http.ResponseWriter, r *http.Request) {
+	id, err := pathInt64(r, "id")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	numbering, err := pathInt64(r, "numbering")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var body chapterPatchRequest
+	if err := decodeJson(r, &body); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	audiobook, err := h.audiobookRepo.GetAudiobookById(r.Context(), id)
+	if err != nil {
+		writeRepoError(w, err)
+		return
+	}
+	chapters := audiobook.ProcessedChapters
+	idx := -1
+	for i, ch := range chapters {
+		if ch.Numbering == int(numbering) {
+			idx = i
+		}
+	}
+	if idx < 0 {
+		writeError(w, http.StatusNotFound, "chapter not found")
+		return
+	}
+
+	overrides := []models.ChapterOverride{}
+	if body.Title != nil {
+		title := strings.TrimSpace(*body.Title)
+		if len(title) == 0 {
+			writeError(w, http.StatusBadRequest, "title must not be empty")
+			return
+		}
+		overrides = append(overrides, models.ChapterOverride{Numbering: int(numbering), Title: &title})
+	}
+	start, end := chapters[idx].StartTime, chapters[idx].EndTime
+	if body.StartTime != nil {
+		if idx == 0 {
+			writeError(w, http.StatusBadRequest, "first chapter always starts at the beginning")
+			return
+		}
+		start = *body.StartTime
+		// The start of a chapter is stored as the end of the previous one
+		overrides = append(overrides, models.ChapterOverride{Numbering: chapters[idx-1].Numbering, EndTime: body.StartTime})
+	}
+	if body.EndTime != nil {
+		if idx == len(chapters)-1 {
+			writeError(w, http.StatusBadRequest, "last chapter always ends at the end")
+			return
+		}
+		end = *body.EndTime
+		overrides = append(overrides, models.ChapterOverride{Numbering: int(numbering), EndTime: body.EndTime})
+	}
+	if len(overrides) == 0 {
+		writeError(w, http.StatusBadRequest, "nothing to change")
+		return
+	}
+	movesBoundaries := body.StartTime != nil || body.EndTime != nil
+	if movesBoundaries {
+		// Chapters must keep a length and their order
+		if (idx > 0 && start <= chapters[idx-1].StartTime) || end <= start || (idx < len(chapters)-1 && end >= chapters[idx+1].EndTime) {
+			writeError(w, http.StatusBadRequest, "chapter boundaries must stay between the neighboring chapters")
+			return
+		}
+		files, err := h.sourceFileRepo.GetAudiobookSourceFiles(r.Context(), id)
+		if err != nil {
+			writeRepoError(w, err)
+			return
+		}
+		if len(files) == 0 {
+			writeError(w, http.StatusConflict, "audiobook has no source in the library")
+			return
+		}
+		if len(files) > 1 {
+			writeError(w, http.StatusConflict, "chapters of audiobooks made of several files are the files and cannot be moved")
+			return
+		}
+	}
+	if err := h.overrideRepo.SaveChapterOverrides(r.Context(), id, overrides); err != nil {
+		writeRepoError(w, err)
+		return
+	}
+	if movesBoundaries {
+		h.pipeline.dispatchForAudiobook(models.CommandReprocess)(w, r)
+		return
+	}
+	chapter, err := h.audiobookRepo.GetAudiobookChapter(r.Context(), id, int(numbering))
+	if err != nil {
+		writeRepoError(w, err)
+		return
+	}
+	writeJson(w, http.StatusOK, asChapterResponse(id, *chapter))
+}
+
+// DELETE /audiobooks/{id}/overrides; the source is processed again to restore the extracted values
+func (h overrideHandler) deleteOverrides(w http.ResponseWriter, r *http.Request) {
+	id, err := pathInt64(r, "id")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if _, err := h.audiobookRepo.GetAudiobookById(r.Context(), id); err != nil {
+		writeRepoError(w, err)
+		return
+	}
+	if err := h.overrideRepo.DeleteOverrides(r.Context(), id); err != nil {
+		writeRepoError(w, err)
+		return
+	}
+	files, err := h.sourceFileRepo.GetAudiobookSourceFiles(r.Context(), id)
+	if err != nil {
+		writeRepoError(w, err)
+		return
+	}
+	if len(files) == 0 {
+		// Nothing to restore the extracted values from
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	h.pipeline.dispatchCommand(w, r, models.CommandReprocess, files[0].SourcePath)
+}
+
+// POST /audiobooks/{id}/write-back; only available if enabled as it modifies the library
+func (h overrideHandler) writeBack(w http.ResponseWriter, r *http.Request) {
+	if !h.config.WriteBackMetadata {
+		writeError(w, http.StatusConflict, "writing metadata back into sources is disabled")
+		return
+	}
+	h.pipeline.dispatchForAudiobook(models.CommandWriteBack)(w, r)
+}
@@ -0,0 +1,130 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bongofriend/bookplayer/backend/lib/config"
+	"github.com/bongofriend/bookplayer/backend/lib/models"
+)
+
+func TestOverrideApi(t *testing.T) {
+	testApi := prepareApi(t, config.Config{WriteBackMetadata: true})
+	id := insertTestAudiobook(t, testApi.audiobookRepo, "The Art of War")
+	files := []models.SourceFile{{Path: "Sun Tzu/The Art of War.m4b", Size: 1024, ModTime: time.Now(), Hash: "abc"}}
+	if err := testApi.sourceFileRepo.SaveSourceFiles(context.Background(), files[0].Path, files); err != nil {
+		t.Fatal(err)
+	}
+	if err := testApi.sourceFileRepo.SetSourceAudiobook(context.Background(), files[0].Path, id); err != nil {
+		t.Fatal(err)
+	}
+
+	patch := func(t *testing.T, target string, body string, status int) []byte {
+		rec := testApi.serve(testApi.authorizedRequest(http.MethodPatch, target, strings.NewReader(body)))
+		if rec.Code != status {
+			t.Fatalf("Expected status %d; received: %d %s", status, rec.Code, rec.Body.String())
+		}
+		return rec.Body.Bytes()
+	}
+
+	t.Run("should edit audiobook", func(t *testing.T) {
+		data := patch(t, "/audiobooks/1", `{"Title": " The Art of War ", "Authors": ["Sun Tzu", "Lionel Giles"], "Series": "Classics"}`, http.StatusOK)
+		var audiobook struct {
+			Title   string
+			Author  string
+			Authors []string
+			Series  string
+		}
+		if err := json.Unmarshal(data, &audiobook); err != nil {
+			t.Fatal(err)
+		}
+		if audiobook.Title != "The Art of War" || audiobook.Author != "Sun Tzu, Lionel Giles" || len(audiobook.Authors) != 2 || audiobook.Series != "Classics" {
+			t.Fatalf("Unexpected audiobook: %+v", audiobook)
+		}
+	})
+	t.Run("should rename chapter right away", func(t *testing.T) {
+		data := patch(t, "/audiobooks/1/chapters/1", `{"Title": "Estimates"}`, http.StatusOK)
+		var chapter struct{ Title string }
+		if err := json.Unmarshal(data, &chapter); err != nil {
+			t.Fatal(err)
+		}
+		if chapter.Title != "Estimates" {
+			t.Fatalf("Unexpected chapter: %+v", chapter)
+		}
+	})
+	t.Run("should reprocess source when moving boundaries", func(t *testing.T) {
+		data := patch(t, "/audiobooks/1/chapters/1", `{"StartTime": 12.5}`, http.StatusAccepted)
+		var command models.Command
+		if err := json.Unmarshal(data, &command); err != nil {
+			t.Fatal(err)
+		}
+		if command.Type != models.CommandReprocess || command.SourcePath != files[0].Path {
+			t.Fatalf("Unexpected command: %+v", command)
+		}
+	})
+	t.Run("should list overrides", func(t *testing.T) {
+		rec := testApi.serve(testApi.authorizedRequest(http.MethodGet, "/audiobooks/1/overrides", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status %d; received: %d", http.StatusOK, rec.Code)
+		}
+		var overrides models.Overrides
+		if err := json.NewDecoder(rec.Body).Decode(&overrides); err != nil {
+			t.Fatal(err)
+		}
+		if overrides.Audiobook.Title == nil || *overrides.Audiobook.Title != "The Art of War" || len(overrides.Chapters) != 2 {
+			t.Fatalf("Unexpected overrides: %+v", overrides)
+		}
+		// The start of chapter 1 is kept as the end of chapter 0
+		for _, c := range overrides.Chapters {
+			if c.Numbering == 0 && (c.EndTime == nil || *c.EndTime != 12.5) {
+				t.Fatalf("Unexpected chapter override: %+v", c)
+			}
+		}
+	})
+	t.Run("should reject invalid edits", func(t *testing.T) {
+		for target, body := range map[string]string{
+			"/audiobooks/1":            `{"Title": " "}`,
+			"/audiobooks/1/chapters/0": `{"StartTime": 1}`,
+			"/audiobooks/1/chapters/1": `{"EndTime": 20}`,
+		} {
+			patch(t, target, body, http.StatusBadRequest)
+		}
+		patch(t, "/audiobooks/1/chapters/0", `{"EndTime": 35}`, http.StatusBadRequest)
+		patch(t, "/audiobooks/1/chapters/5", `{"Title": "Waging War"}`, http.StatusNotFound)
+	})
+	t.Run("should write back metadata", func(t *testing.T) {
+		rec := testApi.serve(testApi.authorizedRequest(http.MethodPost, "/audiobooks/1/write-back", nil))
+		if rec.Code != http.StatusAccepted {
+			t.Fatalf("Expected status %d; received: %d", http.StatusAccepted, rec.Code)
+		}
+		if command := testApi.commands.last(); command.Type != models.CommandWriteBack || command.SourcePath != files[0].Path {
+			t.Fatalf("Unexpected command: %+v", command)
+		}
+	})
+	t.Run("should delete overrides", func(t *testing.T) {
+		rec := testApi.serve(testApi.authorizedRequest(http.MethodDelete, "/audiobooks/1/overrides", nil))
+		if rec.Code != http.StatusAccepted {
+			t.Fatalf("Expected status %d; received: %d", http.StatusAccepted, rec.Code)
+		}
+		overrides, err := testApi.overrideRepo.GetOverrides(context.Background(), id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if overrides.Audiobook.Title != nil || len(overrides.Chapters) != 0 {
+			t.Fatalf("Unexpected overrides: %+v", overrides)
+		}
+	})
+}
+
+func TestOverrideApiWriteBackDisabled(t *testing.T) {
+	testApi := prepareApi(t, config.Config{})
+	insertTestAudiobook(t, testApi.audiobookRepo, "The Art of War")
+	rec := testApi.serve(testApi.authorizedRequest(http.MethodPost, "/audiobooks/1/write-back", nil))
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("Expected status %d; received: %d", http.StatusConflict, rec.Code)
+	}
+}
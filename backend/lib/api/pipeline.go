@@ -0,0 +1,86 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/bongofriend/bookplayer/backend/lib/data/repo"
+)
+
+type pipelineHandler struct {
+	commands       PipelineCommands
+	audiobookRepo  repo.AudiobookRepository
+	sourceFileRepo repo.SourceFileRepository
+}
+
+func newPipelineHandler(commands PipelineCommands, audiobookRepo repo.AudiobookRepository, sourceFileRepo repo.SourceFileRepository) pipelineHandler {
+	return pipelineHandler{
+		commands:       commands,
+		audiobookRepo:  audiobookRepo,
+		sourceFileRepo: sourceFileRepo,
+	}
+}
+
+// POST /pipeline/{command} for commands applying to the whole library; responds with the command to follow
+func (h pipelineHandler) dispatch(commandType string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h.dispatchCommand(w, r, commandType, "")
+	}
+}
+
+// POST /audiobooks/{id}/{command} for commands applying to the source of an audiobook
+func (h pipelineHandler) dispatchForAudiobook(commandType string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := pathInt64(r, "id")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		sourcePath, ok := h.audiobookSource(w, r, id)
+		if !ok {
+			return
+		}
+		h.dispatchCommand(w, r, commandType, sourcePath)
+	}
+}
+
+// Relative path of the source the audiobook with id was processed from; writes an error response if there is none
+func (h pipelineHandler) audiobookSource(w http.ResponseWriter, r *http.Request, id int64) (string, bool) {
+	if _, err := h.audiobookRepo.GetAudiobookById(r.Context(), id); err != nil {
+		writeRepoError(w, err)
+		return "", false
+	}
+	files, err := h.sourceFileRepo.GetAudiobookSourceFiles(r.Context(), id)
+	if err != nil {
+		writeRepoError(w, err)
+		return "", false
+	}
+	if len(files) == 0 {
+		writeError(w, http.StatusConflict, "audiobook has no source in the library")
+		return "", false
+	}
+	return files[0].SourcePath, true
+}
+
+func (h pipelineHandler) dispatchCommand(w http.ResponseWriter, r *http.Request, commandType string, sourcePath string) {
+	command, err := h.commands.DispatchCommand(r.Context(), commandType, sourcePath)
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	writeJson(w, http.StatusAccepted, command)
+}
+
+// GET /pipeline/commands/{id}
+func (h pipelineHandler) getCommand(w http.ResponseWriter, r *http.Request) {
+	id, err := pathInt64(r, "id")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	command, err := h.commands.GetCommand(id)
+	if err != nil {
+		writeRepoError(w, err)
+		return
+	}
+	writeJson(w, http.StatusOK, command)
+}
@@ -0,0 +1,117 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bongofriend/bookplayer/backend/lib/config"
+	"github.com/bongofriend/bookplayer/backend/lib/data/repo"
+	"github.com/bongofriend/bookplayer/backend/lib/models"
+)
+
+// Records dispatched commands instead of carrying them out
+type commandMock struct {
+	mu       sync.Mutex
+	commands []models.Command
+}
+
+func (c *commandMock) DispatchCommand(context context.Context, commandType string, sourcePath string) (*models.Command, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	command := models.Command{
+		Id:         int64(len(c.commands) + 1),
+		Type:       commandType,
+		SourcePath: sourcePath,
+		State:      models.CommandStateQueued,
+	}
+	c.commands = append(c.commands, command)
+	return &command, nil
+}
+
+func (c *commandMock) GetCommand(id int64) (*models.Command, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if id < 1 || id > int64(len(c.commands)) {
+		return nil, fmt.Errorf("command %d %w", id, repo.ErrNotFound)
+	}
+	command := c.commands[id-1]
+	return &command, nil
+}
+
+func (c *commandMock) last() *models.Command {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.commands) == 0 {
+		return nil
+	}
+	return &c.commands[len(c.commands)-1]
+}
+
+func TestPipelineApi(t *testing.T) {
+	testApi := prepareApi(t, config.Config{})
+	id := insertTestAudiobook(t, testApi.audiobookRepo, "The Art of War")
+	files := []models.SourceFile{{Path: "Sun Tzu/The Art of War.m4b", Size: 1024, ModTime: time.Now(), Hash: "abc"}}
+	if err := testApi.sourceFileRepo.SaveSourceFiles(context.Background(), files[0].Path, files); err != nil {
+		t.Fatal(err)
+	}
+	if err := testApi.sourceFileRepo.SetSourceAudiobook(context.Background(), files[0].Path, id); err != nil {
+		t.Fatal(err)
+	}
+
+	dispatch := func(t *testing.T, target string, status int) models.Command {
+		rec := testApi.serve(testApi.authorizedRequest(http.MethodPost, target, nil))
+		if rec.Code != status {
+			t.Fatalf("Expected status %d; received: %d", status, rec.Code)
+		}
+		var command models.Command
+		if err := json.NewDecoder(rec.Body).Decode(&command); err != nil {
+			t.Fatal(err)
+		}
+		return command
+	}
+
+	t.Run("should dispatch library commands", func(t *testing.T) {
+		for target, commandType := range map[string]string{
+			"/pipeline/scan":   models.CommandScan,
+			"/pipeline/rescan": models.CommandRescan,
+			"/pipeline/rehash": models.CommandRehash,
+			"/pipeline/pause":  models.CommandPause,
+			"/pipeline/resume": models.CommandResume,
+		} {
+			if command := dispatch(t, target, http.StatusAccepted); command.Type != commandType || command.Id == 0 || len(command.SourcePath) > 0 {
+				t.Fatalf("Unexpected command for %s: %+v", target, command)
+			}
+		}
+	})
+	t.Run("should dispatch commands for source of audiobook", func(t *testing.T) {
+		command := dispatch(t, fmt.Sprintf("/audiobooks/%d/reprocess", id), http.StatusAccepted)
+		if command.Type != models.CommandReprocess || command.SourcePath != files[0].Path {
+			t.Fatalf("Unexpected command: %+v", command)
+		}
+		if rec := testApi.serve(testApi.authorizedRequest(http.MethodPost, "/audiobooks/99/rehash", nil)); rec.Code != http.StatusNotFound {
+			t.Fatalf("Expected status %d; received: %d", http.StatusNotFound, rec.Code)
+		}
+	})
+	t.Run("should follow dispatched command", func(t *testing.T) {
+		command := dispatch(t, fmt.Sprintf("/audiobooks/%d/rehash", id), http.StatusAccepted)
+		rec := testApi.serve(testApi.authorizedRequest(http.MethodGet, fmt.Sprintf("/pipeline/commands/%d", command.Id), nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status %d; received: %d", http.StatusOK, rec.Code)
+		}
+		var followed models.Command
+		if err := json.NewDecoder(rec.Body).Decode(&followed); err != nil {
+			t.Fatal(err)
+		}
+		if followed.Id != command.Id || followed.State != models.CommandStateQueued {
+			t.Fatalf("Unexpected command: %+v", followed)
+		}
+		if rec := testApi.serve(testApi.authorizedRequest(http.MethodGet, "/pipeline/commands/99", nil)); rec.Code != http.StatusNotFound {
+			t.Fatalf("Expected status %d; received: %d", http.StatusNotFound, rec.Code)
+		}
+	})
+}
@@ -0,0 +1,129 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bongofriend/bookplayer/backend/lib/data/repo"
+	"github.com/bongofriend/bookplayer/backend/lib/models"
+)
+
+// Tolerance for offsets reported slightly past the end of a chapter
+const chapterEndTolerance = 1.0
+
+type progressHandler struct {
+	audiobookRepo repo.AudiobookRepository
+	progressRepo  repo.ProgressRepository
+}
+
+type progressRequest struct {
+	ChapterNumbering int     `json:"ChapterNumbering"`
+	Offset           float32 `json:"Offset"`
+	Finished         bool    `json:"Finished"`
+	// Point in time the position was recorded on the device; defaults to now
+	UpdatedAt *time.Time `json:"UpdatedAt"`
+}
+
+type progressResponse struct {
+	models.PlaybackProgress
+	// False if a more recent update was stored before
+	Applied bool `json:"Applied"`
+}
+
+func newProgressHandler(audiobookRepo repo.AudiobookRepository, progressRepo repo.ProgressRepository) progressHandler {
+	return progressHandler{
+		audiobookRepo: audiobookRepo,
+		progressRepo:  progressRepo,
+	}
+}
+
+var errInvalidPosition = errors.New("invalid position")
+
+// Check that offset lies within the chapter of the audiobook
+func validateChapterOffset(r *http.Request, audiobookRepo repo.AudiobookRepository, audiobookId int64, numbering int, offset float32) error {
+	chapter, err := audiobookRepo.GetAudiobookChapter(r.Context(), audiobookId, numbering)
+	if err != nil {
+		return err
+	}
+	length := chapter.EndTime - chapter.StartTime
+	if offset < 0 || offset > length+chapterEndTolerance {
+		return fmt.Errorf("%w: offset %.3f outside of chapter %d with length %.3f", errInvalidPosition, offset, numbering, length)
+	}
+	return nil
+}
+
+func writePositionError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errInvalidPosition) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeRepoError(w, err)
+}
+
+// GET /progress
+func (h progressHandler) listProgress(w http.ResponseWriter, r *http.Request) {
+	user := requestUser(r)
+	progress, err := h.progressRepo.GetUserProgress(r.Context(), user.Id)
+	if err != nil {
+		writeRepoError(w, err)
+		return
+	}
+	writeJson(w, http.StatusOK, progress)
+}
+
+// GET /audiobooks/{id}/progress
+func (h progressHandler) getProgress(w http.ResponseWriter, r *http.Request) {
+	id, err := pathInt64(r, "id")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	progress, err := h.progressRepo.GetProgress(r.Context(), requestUser(r).Id, id)
+	if err != nil {
+		writeRepoError(w, err)
+		return
+	}
+	writeJson(w, http.StatusOK, progress)
+}
+
+// PUT /audiobooks/{id}/progress
+func (h progressHandler) putProgress(w http.ResponseWriter, r *http.Request) {
+	id, err := pathInt64(r, "id")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var body progressRequest
+	if err := decodeJson(r, &body); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := validateChapterOffset(r, h.audiobookRepo, id, body.ChapterNumbering, body.Offset); err != nil {
+		writePositionError(w, err)
+		return
+	}
+	// Don't let devices with clocks running ahead block updates from others
+	now := time.Now()
+	updatedAt := now
+	if body.UpdatedAt != nil && body.UpdatedAt.Before(now) {
+		updatedAt = *body.UpdatedAt
+	}
+	stored, applied, err := h.progressRepo.SaveProgress(r.Context(), models.PlaybackProgress{
+		UserId:           requestUser(r).Id,
+		AudiobookId:      id,
+		ChapterNumbering: body.ChapterNumbering,
+		Offset:           body.Offset,
+		Finished:         body.Finished,
+		UpdatedAt:        updatedAt,
+	})
+	if err != nil {
+		writeRepoError(w, err)
+		return
+	}
+	writeJson(w, http.StatusOK, progressResponse{
+		PlaybackProgress: *stored,
+		Applied:          applied,
+	})
+}
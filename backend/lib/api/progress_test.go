@@ -0,0 +1,72 @@
+package api_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bongofriend/bookplayer/backend/lib/config"
+)
+
+func TestProgressApi(t *testing.T) {
+	testApi := prepareApi(t, config.Config{})
+	id := insertTestAudiobook(t, testApi.audiobookRepo, "The Art of War")
+	target := fmt.Sprintf("/audiobooks/%d/progress", id)
+
+	t.Run("should respond with not found without progress", func(t *testing.T) {
+		rec := testApi.serve(testApi.authorizedRequest(http.MethodGet, target, nil))
+		if rec.Code != http.StatusNotFound {
+			t.Fatalf("Expected status %d; received: %d", http.StatusNotFound, rec.Code)
+		}
+	})
+	t.Run("should store progress", func(t *testing.T) {
+		rec := testApi.serve(testApi.authorizedRequest(http.MethodPut, target, strings.NewReader(`{"ChapterNumbering":1,"Offset":12.5}`)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status %d; received: %d", http.StatusOK, rec.Code)
+		}
+		rec = testApi.serve(testApi.authorizedRequest(http.MethodGet, target, nil))
+		var progress struct {
+			ChapterNumbering int
+			Offset           float32
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&progress); err != nil {
+			t.Fatal(err)
+		}
+		if progress.ChapterNumbering != 1 || progress.Offset != 12.5 {
+			t.Fatalf("Unexpected progress %+v", progress)
+		}
+	})
+	t.Run("should not apply outdated progress", func(t *testing.T) {
+		updatedAt := time.Now().Add(-time.Hour).Format(time.RFC3339)
+		body := fmt.Sprintf(`{"ChapterNumbering":0,"Offset":3,"UpdatedAt":"%s"}`, updatedAt)
+		rec := testApi.serve(testApi.authorizedRequest(http.MethodPut, target, strings.NewReader(body)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status %d; received: %d", http.StatusOK, rec.Code)
+		}
+		var progress struct {
+			ChapterNumbering int
+			Applied          bool
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&progress); err != nil {
+			t.Fatal(err)
+		}
+		if progress.Applied || progress.ChapterNumbering != 1 {
+			t.Fatalf("Unexpected progress %+v", progress)
+		}
+	})
+	t.Run("should reject positions outside of chapters", func(t *testing.T) {
+		for body, status := range map[string]int{
+			`{"ChapterNumbering":0,"Offset":60}`: http.StatusBadRequest,
+			`{"ChapterNumbering":0,"Offset":-1}`: http.StatusBadRequest,
+			`{"ChapterNumbering":7,"Offset":0}`:  http.StatusNotFound,
+		} {
+			rec := testApi.serve(testApi.authorizedRequest(http.MethodPut, target, strings.NewReader(body)))
+			if rec.Code != status {
+				t.Fatalf("%s: expected status %d; received: %d", body, status, rec.Code)
+			}
+		}
+	})
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/bongofriend/bookplayer/backend/lib/api/middleware"
+	"github.com/bongofriend/bookplayer/backend/lib/data/repo"
+	"github.com/bongofriend/bookplayer/backend/lib/models"
+)
+
+type errorResponse struct {
+	Error string `json:"Error"`
+}
+
+func writeJson(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Println(err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJson(w, status, errorResponse{Error: message})
+}
+
+// Map errors returned by repositories to a matching response
+func writeRepoError(w http.ResponseWriter, err error) {
+	if errors.Is(err, repo.ErrNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if errors.Is(err, repo.ErrInvalidState) {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	log.Println(err)
+	writeError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+}
+
+func decodeJson(r *http.Request, body any) error {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(body); err != nil {
+		return errors.New("invalid request body")
+	}
+	return nil
+}
+
+// User of a request registered with HandleAuthenticated
+func requestUser(r *http.Request) *models.User {
+	user, _ := middleware.UserFromContext(r.Context())
+	return user
+}
+
+func pathInt64(r *http.Request, name string) (int64, error) {
+	value, err := strconv.ParseInt(r.PathValue(name), 10, 64)
+	if err != nil {
+		return 0, errors.New("invalid path parameter " + name)
+	}
+	return value, nil
+}
+
+func queryInt64(r *http.Request, name string, defaultValue int64) (int64, error) {
+	raw := r.URL.Query().Get(name)
+	if len(raw) == 0 {
+		return defaultValue, nil
+	}
+	value, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || value < 0 {
+		return 0, errors.New("invalid query parameter " + name)
+	}
+	return value, nil
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"errors"
+	"html"
+	"net/http"
+	"strings"
+
+	"github.com/bongofriend/bookplayer/backend/lib/data/repo"
+	"github.com/bongofriend/bookplayer/backend/lib/models"
+)
+
+type searchResultResponse struct {
+	audiobookResponse
+	// HTML escaped excerpt with matches wrapped in <mark> elements
+	Snippet string  `json:"Snippet"`
+	Score   float64 `json:"Score"`
+}
+
+type searchPageResponse struct {
+	Items  []searchResultResponse `json:"Items"`
+	Total  int64                  `json:"Total"`
+	Limit  int64                  `json:"Limit"`
+	Offset int64                  `json:"Offset"`
+}
+
+func highlightSnippet(snippet string) string {
+	escaped := html.EscapeString(snippet)
+	return strings.NewReplacer(
+		models.SearchHighlightStart, "<mark>",
+		models.SearchHighlightEnd, "</mark>",
+	).Replace(escaped)
+}
+
+// GET /search?q=&limit=&offset=
+func (h audiobookHandler) searchAudiobooks(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("q")
+	limit, err := queryInt64(r, "limit", defaultPageLimit)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	limit = min(max(limit, 1), maxPageLimit)
+	offset, err := queryInt64(r, "offset", 0)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	results, total, err := h.audiobookRepo.SearchAudiobooks(r.Context(), query, limit, offset)
+	if err != nil {
+		if errors.Is(err, repo.ErrEmptySearchQuery) {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeRepoError(w, err)
+		return
+	}
+	items := make([]searchResultResponse, len(results))
+	for idx, result := range results {
+		items[idx] = searchResultResponse{
+			audiobookResponse: asAudiobookResponse(result.Audiobook),
+			Snippet:           highlightSnippet(result.Snippet),
+			Score:             result.Score,
+		}
+	}
+	writeJson(w, http.StatusOK, searchPageResponse{
+		Items:  items,
+		Total:  total,
+		Limit:  limit,
+		Offset: offset,
+	})
+}
@@ -0,0 +1,46 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/bongofriend/bookplayer/backend/lib/config"
+	"github.com/bongofriend/bookplayer/backend/lib/models"
+)
+
+func TestSearchApi(t *testing.T) {
+	testApi := prepareApi(t, config.Config{})
+	insertTestAudiobook(t, testApi.audiobookRepo, "The Art of War")
+	_, err := testApi.audiobookRepo.InsertAudiobook(context.Background(), models.AudiobookProcessed{
+		AudiobookCommon: models.AudiobookCommon{Title: "<script>War</script> & Peace"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("should find and highlight matches", func(t *testing.T) {
+		rec := testApi.serve(testApi.authorizedRequest(http.MethodGet, "/search?q=peace", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status %d; received: %d", http.StatusOK, rec.Code)
+		}
+		var page struct {
+			Items []struct{ Snippet string }
+			Total int64
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&page); err != nil {
+			t.Fatal(err)
+		}
+		expected := "&lt;script&gt;War&lt;/script&gt; &amp; <mark>Peace</mark>"
+		if page.Total != 1 || page.Items[0].Snippet != expected {
+			t.Fatalf("Unexpected search result %+v", page)
+		}
+	})
+	t.Run("should reject missing query", func(t *testing.T) {
+		rec := testApi.serve(testApi.authorizedRequest(http.MethodGet, "/search?q=", nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("Expected status %d; received: %d", http.StatusBadRequest, rec.Code)
+		}
+	})
+}
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/bongofriend/bookplayer/backend/lib/data/repo"
+)
+
+type sourceHandler struct {
+	audiobookRepo  repo.AudiobookRepository
+	sourceFileRepo repo.SourceFileRepository
+}
+
+func newSourceHandler(audiobookRepo repo.AudiobookRepository, sourceFileRepo repo.SourceFileRepository) sourceHandler {
+	return sourceHandler{
+		audiobookRepo:  audiobookRepo,
+		sourceFileRepo: sourceFileRepo,
+	}
+}
+
+// GET /audiobooks/{id}/sources
+func (h sourceHandler) listSourceFiles(w http.ResponseWriter, r *http.Request) {
+	id, err := pathInt64(r, "id")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if _, err := h.audiobookRepo.GetAudiobookById(r.Context(), id); err != nil {
+		writeRepoError(w, err)
+		return
+	}
+	files, err := h.sourceFileRepo.GetAudiobookSourceFiles(r.Context(), id)
+	if err != nil {
+		writeRepoError(w, err)
+		return
+	}
+	writeJson(w, http.StatusOK, files)
+}
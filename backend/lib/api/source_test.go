@@ -0,0 +1,44 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bongofriend/bookplayer/backend/lib/config"
+	"github.com/bongofriend/bookplayer/backend/lib/models"
+)
+
+func TestSourceFileApi(t *testing.T) {
+	testApi := prepareApi(t, config.Config{})
+	id := insertTestAudiobook(t, testApi.audiobookRepo, "The Art of War")
+	files := []models.SourceFile{{Path: "Sun Tzu/The Art of War.m4b", Size: 1024, ModTime: time.Now(), Hash: "abc"}}
+	if err := testApi.sourceFileRepo.SaveSourceFiles(context.Background(), files[0].Path, files); err != nil {
+		t.Fatal(err)
+	}
+	if err := testApi.sourceFileRepo.SetSourceAudiobook(context.Background(), files[0].Path, id); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("should list source files of audiobook", func(t *testing.T) {
+		rec := testApi.serve(testApi.authorizedRequest(http.MethodGet, "/audiobooks/1/sources", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status %d; received: %d", http.StatusOK, rec.Code)
+		}
+		var sources []models.SourceFile
+		if err := json.NewDecoder(rec.Body).Decode(&sources); err != nil {
+			t.Fatal(err)
+		}
+		if len(sources) != 1 || sources[0].Path != files[0].Path || sources[0].Status != models.SourceStatusProcessed {
+			t.Fatalf("Unexpected source files: %+v", sources)
+		}
+	})
+	t.Run("should return 404 for unknown audiobook", func(t *testing.T) {
+		rec := testApi.serve(testApi.authorizedRequest(http.MethodGet, "/audiobooks/99/sources", nil))
+		if rec.Code != http.StatusNotFound {
+			t.Fatalf("Expected status %d; received: %d", http.StatusNotFound, rec.Code)
+		}
+	})
+}
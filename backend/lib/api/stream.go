@@ -0,0 +1,194 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/bongofriend/bookplayer/backend/lib/config"
+	"github.com/bongofriend/bookplayer/backend/lib/data/repo"
+	"github.com/bongofriend/bookplayer/backend/lib/transcode"
+)
+
+var audioContentTypes = map[string]string{
+	".m4b":  "audio/mp4",
+	".m4a":  "audio/mp4",
+	".mp4":  "audio/mp4",
+	".aac":  "audio/aac",
+	".mp3":  "audio/mpeg",
+	".ogg":  "audio/ogg",
+	".oga":  "audio/ogg",
+	".opus": "audio/ogg",
+	".flac": "audio/flac",
+	".wav":  "audio/wav",
+}
+
+type streamHandler struct {
+	config        config.Config
+	audiobookRepo repo.AudiobookRepository
+	transcoder    *transcode.Transcoder
+}
+
+func newStreamHandler(c config.Config, audiobookRepo repo.AudiobookRepository) streamHandler {
+	return streamHandler{
+		config:        c,
+		audiobookRepo: audiobookRepo,
+		transcoder:    transcode.NewTranscoder(c),
+	}
+}
+
+func audioContentType(p string) string {
+	if contentType, ok := audioContentTypes[strings.ToLower(filepath.Ext(p))]; ok {
+		return contentType
+	}
+	return "application/octet-stream"
+}
+
+// Check that p points into dir after resolving ".." elements
+func isWithinDirectory(dir string, p string) bool {
+	rel, err := filepath.Rel(filepath.Clean(dir), filepath.Clean(p))
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) && !filepath.IsAbs(rel)
+}
+
+// Strong validator derived from size and modification time of the served file
+func fileETag(stat os.FileInfo) string {
+	return fmt.Sprintf(`"%x-%x"`, stat.Size(), stat.ModTime().UnixNano())
+}
+
+/*
+Serve a file with support for Range, If-Range, If-None-Match and If-Modified-Since requests.
+p must already be validated by the caller.
+*/
+func serveFile(w http.ResponseWriter, r *http.Request, p string, contentType string) {
+	file, err := os.Open(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			writeError(w, http.StatusNotFound, "file not found")
+			return
+		}
+		log.Println(err)
+		writeError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil || !stat.Mode().IsRegular() {
+		writeError(w, http.StatusNotFound, "file not found")
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("ETag", fileETag(stat))
+	w.Header().Set("Accept-Ranges", "bytes")
+	http.ServeContent(w, r, "", stat.ModTime(), file)
+}
+
+// Media ranges of an Accept header in order of appearance; ranges with q=0 are left out
+func acceptedTypes(accept string) []string {
+	types := []string{}
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(part)
+		if err != nil {
+			continue
+		}
+		if q, err := strconv.ParseFloat(params["q"], 64); err == nil && q == 0 {
+			continue
+		}
+		types = append(types, mediaType)
+	}
+	return types
+}
+
+func matchesMediaRange(mediaRange string, contentType string) bool {
+	if mediaRange == "*/*" || mediaRange == contentType {
+		return true
+	}
+	prefix, ok := strings.CutSuffix(mediaRange, "*")
+	return ok && strings.HasSuffix(prefix, "/") && strings.HasPrefix(contentType, prefix)
+}
+
+/*
+Transcoding profile for a chapter of contentType: the one named by the profile query parameter or, if the Accept header
+rules out contentType, the first profile producing an accepted type. nil to serve the chapter as it is
+*/
+func (h streamHandler) requestedProfile(r *http.Request, contentType string) (*config.TranscodingProfile, error) {
+	if name := r.URL.Query().Get("profile"); len(name) > 0 {
+		profile, ok := h.transcoder.Profile(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown transcoding profile %s", name)
+		}
+		return &profile, nil
+	}
+	accepted := acceptedTypes(r.Header.Get("Accept"))
+	if len(accepted) == 0 || slices.ContainsFunc(accepted, func(a string) bool { return matchesMediaRange(a, contentType) }) {
+		return nil, nil
+	}
+	for _, mediaRange := range accepted {
+		for _, profile := range h.transcoder.Profiles() {
+			if matchesMediaRange(mediaRange, transcode.ContentType(profile)) {
+				return &profile, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// GET /audiobooks/{id}/chapters/{numbering}/stream?profile=car
+func (h streamHandler) streamChapter(w http.ResponseWriter, r *http.Request) {
+	id, err := pathInt64(r, "id")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	numbering, err := pathInt64(r, "numbering")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	chapter, err := h.audiobookRepo.GetAudiobookChapter(r.Context(), id, int(numbering))
+	if err != nil {
+		writeRepoError(w, err)
+		return
+	}
+	// Never serve anything outside of the directory for processed audiobooks, even if the database says otherwise
+	if !isWithinDirectory(h.config.ProcessedAudiobookPath, chapter.FilePath) {
+		log.Printf("Refusing to serve %s outside of %s", chapter.FilePath, h.config.ProcessedAudiobookPath)
+		writeError(w, http.StatusNotFound, "file not found")
+		return
+	}
+	contentType := audioContentType(chapter.FilePath)
+	profile, err := h.requestedProfile(r, contentType)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	// Caches must not hand a transcoded chapter to clients accepting other types
+	w.Header().Add("Vary", "Accept")
+	if profile == nil {
+		serveFile(w, r, chapter.FilePath, contentType)
+		return
+	}
+	transcoded, err := h.transcoder.Transcode(r.Context(), *profile, chapter.FilePath)
+	if err != nil {
+		switch {
+		case errors.Is(err, context.Canceled):
+		case os.IsNotExist(err):
+			writeError(w, http.StatusNotFound, "file not found")
+		default:
+			log.Println(err)
+			writeError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		}
+		return
+	}
+	serveFile(w, r, transcoded, transcode.ContentType(*profile))
+}
@@ -0,0 +1,166 @@
+package api_test
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bongofriend/bookplayer/backend/lib/config"
+	"github.com/bongofriend/bookplayer/backend/lib/models"
+	"github.com/bongofriend/bookplayer/backend/lib/transcode"
+)
+
+func TestStreamChapter(t *testing.T) {
+	testConfig := config.Config{
+		ProcessedAudiobookPath: filepath.Join(t.TempDir(), "processed_audiobook"),
+	}
+	testApi := prepareApi(t, testConfig)
+	chapterDir := filepath.Join(testConfig.ProcessedAudiobookPath, "The Art of War")
+	if err := os.MkdirAll(chapterDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	chapterPath := filepath.Join(chapterDir, "0.m4b")
+	if err := os.WriteFile(chapterPath, []byte("0123456789"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	outsidePath := filepath.Join(t.TempDir(), "secret.m4b")
+	if err := os.WriteFile(outsidePath, []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := testApi.audiobookRepo.InsertAudiobook(context.Background(), models.AudiobookProcessed{
+		AudiobookCommon: models.AudiobookCommon{Title: "The Art of War"},
+		ProcessedChapters: []models.ProcessedChapter{
+			{ChapterCommon: models.ChapterCommon{Numbering: 0, EndTime: 10}, FilePath: chapterPath},
+			{ChapterCommon: models.ChapterCommon{Numbering: 1, StartTime: 10, EndTime: 20}, FilePath: outsidePath},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("should serve whole chapter", func(t *testing.T) {
+		rec := testApi.serve(testApi.authorizedRequest(http.MethodGet, "/audiobooks/1/chapters/0/stream", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status %d; received: %d", http.StatusOK, rec.Code)
+		}
+		if contentType := rec.Header().Get("Content-Type"); contentType != "audio/mp4" {
+			t.Fatalf("Unexpected Content-Type %s", contentType)
+		}
+		if rec.Header().Get("ETag") == "" || rec.Header().Get("Last-Modified") == "" {
+			t.Fatal("Missing ETag or Last-Modified header")
+		}
+		if body := rec.Body.String(); body != "0123456789" {
+			t.Fatalf("Unexpected body %q", body)
+		}
+	})
+	t.Run("should serve requested range", func(t *testing.T) {
+		req := testApi.authorizedRequest(http.MethodGet, "/audiobooks/1/chapters/0/stream", nil)
+		req.Header.Set("Range", "bytes=2-5")
+		rec := testApi.serve(req)
+		if rec.Code != http.StatusPartialContent {
+			t.Fatalf("Expected status %d; received: %d", http.StatusPartialContent, rec.Code)
+		}
+		if body := rec.Body.String(); body != "2345" {
+			t.Fatalf("Unexpected body %q", body)
+		}
+		if contentRange := rec.Header().Get("Content-Range"); contentRange != "bytes 2-5/10" {
+			t.Fatalf("Unexpected Content-Range %s", contentRange)
+		}
+	})
+	t.Run("should honor ETag", func(t *testing.T) {
+		rec := testApi.serve(testApi.authorizedRequest(http.MethodGet, "/audiobooks/1/chapters/0/stream", nil))
+		req := testApi.authorizedRequest(http.MethodGet, "/audiobooks/1/chapters/0/stream", nil)
+		req.Header.Set("If-None-Match", rec.Header().Get("ETag"))
+		rec = testApi.serve(req)
+		if rec.Code != http.StatusNotModified {
+			t.Fatalf("Expected status %d; received: %d", http.StatusNotModified, rec.Code)
+		}
+	})
+	t.Run("should not serve files outside of processed directory", func(t *testing.T) {
+		rec := testApi.serve(testApi.authorizedRequest(http.MethodGet, "/audiobooks/1/chapters/1/stream", nil))
+		if rec.Code != http.StatusNotFound {
+			t.Fatalf("Expected status %d; received: %d", http.StatusNotFound, rec.Code)
+		}
+	})
+}
+
+func TestStreamTranscodedChapter(t *testing.T) {
+	testDir := t.TempDir()
+	testConfig := config.Config{
+		ProcessedAudiobookPath: filepath.Join(testDir, "processed_audiobook"),
+		TranscodedChapterPath:  filepath.Join(testDir, "transcoded"),
+		Transcoding: config.TranscodingConfig{Profiles: []config.TranscodingProfile{
+			{Name: "car", Codec: config.CodecMp3, Container: "mp3", Bitrate: 64},
+		}},
+	}
+	testApi := prepareApi(t, testConfig)
+	chapterPath := filepath.Join(testConfig.ProcessedAudiobookPath, "The Art of War", "0.m4b")
+	// Transcoded before, so ffmpeg is not needed
+	cachePath, err := transcode.CachePath(testConfig, testConfig.Transcoding.Profiles[0], chapterPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []struct {
+		path    string
+		content string
+		modTime time.Time
+	}{
+		{path: chapterPath, content: "original", modTime: time.Now().Add(-time.Hour)},
+		{path: cachePath, content: "transcoded", modTime: time.Now()},
+	} {
+		if err := os.MkdirAll(filepath.Dir(f.path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(f.path, []byte(f.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(f.path, f.modTime, f.modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = testApi.audiobookRepo.InsertAudiobook(context.Background(), models.AudiobookProcessed{
+		AudiobookCommon: models.AudiobookCommon{Title: "The Art of War"},
+		ProcessedChapters: []models.ProcessedChapter{
+			{ChapterCommon: models.ChapterCommon{Numbering: 0, EndTime: 10}, FilePath: chapterPath},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream := func(t *testing.T, target string, accept string) (string, string) {
+		req := testApi.authorizedRequest(http.MethodGet, target, nil)
+		if len(accept) > 0 {
+			req.Header.Set("Accept", accept)
+		}
+		rec := testApi.serve(req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status %d; received: %d", http.StatusOK, rec.Code)
+		}
+		return rec.Header().Get("Content-Type"), rec.Body.String()
+	}
+
+	t.Run("should serve profile from query parameter", func(t *testing.T) {
+		if contentType, body := stream(t, "/audiobooks/1/chapters/0/stream?profile=car", ""); contentType != "audio/mpeg" || body != "transcoded" {
+			t.Fatalf("Unexpected %s body %q", contentType, body)
+		}
+	})
+	t.Run("should pick profile from Accept header", func(t *testing.T) {
+		if contentType, body := stream(t, "/audiobooks/1/chapters/0/stream", "audio/mpeg, audio/mp4;q=0"); contentType != "audio/mpeg" || body != "transcoded" {
+			t.Fatalf("Unexpected %s body %q", contentType, body)
+		}
+	})
+	t.Run("should serve original if accepted", func(t *testing.T) {
+		if contentType, body := stream(t, "/audiobooks/1/chapters/0/stream", "audio/ogg, audio/*;q=0.9"); contentType != "audio/mp4" || body != "original" {
+			t.Fatalf("Unexpected %s body %q", contentType, body)
+		}
+	})
+	t.Run("should reject unknown profile", func(t *testing.T) {
+		rec := testApi.serve(testApi.authorizedRequest(http.MethodGet, "/audiobooks/1/chapters/0/stream?profile=tape", nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("Expected status %d; received: %d", http.StatusBadRequest, rec.Code)
+		}
+	})
+}
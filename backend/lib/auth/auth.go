@@ -0,0 +1,223 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/bongofriend/bookplayer/backend/lib/config"
+	"github.com/bongofriend/bookplayer/backend/lib/data/repo"
+	"github.com/bongofriend/bookplayer/backend/lib/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	secretFileName    = "session_secret"
+	sessionIdLength   = 32
+	minPasswordLength = 8
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	ErrInvalidToken       = errors.New("invalid or expired session token")
+	ErrInvalidUser        = errors.New("username must not be empty and password must have at least 8 characters")
+)
+
+// Used to keep the duration of failed logins for unknown users similar to those of known users
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("bookplayer-dummy-password"), bcrypt.DefaultCost)
+
+/*
+Handles user accounts and sessions.
+Session tokens have the form <session id>.<signature>, signed with HMAC-SHA256.
+Sessions are persisted so they can be revoked on logout.
+*/
+type Service struct {
+	userRepo        repo.UserRepository
+	secret          []byte
+	sessionLifetime time.Duration
+}
+
+func NewService(c config.Config, userRepo repo.UserRepository) (*Service, error) {
+	secret, err := loadSecret(c)
+	if err != nil {
+		return nil, err
+	}
+	return &Service{
+		userRepo:        userRepo,
+		secret:          secret,
+		sessionLifetime: c.Auth.SessionLifetime,
+	}, nil
+}
+
+// Use configured secret or load/generate one in the application directory
+func loadSecret(c config.Config) ([]byte, error) {
+	if len(c.Auth.SessionSecret) > 0 {
+		return []byte(c.Auth.SessionSecret), nil
+	}
+	secretFilePath := path.Join(c.ApplicationDirectory, secretFileName)
+	data, err := os.ReadFile(secretFilePath)
+	if err == nil && len(data) > 0 {
+		return data, nil
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(c.ApplicationDirectory, 0755); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(secretFilePath, secret, 0600); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+func (s *Service) CreateUser(ctx context.Context, username string, password string, isAdmin bool) (*models.User, error) {
+	username = strings.TrimSpace(username)
+	if len(username) == 0 || len(password) < minPasswordLength {
+		return nil, ErrInvalidUser
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	user := models.User{
+		Username:     username,
+		PasswordHash: string(hash),
+		IsAdmin:      isAdmin,
+		CreatedAt:    time.Now(),
+	}
+	id, err := s.userRepo.InsertUser(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	user.Id = id
+	return &user, nil
+}
+
+// True if no user exists yet; the first user to register becomes admin
+func (s *Service) NeedsSetup(ctx context.Context) (bool, error) {
+	count, err := s.userRepo.CountUsers(ctx)
+	if err != nil {
+		return false, err
+	}
+	return count == 0, nil
+}
+
+type LoginResult struct {
+	// Signed session token
+	Token   string
+	Session models.Session
+	User    models.User
+}
+
+// Verify credentials and start a new session
+func (s *Service) Login(ctx context.Context, username string, password string) (*LoginResult, error) {
+	user, err := s.userRepo.GetUserByUsername(ctx, username)
+	if err != nil {
+		if errors.Is(err, repo.ErrNotFound) {
+			bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+			return nil, ErrInvalidCredentials
+		}
+		return nil, err
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	idBytes := make([]byte, sessionIdLength)
+	if _, err := rand.Read(idBytes); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	session := models.Session{
+		Id:        hex.EncodeToString(idBytes),
+		UserId:    user.Id,
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.sessionLifetime),
+	}
+	if err := s.userRepo.DeleteExpiredSessions(ctx, now); err != nil {
+		return nil, err
+	}
+	if err := s.userRepo.InsertSession(ctx, session); err != nil {
+		return nil, err
+	}
+	return &LoginResult{
+		Token:   s.signToken(session.Id),
+		Session: session,
+		User:    *user,
+	}, nil
+}
+
+// Revoke the session belonging to token
+func (s *Service) Logout(ctx context.Context, token string) error {
+	sessionId, err := s.verifyToken(token)
+	if err != nil {
+		return err
+	}
+	return s.userRepo.DeleteSession(ctx, sessionId)
+}
+
+// Resolve the user of a valid, unexpired session token
+func (s *Service) Authenticate(ctx context.Context, token string) (*models.User, error) {
+	sessionId, err := s.verifyToken(token)
+	if err != nil {
+		return nil, err
+	}
+	session, err := s.userRepo.GetSession(ctx, sessionId)
+	if err != nil {
+		if errors.Is(err, repo.ErrNotFound) {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+	if !time.Now().Before(session.ExpiresAt) {
+		return nil, ErrInvalidToken
+	}
+	user, err := s.userRepo.GetUserById(ctx, session.UserId)
+	if err != nil {
+		if errors.Is(err, repo.ErrNotFound) {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *Service) signature(sessionId string) []byte {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(sessionId))
+	return mac.Sum(nil)
+}
+
+func (s *Service) signToken(sessionId string) string {
+	return fmt.Sprintf("%s.%s", sessionId, base64.RawURLEncoding.EncodeToString(s.signature(sessionId)))
+}
+
+// Check signature of token and return the contained session id
+func (s *Service) verifyToken(token string) (string, error) {
+	sessionId, encodedSignature, found := strings.Cut(token, ".")
+	if !found {
+		return "", ErrInvalidToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil {
+		return "", ErrInvalidToken
+	}
+	if !hmac.Equal(signature, s.signature(sessionId)) {
+		return "", ErrInvalidToken
+	}
+	return sessionId, nil
+}
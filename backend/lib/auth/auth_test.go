@@ -0,0 +1,101 @@
+package auth_test
+
+import (
+	"context"
+	"errors"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/bongofriend/bookplayer/backend/lib/auth"
+	"github.com/bongofriend/bookplayer/backend/lib/config"
+	"github.com/bongofriend/bookplayer/backend/lib/data/repo"
+)
+
+func prepareService(t *testing.T, sessionLifetime time.Duration) *auth.Service {
+	tmpDir := t.TempDir()
+	testConfig := config.Config{
+		ApplicationDirectory: tmpDir,
+		Database: config.DatabaseConfig{
+			Path:   path.Join(tmpDir, "test.db"),
+			Driver: "sqlite3",
+		},
+		Auth: config.AuthConfig{
+			SessionLifetime: sessionLifetime,
+		},
+	}
+	if err := repo.ApplyDatabaseMigrations(testConfig.Database); err != nil {
+		t.Fatal(err)
+	}
+	client, err := repo.NewDbClient(testConfig.Database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	service, err := auth.NewService(testConfig, repo.NewUserRepository(client))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return service
+}
+
+func TestAuthService(t *testing.T) {
+	t.Run("should authenticate issued token", func(t *testing.T) {
+		service := prepareService(t, time.Hour)
+		ctx := context.Background()
+		if _, err := service.CreateUser(ctx, "listener", "password123", false); err != nil {
+			t.Fatal(err)
+		}
+		login, err := service.Login(ctx, "listener", "password123")
+		if err != nil {
+			t.Fatal(err)
+		}
+		user, err := service.Authenticate(ctx, login.Token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.Username != "listener" {
+			t.Fatalf("Expected user %s; received: %s", "listener", user.Username)
+		}
+	})
+	t.Run("should reject tampered token", func(t *testing.T) {
+		service := prepareService(t, time.Hour)
+		ctx := context.Background()
+		if _, err := service.CreateUser(ctx, "listener", "password123", false); err != nil {
+			t.Fatal(err)
+		}
+		login, err := service.Login(ctx, "listener", "password123")
+		if err != nil {
+			t.Fatal(err)
+		}
+		tampered := "0" + login.Token[1:]
+		if tampered == login.Token {
+			tampered = "1" + login.Token[1:]
+		}
+		for _, token := range []string{tampered, "not-a-token", ""} {
+			if _, err := service.Authenticate(ctx, token); !errors.Is(err, auth.ErrInvalidToken) {
+				t.Fatalf("Expected ErrInvalidToken for %q; received: %v", token, err)
+			}
+		}
+	})
+	t.Run("should reject expired token", func(t *testing.T) {
+		service := prepareService(t, -time.Minute)
+		ctx := context.Background()
+		if _, err := service.CreateUser(ctx, "listener", "password123", false); err != nil {
+			t.Fatal(err)
+		}
+		login, err := service.Login(ctx, "listener", "password123")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := service.Authenticate(ctx, login.Token); !errors.Is(err, auth.ErrInvalidToken) {
+			t.Fatalf("Expected ErrInvalidToken; received: %v", err)
+		}
+	})
+	t.Run("should reject weak passwords", func(t *testing.T) {
+		service := prepareService(t, time.Hour)
+		if _, err := service.CreateUser(context.Background(), "listener", "short", false); !errors.Is(err, auth.ErrInvalidUser) {
+			t.Fatalf("Expected ErrInvalidUser; received: %v", err)
+		}
+	})
+}
@@ -7,20 +7,149 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"runtime"
+	"slices"
+	"strings"
 	"time"
 )
 
 const (
 	processedAudiobookFolder = "processed_audiobook"
+	transcodedChapterFolder  = "transcoded"
+	defaultSessionLifetime   = 30 * 24 * time.Hour
+	defaultWatchDebounce     = 5 * time.Second
+	defaultMissingGrace      = 7 * 24 * time.Hour
+	defaultMaxAttempts       = 5
+	defaultRetryBackoff      = time.Minute
+	defaultLoudnessTarget    = -18
+	defaultSilenceThreshold  = -40
+	defaultMinSilence        = 2 * time.Second
+	defaultChapterLength     = 20 * time.Minute
+	// Audiobooks queued in front of a stage unless configured otherwise
+	DefaultStageBufferSize = 32
+)
+
+// Codecs chapters can be transcoded to
+const (
+	CodecOpus = "opus"
+	CodecMp3  = "mp3"
+	CodecAac  = "aac"
+)
+
+// Containers allowed for each codec; the first one is used unless configured otherwise
+var codecContainers = map[string][]string{
+	CodecOpus: {"ogg"},
+	CodecMp3:  {"mp3"},
+	CodecAac:  {"m4a", "aac"},
+}
+
+// What is done with the measured loudness of an audiobook
+type LoudnessMode string
+
+const (
+	// Only store the gain for players to apply, leaving chapter files untouched
+	LoudnessModeGain LoudnessMode = "gain"
+	// Apply the gain to the chapter files, which re-encodes them
+	LoudnessModeNormalize LoudnessMode = "normalize"
+)
+
+// How DirectoryWatcher notices changes in AudiobookDirectory
+type WatchMode string
+
+const (
+	// Scan the whole library every ScanInterval
+	WatchModePoll WatchMode = "poll"
+	// React to filesystem events; falls back to polling where those are not available, e.g. on network filesystems
+	WatchModeInotify WatchMode = "inotify"
 )
 
 type Config struct {
 	Port                   int
 	AudiobookDirectory     string
 	ProcessedAudiobookPath string
+	TranscodedChapterPath  string
 	ScanInterval           time.Duration
-	ApplicationDirectory   string
-	Database               DatabaseConfig
+	WatchMode              WatchMode
+	// Time without changes before a file is considered completely copied
+	WatchDebounce time.Duration
+	// Time an audiobook is kept after its source disappeared from AudiobookDirectory
+	MissingGracePeriod time.Duration
+	// Processing attempts before a failing audiobook is quarantined; retries wait RetryBackoff, doubled after every attempt
+	MaxAttempts          int
+	RetryBackoff         time.Duration
+	ApplicationDirectory string
+	Database             DatabaseConfig
+	Auth                 AuthConfig
+	Pipeline             PipelineConfig
+	Transcoding          TranscodingConfig
+	Loudness             LoudnessConfig
+	ChapterDetection     ChapterDetectionConfig
+	// Allow writing edited tags and chapters back into single file sources; off by default as it modifies the library
+	WriteBackMetadata bool
+}
+
+// Concurrency of the processing stages; scanning and storing audiobooks always happen one at a time
+type PipelineConfig struct {
+	Metadata StageConfig `json:"metadata"`
+	Chapters StageConfig `json:"chapters"`
+	Covers   StageConfig `json:"covers"`
+	Loudness StageConfig `json:"loudness"`
+}
+
+type StageConfig struct {
+	// Audiobooks processed at the same time
+	Workers int `json:"workers"`
+	// Audiobooks waiting for a free worker before earlier stages are held up
+	BufferSize int `json:"bufferSize"`
+	// Leave out the stage; only optional stages like cover extraction can be disabled
+	Disabled bool `json:"disabled"`
+}
+
+// Formats for clients that cannot play chapters in the container of their source
+type TranscodingConfig struct {
+	Profiles []TranscodingProfile `json:"profiles"`
+}
+
+type TranscodingProfile struct {
+	// Requested by clients as profile query parameter of the stream endpoint
+	Name  string `json:"name"`
+	Codec string `json:"codec"`
+	// Defaults to the usual container of Codec, e.g. ogg for opus
+	Container string `json:"container"`
+	// In kbit/s; left to the encoder if 0, like Channels and SampleRate
+	Bitrate    int `json:"bitrate"`
+	Channels   int `json:"channels"`
+	SampleRate int `json:"sampleRate"`
+	// Transcode chapters right after splitting instead of on their first request
+	Pretranscode bool `json:"pretranscode"`
+}
+
+// Measurement of the integrated loudness of audiobooks so they play at a similar volume; off unless Enabled
+type LoudnessConfig struct {
+	Enabled bool `json:"enabled"`
+	// Defaults to LoudnessModeGain
+	Mode LoudnessMode `json:"mode"`
+	// Integrated loudness in LUFS the gain aims for; defaults to -18
+	TargetLufs float64 `json:"targetLufs"`
+}
+
+// Chapters proposed at long silences for single files without chapter markers
+type ChapterDetectionConfig struct {
+	// Keep files without chapter markers as a single chapter
+	Disabled bool
+	// Volume in dB below which audio counts as silence
+	SilenceThreshold float64
+	// Shortest silence a chapter may start after
+	MinSilence time.Duration
+	// Length chapters aim for; boundaries are placed at the silences closest to it
+	TargetChapterLength time.Duration
+}
+
+type intermediateChapterDetectionConfig struct {
+	Disabled            bool           `json:"disabled"`
+	SilenceThreshold    float64        `json:"silenceThreshold"`
+	MinSilence          configDuration `json:"minSilence"`
+	TargetChapterLength configDuration `json:"targetChapterLength"`
 }
 
 type DatabaseConfig struct {
@@ -29,12 +158,34 @@ type DatabaseConfig struct {
 	Driver     string `json:"driver"`
 }
 
+type AuthConfig struct {
+	// Key for signing session tokens; generated and stored in ApplicationDirectory if empty
+	SessionSecret   string
+	SessionLifetime time.Duration
+}
+
+type intermediateAuthConfig struct {
+	SessionSecret   string         `json:"sessionSecret"`
+	SessionLifetime configDuration `json:"sessionLifetime"`
+}
+
 type intermediateConfig struct {
-	Port                 int            `json:"port"`
-	AudiobookDirectory   string         `json:"audiobookDirectory"`
-	ScanInterval         configDuration `json:"scanInterval"`
-	ApplicationDirectory string         `json:"applicationDirectory"`
-	Database             DatabaseConfig `json:"database"`
+	Port                 int                                `json:"port"`
+	AudiobookDirectory   string                             `json:"audiobookDirectory"`
+	ScanInterval         configDuration                     `json:"scanInterval"`
+	WatchMode            WatchMode                          `json:"watchMode"`
+	WatchDebounce        configDuration                     `json:"watchDebounce"`
+	MissingGracePeriod   configDuration                     `json:"missingGracePeriod"`
+	MaxAttempts          int                                `json:"maxAttempts"`
+	RetryBackoff         configDuration                     `json:"retryBackoff"`
+	ApplicationDirectory string                             `json:"applicationDirectory"`
+	Database             DatabaseConfig                     `json:"database"`
+	Auth                 intermediateAuthConfig             `json:"auth"`
+	Pipeline             PipelineConfig                     `json:"pipeline"`
+	Transcoding          TranscodingConfig                  `json:"transcoding"`
+	Loudness             LoudnessConfig                     `json:"loudness"`
+	ChapterDetection     intermediateChapterDetectionConfig `json:"chapterDetection"`
+	WriteBackMetadata    bool                               `json:"writeBackMetadata"`
 }
 
 type configDuration time.Duration
@@ -74,14 +225,124 @@ func ParseConfig(configFilePath string) (*Config, error) {
 		Port:                   intermediateConfig.Port,
 		AudiobookDirectory:     intermediateConfig.AudiobookDirectory,
 		ProcessedAudiobookPath: path.Join(intermediateConfig.ApplicationDirectory, processedAudiobookFolder),
+		TranscodedChapterPath:  path.Join(intermediateConfig.ApplicationDirectory, transcodedChapterFolder),
 		ScanInterval:           time.Duration(intermediateConfig.ScanInterval),
+		WatchMode:              intermediateConfig.WatchMode,
+		WatchDebounce:          time.Duration(intermediateConfig.WatchDebounce),
+		MissingGracePeriod:     time.Duration(intermediateConfig.MissingGracePeriod),
+		MaxAttempts:            intermediateConfig.MaxAttempts,
+		RetryBackoff:           time.Duration(intermediateConfig.RetryBackoff),
 		ApplicationDirectory:   intermediateConfig.ApplicationDirectory,
 		Database:               intermediateConfig.Database,
+		Auth: AuthConfig{
+			SessionSecret:   intermediateConfig.Auth.SessionSecret,
+			SessionLifetime: time.Duration(intermediateConfig.Auth.SessionLifetime),
+		},
+		Pipeline:    intermediateConfig.Pipeline,
+		Transcoding: intermediateConfig.Transcoding,
+		Loudness:    intermediateConfig.Loudness,
+		ChapterDetection: ChapterDetectionConfig{
+			Disabled:            intermediateConfig.ChapterDetection.Disabled,
+			SilenceThreshold:    intermediateConfig.ChapterDetection.SilenceThreshold,
+			MinSilence:          time.Duration(intermediateConfig.ChapterDetection.MinSilence),
+			TargetChapterLength: time.Duration(intermediateConfig.ChapterDetection.TargetChapterLength),
+		},
+		WriteBackMetadata: intermediateConfig.WriteBackMetadata,
+	}
+	if config.Auth.SessionLifetime <= 0 {
+		config.Auth.SessionLifetime = defaultSessionLifetime
+	}
+	switch config.WatchMode {
+	case "":
+		config.WatchMode = WatchModePoll
+	case WatchModePoll, WatchModeInotify:
+	default:
+		return nil, fmt.Errorf("unknown watch mode %s", config.WatchMode)
+	}
+	if config.WatchDebounce <= 0 {
+		config.WatchDebounce = defaultWatchDebounce
+	}
+	if config.MissingGracePeriod <= 0 {
+		config.MissingGracePeriod = defaultMissingGrace
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = defaultMaxAttempts
+	}
+	if config.RetryBackoff <= 0 {
+		config.RetryBackoff = defaultRetryBackoff
+	}
+	names := map[string]bool{}
+	for idx := range config.Transcoding.Profiles {
+		profile := &config.Transcoding.Profiles[idx]
+		if err := profile.validate(); err != nil {
+			return nil, err
+		}
+		if names[profile.Name] {
+			return nil, fmt.Errorf("transcoding profile %s is configured more than once", profile.Name)
+		}
+		names[profile.Name] = true
+	}
+	switch config.Loudness.Mode {
+	case "":
+		config.Loudness.Mode = LoudnessModeGain
+	case LoudnessModeGain, LoudnessModeNormalize:
+	default:
+		return nil, fmt.Errorf("unknown loudness mode %s", config.Loudness.Mode)
+	}
+	if config.Loudness.TargetLufs == 0 {
+		config.Loudness.TargetLufs = defaultLoudnessTarget
+	} else if config.Loudness.TargetLufs < -70 || config.Loudness.TargetLufs > -5 {
+		return nil, fmt.Errorf("loudness target %g LUFS is out of range", config.Loudness.TargetLufs)
+	}
+	if config.ChapterDetection.SilenceThreshold == 0 {
+		config.ChapterDetection.SilenceThreshold = defaultSilenceThreshold
+	} else if config.ChapterDetection.SilenceThreshold > 0 {
+		return nil, fmt.Errorf("silence threshold %g dB has to be negative", config.ChapterDetection.SilenceThreshold)
 	}
+	if config.ChapterDetection.MinSilence <= 0 {
+		config.ChapterDetection.MinSilence = defaultMinSilence
+	}
+	if config.ChapterDetection.TargetChapterLength <= 0 {
+		config.ChapterDetection.TargetChapterLength = defaultChapterLength
+	}
+	// Splitting chapters and measuring loudness run ffmpeg, which already makes use of more than one core
+	config.Pipeline.Metadata.withDefaults(runtime.NumCPU())
+	config.Pipeline.Chapters.withDefaults(max(runtime.NumCPU()/2, 1))
+	config.Pipeline.Covers.withDefaults(runtime.NumCPU())
+	config.Pipeline.Loudness.withDefaults(max(runtime.NumCPU()/2, 1))
 
 	return &config, nil
 }
 
+func (s *StageConfig) withDefaults(workers int) {
+	if s.Workers <= 0 {
+		s.Workers = workers
+	}
+	if s.BufferSize <= 0 {
+		s.BufferSize = DefaultStageBufferSize
+	}
+}
+
+// Check profile and fill in the default container of its codec
+func (p *TranscodingProfile) validate() error {
+	if len(p.Name) == 0 || strings.ContainsAny(p.Name, `/\.`) {
+		return fmt.Errorf("invalid transcoding profile name %q", p.Name)
+	}
+	containers, ok := codecContainers[p.Codec]
+	if !ok {
+		return fmt.Errorf("unknown codec %s of transcoding profile %s", p.Codec, p.Name)
+	}
+	if len(p.Container) == 0 {
+		p.Container = containers[0]
+	} else if !slices.Contains(containers, p.Container) {
+		return fmt.Errorf("container %s of transcoding profile %s does not support %s", p.Container, p.Name, p.Codec)
+	}
+	if p.Bitrate < 0 || p.Channels < 0 || p.SampleRate < 0 {
+		return fmt.Errorf("invalid audio settings of transcoding profile %s", p.Name)
+	}
+	return nil
+}
+
 func GetEnvPathFromFlags() (string, error) {
 	var configPath string
 	flag.StringVar(&configPath, "configPath", "", "Path to environment configuration file")
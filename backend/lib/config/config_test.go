@@ -1,7 +1,10 @@
 package config_test
 
 import (
+	"os"
+	"path"
 	"testing"
+	"time"
 
 	"github.com/bongofriend/bookplayer/backend/lib/config"
 )
@@ -17,3 +20,100 @@ func TestConfig(t *testing.T) {
 		t.Fatalf("Config at %s could not be parsed", testConfigFilePath)
 	}
 }
+
+func TestConfigWatchMode(t *testing.T) {
+	writeConfig := func(t *testing.T, content string) string {
+		p := path.Join(t.TempDir(), "config.json")
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	t.Run("should default to polling", func(t *testing.T) {
+		c, err := config.ParseConfig(writeConfig(t, `{"scanInterval": "5s"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.WatchMode != config.WatchModePoll || c.WatchDebounce <= 0 {
+			t.Fatalf("Unexpected watch mode %s with debounce %s", c.WatchMode, c.WatchDebounce)
+		}
+		if c.MissingGracePeriod <= 0 {
+			t.Fatalf("Unexpected grace period %s", c.MissingGracePeriod)
+		}
+		if c.MaxAttempts <= 0 || c.RetryBackoff <= 0 {
+			t.Fatalf("Unexpected retry policy of %d attempts with backoff %s", c.MaxAttempts, c.RetryBackoff)
+		}
+		for _, stage := range []config.StageConfig{c.Pipeline.Metadata, c.Pipeline.Chapters, c.Pipeline.Covers, c.Pipeline.Loudness} {
+			if stage.Workers <= 0 || stage.BufferSize <= 0 {
+				t.Fatalf("Unexpected stage concurrency %+v", stage)
+			}
+		}
+	})
+	t.Run("should keep configured stage concurrency", func(t *testing.T) {
+		c, err := config.ParseConfig(writeConfig(t, `{"pipeline": {"chapters": {"workers": 3, "bufferSize": 8}}}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.Pipeline.Chapters.Workers != 3 || c.Pipeline.Chapters.BufferSize != 8 {
+			t.Fatalf("Unexpected chapter stage concurrency %+v", c.Pipeline.Chapters)
+		}
+	})
+	t.Run("should default container of transcoding profile", func(t *testing.T) {
+		c, err := config.ParseConfig(writeConfig(t, `{"transcoding": {"profiles": [{"name": "car", "codec": "mp3", "bitrate": 64}, {"name": "adts", "codec": "aac", "container": "aac"}]}}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if profiles := c.Transcoding.Profiles; len(profiles) != 2 || profiles[0].Container != "mp3" || profiles[1].Container != "aac" {
+			t.Fatalf("Unexpected transcoding profiles %+v", profiles)
+		}
+	})
+	t.Run("should reject invalid transcoding profiles", func(t *testing.T) {
+		for _, profiles := range []string{
+			`[{"name": "car", "codec": "vorbis"}]`,
+			`[{"name": "car", "codec": "opus", "container": "m4a"}]`,
+			`[{"name": "../car", "codec": "mp3"}]`,
+			`[{"name": "car", "codec": "mp3"}, {"name": "car", "codec": "opus"}]`,
+		} {
+			if _, err := config.ParseConfig(writeConfig(t, `{"transcoding": {"profiles": `+profiles+`}}`)); err == nil {
+				t.Fatalf("Expected error for %s", profiles)
+			}
+		}
+	})
+	t.Run("should default loudness settings", func(t *testing.T) {
+		c, err := config.ParseConfig(writeConfig(t, `{"loudness": {"enabled": true}}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !c.Loudness.Enabled || c.Loudness.Mode != config.LoudnessModeGain || c.Loudness.TargetLufs != -18 {
+			t.Fatalf("Unexpected loudness settings %+v", c.Loudness)
+		}
+	})
+	t.Run("should reject invalid loudness settings", func(t *testing.T) {
+		for _, loudness := range []string{
+			`{"mode": "replaygain"}`,
+			`{"targetLufs": 3}`,
+		} {
+			if _, err := config.ParseConfig(writeConfig(t, `{"loudness": `+loudness+`}`)); err == nil {
+				t.Fatalf("Expected error for %s", loudness)
+			}
+		}
+	})
+	t.Run("should default chapter detection settings", func(t *testing.T) {
+		c, err := config.ParseConfig(writeConfig(t, `{"chapterDetection": {"minSilence": "3s"}}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		detection := c.ChapterDetection
+		if detection.Disabled || detection.SilenceThreshold >= 0 || detection.MinSilence != 3*time.Second || detection.TargetChapterLength <= 0 {
+			t.Fatalf("Unexpected chapter detection settings %+v", detection)
+		}
+		if _, err := config.ParseConfig(writeConfig(t, `{"chapterDetection": {"silenceThreshold": 10}}`)); err == nil {
+			t.Fatal("Expected error for positive silence threshold")
+		}
+	})
+	t.Run("should reject unknown watch mode", func(t *testing.T) {
+		if _, err := config.ParseConfig(writeConfig(t, `{"watchMode": "fanotify"}`)); err == nil {
+			t.Fatal("Expected error for unknown watch mode")
+		}
+	})
+}
@@ -4,6 +4,10 @@
 
 package datasource
 
+import (
+	"database/sql"
+)
+
 type Audiobook struct {
 	ID           int64
 	Title        string
@@ -11,17 +15,156 @@ type Audiobook struct {
 	Narrator     string
 	Description  string
 	Duration     int64
-	DirPath      string
+	RelativePath string
 	ChapterCount int64
 	Genre        string
+	MissingSince sql.NullInt64
+}
+
+type AudiobookAuthor struct {
+	AudiobookID int64
+	PersonID    int64
+	Position    int64
+}
+
+type AudiobookGenre struct {
+	AudiobookID int64
+	GenreID     int64
+}
+
+type AudiobookImage struct {
+	AudiobookID int64
+	Kind        string
+	FilePath    string
+	ContentType string
+	Width       int64
+	Height      int64
+}
+
+type AudiobookLoudness struct {
+	AudiobookID    int64
+	IntegratedLufs float64
+	TruePeak       float64
+	Gain           float64
+	Normalized     bool
+}
+
+type AudiobookOverride struct {
+	AudiobookID    int64
+	Title          sql.NullString
+	Authors        sql.NullString
+	Narrators      sql.NullString
+	Description    sql.NullString
+	Genres         sql.NullString
+	Series         sql.NullString
+	SeriesPosition sql.NullString
+}
+
+type AudiobookNarrator struct {
+	AudiobookID int64
+	PersonID    int64
+	Position    int64
+}
+
+type AudiobookSeries struct {
+	AudiobookID int64
+	SeriesID    int64
+	Position    string
+}
+
+type Bookmark struct {
+	ID               int64
+	UserID           int64
+	AudiobookID      int64
+	ChapterNumbering int64
+	OffsetSeconds    float64
+	Name             string
+	Note             string
+	CreatedAt        int64
+	UpdatedAt        int64
 }
 
 type Chapter struct {
-	ID          int64
+	ID           int64
+	AudiobookID  int64
+	Numbering    int64
+	Title        string
+	StartTime    float64
+	EndTime      float64
+	FilePath     string
+	AutoDetected bool
+}
+
+type ChapterOverride struct {
 	AudiobookID int64
 	Numbering   int64
-	Title       string
-	StartTime   float64
-	EndTime     float64
-	FilePath    string
+	Title       sql.NullString
+	EndTime     sql.NullFloat64
+}
+
+type Genre struct {
+	ID   int64
+	Name string
+}
+
+type Person struct {
+	ID   int64
+	Name string
+}
+
+type Job struct {
+	ID         int64
+	SourcePath string
+	ContentKey string
+	Stage      string
+	State      string
+	Results    string
+	Error      string
+	CreatedAt  int64
+	UpdatedAt  int64
+}
+
+type PlaybackProgress struct {
+	UserID           int64
+	AudiobookID      int64
+	ChapterNumbering int64
+	OffsetSeconds    float64
+	Finished         bool
+	UpdatedAt        int64
+}
+
+type Series struct {
+	ID   int64
+	Name string
+}
+
+type Session struct {
+	ID        string
+	UserID    int64
+	CreatedAt int64
+	ExpiresAt int64
+}
+
+type SourceFile struct {
+	ID          int64
+	Path        string
+	SourcePath  string
+	Size        int64
+	ModTime     int64
+	Hash        string
+	AudiobookID sql.NullInt64
+	Status      string
+	LastError   string
+	UpdatedAt   int64
+	Attempts    int64
+	FailedStage string
+	RetryAt     sql.NullInt64
+}
+
+type User struct {
+	ID           int64
+	Username     string
+	PasswordHash string
+	IsAdmin      bool
+	CreatedAt    int64
 }
@@ -10,8 +10,271 @@ import (
 	"database/sql"
 )
 
+const advanceJob = `-- name: AdvanceJob :execrows
+Update Job Set stage = ?, state = ?, results = ?, updated_at = ? Where source_path = ? And state = ?
+`
+
+type AdvanceJobParams struct {
+	Stage      string
+	State      string
+	Results    string
+	UpdatedAt  int64
+	SourcePath string
+	State_2    string
+}
+
+func (q *Queries) AdvanceJob(ctx context.Context, arg AdvanceJobParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, advanceJob,
+		arg.Stage,
+		arg.State,
+		arg.Results,
+		arg.UpdatedAt,
+		arg.SourcePath,
+		arg.State_2,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const countAudiobooks = `-- name: CountAudiobooks :one
+Select Count(*)
+From Audiobook a
+`
+
+func (q *Queries) CountAudiobooks(ctx context.Context) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countAudiobooks)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countSearchAudiobooks = `-- name: CountSearchAudiobooks :one
+Select Count(*) From AudiobookSearch
+Where AudiobookSearch Match ?
+`
+
+func (q *Queries) CountSearchAudiobooks(ctx context.Context, match string) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countSearchAudiobooks, match)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countUsers = `-- name: CountUsers :one
+Select Count(*)
+From User u
+`
+
+func (q *Queries) CountUsers(ctx context.Context) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countUsers)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const deleteAudiobook = `-- name: DeleteAudiobook :exec
+Delete From Audiobook Where id = ?
+`
+
+func (q *Queries) DeleteAudiobook(ctx context.Context, id int64) error {
+	_, err := q.db.ExecContext(ctx, deleteAudiobook, id)
+	return err
+}
+
+const deleteAudiobookAuthors = `-- name: DeleteAudiobookAuthors :exec
+Delete From AudiobookAuthor Where audiobook_id = ?
+`
+
+func (q *Queries) DeleteAudiobookAuthors(ctx context.Context, audiobookID int64) error {
+	_, err := q.db.ExecContext(ctx, deleteAudiobookAuthors, audiobookID)
+	return err
+}
+
+const deleteAudiobookChapters = `-- name: DeleteAudiobookChapters :exec
+Delete From Chapter Where audiobook_id = ?
+`
+
+func (q *Queries) DeleteAudiobookChapters(ctx context.Context, audiobookID int64) error {
+	_, err := q.db.ExecContext(ctx, deleteAudiobookChapters, audiobookID)
+	return err
+}
+
+const deleteAudiobookGenres = `-- name: DeleteAudiobookGenres :exec
+Delete From AudiobookGenre Where audiobook_id = ?
+`
+
+func (q *Queries) DeleteAudiobookGenres(ctx context.Context, audiobookID int64) error {
+	_, err := q.db.ExecContext(ctx, deleteAudiobookGenres, audiobookID)
+	return err
+}
+
+const deleteAudiobookImages = `-- name: DeleteAudiobookImages :exec
+Delete From AudiobookImage Where audiobook_id = ?
+`
+
+func (q *Queries) DeleteAudiobookImages(ctx context.Context, audiobookID int64) error {
+	_, err := q.db.ExecContext(ctx, deleteAudiobookImages, audiobookID)
+	return err
+}
+
+const deleteAudiobookJobs = `-- name: DeleteAudiobookJobs :exec
+Delete From Job Where source_path In (Select source_path From SourceFile Where audiobook_id = ?)
+`
+
+func (q *Queries) DeleteAudiobookJobs(ctx context.Context, audiobookID sql.NullInt64) error {
+	_, err := q.db.ExecContext(ctx, deleteAudiobookJobs, audiobookID)
+	return err
+}
+
+const deleteAudiobookLoudness = `-- name: DeleteAudiobookLoudness :exec
+Delete From AudiobookLoudness Where audiobook_id = ?
+`
+
+func (q *Queries) DeleteAudiobookLoudness(ctx context.Context, audiobookID int64) error {
+	_, err := q.db.ExecContext(ctx, deleteAudiobookLoudness, audiobookID)
+	return err
+}
+
+const deleteAudiobookNarrators = `-- name: DeleteAudiobookNarrators :exec
+Delete From AudiobookNarrator Where audiobook_id = ?
+`
+
+func (q *Queries) DeleteAudiobookNarrators(ctx context.Context, audiobookID int64) error {
+	_, err := q.db.ExecContext(ctx, deleteAudiobookNarrators, audiobookID)
+	return err
+}
+
+const deleteAudiobookOverride = `-- name: DeleteAudiobookOverride :exec
+Delete From AudiobookOverride Where audiobook_id = ?
+`
+
+func (q *Queries) DeleteAudiobookOverride(ctx context.Context, audiobookID int64) error {
+	_, err := q.db.ExecContext(ctx, deleteAudiobookOverride, audiobookID)
+	return err
+}
+
+const deleteAudiobookSeries = `-- name: DeleteAudiobookSeries :exec
+Delete From AudiobookSeries Where audiobook_id = ?
+`
+
+func (q *Queries) DeleteAudiobookSeries(ctx context.Context, audiobookID int64) error {
+	_, err := q.db.ExecContext(ctx, deleteAudiobookSeries, audiobookID)
+	return err
+}
+
+const deleteAudiobookSourceFiles = `-- name: DeleteAudiobookSourceFiles :exec
+Delete From SourceFile Where audiobook_id = ?
+`
+
+func (q *Queries) DeleteAudiobookSourceFiles(ctx context.Context, audiobookID sql.NullInt64) error {
+	_, err := q.db.ExecContext(ctx, deleteAudiobookSourceFiles, audiobookID)
+	return err
+}
+
+const deleteBookmark = `-- name: DeleteBookmark :execrows
+Delete From Bookmark
+Where id = ? And user_id = ?
+`
+
+type DeleteBookmarkParams struct {
+	ID     int64
+	UserID int64
+}
+
+func (q *Queries) DeleteBookmark(ctx context.Context, arg DeleteBookmarkParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteBookmark, arg.ID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteChapterOverrides = `-- name: DeleteChapterOverrides :exec
+Delete From ChapterOverride Where audiobook_id = ?
+`
+
+func (q *Queries) DeleteChapterOverrides(ctx context.Context, audiobookID int64) error {
+	_, err := q.db.ExecContext(ctx, deleteChapterOverrides, audiobookID)
+	return err
+}
+
+const deleteExpiredSessions = `-- name: DeleteExpiredSessions :exec
+Delete From Session
+Where expires_at <= ?
+`
+
+func (q *Queries) DeleteExpiredSessions(ctx context.Context, expiresAt int64) error {
+	_, err := q.db.ExecContext(ctx, deleteExpiredSessions, expiresAt)
+	return err
+}
+
+const deleteJobBySource = `-- name: DeleteJobBySource :exec
+Delete From Job Where source_path = ?
+`
+
+func (q *Queries) DeleteJobBySource(ctx context.Context, sourcePath string) error {
+	_, err := q.db.ExecContext(ctx, deleteJobBySource, sourcePath)
+	return err
+}
+
+const deleteSession = `-- name: DeleteSession :exec
+Delete From Session
+Where id = ?
+`
+
+func (q *Queries) DeleteSession(ctx context.Context, id string) error {
+	_, err := q.db.ExecContext(ctx, deleteSession, id)
+	return err
+}
+
+const deleteSourceFile = `-- name: DeleteSourceFile :exec
+Delete From SourceFile Where path = ?
+`
+
+func (q *Queries) DeleteSourceFile(ctx context.Context, path string) error {
+	_, err := q.db.ExecContext(ctx, deleteSourceFile, path)
+	return err
+}
+
+const deleteSourceFilesBySource = `-- name: DeleteSourceFilesBySource :exec
+Delete From SourceFile Where source_path = ?
+`
+
+func (q *Queries) DeleteSourceFilesBySource(ctx context.Context, sourcePath string) error {
+	_, err := q.db.ExecContext(ctx, deleteSourceFilesBySource, sourcePath)
+	return err
+}
+
+const failJob = `-- name: FailJob :execrows
+Update Job Set state = ?, error = ?, updated_at = ? Where source_path = ? And state = ?
+`
+
+type FailJobParams struct {
+	State      string
+	Error      string
+	UpdatedAt  int64
+	SourcePath string
+	State_2    string
+}
+
+func (q *Queries) FailJob(ctx context.Context, arg FailJobParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, failJob,
+		arg.State,
+		arg.Error,
+		arg.UpdatedAt,
+		arg.SourcePath,
+		arg.State_2,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const getAllAudiobooks = `-- name: GetAllAudiobooks :many
-Select id, title, author, narrator, description, duration, dir_path, chapter_count, genre
+Select id, title, author, narrator, description, duration, relative_path, chapter_count, genre, missing_since
 From Audiobook a
 `
 
@@ -31,9 +294,51 @@ func (q *Queries) GetAllAudiobooks(ctx context.Context) ([]Audiobook, error) {
 			&i.Narrator,
 			&i.Description,
 			&i.Duration,
-			&i.DirPath,
+			&i.RelativePath,
 			&i.ChapterCount,
 			&i.Genre,
+			&i.MissingSince,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getAllSourceFiles = `-- name: GetAllSourceFiles :many
+Select id, path, source_path, size, mod_time, hash, audiobook_id, status, last_error, updated_at, attempts, failed_stage, retry_at From SourceFile Order By source_path, path
+`
+
+func (q *Queries) GetAllSourceFiles(ctx context.Context) ([]SourceFile, error) {
+	rows, err := q.db.QueryContext(ctx, getAllSourceFiles)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SourceFile
+	for rows.Next() {
+		var i SourceFile
+		if err := rows.Scan(
+			&i.ID,
+			&i.Path,
+			&i.SourcePath,
+			&i.Size,
+			&i.ModTime,
+			&i.Hash,
+			&i.AudiobookID,
+			&i.Status,
+			&i.LastError,
+			&i.UpdatedAt,
+			&i.Attempts,
+			&i.FailedStage,
+			&i.RetryAt,
 		); err != nil {
 			return nil, err
 		}
@@ -48,48 +353,51 @@ func (q *Queries) GetAllAudiobooks(ctx context.Context) ([]Audiobook, error) {
 	return items, nil
 }
 
-const getAudiobookById = `-- name: GetAudiobookById :many
-Select a.id, a.title, a.author, a.narrator, a.description, a.duration, a.dir_path, a.chapter_count, a.genre, c.id, c.audiobook_id, c.numbering, c.title, c.start_time, c.end_time, c.file_path
+const getAudiobook = `-- name: GetAudiobook :one
+Select id, title, author, narrator, description, duration, relative_path, chapter_count, genre, missing_since
 From Audiobook a
-Join Chapter c On a.id = c.audiobook_id
 Where a.id = ?
 `
 
-type GetAudiobookByIdRow struct {
-	Audiobook Audiobook
-	Chapter   Chapter
+func (q *Queries) GetAudiobook(ctx context.Context, id int64) (Audiobook, error) {
+	row := q.db.QueryRowContext(ctx, getAudiobook, id)
+	var i Audiobook
+	err := row.Scan(
+		&i.ID,
+		&i.Title,
+		&i.Author,
+		&i.Narrator,
+		&i.Description,
+		&i.Duration,
+		&i.RelativePath,
+		&i.ChapterCount,
+		&i.Genre,
+		&i.MissingSince,
+	)
+	return i, err
 }
 
-func (q *Queries) GetAudiobookById(ctx context.Context, id int64) ([]GetAudiobookByIdRow, error) {
-	rows, err := q.db.QueryContext(ctx, getAudiobookById, id)
+const getAudiobookAuthors = `-- name: GetAudiobookAuthors :many
+Select p.name
+From Person p
+Join AudiobookAuthor aa On aa.person_id = p.id
+Where aa.audiobook_id = ?
+Order By aa.position Asc
+`
+
+func (q *Queries) GetAudiobookAuthors(ctx context.Context, audiobookID int64) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, getAudiobookAuthors, audiobookID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []GetAudiobookByIdRow
+	var items []string
 	for rows.Next() {
-		var i GetAudiobookByIdRow
-		if err := rows.Scan(
-			&i.Audiobook.ID,
-			&i.Audiobook.Title,
-			&i.Audiobook.Author,
-			&i.Audiobook.Narrator,
-			&i.Audiobook.Description,
-			&i.Audiobook.Duration,
-			&i.Audiobook.DirPath,
-			&i.Audiobook.ChapterCount,
-			&i.Audiobook.Genre,
-			&i.Chapter.ID,
-			&i.Chapter.AudiobookID,
-			&i.Chapter.Numbering,
-			&i.Chapter.Title,
-			&i.Chapter.StartTime,
-			&i.Chapter.EndTime,
-			&i.Chapter.FilePath,
-		); err != nil {
+		var name string
+		if err := rows.Scan(&name); err != nil {
 			return nil, err
 		}
-		items = append(items, i)
+		items = append(items, name)
 	}
 	if err := rows.Close(); err != nil {
 		return nil, err
@@ -100,8 +408,61 @@ func (q *Queries) GetAudiobookById(ctx context.Context, id int64) ([]GetAudioboo
 	return items, nil
 }
 
+const getAudiobookByRelativePath = `-- name: GetAudiobookByRelativePath :one
+Select id, title, author, narrator, description, duration, relative_path, chapter_count, genre, missing_since
+From Audiobook a
+Where a.relative_path = ?
+Order By a.id Asc
+Limit 1
+`
+
+func (q *Queries) GetAudiobookByRelativePath(ctx context.Context, relativePath string) (Audiobook, error) {
+	row := q.db.QueryRowContext(ctx, getAudiobookByRelativePath, relativePath)
+	var i Audiobook
+	err := row.Scan(
+		&i.ID,
+		&i.Title,
+		&i.Author,
+		&i.Narrator,
+		&i.Description,
+		&i.Duration,
+		&i.RelativePath,
+		&i.ChapterCount,
+		&i.Genre,
+		&i.MissingSince,
+	)
+	return i, err
+}
+
+const getAudiobookChapter = `-- name: GetAudiobookChapter :one
+Select id, audiobook_id, numbering, title, start_time, end_time, file_path, auto_detected
+From Chapter c
+Where c.audiobook_id = ? And c.numbering = ?
+`
+
+type GetAudiobookChapterParams struct {
+	AudiobookID int64
+	Numbering   int64
+}
+
+func (q *Queries) GetAudiobookChapter(ctx context.Context, arg GetAudiobookChapterParams) (Chapter, error) {
+	row := q.db.QueryRowContext(ctx, getAudiobookChapter, arg.AudiobookID, arg.Numbering)
+	var i Chapter
+	err := row.Scan(
+		&i.ID,
+		&i.AudiobookID,
+		&i.Numbering,
+		&i.Title,
+		&i.StartTime,
+		&i.EndTime,
+		&i.FilePath,
+		&i.AutoDetected,
+	)
+	return i, err
+}
+
 const getAudiobookChapters = `-- name: GetAudiobookChapters :many
-Select id, audiobook_id, numbering, title, start_time, end_time, file_path
+Select id, audiobook_id, numbering, title, start_time, end_time, file_path, auto_detected
 From Chapter c
 Where c.audiobook_id = ?
 Order By numbering Asc
@@ -124,6 +485,7 @@ func (q *Queries) GetAudiobookChapters(ctx context.Context, audiobookID int64) (
 			&i.StartTime,
 			&i.EndTime,
 			&i.FilePath,
+			&i.AutoDetected,
 		); err != nil {
 			return nil, err
 		}
@@ -138,55 +500,1751 @@ func (q *Queries) GetAudiobookChapters(ctx context.Context, audiobookID int64) (
 	return items, nil
 }
 
-const insertAudiobook = `-- name: InsertAudiobook :execresult
-Insert Into Audiobook (title, author, narrator, description, duration, dir_path, chapter_count, genre) Values (?, ?, ?, ?, ?, ?, ?, ?)
+const getAudiobookGenres = `-- name: GetAudiobookGenres :many
+Select g.name
+From Genre g
+Join AudiobookGenre ag On ag.genre_id = g.id
+Where ag.audiobook_id = ?
+Order By g.name Asc
 `
 
-type InsertAudiobookParams struct {
-	Title        string
-	Author       string
-	Narrator     string
-	Description  string
-	Duration     int64
-	DirPath      string
-	ChapterCount int64
-	Genre        string
+func (q *Queries) GetAudiobookGenres(ctx context.Context, audiobookID int64) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, getAudiobookGenres, audiobookID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		items = append(items, name)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
 }
 
-func (q *Queries) InsertAudiobook(ctx context.Context, arg InsertAudiobookParams) (sql.Result, error) {
-	return q.db.ExecContext(ctx, insertAudiobook,
-		arg.Title,
-		arg.Author,
-		arg.Narrator,
-		arg.Description,
-		arg.Duration,
-		arg.DirPath,
-		arg.ChapterCount,
-		arg.Genre,
+const getAudiobookImage = `-- name: GetAudiobookImage :one
+Select audiobook_id, kind, file_path, content_type, width, height From AudiobookImage Where audiobook_id = ? And kind = ?
+`
+
+type GetAudiobookImageParams struct {
+	AudiobookID int64
+	Kind        string
+}
+
+func (q *Queries) GetAudiobookImage(ctx context.Context, arg GetAudiobookImageParams) (AudiobookImage, error) {
+	row := q.db.QueryRowContext(ctx, getAudiobookImage, arg.AudiobookID, arg.Kind)
+	var i AudiobookImage
+	err := row.Scan(
+		&i.AudiobookID,
+		&i.Kind,
+		&i.FilePath,
+		&i.ContentType,
+		&i.Width,
+		&i.Height,
 	)
+	return i, err
 }
 
-const insertChapter = `-- name: InsertChapter :exec
-Insert Into Chapter (audiobook_id, title, numbering, start_time, end_time, file_path) Values (?, ?, ?, ?, ?, ?)
+const getAudiobookImages = `-- name: GetAudiobookImages :many
+Select audiobook_id, kind, file_path, content_type, width, height From AudiobookImage Where audiobook_id = ? Order By width Asc
 `
 
-type InsertChapterParams struct {
-	AudiobookID int64
-	Title       string
-	Numbering   int64
-	StartTime   float64
-	EndTime     float64
-	FilePath    string
+func (q *Queries) GetAudiobookImages(ctx context.Context, audiobookID int64) ([]AudiobookImage, error) {
+	rows, err := q.db.QueryContext(ctx, getAudiobookImages, audiobookID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []AudiobookImage
+	for rows.Next() {
+		var i AudiobookImage
+		if err := rows.Scan(
+			&i.AudiobookID,
+			&i.Kind,
+			&i.FilePath,
+			&i.ContentType,
+			&i.Width,
+			&i.Height,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
 }
 
-func (q *Queries) InsertChapter(ctx context.Context, arg InsertChapterParams) error {
-	_, err := q.db.ExecContext(ctx, insertChapter,
-		arg.AudiobookID,
-		arg.Title,
-		arg.Numbering,
-		arg.StartTime,
-		arg.EndTime,
-		arg.FilePath,
+const getAudiobookLoudness = `-- name: GetAudiobookLoudness :one
+Select audiobook_id, integrated_lufs, true_peak, gain, normalized From AudiobookLoudness Where audiobook_id = ?
+`
+
+func (q *Queries) GetAudiobookLoudness(ctx context.Context, audiobookID int64) (AudiobookLoudness, error) {
+	row := q.db.QueryRowContext(ctx, getAudiobookLoudness, audiobookID)
+	var i AudiobookLoudness
+	err := row.Scan(
+		&i.AudiobookID,
+		&i.IntegratedLufs,
+		&i.TruePeak,
+		&i.Gain,
+		&i.Normalized,
+	)
+	return i, err
+}
+
+const getAudiobookNarrators = `-- name: GetAudiobookNarrators :many
+Select p.name
+From Person p
+Join AudiobookNarrator an On an.person_id = p.id
+Where an.audiobook_id = ?
+Order By an.position Asc
+`
+
+func (q *Queries) GetAudiobookNarrators(ctx context.Context, audiobookID int64) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, getAudiobookNarrators, audiobookID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		items = append(items, name)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getAudiobookOverride = `-- name: GetAudiobookOverride :one
+Select audiobook_id, title, authors, narrators, description, genres, series, series_position From AudiobookOverride Where audiobook_id = ?
+`
+
+func (q *Queries) GetAudiobookOverride(ctx context.Context, audiobookID int64) (AudiobookOverride, error) {
+	row := q.db.QueryRowContext(ctx, getAudiobookOverride, audiobookID)
+	var i AudiobookOverride
+	err := row.Scan(
+		&i.AudiobookID,
+		&i.Title,
+		&i.Authors,
+		&i.Narrators,
+		&i.Description,
+		&i.Genres,
+		&i.Series,
+		&i.SeriesPosition,
+	)
+	return i, err
+}
+
+const getAudiobooks = `-- name: GetAudiobooks :many
+Select id, title, author, narrator, description, duration, relative_path, chapter_count, genre, missing_since
+From Audiobook a
+Order By a.title Asc, a.id Asc
+Limit ? Offset ?
+`
+
+type GetAudiobooksParams struct {
+	Limit  int64
+	Offset int64
+}
+
+func (q *Queries) GetAudiobooks(ctx context.Context, arg GetAudiobooksParams) ([]Audiobook, error) {
+	rows, err := q.db.QueryContext(ctx, getAudiobooks, arg.Limit, arg.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Audiobook
+	for rows.Next() {
+		var i Audiobook
+		if err := rows.Scan(
+			&i.ID,
+			&i.Title,
+			&i.Author,
+			&i.Narrator,
+			&i.Description,
+			&i.Duration,
+			&i.RelativePath,
+			&i.ChapterCount,
+			&i.Genre,
+			&i.MissingSince,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getAudiobooksByAuthor = `-- name: GetAudiobooksByAuthor :many
+Select a.id, a.title, a.author, a.narrator, a.description, a.duration, a.relative_path, a.chapter_count, a.genre, a.missing_since
+From Audiobook a
+Join AudiobookAuthor aa On aa.audiobook_id = a.id
+Where aa.person_id = ?
+Order By a.title Asc
+`
+
+func (q *Queries) GetAudiobooksByAuthor(ctx context.Context, personID int64) ([]Audiobook, error) {
+	rows, err := q.db.QueryContext(ctx, getAudiobooksByAuthor, personID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Audiobook
+	for rows.Next() {
+		var i Audiobook
+		if err := rows.Scan(
+			&i.ID,
+			&i.Title,
+			&i.Author,
+			&i.Narrator,
+			&i.Description,
+			&i.Duration,
+			&i.RelativePath,
+			&i.ChapterCount,
+			&i.Genre,
+			&i.MissingSince,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getAudiobooksByNarrator = `-- name: GetAudiobooksByNarrator :many
+Select a.id, a.title, a.author, a.narrator, a.description, a.duration, a.relative_path, a.chapter_count, a.genre, a.missing_since
+From Audiobook a
+Join AudiobookNarrator an On an.audiobook_id = a.id
+Where an.person_id = ?
+Order By a.title Asc
+`
+
+func (q *Queries) GetAudiobooksByNarrator(ctx context.Context, personID int64) ([]Audiobook, error) {
+	rows, err := q.db.QueryContext(ctx, getAudiobooksByNarrator, personID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Audiobook
+	for rows.Next() {
+		var i Audiobook
+		if err := rows.Scan(
+			&i.ID,
+			&i.Title,
+			&i.Author,
+			&i.Narrator,
+			&i.Description,
+			&i.Duration,
+			&i.RelativePath,
+			&i.ChapterCount,
+			&i.Genre,
+			&i.MissingSince,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getAudiobooksBySeries = `-- name: GetAudiobooksBySeries :many
+Select a.id, a.title, a.author, a.narrator, a.description, a.duration, a.relative_path, a.chapter_count, a.genre, a.missing_since
+From Audiobook a
+Join AudiobookSeries aseries On aseries.audiobook_id = a.id
+Where aseries.series_id = ?
+Order By Cast(aseries.position As Real) Asc, a.title Asc
+`
+
+func (q *Queries) GetAudiobooksBySeries(ctx context.Context, seriesID int64) ([]Audiobook, error) {
+	rows, err := q.db.QueryContext(ctx, getAudiobooksBySeries, seriesID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Audiobook
+	for rows.Next() {
+		var i Audiobook
+		if err := rows.Scan(
+			&i.ID,
+			&i.Title,
+			&i.Author,
+			&i.Narrator,
+			&i.Description,
+			&i.Duration,
+			&i.RelativePath,
+			&i.ChapterCount,
+			&i.Genre,
+			&i.MissingSince,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getAudiobookSeries = `-- name: GetAudiobookSeries :many
+Select s.name, aseries.position
+From Series s
+Join AudiobookSeries aseries On aseries.series_id = s.id
+Where aseries.audiobook_id = ?
+Order By s.name Asc
+`
+
+type GetAudiobookSeriesRow struct {
+	Name     string
+	Position string
+}
+
+func (q *Queries) GetAudiobookSeries(ctx context.Context, audiobookID int64) ([]GetAudiobookSeriesRow, error) {
+	rows, err := q.db.QueryContext(ctx, getAudiobookSeries, audiobookID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetAudiobookSeriesRow
+	for rows.Next() {
+		var i GetAudiobookSeriesRow
+		if err := rows.Scan(
+			&i.Name,
+			&i.Position,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getAudiobooksWithAbsolutePath = `-- name: GetAudiobooksWithAbsolutePath :many
+Select id, title, author, narrator, description, duration, relative_path, chapter_count, genre, missing_since
+From Audiobook a
+Where a.relative_path Like '/%'
+Order By a.id Asc
+`
+
+func (q *Queries) GetAudiobooksWithAbsolutePath(ctx context.Context) ([]Audiobook, error) {
+	rows, err := q.db.QueryContext(ctx, getAudiobooksWithAbsolutePath)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Audiobook
+	for rows.Next() {
+		var i Audiobook
+		if err := rows.Scan(
+			&i.ID,
+			&i.Title,
+			&i.Author,
+			&i.Narrator,
+			&i.Description,
+			&i.Duration,
+			&i.RelativePath,
+			&i.ChapterCount,
+			&i.Genre,
+			&i.MissingSince,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getAuthors = `-- name: GetAuthors :many
+Select p.id, p.name, Count(aa.audiobook_id) As audiobook_count
+From Person p
+Join AudiobookAuthor aa On aa.person_id = p.id
+Group By p.id, p.name
+Order By p.name Asc
+`
+
+type GetAuthorsRow struct {
+	ID             int64
+	Name           string
+	AudiobookCount int64
+}
+
+func (q *Queries) GetAuthors(ctx context.Context) ([]GetAuthorsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getAuthors)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetAuthorsRow
+	for rows.Next() {
+		var i GetAuthorsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.AudiobookCount,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getBookmark = `-- name: GetBookmark :one
+Select id, user_id, audiobook_id, chapter_numbering, offset_seconds, name, note, created_at, updated_at
+From Bookmark b
+Where b.id = ? And b.user_id = ?
+`
+
+type GetBookmarkParams struct {
+	ID     int64
+	UserID int64
+}
+
+func (q *Queries) GetBookmark(ctx context.Context, arg GetBookmarkParams) (Bookmark, error) {
+	row := q.db.QueryRowContext(ctx, getBookmark, arg.ID, arg.UserID)
+	var i Bookmark
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.AudiobookID,
+		&i.ChapterNumbering,
+		&i.OffsetSeconds,
+		&i.Name,
+		&i.Note,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const getBookmarks = `-- name: GetBookmarks :many
+Select id, user_id, audiobook_id, chapter_numbering, offset_seconds, name, note, created_at, updated_at
+From Bookmark b
+Where b.user_id = ? And b.audiobook_id = ?
+Order By b.chapter_numbering Asc, b.offset_seconds Asc
+`
+
+type GetBookmarksParams struct {
+	UserID      int64
+	AudiobookID int64
+}
+
+func (q *Queries) GetBookmarks(ctx context.Context, arg GetBookmarksParams) ([]Bookmark, error) {
+	rows, err := q.db.QueryContext(ctx, getBookmarks, arg.UserID, arg.AudiobookID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Bookmark
+	for rows.Next() {
+		var i Bookmark
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.AudiobookID,
+			&i.ChapterNumbering,
+			&i.OffsetSeconds,
+			&i.Name,
+			&i.Note,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChapterOverrides = `-- name: GetChapterOverrides :many
+Select audiobook_id, numbering, title, end_time From ChapterOverride Where audiobook_id = ? Order By numbering Asc
+`
+
+func (q *Queries) GetChapterOverrides(ctx context.Context, audiobookID int64) ([]ChapterOverride, error) {
+	rows, err := q.db.QueryContext(ctx, getChapterOverrides, audiobookID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ChapterOverride
+	for rows.Next() {
+		var i ChapterOverride
+		if err := rows.Scan(
+			&i.AudiobookID,
+			&i.Numbering,
+			&i.Title,
+			&i.EndTime,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getJob = `-- name: GetJob :one
+Select id, source_path, content_key, stage, state, results, error, created_at, updated_at From Job Where id = ?
+`
+
+func (q *Queries) GetJob(ctx context.Context, id int64) (Job, error) {
+	row := q.db.QueryRowContext(ctx, getJob, id)
+	var i Job
+	err := row.Scan(
+		&i.ID,
+		&i.SourcePath,
+		&i.ContentKey,
+		&i.Stage,
+		&i.State,
+		&i.Results,
+		&i.Error,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const getJobBySource = `-- name: GetJobBySource :one
+Select id, source_path, content_key, stage, state, results, error, created_at, updated_at From Job Where source_path = ?
+`
+
+func (q *Queries) GetJobBySource(ctx context.Context, sourcePath string) (Job, error) {
+	row := q.db.QueryRowContext(ctx, getJobBySource, sourcePath)
+	var i Job
+	err := row.Scan(
+		&i.ID,
+		&i.SourcePath,
+		&i.ContentKey,
+		&i.Stage,
+		&i.State,
+		&i.Results,
+		&i.Error,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const getJobs = `-- name: GetJobs :many
+Select id, source_path, content_key, stage, state, results, error, created_at, updated_at From Job Order By updated_at Desc, id Desc
+`
+
+func (q *Queries) GetJobs(ctx context.Context) ([]Job, error) {
+	rows, err := q.db.QueryContext(ctx, getJobs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Job
+	for rows.Next() {
+		var i Job
+		if err := rows.Scan(
+			&i.ID,
+			&i.SourcePath,
+			&i.ContentKey,
+			&i.Stage,
+			&i.State,
+			&i.Results,
+			&i.Error,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getMissingAudiobooks = `-- name: GetMissingAudiobooks :many
+Select id, title, author, narrator, description, duration, relative_path, chapter_count, genre, missing_since
+From Audiobook a
+Where a.missing_since <= ?
+Order By a.missing_since Asc
+`
+
+func (q *Queries) GetMissingAudiobooks(ctx context.Context, missingSince sql.NullInt64) ([]Audiobook, error) {
+	rows, err := q.db.QueryContext(ctx, getMissingAudiobooks, missingSince)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Audiobook
+	for rows.Next() {
+		var i Audiobook
+		if err := rows.Scan(
+			&i.ID,
+			&i.Title,
+			&i.Author,
+			&i.Narrator,
+			&i.Description,
+			&i.Duration,
+			&i.RelativePath,
+			&i.ChapterCount,
+			&i.Genre,
+			&i.MissingSince,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getNarrators = `-- name: GetNarrators :many
+Select p.id, p.name, Count(an.audiobook_id) As audiobook_count
+From Person p
+Join AudiobookNarrator an On an.person_id = p.id
+Group By p.id, p.name
+Order By p.name Asc
+`
+
+type GetNarratorsRow struct {
+	ID             int64
+	Name           string
+	AudiobookCount int64
+}
+
+func (q *Queries) GetNarrators(ctx context.Context) ([]GetNarratorsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getNarrators)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetNarratorsRow
+	for rows.Next() {
+		var i GetNarratorsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.AudiobookCount,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getNextSourceRetry = `-- name: GetNextSourceRetry :one
+Select retry_at
+From SourceFile
+Where status = ? And retry_at > ?
+Order By retry_at Asc
+Limit 1
+`
+
+type GetNextSourceRetryParams struct {
+	Status  string
+	RetryAt sql.NullInt64
+}
+
+func (q *Queries) GetNextSourceRetry(ctx context.Context, arg GetNextSourceRetryParams) (sql.NullInt64, error) {
+	row := q.db.QueryRowContext(ctx, getNextSourceRetry, arg.Status, arg.RetryAt)
+	var retry_at sql.NullInt64
+	err := row.Scan(&retry_at)
+	return retry_at, err
+}
+
+const getPlaybackProgress = `-- name: GetPlaybackProgress :one
+Select user_id, audiobook_id, chapter_numbering, offset_seconds, finished, updated_at
+From PlaybackProgress p
+Where p.user_id = ? And p.audiobook_id = ?
+`
+
+type GetPlaybackProgressParams struct {
+	UserID      int64
+	AudiobookID int64
+}
+
+func (q *Queries) GetPlaybackProgress(ctx context.Context, arg GetPlaybackProgressParams) (PlaybackProgress, error) {
+	row := q.db.QueryRowContext(ctx, getPlaybackProgress, arg.UserID, arg.AudiobookID)
+	var i PlaybackProgress
+	err := row.Scan(
+		&i.UserID,
+		&i.AudiobookID,
+		&i.ChapterNumbering,
+		&i.OffsetSeconds,
+		&i.Finished,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const getSeries = `-- name: GetSeries :many
+Select s.id, s.name, Count(aseries.audiobook_id) As audiobook_count
+From Series s
+Join AudiobookSeries aseries On aseries.series_id = s.id
+Group By s.id, s.name
+Order By s.name Asc
+`
+
+type GetSeriesRow struct {
+	ID             int64
+	Name           string
+	AudiobookCount int64
+}
+
+func (q *Queries) GetSeries(ctx context.Context) ([]GetSeriesRow, error) {
+	rows, err := q.db.QueryContext(ctx, getSeries)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetSeriesRow
+	for rows.Next() {
+		var i GetSeriesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.AudiobookCount,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getSession = `-- name: GetSession :one
+Select id, user_id, created_at, expires_at
+From Session s
+Where s.id = ?
+`
+
+func (q *Queries) GetSession(ctx context.Context, id string) (Session, error) {
+	row := q.db.QueryRowContext(ctx, getSession, id)
+	var i Session
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.CreatedAt,
+		&i.ExpiresAt,
+	)
+	return i, err
+}
+
+const getSourceFilesByAudiobook = `-- name: GetSourceFilesByAudiobook :many
+Select id, path, source_path, size, mod_time, hash, audiobook_id, status, last_error, updated_at, attempts, failed_stage, retry_at From SourceFile Where audiobook_id = ? Order By path
+`
+
+func (q *Queries) GetSourceFilesByAudiobook(ctx context.Context, audiobookID sql.NullInt64) ([]SourceFile, error) {
+	rows, err := q.db.QueryContext(ctx, getSourceFilesByAudiobook, audiobookID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SourceFile
+	for rows.Next() {
+		var i SourceFile
+		if err := rows.Scan(
+			&i.ID,
+			&i.Path,
+			&i.SourcePath,
+			&i.Size,
+			&i.ModTime,
+			&i.Hash,
+			&i.AudiobookID,
+			&i.Status,
+			&i.LastError,
+			&i.UpdatedAt,
+			&i.Attempts,
+			&i.FailedStage,
+			&i.RetryAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getSourceFilesBySource = `-- name: GetSourceFilesBySource :many
+Select id, path, source_path, size, mod_time, hash, audiobook_id, status, last_error, updated_at, attempts, failed_stage, retry_at From SourceFile Where source_path = ? Order By path
+`
+
+func (q *Queries) GetSourceFilesBySource(ctx context.Context, sourcePath string) ([]SourceFile, error) {
+	rows, err := q.db.QueryContext(ctx, getSourceFilesBySource, sourcePath)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SourceFile
+	for rows.Next() {
+		var i SourceFile
+		if err := rows.Scan(
+			&i.ID,
+			&i.Path,
+			&i.SourcePath,
+			&i.Size,
+			&i.ModTime,
+			&i.Hash,
+			&i.AudiobookID,
+			&i.Status,
+			&i.LastError,
+			&i.UpdatedAt,
+			&i.Attempts,
+			&i.FailedStage,
+			&i.RetryAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUserById = `-- name: GetUserById :one
+Select id, username, password_hash, is_admin, created_at
+From User u
+Where u.id = ?
+`
+
+func (q *Queries) GetUserById(ctx context.Context, id int64) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserById, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Username,
+		&i.PasswordHash,
+		&i.IsAdmin,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getUserByUsername = `-- name: GetUserByUsername :one
+Select id, username, password_hash, is_admin, created_at
+From User u
+Where u.username = ?
+`
+
+func (q *Queries) GetUserByUsername(ctx context.Context, username string) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByUsername, username)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Username,
+		&i.PasswordHash,
+		&i.IsAdmin,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getUserPlaybackProgress = `-- name: GetUserPlaybackProgress :many
+Select user_id, audiobook_id, chapter_numbering, offset_seconds, finished, updated_at
+From PlaybackProgress p
+Where p.user_id = ?
+Order By p.updated_at Desc
+`
+
+func (q *Queries) GetUserPlaybackProgress(ctx context.Context, userID int64) ([]PlaybackProgress, error) {
+	rows, err := q.db.QueryContext(ctx, getUserPlaybackProgress, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []PlaybackProgress
+	for rows.Next() {
+		var i PlaybackProgress
+		if err := rows.Scan(
+			&i.UserID,
+			&i.AudiobookID,
+			&i.ChapterNumbering,
+			&i.OffsetSeconds,
+			&i.Finished,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const insertAudiobook = `-- name: InsertAudiobook :execresult
+Insert Into Audiobook (title, author, narrator, description, duration, relative_path, chapter_count, genre) Values (?, ?, ?, ?, ?, ?, ?, ?)
+`
+
+type InsertAudiobookParams struct {
+	Title        string
+	Author       string
+	Narrator     string
+	Description  string
+	Duration     int64
+	RelativePath string
+	ChapterCount int64
+	Genre        string
+}
+
+func (q *Queries) InsertAudiobook(ctx context.Context, arg InsertAudiobookParams) (sql.Result, error) {
+	return q.db.ExecContext(ctx, insertAudiobook,
+		arg.Title,
+		arg.Author,
+		arg.Narrator,
+		arg.Description,
+		arg.Duration,
+		arg.RelativePath,
+		arg.ChapterCount,
+		arg.Genre,
+	)
+}
+
+const insertAudiobookAuthor = `-- name: InsertAudiobookAuthor :exec
+Insert Or Ignore Into AudiobookAuthor (audiobook_id, person_id, position) Values (?, ?, ?)
+`
+
+type InsertAudiobookAuthorParams struct {
+	AudiobookID int64
+	PersonID    int64
+	Position    int64
+}
+
+func (q *Queries) InsertAudiobookAuthor(ctx context.Context, arg InsertAudiobookAuthorParams) error {
+	_, err := q.db.ExecContext(ctx, insertAudiobookAuthor, arg.AudiobookID, arg.PersonID, arg.Position)
+	return err
+}
+
+const insertAudiobookGenre = `-- name: InsertAudiobookGenre :exec
+Insert Or Ignore Into AudiobookGenre (audiobook_id, genre_id) Values (?, ?)
+`
+
+type InsertAudiobookGenreParams struct {
+	AudiobookID int64
+	GenreID     int64
+}
+
+func (q *Queries) InsertAudiobookGenre(ctx context.Context, arg InsertAudiobookGenreParams) error {
+	_, err := q.db.ExecContext(ctx, insertAudiobookGenre, arg.AudiobookID, arg.GenreID)
+	return err
+}
+
+const insertAudiobookImage = `-- name: InsertAudiobookImage :exec
+Insert Or Replace Into AudiobookImage (audiobook_id, kind, file_path, content_type, width, height) Values (?, ?, ?, ?, ?, ?)
+`
+
+type InsertAudiobookImageParams struct {
+	AudiobookID int64
+	Kind        string
+	FilePath    string
+	ContentType string
+	Width       int64
+	Height      int64
+}
+
+func (q *Queries) InsertAudiobookImage(ctx context.Context, arg InsertAudiobookImageParams) error {
+	_, err := q.db.ExecContext(ctx, insertAudiobookImage,
+		arg.AudiobookID,
+		arg.Kind,
+		arg.FilePath,
+		arg.ContentType,
+		arg.Width,
+		arg.Height,
+	)
+	return err
+}
+
+const insertAudiobookLoudness = `-- name: InsertAudiobookLoudness :exec
+Insert Or Replace Into AudiobookLoudness (audiobook_id, integrated_lufs, true_peak, gain, normalized) Values (?, ?, ?, ?, ?)
+`
+
+type InsertAudiobookLoudnessParams struct {
+	AudiobookID    int64
+	IntegratedLufs float64
+	TruePeak       float64
+	Gain           float64
+	Normalized     bool
+}
+
+func (q *Queries) InsertAudiobookLoudness(ctx context.Context, arg InsertAudiobookLoudnessParams) error {
+	_, err := q.db.ExecContext(ctx, insertAudiobookLoudness,
+		arg.AudiobookID,
+		arg.IntegratedLufs,
+		arg.TruePeak,
+		arg.Gain,
+		arg.Normalized,
+	)
+	return err
+}
+
+const insertAudiobookNarrator = `-- name: InsertAudiobookNarrator :exec
+Insert Or Ignore Into AudiobookNarrator (audiobook_id, person_id, position) Values (?, ?, ?)
+`
+
+type InsertAudiobookNarratorParams struct {
+	AudiobookID int64
+	PersonID    int64
+	Position    int64
+}
+
+func (q *Queries) InsertAudiobookNarrator(ctx context.Context, arg InsertAudiobookNarratorParams) error {
+	_, err := q.db.ExecContext(ctx, insertAudiobookNarrator, arg.AudiobookID, arg.PersonID, arg.Position)
+	return err
+}
+
+const insertAudiobookSeries = `-- name: InsertAudiobookSeries :exec
+Insert Or Ignore Into AudiobookSeries (audiobook_id, series_id, position) Values (?, ?, ?)
+`
+
+type InsertAudiobookSeriesParams struct {
+	AudiobookID int64
+	SeriesID    int64
+	Position    string
+}
+
+func (q *Queries) InsertAudiobookSeries(ctx context.Context, arg InsertAudiobookSeriesParams) error {
+	_, err := q.db.ExecContext(ctx, insertAudiobookSeries, arg.AudiobookID, arg.SeriesID, arg.Position)
+	return err
+}
+
+const insertBookmark = `-- name: InsertBookmark :execresult
+Insert Into Bookmark (user_id, audiobook_id, chapter_numbering, offset_seconds, name, note, created_at, updated_at) Values (?, ?, ?, ?, ?, ?, ?, ?)
+`
+
+type InsertBookmarkParams struct {
+	UserID           int64
+	AudiobookID      int64
+	ChapterNumbering int64
+	OffsetSeconds    float64
+	Name             string
+	Note             string
+	CreatedAt        int64
+	UpdatedAt        int64
+}
+
+func (q *Queries) InsertBookmark(ctx context.Context, arg InsertBookmarkParams) (sql.Result, error) {
+	return q.db.ExecContext(ctx, insertBookmark,
+		arg.UserID,
+		arg.AudiobookID,
+		arg.ChapterNumbering,
+		arg.OffsetSeconds,
+		arg.Name,
+		arg.Note,
+		arg.CreatedAt,
+		arg.UpdatedAt,
+	)
+}
+
+const insertChapter = `-- name: InsertChapter :exec
+Insert Into Chapter (audiobook_id, title, numbering, start_time, end_time, file_path, auto_detected) Values (?, ?, ?, ?, ?, ?, ?)
+`
+
+type InsertChapterParams struct {
+	AudiobookID  int64
+	Title        string
+	Numbering    int64
+	StartTime    float64
+	EndTime      float64
+	FilePath     string
+	AutoDetected bool
+}
+
+func (q *Queries) InsertChapter(ctx context.Context, arg InsertChapterParams) error {
+	_, err := q.db.ExecContext(ctx, insertChapter,
+		arg.AudiobookID,
+		arg.Title,
+		arg.Numbering,
+		arg.StartTime,
+		arg.EndTime,
+		arg.FilePath,
+		arg.AutoDetected,
+	)
+	return err
+}
+
+const insertSession = `-- name: InsertSession :exec
+Insert Into Session (id, user_id, created_at, expires_at) Values (?, ?, ?, ?)
+`
+
+type InsertSessionParams struct {
+	ID        string
+	UserID    int64
+	CreatedAt int64
+	ExpiresAt int64
+}
+
+func (q *Queries) InsertSession(ctx context.Context, arg InsertSessionParams) error {
+	_, err := q.db.ExecContext(ctx, insertSession,
+		arg.ID,
+		arg.UserID,
+		arg.CreatedAt,
+		arg.ExpiresAt,
+	)
+	return err
+}
+
+const insertUser = `-- name: InsertUser :execresult
+Insert Into User (username, password_hash, is_admin, created_at) Values (?, ?, ?, ?)
+`
+
+type InsertUserParams struct {
+	Username     string
+	PasswordHash string
+	IsAdmin      bool
+	CreatedAt    int64
+}
+
+func (q *Queries) InsertUser(ctx context.Context, arg InsertUserParams) (sql.Result, error) {
+	return q.db.ExecContext(ctx, insertUser,
+		arg.Username,
+		arg.PasswordHash,
+		arg.IsAdmin,
+		arg.CreatedAt,
+	)
+}
+
+const queueJob = `-- name: QueueJob :exec
+Insert Into Job (source_path, content_key, stage, state, results, error, created_at, updated_at)
+Values (?, ?, ?, ?, '', '', ?, ?)
+On Conflict (source_path) Do Update Set
+    stage = Case When content_key = excluded.content_key And state != 'done' Then stage Else excluded.stage End,
+    results = Case When content_key = excluded.content_key And state != 'done' Then results Else '' End,
+    content_key = excluded.content_key,
+    state = excluded.state,
+    error = '',
+    updated_at = excluded.updated_at
+`
+
+type QueueJobParams struct {
+	SourcePath string
+	ContentKey string
+	Stage      string
+	State      string
+	CreatedAt  int64
+	UpdatedAt  int64
+}
+
+func (q *Queries) QueueJob(ctx context.Context, arg QueueJobParams) error {
+	_, err := q.db.ExecContext(ctx, queueJob,
+		arg.SourcePath,
+		arg.ContentKey,
+		arg.Stage,
+		arg.State,
+		arg.CreatedAt,
+		arg.UpdatedAt,
+	)
+	return err
+}
+
+const recordSourceFailure = `-- name: RecordSourceFailure :execrows
+Update SourceFile
+Set status = ?, last_error = ?, failed_stage = ?, attempts = ?, retry_at = ?, updated_at = ?
+Where source_path = ?
+`
+
+type RecordSourceFailureParams struct {
+	Status      string
+	LastError   string
+	FailedStage string
+	Attempts    int64
+	RetryAt     sql.NullInt64
+	UpdatedAt   int64
+	SourcePath  string
+}
+
+func (q *Queries) RecordSourceFailure(ctx context.Context, arg RecordSourceFailureParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, recordSourceFailure,
+		arg.Status,
+		arg.LastError,
+		arg.FailedStage,
+		arg.Attempts,
+		arg.RetryAt,
+		arg.UpdatedAt,
+		arg.SourcePath,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const resetSourceFailures = `-- name: ResetSourceFailures :exec
+Update SourceFile Set status = ?, last_error = '', attempts = 0, retry_at = Null, updated_at = ? Where source_path = ?
+`
+
+type ResetSourceFailuresParams struct {
+	Status     string
+	UpdatedAt  int64
+	SourcePath string
+}
+
+func (q *Queries) ResetSourceFailures(ctx context.Context, arg ResetSourceFailuresParams) error {
+	_, err := q.db.ExecContext(ctx, resetSourceFailures, arg.Status, arg.UpdatedAt, arg.SourcePath)
+	return err
+}
+
+const restartJob = `-- name: RestartJob :exec
+Insert Into Job (source_path, content_key, stage, state, results, error, created_at, updated_at)
+Values (?, ?, ?, ?, '', '', ?, ?)
+On Conflict (source_path) Do Update Set
+    stage = excluded.stage,
+    results = '',
+    content_key = excluded.content_key,
+    state = excluded.state,
+    error = '',
+    updated_at = excluded.updated_at
+`
+
+type RestartJobParams struct {
+	SourcePath string
+	ContentKey string
+	Stage      string
+	State      string
+	CreatedAt  int64
+	UpdatedAt  int64
+}
+
+func (q *Queries) RestartJob(ctx context.Context, arg RestartJobParams) error {
+	_, err := q.db.ExecContext(ctx, restartJob,
+		arg.SourcePath,
+		arg.ContentKey,
+		arg.Stage,
+		arg.State,
+		arg.CreatedAt,
+		arg.UpdatedAt,
+	)
+	return err
+}
+
+const searchAudiobooks = `-- name: SearchAudiobooks :many
+Select a.id, a.title, a.author, a.narrator, a.description, a.duration, a.relative_path, a.chapter_count, a.genre, a.missing_since, snippet(AudiobookSearch, -1, char(2), char(3), '…', 16) As snippet, bm25(AudiobookSearch, 10.0, 5.0, 3.0, 1.0, 2.0, 2.0) As rank
+From AudiobookSearch
+Join Audiobook a On a.id = AudiobookSearch.rowid
+Where AudiobookSearch Match ?
+Order By rank, a.id
+Limit ? Offset ?
+`
+
+type SearchAudiobooksParams struct {
+	Match  string
+	Limit  int64
+	Offset int64
+}
+
+type SearchAudiobooksRow struct {
+	Audiobook Audiobook
+	Snippet   string
+	Rank      float64
+}
+
+func (q *Queries) SearchAudiobooks(ctx context.Context, arg SearchAudiobooksParams) ([]SearchAudiobooksRow, error) {
+	rows, err := q.db.QueryContext(ctx, searchAudiobooks, arg.Match, arg.Limit, arg.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SearchAudiobooksRow
+	for rows.Next() {
+		var i SearchAudiobooksRow
+		if err := rows.Scan(
+			&i.Audiobook.ID,
+			&i.Audiobook.Title,
+			&i.Audiobook.Author,
+			&i.Audiobook.Narrator,
+			&i.Audiobook.Description,
+			&i.Audiobook.Duration,
+			&i.Audiobook.RelativePath,
+			&i.Audiobook.ChapterCount,
+			&i.Audiobook.Genre,
+			&i.Audiobook.MissingSince,
+			&i.Snippet,
+			&i.Rank,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const setAudiobookMissing = `-- name: SetAudiobookMissing :exec
+Update Audiobook Set missing_since = ? Where id = ? And missing_since Is Null
+`
+
+type SetAudiobookMissingParams struct {
+	MissingSince sql.NullInt64
+	ID           int64
+}
+
+func (q *Queries) SetAudiobookMissing(ctx context.Context, arg SetAudiobookMissingParams) error {
+	_, err := q.db.ExecContext(ctx, setAudiobookMissing, arg.MissingSince, arg.ID)
+	return err
+}
+
+const setSourceAudiobook = `-- name: SetSourceAudiobook :execrows
+Update SourceFile Set status = ?, audiobook_id = ?, last_error = '', attempts = 0, failed_stage = '', retry_at = Null, updated_at = ? Where source_path = ?
+`
+
+type SetSourceAudiobookParams struct {
+	Status      string
+	AudiobookID sql.NullInt64
+	UpdatedAt   int64
+	SourcePath  string
+}
+
+func (q *Queries) SetSourceAudiobook(ctx context.Context, arg SetSourceAudiobookParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, setSourceAudiobook,
+		arg.Status,
+		arg.AudiobookID,
+		arg.UpdatedAt,
+		arg.SourcePath,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const updateAudiobook = `-- name: UpdateAudiobook :exec
+Update Audiobook
+Set title = ?, author = ?, narrator = ?, description = ?, duration = ?, chapter_count = ?, genre = ?, missing_since = Null
+Where id = ?
+`
+
+type UpdateAudiobookParams struct {
+	Title        string
+	Author       string
+	Narrator     string
+	Description  string
+	Duration     int64
+	ChapterCount int64
+	Genre        string
+	ID           int64
+}
+
+func (q *Queries) UpdateAudiobook(ctx context.Context, arg UpdateAudiobookParams) error {
+	_, err := q.db.ExecContext(ctx, updateAudiobook,
+		arg.Title,
+		arg.Author,
+		arg.Narrator,
+		arg.Description,
+		arg.Duration,
+		arg.ChapterCount,
+		arg.Genre,
+		arg.ID,
+	)
+	return err
+}
+
+const updateAudiobookDetails = `-- name: UpdateAudiobookDetails :exec
+Update Audiobook Set title = ?, author = ?, narrator = ?, description = ?, genre = ? Where id = ?
+`
+
+type UpdateAudiobookDetailsParams struct {
+	Title       string
+	Author      string
+	Narrator    string
+	Description string
+	Genre       string
+	ID          int64
+}
+
+func (q *Queries) UpdateAudiobookDetails(ctx context.Context, arg UpdateAudiobookDetailsParams) error {
+	_, err := q.db.ExecContext(ctx, updateAudiobookDetails,
+		arg.Title,
+		arg.Author,
+		arg.Narrator,
+		arg.Description,
+		arg.Genre,
+		arg.ID,
+	)
+	return err
+}
+
+const updateAudiobookRelativePath = `-- name: UpdateAudiobookRelativePath :exec
+Update Audiobook Set relative_path = ?, missing_since = Null Where id = ?
+`
+
+type UpdateAudiobookRelativePathParams struct {
+	RelativePath string
+	ID           int64
+}
+
+func (q *Queries) UpdateAudiobookRelativePath(ctx context.Context, arg UpdateAudiobookRelativePathParams) error {
+	_, err := q.db.ExecContext(ctx, updateAudiobookRelativePath, arg.RelativePath, arg.ID)
+	return err
+}
+
+const updateBookmark = `-- name: UpdateBookmark :execrows
+Update Bookmark
+Set chapter_numbering = ?, offset_seconds = ?, name = ?, note = ?, updated_at = ?
+Where id = ? And user_id = ?
+`
+
+type UpdateBookmarkParams struct {
+	ChapterNumbering int64
+	OffsetSeconds    float64
+	Name             string
+	Note             string
+	UpdatedAt        int64
+	ID               int64
+	UserID           int64
+}
+
+func (q *Queries) UpdateBookmark(ctx context.Context, arg UpdateBookmarkParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, updateBookmark,
+		arg.ChapterNumbering,
+		arg.OffsetSeconds,
+		arg.Name,
+		arg.Note,
+		arg.UpdatedAt,
+		arg.ID,
+		arg.UserID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const updateChapterTitle = `-- name: UpdateChapterTitle :exec
+Update Chapter Set title = ? Where audiobook_id = ? And numbering = ?
+`
+
+type UpdateChapterTitleParams struct {
+	Title       string
+	AudiobookID int64
+	Numbering   int64
+}
+
+func (q *Queries) UpdateChapterTitle(ctx context.Context, arg UpdateChapterTitleParams) error {
+	_, err := q.db.ExecContext(ctx, updateChapterTitle, arg.Title, arg.AudiobookID, arg.Numbering)
+	return err
+}
+
+const updateJobState = `-- name: UpdateJobState :exec
+Update Job Set state = ?, error = '', updated_at = ? Where id = ?
+`
+
+type UpdateJobStateParams struct {
+	State     string
+	UpdatedAt int64
+	ID        int64
+}
+
+func (q *Queries) UpdateJobState(ctx context.Context, arg UpdateJobStateParams) error {
+	_, err := q.db.ExecContext(ctx, updateJobState, arg.State, arg.UpdatedAt, arg.ID)
+	return err
+}
+
+const updateSourceFileStat = `-- name: UpdateSourceFileStat :exec
+Update SourceFile Set size = ?, mod_time = ? Where path = ?
+`
+
+type UpdateSourceFileStatParams struct {
+	Size    int64
+	ModTime int64
+	Path    string
+}
+
+func (q *Queries) UpdateSourceFileStat(ctx context.Context, arg UpdateSourceFileStatParams) error {
+	_, err := q.db.ExecContext(ctx, updateSourceFileStat, arg.Size, arg.ModTime, arg.Path)
+	return err
+}
+
+const updateSourceStatus = `-- name: UpdateSourceStatus :execrows
+Update SourceFile Set status = ?, last_error = ?, updated_at = ? Where source_path = ?
+`
+
+type UpdateSourceStatusParams struct {
+	Status     string
+	LastError  string
+	UpdatedAt  int64
+	SourcePath string
+}
+
+func (q *Queries) UpdateSourceStatus(ctx context.Context, arg UpdateSourceStatusParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, updateSourceStatus,
+		arg.Status,
+		arg.LastError,
+		arg.UpdatedAt,
+		arg.SourcePath,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const upsertAudiobookOverride = `-- name: UpsertAudiobookOverride :exec
+Insert Or Replace Into AudiobookOverride (audiobook_id, title, authors, narrators, description, genres, series, series_position) Values (?, ?, ?, ?, ?, ?, ?, ?)
+`
+
+type UpsertAudiobookOverrideParams struct {
+	AudiobookID    int64
+	Title          sql.NullString
+	Authors        sql.NullString
+	Narrators      sql.NullString
+	Description    sql.NullString
+	Genres         sql.NullString
+	Series         sql.NullString
+	SeriesPosition sql.NullString
+}
+
+func (q *Queries) UpsertAudiobookOverride(ctx context.Context, arg UpsertAudiobookOverrideParams) error {
+	_, err := q.db.ExecContext(ctx, upsertAudiobookOverride,
+		arg.AudiobookID,
+		arg.Title,
+		arg.Authors,
+		arg.Narrators,
+		arg.Description,
+		arg.Genres,
+		arg.Series,
+		arg.SeriesPosition,
+	)
+	return err
+}
+
+const upsertChapterOverride = `-- name: UpsertChapterOverride :exec
+Insert Or Replace Into ChapterOverride (audiobook_id, numbering, title, end_time) Values (?, ?, ?, ?)
+`
+
+type UpsertChapterOverrideParams struct {
+	AudiobookID int64
+	Numbering   int64
+	Title       sql.NullString
+	EndTime     sql.NullFloat64
+}
+
+func (q *Queries) UpsertChapterOverride(ctx context.Context, arg UpsertChapterOverrideParams) error {
+	_, err := q.db.ExecContext(ctx, upsertChapterOverride,
+		arg.AudiobookID,
+		arg.Numbering,
+		arg.Title,
+		arg.EndTime,
+	)
+	return err
+}
+
+const upsertGenre = `-- name: UpsertGenre :one
+Insert Into Genre (name) Values (?)
+On Conflict (name) Do Update Set name = Genre.name
+Returning id
+`
+
+func (q *Queries) UpsertGenre(ctx context.Context, name string) (int64, error) {
+	row := q.db.QueryRowContext(ctx, upsertGenre, name)
+	var id int64
+	err := row.Scan(&id)
+	return id, err
+}
+
+const upsertPerson = `-- name: UpsertPerson :one
+Insert Into Person (name) Values (?)
+On Conflict (name) Do Update Set name = Person.name
+Returning id
+`
+
+func (q *Queries) UpsertPerson(ctx context.Context, name string) (int64, error) {
+	row := q.db.QueryRowContext(ctx, upsertPerson, name)
+	var id int64
+	err := row.Scan(&id)
+	return id, err
+}
+
+const upsertPlaybackProgress = `-- name: UpsertPlaybackProgress :execrows
+Insert Into PlaybackProgress (user_id, audiobook_id, chapter_numbering, offset_seconds, finished, updated_at)
+Values (?, ?, ?, ?, ?, ?)
+On Conflict (user_id, audiobook_id) Do Update Set
+    chapter_numbering = excluded.chapter_numbering,
+    offset_seconds = excluded.offset_seconds,
+    finished = excluded.finished,
+    updated_at = excluded.updated_at
+Where excluded.updated_at > PlaybackProgress.updated_at
+`
+
+type UpsertPlaybackProgressParams struct {
+	UserID           int64
+	AudiobookID      int64
+	ChapterNumbering int64
+	OffsetSeconds    float64
+	Finished         bool
+	UpdatedAt        int64
+}
+
+func (q *Queries) UpsertPlaybackProgress(ctx context.Context, arg UpsertPlaybackProgressParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, upsertPlaybackProgress,
+		arg.UserID,
+		arg.AudiobookID,
+		arg.ChapterNumbering,
+		arg.OffsetSeconds,
+		arg.Finished,
+		arg.UpdatedAt,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const upsertSeries = `-- name: UpsertSeries :one
+Insert Into Series (name) Values (?)
+On Conflict (name) Do Update Set name = Series.name
+Returning id
+`
+
+func (q *Queries) UpsertSeries(ctx context.Context, name string) (int64, error) {
+	row := q.db.QueryRowContext(ctx, upsertSeries, name)
+	var id int64
+	err := row.Scan(&id)
+	return id, err
+}
+
+const upsertSourceFile = `-- name: UpsertSourceFile :exec
+Insert Into SourceFile (path, source_path, size, mod_time, hash, status, last_error, updated_at)
+Values (?, ?, ?, ?, ?, ?, '', ?)
+On Conflict (path) Do Update Set
+    source_path = excluded.source_path,
+    size = excluded.size,
+    mod_time = excluded.mod_time,
+    hash = excluded.hash,
+    status = excluded.status,
+    last_error = '',
+    attempts = Case When hash = excluded.hash Then attempts Else 0 End,
+    failed_stage = Case When hash = excluded.hash Then failed_stage Else '' End,
+    retry_at = Null,
+    updated_at = excluded.updated_at
+`
+
+type UpsertSourceFileParams struct {
+	Path       string
+	SourcePath string
+	Size       int64
+	ModTime    int64
+	Hash       string
+	Status     string
+	UpdatedAt  int64
+}
+
+func (q *Queries) UpsertSourceFile(ctx context.Context, arg UpsertSourceFileParams) error {
+	_, err := q.db.ExecContext(ctx, upsertSourceFile,
+		arg.Path,
+		arg.SourcePath,
+		arg.Size,
+		arg.ModTime,
+		arg.Hash,
+		arg.Status,
+		arg.UpdatedAt,
 	)
 	return err
 }
@@ -2,8 +2,12 @@ package repo
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
-	"slices"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/bongofriend/bookplayer/backend/lib/data/datasource"
 	"github.com/bongofriend/bookplayer/backend/lib/models"
@@ -15,7 +19,22 @@ type AudiobookRepositoryService struct {
 
 type AudiobookRepository interface {
 	InsertAudiobook(context context.Context, audiobook models.AudiobookProcessed) (int64, error)
+	// Insert an audiobook or replace the one processed from the same source, keeping its id and user data
+	UpsertAudiobook(context context.Context, audiobook models.AudiobookProcessed) (int64, error)
 	GetAudiobookById(context context.Context, id int64) (*models.AudiobookProcessed, error)
+	// Fetch the audiobook processed from the source at relativePath
+	GetAudiobookBySource(context context.Context, relativePath string) (*models.AudiobookProcessed, error)
+	// Fetch a page of audiobooks ordered by title; chapters are not included
+	GetAudiobooks(context context.Context, limit int64, offset int64) ([]models.AudiobookProcessed, error)
+	CountAudiobooks(context context.Context) (int64, error)
+	GetAudiobookChapters(context context.Context, audiobookId int64) ([]models.ProcessedChapter, error)
+	GetAudiobookChapter(context context.Context, audiobookId int64, numbering int) (*models.ProcessedChapter, error)
+	SearchAudiobooks(context context.Context, query string, limit int64, offset int64) ([]models.AudiobookSearchResult, int64, error)
+	GetAudiobookImage(context context.Context, audiobookId int64, kind string) (*models.AudiobookImage, error)
+	// Fetch audiobooks with chapters and images whose source went missing before missingBefore
+	GetMissingAudiobooks(context context.Context, missingBefore time.Time) ([]models.AudiobookProcessed, error)
+	// Delete an audiobook with everything linked to it, including progress and bookmarks of all users
+	DeleteAudiobook(context context.Context, id int64) error
 }
 
 func NewAudiobookRepository(client *DbClient) *AudiobookRepositoryService {
@@ -25,42 +44,302 @@ func NewAudiobookRepository(client *DbClient) *AudiobookRepositoryService {
 func (r *AudiobookRepositoryService) InsertAudiobook(context context.Context, audiobook models.AudiobookProcessed) (int64, error) {
 	tx, err := r.client.db.Begin()
 	if err != nil {
-		return -1, nil
+		return -1, err
 	}
-	qtx := r.client.queries.WithTx(tx)
-	audiobookParams := audiobookAsParams(audiobook)
-	res, err := qtx.InsertAudiobook(context, audiobookParams)
+	id, err := insertAudiobook(context, r.client.queries.WithTx(tx), audiobook)
 	if err != nil {
 		tx.Rollback()
 		return -1, err
 	}
-	id, err := res.LastInsertId()
+	tx.Commit()
+	return id, nil
+}
+
+func (r *AudiobookRepositoryService) UpsertAudiobook(context context.Context, audiobook models.AudiobookProcessed) (int64, error) {
+	tx, err := r.client.db.Begin()
+	if err != nil {
+		return -1, err
+	}
+	qtx := r.client.queries.WithTx(tx)
+	existing, err := qtx.GetAudiobookByRelativePath(context, audiobook.RelativePath)
+	if errors.Is(err, sql.ErrNoRows) {
+		id, err := insertAudiobook(context, qtx, audiobook)
+		if err != nil {
+			tx.Rollback()
+			return -1, err
+		}
+		return id, tx.Commit()
+	}
 	if err != nil {
 		tx.Rollback()
 		return -1, err
 	}
-	for _, params := range chaptersAsParams(id, audiobook) {
-		if err := qtx.InsertChapter(context, params); err != nil {
+	params := audiobookAsParams(audiobook)
+	if err := qtx.UpdateAudiobook(context, datasource.UpdateAudiobookParams{
+		Title:        params.Title,
+		Author:       params.Author,
+		Narrator:     params.Narrator,
+		Description:  params.Description,
+		Duration:     params.Duration,
+		ChapterCount: params.ChapterCount,
+		Genre:        params.Genre,
+		ID:           existing.ID,
+	}); err != nil {
+		tx.Rollback()
+		return -1, err
+	}
+	// Progress and bookmarks stay linked to the audiobook; everything derived from the source is replaced
+	replaced := []deleteByAudiobookId{
+		qtx.DeleteAudiobookChapters,
+		qtx.DeleteAudiobookAuthors,
+		qtx.DeleteAudiobookNarrators,
+		qtx.DeleteAudiobookGenres,
+		qtx.DeleteAudiobookSeries,
+		qtx.DeleteAudiobookImages,
+		qtx.DeleteAudiobookLoudness,
+	}
+	for _, deleteRows := range replaced {
+		if err := deleteRows(context, existing.ID); err != nil {
 			tx.Rollback()
 			return -1, err
 		}
 	}
-	tx.Commit()
-	return id, nil
+	if err := insertAudiobookDetails(context, qtx, existing.ID, audiobook); err != nil {
+		tx.Rollback()
+		return -1, err
+	}
+	return existing.ID, tx.Commit()
+}
+
+func insertAudiobook(context context.Context, q *datasource.Queries, audiobook models.AudiobookProcessed) (int64, error) {
+	res, err := q.InsertAudiobook(context, audiobookAsParams(audiobook))
+	if err != nil {
+		return -1, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return -1, err
+	}
+	return id, insertAudiobookDetails(context, q, id, audiobook)
+}
+
+// Insert chapters, contributors, images and loudness of the audiobook with id
+func insertAudiobookDetails(context context.Context, q *datasource.Queries, id int64, audiobook models.AudiobookProcessed) error {
+	for _, params := range chaptersAsParams(id, audiobook) {
+		if err := q.InsertChapter(context, params); err != nil {
+			return err
+		}
+	}
+	if err := insertContributors(context, q, id, audiobook.AudiobookCommon); err != nil {
+		return err
+	}
+	for _, image := range audiobook.Images {
+		if err := q.InsertAudiobookImage(context, datasource.InsertAudiobookImageParams{
+			AudiobookID: id,
+			Kind:        image.Kind,
+			FilePath:    image.FilePath,
+			ContentType: image.ContentType,
+			Width:       int64(image.Width),
+			Height:      int64(image.Height),
+		}); err != nil {
+			return err
+		}
+	}
+	if l := audiobook.Loudness; l != nil {
+		if err := q.InsertAudiobookLoudness(context, datasource.InsertAudiobookLoudnessParams{
+			AudiobookID:    id,
+			IntegratedLufs: l.IntegratedLufs,
+			TruePeak:       l.TruePeak,
+			Gain:           l.Gain,
+			Normalized:     l.Normalized,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (r *AudiobookRepositoryService) GetAudiobookById(context context.Context, id int64) (*models.AudiobookProcessed, error) {
-	rows, err := r.client.queries.GetAudiobookById(context, id)
+	row, err := r.client.queries.GetAudiobook(context, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("audiobook with id %d %w", id, ErrNotFound)
+		}
+		return nil, err
+	}
+	chapterRows, err := r.client.queries.GetAudiobookChapters(context, id)
+	if err != nil {
+		return nil, err
+	}
+	model := audiobookAsModel(row)
+	if err := loadContributors(context, &r.client.queries, &model); err != nil {
+		return nil, err
+	}
+	imageRows, err := r.client.queries.GetAudiobookImages(context, id)
 	if err != nil {
 		return nil, err
 	}
-	if len(rows) == 0 {
-		return nil, fmt.Errorf("audiobook with id %d not found", id)
+	model.Images = make([]models.AudiobookImage, len(imageRows))
+	for idx, i := range imageRows {
+		model.Images[idx] = imageAsModel(i)
+	}
+	loudnessRow, err := r.client.queries.GetAudiobookLoudness(context, id)
+	if err == nil {
+		model.Loudness = loudnessAsModel(loudnessRow)
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	model.ProcessedChapters = make([]models.ProcessedChapter, len(chapterRows))
+	for idx, c := range chapterRows {
+		model.ProcessedChapters[idx] = chapterAsModel(c)
 	}
-	model := audiobookRowsToModels(rows)
 	return &model, nil
 }
 
+func (r *AudiobookRepositoryService) GetAudiobookBySource(context context.Context, relativePath string) (*models.AudiobookProcessed, error) {
+	row, err := r.client.queries.GetAudiobookByRelativePath(context, relativePath)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("audiobook from %s %w", relativePath, ErrNotFound)
+		}
+		return nil, err
+	}
+	return r.GetAudiobookById(context, row.ID)
+}
+
+func (r *AudiobookRepositoryService) GetAudiobooks(context context.Context, limit int64, offset int64) ([]models.AudiobookProcessed, error) {
+	rows, err := r.client.queries.GetAudiobooks(context, datasource.GetAudiobooksParams{
+		Limit:  limit,
+		Offset: offset,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return audiobooksWithContributors(context, &r.client.queries, rows)
+}
+
+func (r *AudiobookRepositoryService) CountAudiobooks(context context.Context) (int64, error) {
+	return r.client.queries.CountAudiobooks(context)
+}
+
+func (r *AudiobookRepositoryService) GetAudiobookChapters(context context.Context, audiobookId int64) ([]models.ProcessedChapter, error) {
+	if _, err := r.client.queries.GetAudiobook(context, audiobookId); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("audiobook with id %d %w", audiobookId, ErrNotFound)
+		}
+		return nil, err
+	}
+	rows, err := r.client.queries.GetAudiobookChapters(context, audiobookId)
+	if err != nil {
+		return nil, err
+	}
+	chapters := make([]models.ProcessedChapter, len(rows))
+	for idx, row := range rows {
+		chapters[idx] = chapterAsModel(row)
+	}
+	return chapters, nil
+}
+
+func (r *AudiobookRepositoryService) GetAudiobookChapter(context context.Context, audiobookId int64, numbering int) (*models.ProcessedChapter, error) {
+	row, err := r.client.queries.GetAudiobookChapter(context, datasource.GetAudiobookChapterParams{
+		AudiobookID: audiobookId,
+		Numbering:   int64(numbering),
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("chapter %d of audiobook with id %d %w", numbering, audiobookId, ErrNotFound)
+		}
+		return nil, err
+	}
+	chapter := chapterAsModel(row)
+	return &chapter, nil
+}
+
+func (r *AudiobookRepositoryService) GetAudiobookImage(context context.Context, audiobookId int64, kind string) (*models.AudiobookImage, error) {
+	row, err := r.client.queries.GetAudiobookImage(context, datasource.GetAudiobookImageParams{
+		AudiobookID: audiobookId,
+		Kind:        kind,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%s image of audiobook with id %d %w", kind, audiobookId, ErrNotFound)
+		}
+		return nil, err
+	}
+	image := imageAsModel(row)
+	return &image, nil
+}
+
+func (r *AudiobookRepositoryService) GetMissingAudiobooks(context context.Context, missingBefore time.Time) ([]models.AudiobookProcessed, error) {
+	rows, err := r.client.queries.GetMissingAudiobooks(context, sql.NullInt64{Int64: missingBefore.UnixMilli(), Valid: true})
+	if err != nil {
+		return nil, err
+	}
+	audiobooks := make([]models.AudiobookProcessed, len(rows))
+	for idx, row := range rows {
+		audiobook, err := r.GetAudiobookById(context, row.ID)
+		if err != nil {
+			return nil, err
+		}
+		audiobooks[idx] = *audiobook
+	}
+	return audiobooks, nil
+}
+
+/*
+Rewrite paths of audiobooks stored before they were located relative to libraryRoot, so processing them again
+updates them instead of adding duplicates. Paths outside of libraryRoot and paths already taken are left as they are.
+Returns the number of rewritten paths
+*/
+func (r *AudiobookRepositoryService) RelativizeAudiobookPaths(context context.Context, libraryRoot string) (int, error) {
+	rows, err := r.client.queries.GetAudiobooksWithAbsolutePath(context)
+	if err != nil {
+		return 0, err
+	}
+	rewritten := 0
+	for _, row := range rows {
+		rel, err := filepath.Rel(filepath.Clean(libraryRoot), filepath.Clean(row.RelativePath))
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		if _, err := r.client.queries.GetAudiobookByRelativePath(context, rel); err == nil {
+			continue
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return rewritten, err
+		}
+		if err := r.client.queries.UpdateAudiobookRelativePath(context, datasource.UpdateAudiobookRelativePathParams{
+			RelativePath: rel,
+			ID:           row.ID,
+		}); err != nil {
+			return rewritten, err
+		}
+		rewritten++
+	}
+	return rewritten, nil
+}
+
+func (r *AudiobookRepositoryService) DeleteAudiobook(context context.Context, id int64) error {
+	tx, err := r.client.db.Begin()
+	if err != nil {
+		return err
+	}
+	qtx := r.client.queries.WithTx(tx)
+	// Rows linked by foreign keys are deleted along with the audiobook; source files would only be unlinked
+	deletions := []deleteByAudiobookId{
+		// Jobs are found through the source files and deleted first
+		deleteJobsOf(qtx),
+		deleteSourceFilesOf(qtx),
+		qtx.DeleteAudiobook,
+	}
+	for _, deleteRows := range deletions {
+		if err := deleteRows(context, id); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
 func audiobookAsParams(audiobook models.AudiobookProcessed) datasource.InsertAudiobookParams {
 	return datasource.InsertAudiobookParams{
 		Title:        audiobook.Title,
@@ -68,7 +347,7 @@ func audiobookAsParams(audiobook models.AudiobookProcessed) datasource.InsertAud
 		Narrator:     audiobook.Narrator,
 		Description:  audiobook.Description,
 		Duration:     int64(audiobook.Duration),
-		DirPath:      audiobook.FilePath,
+		RelativePath: audiobook.RelativePath,
 		ChapterCount: int64(len(audiobook.ProcessedChapters)),
 		Genre:        audiobook.Genre,
 	}
@@ -76,51 +355,89 @@ func audiobookAsParams(audiobook models.AudiobookProcessed) datasource.InsertAud
 }
 
 func chaptersAsParams(id int64, audiobook models.AudiobookProcessed) []datasource.InsertChapterParams {
-	params := make([]datasource.InsertChapterParams, len(audiobook.ProcessedChapters))
+	params := make([]datasource.InsertChapterParams, 0, len(audiobook.ProcessedChapters))
 	for _, ch := range audiobook.ProcessedChapters {
 		p := datasource.InsertChapterParams{
-			AudiobookID: id,
-			Title:       ch.Title,
-			Numbering:   int64(ch.Numbering),
-			StartTime:   float64(ch.StartTime),
-			EndTime:     float64(ch.EndTime),
-			FilePath:    ch.FilePath,
+			AudiobookID:  id,
+			Title:        ch.Title,
+			Numbering:    int64(ch.Numbering),
+			StartTime:    float64(ch.StartTime),
+			EndTime:      float64(ch.EndTime),
+			FilePath:     ch.FilePath,
+			AutoDetected: ch.AutoDetected,
 		}
 		params = append(params, p)
 	}
 	return params
 }
 
-func audiobookRowsToModels(rows []datasource.GetAudiobookByIdRow) models.AudiobookProcessed {
-	chapters := make([]models.ProcessedChapter, len(rows))
-	for idx, r := range rows {
-		chapter := models.ProcessedChapter{
-			ChapterCommon: models.ChapterCommon{
-				Title:     r.Chapter.Title,
-				StartTime: float32(r.Chapter.StartTime),
-				EndTime:   float32(r.Chapter.EndTime),
-				//Start:     0,
-				//End:       0,
-				Numbering: int(r.Chapter.Numbering),
-			},
-			FilePath: r.Chapter.FilePath,
-		}
-		chapters[idx] = chapter
-	}
-	slices.SortFunc(chapters, func(c1 models.ProcessedChapter, c2 models.ProcessedChapter) int {
-		return c1.Numbering - c2.Numbering
-	})
-	firstRow := rows[0]
+func audiobookAsModel(a datasource.Audiobook) models.AudiobookProcessed {
 	return models.AudiobookProcessed{
+		Id: a.ID,
 		AudiobookCommon: models.AudiobookCommon{
-			Title:       firstRow.Audiobook.Title,
-			Author:      firstRow.Audiobook.Author,
-			Narrator:    firstRow.Audiobook.Narrator,
-			Description: firstRow.Audiobook.Description,
-			Genre:       firstRow.Audiobook.Genre,
-			Duration:    float32(firstRow.Audiobook.Duration),
+			Title:       a.Title,
+			Author:      a.Author,
+			Narrator:    a.Narrator,
+			Description: a.Description,
+			Genre:       a.Genre,
+			Duration:    float32(a.Duration),
+		},
+		RelativePath: a.RelativePath,
+		MissingSince: nullTime(a.MissingSince),
+	}
+}
+
+func chapterAsModel(c datasource.Chapter) models.ProcessedChapter {
+	return models.ProcessedChapter{
+		Id: c.ID,
+		ChapterCommon: models.ChapterCommon{
+			Title:        c.Title,
+			StartTime:    float32(c.StartTime),
+			EndTime:      float32(c.EndTime),
+			Numbering:    int(c.Numbering),
+			AutoDetected: c.AutoDetected,
 		},
-		FilePath:          firstRow.Chapter.FilePath,
-		ProcessedChapters: chapters,
+		FilePath: c.FilePath,
+	}
+}
+
+func imageAsModel(i datasource.AudiobookImage) models.AudiobookImage {
+	return models.AudiobookImage{
+		Kind:        i.Kind,
+		FilePath:    i.FilePath,
+		ContentType: i.ContentType,
+		Width:       int(i.Width),
+		Height:      int(i.Height),
+	}
+}
+
+func loudnessAsModel(l datasource.AudiobookLoudness) *models.Loudness {
+	return &models.Loudness{
+		IntegratedLufs: l.IntegratedLufs,
+		TruePeak:       l.TruePeak,
+		Gain:           l.Gain,
+		Normalized:     l.Normalized,
+	}
+}
+
+type deleteByAudiobookId func(context context.Context, audiobookId int64) error
+
+func deleteJobsOf(q *datasource.Queries) deleteByAudiobookId {
+	return func(context context.Context, audiobookId int64) error {
+		return q.DeleteAudiobookJobs(context, sql.NullInt64{Int64: audiobookId, Valid: true})
+	}
+}
+
+func deleteSourceFilesOf(q *datasource.Queries) deleteByAudiobookId {
+	return func(context context.Context, audiobookId int64) error {
+		return q.DeleteAudiobookSourceFiles(context, sql.NullInt64{Int64: audiobookId, Valid: true})
+	}
+}
+
+func nullTime(millis sql.NullInt64) *time.Time {
+	if !millis.Valid {
+		return nil
 	}
+	t := time.UnixMilli(millis.Int64)
+	return &t
 }
@@ -3,8 +3,11 @@ package repo_test
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"path"
 	"testing"
+	"time"
 
 	"github.com/bongofriend/bookplayer/backend/lib/config"
 	"github.com/bongofriend/bookplayer/backend/lib/data/repo"
@@ -51,7 +54,208 @@ func TestAudiobookRepository(t *testing.T) {
 			t.Fatalf("could not retrieve Audiobook with id %d from database", id)
 		}
 	})
+	t.Run("should list inserted Audiobooks", func(t *testing.T) {
+		config := prepareDatabase(t)
+		client, err := repo.NewDbClient(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		context := context.Background()
+		audiobookRepo := repo.NewAudiobookRepository(client)
+		model := getAudiobookModel()
+		for i := 0; i < 3; i++ {
+			if _, err := audiobookRepo.InsertAudiobook(context, *model); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		count, err := audiobookRepo.CountAudiobooks(context)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != 3 {
+			t.Fatalf("Expected %d audiobooks; counted: %d", 3, count)
+		}
+		page, err := audiobookRepo.GetAudiobooks(context, 2, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page) != 2 {
+			t.Fatalf("Expected %d audiobooks; received: %d", 2, len(page))
+		}
+		if page[0].Id != 2 || page[1].Id != 3 {
+			t.Fatalf("Unexpected page of audiobooks: %d, %d", page[0].Id, page[1].Id)
+		}
+	})
+	t.Run("should fetch chapters of inserted Audiobook", func(t *testing.T) {
+		config := prepareDatabase(t)
+		client, err := repo.NewDbClient(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		context := context.Background()
+		audiobookRepo := repo.NewAudiobookRepository(client)
+		model := getAudiobookModel()
+		model.ProcessedChapters[3].AutoDetected = true
+		id, err := audiobookRepo.InsertAudiobook(context, *model)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		chapters, err := audiobookRepo.GetAudiobookChapters(context, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(chapters) != len(model.ProcessedChapters) {
+			t.Fatalf("Expected %d chapters; received: %d", len(model.ProcessedChapters), len(chapters))
+		}
+		chapter, err := audiobookRepo.GetAudiobookChapter(context, id, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if chapter.Title != model.ProcessedChapters[3].Title {
+			t.Fatalf("Expected chapter %q; received: %q", model.ProcessedChapters[3].Title, chapter.Title)
+		}
+		if !chapter.AutoDetected || chapters[2].AutoDetected {
+			t.Fatal("Expected only chapter 3 to be marked as auto-detected")
+		}
+		if _, err := audiobookRepo.GetAudiobookChapter(context, id, 99); !errors.Is(err, repo.ErrNotFound) {
+			t.Fatalf("Expected ErrNotFound; received: %v", err)
+		}
+	})
+	t.Run("should not find missing Audiobook", func(t *testing.T) {
+		config := prepareDatabase(t)
+		client, err := repo.NewDbClient(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		audiobookRepo := repo.NewAudiobookRepository(client)
+		if _, err := audiobookRepo.GetAudiobookById(context.Background(), 42); !errors.Is(err, repo.ErrNotFound) {
+			t.Fatalf("Expected ErrNotFound; received: %v", err)
+		}
+	})
+	t.Run("should relativize absolute paths of legacy Audiobooks", func(t *testing.T) {
+		config := prepareDatabase(t)
+		client, err := repo.NewDbClient(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		context := context.Background()
+		audiobookRepo := repo.NewAudiobookRepository(client)
+		ids := map[string]int64{}
+		for _, p := range []string{"/library/Dune.m4b", "/elsewhere/Emma.m4b", "/library/Sun Tzu/The Art of War.m4b", "Sun Tzu/The Art of War.m4b"} {
+			model := getAudiobookModel()
+			model.RelativePath = p
+			id, err := audiobookRepo.InsertAudiobook(context, *model)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids[p] = id
+		}
+
+		rewritten, err := audiobookRepo.RelativizeAudiobookPaths(context, "/library/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rewritten != 1 {
+			t.Fatalf("Expected %d rewritten path; received: %d", 1, rewritten)
+		}
+		if fetched, err := audiobookRepo.GetAudiobookBySource(context, "Dune.m4b"); err != nil || fetched.Id != ids["/library/Dune.m4b"] {
+			t.Fatalf("Expected legacy audiobook to be found by relative path; error: %v", err)
+		}
+		// Outside of the library or already taken by an audiobook processed again
+		for _, p := range []string{"/elsewhere/Emma.m4b", "/library/Sun Tzu/The Art of War.m4b"} {
+			if fetched, err := audiobookRepo.GetAudiobookById(context, ids[p]); err != nil || fetched.RelativePath != p {
+				t.Fatalf("Expected path %s to be kept; received: %+v, %v", p, fetched, err)
+			}
+		}
+	})
+	t.Run("should update Audiobook from same source", func(t *testing.T) {
+		config := prepareDatabase(t)
+		client, err := repo.NewDbClient(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		context := context.Background()
+		audiobookRepo := repo.NewAudiobookRepository(client)
+		bookmarkRepo := repo.NewBookmarkRepository(client)
+		insertTestUsers(t, client, 1)
+		var model models.AudiobookProcessed
+		if err := json.Unmarshal([]byte(audiobook), &model); err != nil {
+			t.Fatal(err)
+		}
+		model.RelativePath = "Sun Tzu/The Art of War.m4b"
+		model.Authors = []string{"Sun Tzu"}
+		id, err := audiobookRepo.UpsertAudiobook(context, model)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := bookmarkRepo.InsertBookmark(context, models.Bookmark{UserId: 1, AudiobookId: id, ChapterNumbering: 2, Name: "Waging War"}); err != nil {
+			t.Fatal(err)
+		}
 
+		model.Title = "The Art of War"
+		model.Authors = []string{"Sunzi"}
+		model.ProcessedChapters = model.ProcessedChapters[:3]
+		updatedId, err := audiobookRepo.UpsertAudiobook(context, model)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if updatedId != id {
+			t.Fatalf("Expected audiobook %d to be updated; received: %d", id, updatedId)
+		}
+		if count, _ := audiobookRepo.CountAudiobooks(context); count != 1 {
+			t.Fatalf("Expected 1 audiobook; received: %d", count)
+		}
+		fetched, err := audiobookRepo.GetAudiobookBySource(context, model.RelativePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fetched.Title != "The Art of War" || len(fetched.ProcessedChapters) != 3 || len(fetched.Authors) != 1 || fetched.Authors[0] != "Sunzi" {
+			t.Fatalf("Unexpected audiobook %+v", fetched)
+		}
+		if bookmarks, _ := bookmarkRepo.GetBookmarks(context, 1, id); len(bookmarks) != 1 {
+			t.Fatalf("Expected bookmark to be kept; received: %+v", bookmarks)
+		}
+		if _, err := audiobookRepo.GetAudiobookBySource(context, "unknown.m4b"); !errors.Is(err, repo.ErrNotFound) {
+			t.Fatalf("Expected ErrNotFound; received: %v", err)
+		}
+	})
+	t.Run("should store loudness of Audiobook", func(t *testing.T) {
+		config := prepareDatabase(t)
+		client, err := repo.NewDbClient(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		context := context.Background()
+		audiobookRepo := repo.NewAudiobookRepository(client)
+		model := getAudiobookModel()
+		model.RelativePath = "Sun Tzu/The Art of War.m4b"
+		model.Loudness = &models.Loudness{IntegratedLufs: -23.5, TruePeak: -4.2, Gain: 3.2, Normalized: true}
+		id, err := audiobookRepo.UpsertAudiobook(context, *model)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fetched, err := audiobookRepo.GetAudiobookById(context, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fetched.Loudness == nil || *fetched.Loudness != *model.Loudness {
+			t.Fatalf("Unexpected loudness %+v", fetched.Loudness)
+		}
+
+		// Measured again with every update; left out if the measurement is disabled or failed
+		model.Loudness = nil
+		if _, err := audiobookRepo.UpsertAudiobook(context, *model); err != nil {
+			t.Fatal(err)
+		}
+		if fetched, err = audiobookRepo.GetAudiobookById(context, id); err != nil {
+			t.Fatal(err)
+		}
+		if fetched.Loudness != nil {
+			t.Fatalf("Expected loudness to be removed; received: %+v", fetched.Loudness)
+		}
+	})
 }
 
 func prepareDatabase(t *testing.T) config.DatabaseConfig {
@@ -67,6 +271,26 @@ func prepareDatabase(t *testing.T) config.DatabaseConfig {
 	return testConfig
 }
 
+// Users with ids 1 to count, as foreign keys require them to exist
+func insertTestUsers(t *testing.T, client *repo.DbClient, count int) {
+	userRepo := repo.NewUserRepository(client)
+	for idx := 1; idx <= count; idx++ {
+		if _, err := userRepo.InsertUser(context.Background(), models.User{Username: fmt.Sprintf("listener%d", idx), PasswordHash: "hash", CreatedAt: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// Audiobooks with ids 1 to count
+func insertTestAudiobooks(t *testing.T, client *repo.DbClient, count int) {
+	audiobookRepo := repo.NewAudiobookRepository(client)
+	for idx := 1; idx <= count; idx++ {
+		if _, err := audiobookRepo.InsertAudiobook(context.Background(), *getAudiobookModel()); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
 func getAudiobookModel() *models.AudiobookProcessed {
 	raw := json.RawMessage(audiobook)
 	var model models.AudiobookProcessed
@@ -0,0 +1,123 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bongofriend/bookplayer/backend/lib/data/datasource"
+	"github.com/bongofriend/bookplayer/backend/lib/models"
+)
+
+type BookmarkRepositoryService struct {
+	client *DbClient
+}
+
+// Bookmarks are always scoped to the user owning them
+type BookmarkRepository interface {
+	InsertBookmark(context context.Context, bookmark models.Bookmark) (int64, error)
+	GetBookmark(context context.Context, userId int64, id int64) (*models.Bookmark, error)
+	GetBookmarks(context context.Context, userId int64, audiobookId int64) ([]models.Bookmark, error)
+	UpdateBookmark(context context.Context, bookmark models.Bookmark) error
+	DeleteBookmark(context context.Context, userId int64, id int64) error
+}
+
+func NewBookmarkRepository(client *DbClient) *BookmarkRepositoryService {
+	return &BookmarkRepositoryService{client}
+}
+
+func (r *BookmarkRepositoryService) InsertBookmark(context context.Context, bookmark models.Bookmark) (int64, error) {
+	res, err := r.client.queries.InsertBookmark(context, datasource.InsertBookmarkParams{
+		UserID:           bookmark.UserId,
+		AudiobookID:      bookmark.AudiobookId,
+		ChapterNumbering: int64(bookmark.ChapterNumbering),
+		OffsetSeconds:    float64(bookmark.Offset),
+		Name:             bookmark.Name,
+		Note:             bookmark.Note,
+		CreatedAt:        bookmark.CreatedAt.UnixMilli(),
+		UpdatedAt:        bookmark.UpdatedAt.UnixMilli(),
+	})
+	if err != nil {
+		return -1, err
+	}
+	return res.LastInsertId()
+}
+
+func (r *BookmarkRepositoryService) GetBookmark(context context.Context, userId int64, id int64) (*models.Bookmark, error) {
+	row, err := r.client.queries.GetBookmark(context, datasource.GetBookmarkParams{
+		ID:     id,
+		UserID: userId,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("bookmark with id %d %w", id, ErrNotFound)
+		}
+		return nil, err
+	}
+	bookmark := bookmarkAsModel(row)
+	return &bookmark, nil
+}
+
+func (r *BookmarkRepositoryService) GetBookmarks(context context.Context, userId int64, audiobookId int64) ([]models.Bookmark, error) {
+	rows, err := r.client.queries.GetBookmarks(context, datasource.GetBookmarksParams{
+		UserID:      userId,
+		AudiobookID: audiobookId,
+	})
+	if err != nil {
+		return nil, err
+	}
+	bookmarks := make([]models.Bookmark, len(rows))
+	for idx, row := range rows {
+		bookmarks[idx] = bookmarkAsModel(row)
+	}
+	return bookmarks, nil
+}
+
+func (r *BookmarkRepositoryService) UpdateBookmark(context context.Context, bookmark models.Bookmark) error {
+	affected, err := r.client.queries.UpdateBookmark(context, datasource.UpdateBookmarkParams{
+		ChapterNumbering: int64(bookmark.ChapterNumbering),
+		OffsetSeconds:    float64(bookmark.Offset),
+		Name:             bookmark.Name,
+		Note:             bookmark.Note,
+		UpdatedAt:        bookmark.UpdatedAt.UnixMilli(),
+		ID:               bookmark.Id,
+		UserID:           bookmark.UserId,
+	})
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return fmt.Errorf("bookmark with id %d %w", bookmark.Id, ErrNotFound)
+	}
+	return nil
+}
+
+func (r *BookmarkRepositoryService) DeleteBookmark(context context.Context, userId int64, id int64) error {
+	affected, err := r.client.queries.DeleteBookmark(context, datasource.DeleteBookmarkParams{
+		ID:     id,
+		UserID: userId,
+	})
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return fmt.Errorf("bookmark with id %d %w", id, ErrNotFound)
+	}
+	return nil
+}
+
+func bookmarkAsModel(b datasource.Bookmark) models.Bookmark {
+	return models.Bookmark{
+		Id:               b.ID,
+		UserId:           b.UserID,
+		AudiobookId:      b.AudiobookID,
+		ChapterNumbering: int(b.ChapterNumbering),
+		Offset:           float32(b.OffsetSeconds),
+		Name:             b.Name,
+		Note:             b.Note,
+		CreatedAt:        time.UnixMilli(b.CreatedAt),
+		UpdatedAt:        time.UnixMilli(b.UpdatedAt),
+	}
+}
@@ -0,0 +1,80 @@
+package repo_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bongofriend/bookplayer/backend/lib/data/repo"
+	"github.com/bongofriend/bookplayer/backend/lib/models"
+)
+
+func TestBookmarkRepository(t *testing.T) {
+	config := prepareDatabase(t)
+	client, err := repo.NewDbClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	context := context.Background()
+	bookmarkRepo := repo.NewBookmarkRepository(client)
+	insertTestUsers(t, client, 1)
+	insertTestAudiobooks(t, client, 1)
+	now := time.Now()
+	bookmark := models.Bookmark{UserId: 1, AudiobookId: 1, ChapterNumbering: 2, Offset: 30, Name: "Battle", CreatedAt: now, UpdatedAt: now}
+	id, err := bookmarkRepo.InsertBookmark(context, bookmark)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bookmark.Id = id
+
+	t.Run("should only expose Bookmark to owner", func(t *testing.T) {
+		if _, err := bookmarkRepo.GetBookmark(context, 1, id); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := bookmarkRepo.GetBookmark(context, 2, id); !errors.Is(err, repo.ErrNotFound) {
+			t.Fatalf("Expected ErrNotFound; received: %v", err)
+		}
+		other := bookmark
+		other.UserId = 2
+		if err := bookmarkRepo.UpdateBookmark(context, other); !errors.Is(err, repo.ErrNotFound) {
+			t.Fatalf("Expected ErrNotFound; received: %v", err)
+		}
+		if err := bookmarkRepo.DeleteBookmark(context, 2, id); !errors.Is(err, repo.ErrNotFound) {
+			t.Fatalf("Expected ErrNotFound; received: %v", err)
+		}
+	})
+	t.Run("should update Bookmark", func(t *testing.T) {
+		updated := bookmark
+		updated.Note = "Sun Tzu on terrain"
+		if err := bookmarkRepo.UpdateBookmark(context, updated); err != nil {
+			t.Fatal(err)
+		}
+		bookmarks, err := bookmarkRepo.GetBookmarks(context, 1, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(bookmarks) != 1 || bookmarks[0].Note != updated.Note {
+			t.Fatalf("Unexpected bookmarks %+v", bookmarks)
+		}
+	})
+	t.Run("should delete Bookmark", func(t *testing.T) {
+		if err := bookmarkRepo.DeleteBookmark(context, 1, id); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := bookmarkRepo.GetBookmark(context, 1, id); !errors.Is(err, repo.ErrNotFound) {
+			t.Fatalf("Expected ErrNotFound; received: %v", err)
+		}
+	})
+	t.Run("should delete Bookmarks along with Audiobook", func(t *testing.T) {
+		if _, err := bookmarkRepo.InsertBookmark(context, bookmark); err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.NewAudiobookRepository(client).DeleteAudiobook(context, bookmark.AudiobookId); err != nil {
+			t.Fatal(err)
+		}
+		if bookmarks, err := bookmarkRepo.GetBookmarks(context, 1, bookmark.AudiobookId); err != nil || len(bookmarks) != 0 {
+			t.Fatalf("Expected bookmarks to be deleted; received: %+v, %v", bookmarks, err)
+		}
+	})
+}
@@ -0,0 +1,175 @@
+package repo
+
+import (
+	"context"
+	"strings"
+
+	"github.com/bongofriend/bookplayer/backend/lib/data/datasource"
+	"github.com/bongofriend/bookplayer/backend/lib/models"
+)
+
+type CatalogRepositoryService struct {
+	client *DbClient
+}
+
+// Browse the library by the people and series audiobooks are linked to
+type CatalogRepository interface {
+	GetAuthors(context context.Context) ([]models.CatalogEntry, error)
+	GetNarrators(context context.Context) ([]models.CatalogEntry, error)
+	GetSeries(context context.Context) ([]models.CatalogEntry, error)
+	GetAudiobooksByAuthor(context context.Context, personId int64) ([]models.AudiobookProcessed, error)
+	GetAudiobooksByNarrator(context context.Context, personId int64) ([]models.AudiobookProcessed, error)
+	GetAudiobooksBySeries(context context.Context, seriesId int64) ([]models.AudiobookProcessed, error)
+}
+
+func NewCatalogRepository(client *DbClient) *CatalogRepositoryService {
+	return &CatalogRepositoryService{client}
+}
+
+func (r *CatalogRepositoryService) GetAuthors(context context.Context) ([]models.CatalogEntry, error) {
+	rows, err := r.client.queries.GetAuthors(context)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]models.CatalogEntry, len(rows))
+	for idx, row := range rows {
+		entries[idx] = models.CatalogEntry{Id: row.ID, Name: row.Name, AudiobookCount: row.AudiobookCount}
+	}
+	return entries, nil
+}
+
+func (r *CatalogRepositoryService) GetNarrators(context context.Context) ([]models.CatalogEntry, error) {
+	rows, err := r.client.queries.GetNarrators(context)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]models.CatalogEntry, len(rows))
+	for idx, row := range rows {
+		entries[idx] = models.CatalogEntry{Id: row.ID, Name: row.Name, AudiobookCount: row.AudiobookCount}
+	}
+	return entries, nil
+}
+
+func (r *CatalogRepositoryService) GetSeries(context context.Context) ([]models.CatalogEntry, error) {
+	rows, err := r.client.queries.GetSeries(context)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]models.CatalogEntry, len(rows))
+	for idx, row := range rows {
+		entries[idx] = models.CatalogEntry{Id: row.ID, Name: row.Name, AudiobookCount: row.AudiobookCount}
+	}
+	return entries, nil
+}
+
+func (r *CatalogRepositoryService) GetAudiobooksByAuthor(context context.Context, personId int64) ([]models.AudiobookProcessed, error) {
+	rows, err := r.client.queries.GetAudiobooksByAuthor(context, personId)
+	if err != nil {
+		return nil, err
+	}
+	return audiobooksWithContributors(context, &r.client.queries, rows)
+}
+
+func (r *CatalogRepositoryService) GetAudiobooksByNarrator(context context.Context, personId int64) ([]models.AudiobookProcessed, error) {
+	rows, err := r.client.queries.GetAudiobooksByNarrator(context, personId)
+	if err != nil {
+		return nil, err
+	}
+	return audiobooksWithContributors(context, &r.client.queries, rows)
+}
+
+func (r *CatalogRepositoryService) GetAudiobooksBySeries(context context.Context, seriesId int64) ([]models.AudiobookProcessed, error) {
+	rows, err := r.client.queries.GetAudiobooksBySeries(context, seriesId)
+	if err != nil {
+		return nil, err
+	}
+	return audiobooksWithContributors(context, &r.client.queries, rows)
+}
+
+// Link an inserted audiobook to its people, genres and series; must run inside the insert transaction
+func insertContributors(context context.Context, q *datasource.Queries, audiobookId int64, audiobook models.AudiobookCommon) error {
+	for idx, name := range audiobook.Authors {
+		personId, err := q.UpsertPerson(context, name)
+		if err != nil {
+			return err
+		}
+		if err := q.InsertAudiobookAuthor(context, datasource.InsertAudiobookAuthorParams{
+			AudiobookID: audiobookId,
+			PersonID:    personId,
+			Position:    int64(idx),
+		}); err != nil {
+			return err
+		}
+	}
+	for idx, name := range audiobook.Narrators {
+		personId, err := q.UpsertPerson(context, name)
+		if err != nil {
+			return err
+		}
+		if err := q.InsertAudiobookNarrator(context, datasource.InsertAudiobookNarratorParams{
+			AudiobookID: audiobookId,
+			PersonID:    personId,
+			Position:    int64(idx),
+		}); err != nil {
+			return err
+		}
+	}
+	for _, name := range audiobook.Genres {
+		genreId, err := q.UpsertGenre(context, name)
+		if err != nil {
+			return err
+		}
+		if err := q.InsertAudiobookGenre(context, datasource.InsertAudiobookGenreParams{
+			AudiobookID: audiobookId,
+			GenreID:     genreId,
+		}); err != nil {
+			return err
+		}
+	}
+	if series := strings.TrimSpace(audiobook.Series); series != "" {
+		seriesId, err := q.UpsertSeries(context, series)
+		if err != nil {
+			return err
+		}
+		return q.InsertAudiobookSeries(context, datasource.InsertAudiobookSeriesParams{
+			AudiobookID: audiobookId,
+			SeriesID:    seriesId,
+			Position:    audiobook.SeriesPosition,
+		})
+	}
+	return nil
+}
+
+// Fill the normalized people, genres and series of a loaded audiobook
+func loadContributors(context context.Context, q *datasource.Queries, audiobook *models.AudiobookProcessed) error {
+	var err error
+	if audiobook.Authors, err = q.GetAudiobookAuthors(context, audiobook.Id); err != nil {
+		return err
+	}
+	if audiobook.Narrators, err = q.GetAudiobookNarrators(context, audiobook.Id); err != nil {
+		return err
+	}
+	if audiobook.Genres, err = q.GetAudiobookGenres(context, audiobook.Id); err != nil {
+		return err
+	}
+	series, err := q.GetAudiobookSeries(context, audiobook.Id)
+	if err != nil {
+		return err
+	}
+	if len(series) > 0 {
+		audiobook.Series = series[0].Name
+		audiobook.SeriesPosition = series[0].Position
+	}
+	return nil
+}
+
+func audiobooksWithContributors(context context.Context, q *datasource.Queries, rows []datasource.Audiobook) ([]models.AudiobookProcessed, error) {
+	audiobooks := make([]models.AudiobookProcessed, len(rows))
+	for idx, row := range rows {
+		audiobooks[idx] = audiobookAsModel(row)
+		if err := loadContributors(context, q, &audiobooks[idx]); err != nil {
+			return nil, err
+		}
+	}
+	return audiobooks, nil
+}
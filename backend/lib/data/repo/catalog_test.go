@@ -0,0 +1,109 @@
+package repo_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/bongofriend/bookplayer/backend/lib/data/repo"
+	"github.com/bongofriend/bookplayer/backend/lib/models"
+)
+
+func TestCatalogRepository(t *testing.T) {
+	insert := func(t *testing.T, audiobookRepo repo.AudiobookRepository, title string, authors []string, narrators []string, series string, position string) int64 {
+		id, err := audiobookRepo.InsertAudiobook(context.Background(), models.AudiobookProcessed{
+			AudiobookCommon: models.AudiobookCommon{
+				Title:          title,
+				Authors:        authors,
+				Narrators:      narrators,
+				Genres:         []string{"Fantasy"},
+				Series:         series,
+				SeriesPosition: position,
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+
+	t.Run("should store normalized contributors", func(t *testing.T) {
+		config := prepareDatabase(t)
+		client, err := repo.NewDbClient(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		audiobookRepo := repo.NewAudiobookRepository(client)
+		id := insert(t, audiobookRepo, "Good Omens", []string{"Terry Pratchett", "Neil Gaiman"}, []string{"Stephen Fry", "Jim Dale"}, "", "")
+
+		fetched, err := audiobookRepo.GetAudiobookById(context.Background(), id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(fetched.Authors, []string{"Terry Pratchett", "Neil Gaiman"}) {
+			t.Fatalf("Unexpected authors %v", fetched.Authors)
+		}
+		if !slices.Equal(fetched.Narrators, []string{"Stephen Fry", "Jim Dale"}) {
+			t.Fatalf("Unexpected narrators %v", fetched.Narrators)
+		}
+		if !slices.Equal(fetched.Genres, []string{"Fantasy"}) {
+			t.Fatalf("Unexpected genres %v", fetched.Genres)
+		}
+	})
+	t.Run("should browse by author, narrator and series", func(t *testing.T) {
+		config := prepareDatabase(t)
+		client, err := repo.NewDbClient(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		context := context.Background()
+		audiobookRepo := repo.NewAudiobookRepository(client)
+		catalogRepo := repo.NewCatalogRepository(client)
+		insert(t, audiobookRepo, "Guards! Guards!", []string{"Terry Pratchett"}, []string{"Nigel Planer"}, "Discworld", "8")
+		insert(t, audiobookRepo, "Mort", []string{"terry pratchett"}, []string{"Nigel Planer"}, "Discworld", "4")
+		insert(t, audiobookRepo, "Stardust", []string{"Neil Gaiman"}, []string{"Neil Gaiman"}, "", "")
+
+		authors, err := catalogRepo.GetAuthors(context)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(authors) != 2 || authors[0].Name != "Neil Gaiman" || authors[1].AudiobookCount != 2 {
+			t.Fatalf("Unexpected authors %v", authors)
+		}
+		narrators, err := catalogRepo.GetNarrators(context)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(narrators) != 2 {
+			t.Fatalf("Expected 2 narrators; received: %v", narrators)
+		}
+		series, err := catalogRepo.GetSeries(context)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(series) != 1 || series[0].Name != "Discworld" || series[0].AudiobookCount != 2 {
+			t.Fatalf("Unexpected series %v", series)
+		}
+		books, err := catalogRepo.GetAudiobooksBySeries(context, series[0].Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(books) != 2 || books[0].Title != "Mort" || books[0].SeriesPosition != "4" {
+			t.Fatalf("Expected series ordered by position; received: %v", books)
+		}
+		books, err = catalogRepo.GetAudiobooksByAuthor(context, authors[1].Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(books) != 2 {
+			t.Fatalf("Expected 2 audiobooks by %s; received: %d", authors[1].Name, len(books))
+		}
+		books, err = catalogRepo.GetAudiobooksByNarrator(context, authors[0].Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(books) != 1 || books[0].Title != "Stardust" {
+			t.Fatalf("Unexpected audiobooks %v", books)
+		}
+	})
+}
@@ -2,10 +2,21 @@ package repo
 
 import (
 	"database/sql"
+	"errors"
+	"strings"
 
 	"github.com/bongofriend/bookplayer/backend/lib/config"
 	"github.com/bongofriend/bookplayer/backend/lib/data/datasource"
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
+)
+
+var (
+	// Returned by repositories if a requested entity does not exist
+	ErrNotFound = errors.New("not found")
+	// Returned by repositories if an entity violates a uniqueness constraint
+	ErrConflict = errors.New("already exists")
+	// Returned by repositories if an entity cannot be changed in its current state
+	ErrInvalidState = errors.New("cannot be changed in its current state")
 )
 
 type DbClient struct {
@@ -14,7 +25,7 @@ type DbClient struct {
 }
 
 func NewDbClient(config config.DatabaseConfig) (*DbClient, error) {
-	db, err := sql.Open(config.Driver, config.Path)
+	db, err := sql.Open(config.Driver, withForeignKeys(config.Path))
 	if err != nil {
 		return nil, err
 	}
@@ -24,6 +35,22 @@ func NewDbClient(config config.DatabaseConfig) (*DbClient, error) {
 	}, nil
 }
 
+// SQLite only enforces foreign keys, and with them on delete clauses, if every connection asks for it
+func withForeignKeys(dsn string) string {
+	if strings.Contains(dsn, "?") {
+		return dsn + "&_foreign_keys=1"
+	}
+	return dsn + "?_foreign_keys=1"
+}
+
 func (c *DbClient) Close() error {
 	return c.db.Close()
 }
+
+func isUniqueConstraintError(err error) bool {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique || sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey
+	}
+	return false
+}
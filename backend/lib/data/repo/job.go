@@ -0,0 +1,253 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/bongofriend/bookplayer/backend/lib/data/datasource"
+	"github.com/bongofriend/bookplayer/backend/lib/models"
+)
+
+type JobRepositoryService struct {
+	client *DbClient
+}
+
+// Processing jobs of audiobook sources, one per source
+type JobRepository interface {
+	// All jobs, most recently updated first
+	GetJobs(context context.Context) ([]models.Job, error)
+	GetJob(context context.Context, id int64) (*models.Job, error)
+	GetJobBySource(context context.Context, sourcePath string) (*models.Job, error)
+	// Queue the job of a source with the given content; progress is kept unless the content changed or the job was done
+	QueueJob(context context.Context, sourcePath string, contentKey string) error
+	// Queue the job of a source to start over from discovery, discarding the results of completed stages
+	RestartJob(context context.Context, sourcePath string, contentKey string) error
+	// Record the result of a completed stage; ErrNotFound if the job is not active, e.g. because it was canceled
+	AdvanceJob(context context.Context, sourcePath string, stage string, result any) error
+	// Mark an active job as failed; ErrNotFound if there is none
+	FailJob(context context.Context, sourcePath string, message string) error
+	// Queue a failed or canceled job again; its source is processed again at the next scan
+	RetryJob(context context.Context, id int64) error
+	// Stop an active or failed job; its source is not processed again until it changes or the job is retried
+	CancelJob(context context.Context, id int64) error
+}
+
+func NewJobRepository(client *DbClient) *JobRepositoryService {
+	return &JobRepositoryService{client}
+}
+
+func (r *JobRepositoryService) GetJobs(context context.Context) ([]models.Job, error) {
+	rows, err := r.client.queries.GetJobs(context)
+	if err != nil {
+		return nil, err
+	}
+	jobs := make([]models.Job, len(rows))
+	for idx, row := range rows {
+		job, err := jobAsModel(row)
+		if err != nil {
+			return nil, err
+		}
+		jobs[idx] = *job
+	}
+	return jobs, nil
+}
+
+func (r *JobRepositoryService) GetJob(context context.Context, id int64) (*models.Job, error) {
+	return getJob(context, &r.client.queries, id)
+}
+
+func (r *JobRepositoryService) GetJobBySource(context context.Context, sourcePath string) (*models.Job, error) {
+	row, err := r.client.queries.GetJobBySource(context, sourcePath)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("job for %s %w", sourcePath, ErrNotFound)
+		}
+		return nil, err
+	}
+	return jobAsModel(row)
+}
+
+func (r *JobRepositoryService) QueueJob(context context.Context, sourcePath string, contentKey string) error {
+	now := time.Now().UnixMilli()
+	return r.client.queries.QueueJob(context, datasource.QueueJobParams{
+		SourcePath: sourcePath,
+		ContentKey: contentKey,
+		Stage:      models.JobStageDiscovered,
+		State:      models.JobStateActive,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	})
+}
+
+func (r *JobRepositoryService) RestartJob(context context.Context, sourcePath string, contentKey string) error {
+	now := time.Now().UnixMilli()
+	return r.client.queries.RestartJob(context, datasource.RestartJobParams{
+		SourcePath: sourcePath,
+		ContentKey: contentKey,
+		Stage:      models.JobStageDiscovered,
+		State:      models.JobStateActive,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	})
+}
+
+func (r *JobRepositoryService) AdvanceJob(context context.Context, sourcePath string, stage string, result any) error {
+	tx, err := r.client.db.Begin()
+	if err != nil {
+		return err
+	}
+	qtx := r.client.queries.WithTx(tx)
+	row, err := qtx.GetJobBySource(context, sourcePath)
+	if err != nil {
+		tx.Rollback()
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("job for %s %w", sourcePath, ErrNotFound)
+		}
+		return err
+	}
+	params := datasource.AdvanceJobParams{
+		Stage:      stage,
+		State:      models.JobStateActive,
+		UpdatedAt:  time.Now().UnixMilli(),
+		SourcePath: sourcePath,
+		State_2:    models.JobStateActive,
+	}
+	if stage == models.JobStageStored {
+		// Results are only kept for resuming and not needed anymore
+		params.State = models.JobStateDone
+	} else {
+		results := map[string]json.RawMessage{}
+		if len(row.Results) > 0 {
+			if err := json.Unmarshal([]byte(row.Results), &results); err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+		if results[stage], err = json.Marshal(result); err != nil {
+			tx.Rollback()
+			return err
+		}
+		encoded, err := json.Marshal(results)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		params.Results = string(encoded)
+	}
+	affected, err := qtx.AdvanceJob(context, params)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if affected == 0 {
+		tx.Rollback()
+		return fmt.Errorf("active job for %s %w", sourcePath, ErrNotFound)
+	}
+	return tx.Commit()
+}
+
+func (r *JobRepositoryService) FailJob(context context.Context, sourcePath string, message string) error {
+	affected, err := r.client.queries.FailJob(context, datasource.FailJobParams{
+		State:      models.JobStateFailed,
+		Error:      message,
+		UpdatedAt:  time.Now().UnixMilli(),
+		SourcePath: sourcePath,
+		State_2:    models.JobStateActive,
+	})
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return fmt.Errorf("active job for %s %w", sourcePath, ErrNotFound)
+	}
+	return nil
+}
+
+func (r *JobRepositoryService) RetryJob(context context.Context, id int64) error {
+	// Failed sources without a scheduled retry are due at the next scan
+	return r.changeJobState(context, id, []string{models.JobStateFailed, models.JobStateCanceled}, models.JobStateActive, func(qtx *datasource.Queries, job *models.Job, updatedAt int64) error {
+		return qtx.ResetSourceFailures(context, datasource.ResetSourceFailuresParams{
+			Status:     models.SourceStatusFailed,
+			UpdatedAt:  updatedAt,
+			SourcePath: job.SourcePath,
+		})
+	})
+}
+
+func (r *JobRepositoryService) CancelJob(context context.Context, id int64) error {
+	return r.changeJobState(context, id, []string{models.JobStateActive, models.JobStateFailed}, models.JobStateCanceled, func(qtx *datasource.Queries, job *models.Job, updatedAt int64) error {
+		_, err := qtx.UpdateSourceStatus(context, datasource.UpdateSourceStatusParams{
+			Status:     models.SourceStatusCanceled,
+			UpdatedAt:  updatedAt,
+			SourcePath: job.SourcePath,
+		})
+		return err
+	})
+}
+
+// Move a job in one of the states from to state and update its source files accordingly
+func (r *JobRepositoryService) changeJobState(context context.Context, id int64, from []string, state string, updateSource func(qtx *datasource.Queries, job *models.Job, updatedAt int64) error) error {
+	tx, err := r.client.db.Begin()
+	if err != nil {
+		return err
+	}
+	qtx := r.client.queries.WithTx(tx)
+	job, err := getJob(context, qtx, id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if !slices.Contains(from, job.State) {
+		tx.Rollback()
+		return fmt.Errorf("job with id %d is %s and %w", id, job.State, ErrInvalidState)
+	}
+	updatedAt := time.Now().UnixMilli()
+	if err := qtx.UpdateJobState(context, datasource.UpdateJobStateParams{
+		State:     state,
+		UpdatedAt: updatedAt,
+		ID:        id,
+	}); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := updateSource(qtx, job, updatedAt); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func getJob(context context.Context, q *datasource.Queries, id int64) (*models.Job, error) {
+	row, err := q.GetJob(context, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("job with id %d %w", id, ErrNotFound)
+		}
+		return nil, err
+	}
+	return jobAsModel(row)
+}
+
+func jobAsModel(row datasource.Job) (*models.Job, error) {
+	job := &models.Job{
+		Id:         row.ID,
+		SourcePath: row.SourcePath,
+		Stage:      row.Stage,
+		State:      row.State,
+		Error:      row.Error,
+		CreatedAt:  time.UnixMilli(row.CreatedAt),
+		UpdatedAt:  time.UnixMilli(row.UpdatedAt),
+		Results:    map[string]json.RawMessage{},
+	}
+	if len(row.Results) > 0 {
+		if err := json.Unmarshal([]byte(row.Results), &job.Results); err != nil {
+			return nil, fmt.Errorf("results of job with id %d: %w", row.ID, err)
+		}
+	}
+	return job, nil
+}
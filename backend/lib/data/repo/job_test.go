@@ -0,0 +1,140 @@
+package repo_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bongofriend/bookplayer/backend/lib/data/repo"
+	"github.com/bongofriend/bookplayer/backend/lib/models"
+)
+
+func TestJobRepository(t *testing.T) {
+	files := []models.SourceFile{
+		{Path: "Author/Book/01.mp3", Size: 100, ModTime: time.Now(), Hash: "a"},
+	}
+	type metadata struct {
+		Title string
+	}
+
+	t.Run("should advance and resume jobs", func(t *testing.T) {
+		config := prepareDatabase(t)
+		client, err := repo.NewDbClient(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		context := context.Background()
+		jobRepo := repo.NewJobRepository(client)
+
+		if err := jobRepo.QueueJob(context, "Author/Book", "a"); err != nil {
+			t.Fatal(err)
+		}
+		if err := jobRepo.AdvanceJob(context, "Author/Book", models.JobStageProbed, metadata{Title: "Book"}); err != nil {
+			t.Fatal(err)
+		}
+		// Queued again after an interruption
+		if err := jobRepo.QueueJob(context, "Author/Book", "a"); err != nil {
+			t.Fatal(err)
+		}
+		job, err := jobRepo.GetJobBySource(context, "Author/Book")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.Stage != models.JobStageProbed || job.State != models.JobStateActive || string(job.Results[models.JobStageProbed]) != `{"Title":"Book"}` {
+			t.Fatalf("Unexpected job %+v", job)
+		}
+
+		if err := jobRepo.QueueJob(context, "Author/Book", "b"); err != nil {
+			t.Fatal(err)
+		}
+		job, _ = jobRepo.GetJobBySource(context, "Author/Book")
+		if job.Stage != models.JobStageDiscovered || len(job.Results) != 0 {
+			t.Fatalf("Expected changed source to start over; received: %+v", job)
+		}
+
+		if err := jobRepo.AdvanceJob(context, "Author/Book", models.JobStageProbed, metadata{Title: "Book"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := jobRepo.RestartJob(context, "Author/Book", "b"); err != nil {
+			t.Fatal(err)
+		}
+		job, _ = jobRepo.GetJobBySource(context, "Author/Book")
+		if job.Stage != models.JobStageDiscovered || len(job.Results) != 0 {
+			t.Fatalf("Expected restarted job to start over; received: %+v", job)
+		}
+
+		if err := jobRepo.AdvanceJob(context, "Author/Book", models.JobStageStored, struct{}{}); err != nil {
+			t.Fatal(err)
+		}
+		jobs, err := jobRepo.GetJobs(context)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(jobs) != 1 || jobs[0].State != models.JobStateDone || len(jobs[0].Results) != 0 {
+			t.Fatalf("Unexpected jobs %+v", jobs)
+		}
+		if err := jobRepo.AdvanceJob(context, "Author/Book", models.JobStageProbed, metadata{}); !errors.Is(err, repo.ErrNotFound) {
+			t.Fatalf("Expected ErrNotFound for finished job; received: %v", err)
+		}
+	})
+	t.Run("should cancel and retry jobs", func(t *testing.T) {
+		config := prepareDatabase(t)
+		client, err := repo.NewDbClient(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		context := context.Background()
+		jobRepo := repo.NewJobRepository(client)
+		sourceFileRepo := repo.NewSourceFileRepository(client)
+		if err := sourceFileRepo.SaveSourceFiles(context, "Author/Book", files); err != nil {
+			t.Fatal(err)
+		}
+		if err := jobRepo.QueueJob(context, "Author/Book", "a"); err != nil {
+			t.Fatal(err)
+		}
+		job, err := jobRepo.GetJobBySource(context, "Author/Book")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := jobRepo.RetryJob(context, job.Id); !errors.Is(err, repo.ErrInvalidState) {
+			t.Fatalf("Expected ErrInvalidState for active job; received: %v", err)
+		}
+		if err := jobRepo.CancelJob(context, job.Id); err != nil {
+			t.Fatal(err)
+		}
+		saved, _ := sourceFileRepo.GetSourceFiles(context, "Author/Book")
+		if saved[0].Status != models.SourceStatusCanceled {
+			t.Fatalf("Expected canceled source; received: %+v", saved[0])
+		}
+		if err := jobRepo.AdvanceJob(context, "Author/Book", models.JobStageProbed, metadata{}); !errors.Is(err, repo.ErrNotFound) {
+			t.Fatalf("Expected ErrNotFound for canceled job; received: %v", err)
+		}
+
+		if err := sourceFileRepo.RecordSourceFailure(context, "Author/Book", models.SourceFailure{Stage: "chapters", Error: "ffmpeg failed", Attempts: 5}); err != nil {
+			t.Fatal(err)
+		}
+		if err := jobRepo.RetryJob(context, job.Id); err != nil {
+			t.Fatal(err)
+		}
+		retried, err := jobRepo.GetJob(context, job.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		saved, _ = sourceFileRepo.GetSourceFiles(context, "Author/Book")
+		if retried.State != models.JobStateActive || saved[0].Status != models.SourceStatusFailed || saved[0].Attempts != 0 || saved[0].RetryAt != nil {
+			t.Fatalf("Expected source to be due for processing; received: %+v", saved[0])
+		}
+
+		if err := jobRepo.FailJob(context, "Author/Book", "invalid data"); err != nil {
+			t.Fatal(err)
+		}
+		if err := sourceFileRepo.DeleteSource(context, "Author/Book"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := jobRepo.GetJob(context, job.Id); !errors.Is(err, repo.ErrNotFound) {
+			t.Fatalf("Expected job to be deleted with its source; received: %v", err)
+		}
+	})
+}
@@ -0,0 +1,305 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/bongofriend/bookplayer/backend/lib/data/datasource"
+	"github.com/bongofriend/bookplayer/backend/lib/models"
+)
+
+type OverrideRepositoryService struct {
+	client *DbClient
+}
+
+// Values edited by users, stored apart from the audiobooks so processing a source again does not overwrite them
+type OverrideRepository interface {
+	// Overrides of the audiobook with id; empty if nothing was edited
+	GetOverrides(context context.Context, audiobookId int64) (*models.Overrides, error)
+	// Overrides of the audiobook processed from the source at relativePath
+	GetOverridesBySource(context context.Context, relativePath string) (*models.Overrides, error)
+	// Merge override into the stored one and apply it to the audiobook right away
+	SaveAudiobookOverride(context context.Context, audiobookId int64, override models.AudiobookOverride) error
+	// Merge overrides into the stored ones by numbering and apply chapter titles right away; boundaries apply once the source is split again
+	SaveChapterOverrides(context context.Context, audiobookId int64, overrides []models.ChapterOverride) error
+	// Drop all overrides of the audiobook; extracted values return once its source is processed again
+	DeleteOverrides(context context.Context, audiobookId int64) error
+}
+
+func NewOverrideRepository(client *DbClient) *OverrideRepositoryService {
+	return &OverrideRepositoryService{client}
+}
+
+func (r *OverrideRepositoryService) GetOverrides(context context.Context, audiobookId int64) (*models.Overrides, error) {
+	if _, err := r.client.queries.GetAudiobook(context, audiobookId); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("audiobook with id %d %w", audiobookId, ErrNotFound)
+		}
+		return nil, err
+	}
+	return getOverrides(context, &r.client.queries, audiobookId)
+}
+
+func (r *OverrideRepositoryService) GetOverridesBySource(context context.Context, relativePath string) (*models.Overrides, error) {
+	row, err := r.client.queries.GetAudiobookByRelativePath(context, relativePath)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("audiobook from %s %w", relativePath, ErrNotFound)
+		}
+		return nil, err
+	}
+	return getOverrides(context, &r.client.queries, row.ID)
+}
+
+func getOverrides(context context.Context, q *datasource.Queries, audiobookId int64) (*models.Overrides, error) {
+	overrides := models.Overrides{Chapters: []models.ChapterOverride{}}
+	row, err := q.GetAudiobookOverride(context, audiobookId)
+	if err == nil {
+		if overrides.Audiobook, err = audiobookOverrideAsModel(row); err != nil {
+			return nil, err
+		}
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	chapterRows, err := q.GetChapterOverrides(context, audiobookId)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range chapterRows {
+		overrides.Chapters = append(overrides.Chapters, chapterOverrideAsModel(c))
+	}
+	return &overrides, nil
+}
+
+func (r *OverrideRepositoryService) SaveAudiobookOverride(context context.Context, audiobookId int64, override models.AudiobookOverride) error {
+	tx, err := r.client.db.Begin()
+	if err != nil {
+		return err
+	}
+	qtx := r.client.queries.WithTx(tx)
+	if err := saveAudiobookOverride(context, qtx, audiobookId, override); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func saveAudiobookOverride(context context.Context, q *datasource.Queries, audiobookId int64, override models.AudiobookOverride) error {
+	row, err := q.GetAudiobook(context, audiobookId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("audiobook with id %d %w", audiobookId, ErrNotFound)
+		}
+		return err
+	}
+	stored, err := getOverrides(context, q, audiobookId)
+	if err != nil {
+		return err
+	}
+	merged := stored.Audiobook.Merge(override)
+	params, err := audiobookOverrideAsParams(audiobookId, merged)
+	if err != nil {
+		return err
+	}
+	if err := q.UpsertAudiobookOverride(context, params); err != nil {
+		return err
+	}
+
+	audiobook := audiobookAsModel(row)
+	if err := loadContributors(context, q, &audiobook); err != nil {
+		return err
+	}
+	merged.Apply(&audiobook.AudiobookCommon)
+	if err := q.UpdateAudiobookDetails(context, datasource.UpdateAudiobookDetailsParams{
+		Title:       audiobook.Title,
+		Author:      audiobook.Author,
+		Narrator:    audiobook.Narrator,
+		Description: audiobook.Description,
+		Genre:       audiobook.Genre,
+		ID:          audiobookId,
+	}); err != nil {
+		return err
+	}
+	contributors := []deleteByAudiobookId{
+		q.DeleteAudiobookAuthors,
+		q.DeleteAudiobookNarrators,
+		q.DeleteAudiobookGenres,
+		q.DeleteAudiobookSeries,
+	}
+	for _, deleteRows := range contributors {
+		if err := deleteRows(context, audiobookId); err != nil {
+			return err
+		}
+	}
+	return insertContributors(context, q, audiobookId, audiobook.AudiobookCommon)
+}
+
+func (r *OverrideRepositoryService) SaveChapterOverrides(context context.Context, audiobookId int64, overrides []models.ChapterOverride) error {
+	tx, err := r.client.db.Begin()
+	if err != nil {
+		return err
+	}
+	qtx := r.client.queries.WithTx(tx)
+	if err := saveChapterOverrides(context, qtx, audiobookId, overrides); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func saveChapterOverrides(context context.Context, q *datasource.Queries, audiobookId int64, overrides []models.ChapterOverride) error {
+	if _, err := q.GetAudiobook(context, audiobookId); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("audiobook with id %d %w", audiobookId, ErrNotFound)
+		}
+		return err
+	}
+	stored, err := getOverrides(context, q, audiobookId)
+	if err != nil {
+		return err
+	}
+	for _, override := range overrides {
+		merged := override
+		for _, s := range stored.Chapters {
+			if s.Numbering != override.Numbering {
+				continue
+			}
+			if merged.Title == nil {
+				merged.Title = s.Title
+			}
+			if merged.EndTime == nil {
+				merged.EndTime = s.EndTime
+			}
+		}
+		params := datasource.UpsertChapterOverrideParams{
+			AudiobookID: audiobookId,
+			Numbering:   int64(merged.Numbering),
+			Title:       nullString(merged.Title),
+		}
+		if merged.EndTime != nil {
+			params.EndTime = sql.NullFloat64{Float64: float64(*merged.EndTime), Valid: true}
+		}
+		if err := q.UpsertChapterOverride(context, params); err != nil {
+			return err
+		}
+		if override.Title == nil {
+			continue
+		}
+		if err := q.UpdateChapterTitle(context, datasource.UpdateChapterTitleParams{
+			Title:       *override.Title,
+			AudiobookID: audiobookId,
+			Numbering:   int64(override.Numbering),
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *OverrideRepositoryService) DeleteOverrides(context context.Context, audiobookId int64) error {
+	tx, err := r.client.db.Begin()
+	if err != nil {
+		return err
+	}
+	qtx := r.client.queries.WithTx(tx)
+	for _, deleteRows := range []deleteByAudiobookId{qtx.DeleteAudiobookOverride, qtx.DeleteChapterOverrides} {
+		if err := deleteRows(context, audiobookId); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func audiobookOverrideAsParams(audiobookId int64, o models.AudiobookOverride) (datasource.UpsertAudiobookOverrideParams, error) {
+	params := datasource.UpsertAudiobookOverrideParams{
+		AudiobookID:    audiobookId,
+		Title:          nullString(o.Title),
+		Description:    nullString(o.Description),
+		Series:         nullString(o.Series),
+		SeriesPosition: nullString(o.SeriesPosition),
+	}
+	var err error
+	if params.Authors, err = nullNames(o.Authors); err != nil {
+		return params, err
+	}
+	if params.Narrators, err = nullNames(o.Narrators); err != nil {
+		return params, err
+	}
+	if params.Genres, err = nullNames(o.Genres); err != nil {
+		return params, err
+	}
+	return params, nil
+}
+
+func audiobookOverrideAsModel(o datasource.AudiobookOverride) (models.AudiobookOverride, error) {
+	override := models.AudiobookOverride{
+		Title:          stringOrNil(o.Title),
+		Description:    stringOrNil(o.Description),
+		Series:         stringOrNil(o.Series),
+		SeriesPosition: stringOrNil(o.SeriesPosition),
+	}
+	var err error
+	if override.Authors, err = namesOrNil(o.Authors); err != nil {
+		return override, err
+	}
+	if override.Narrators, err = namesOrNil(o.Narrators); err != nil {
+		return override, err
+	}
+	if override.Genres, err = namesOrNil(o.Genres); err != nil {
+		return override, err
+	}
+	return override, nil
+}
+
+func chapterOverrideAsModel(c datasource.ChapterOverride) models.ChapterOverride {
+	override := models.ChapterOverride{
+		Numbering: int(c.Numbering),
+		Title:     stringOrNil(c.Title),
+	}
+	if c.EndTime.Valid {
+		endTime := float32(c.EndTime.Float64)
+		override.EndTime = &endTime
+	}
+	return override
+}
+
+func nullString(s *string) sql.NullString {
+	if s == nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: *s, Valid: true}
+}
+
+func stringOrNil(s sql.NullString) *string {
+	if !s.Valid {
+		return nil
+	}
+	return &s.String
+}
+
+// Names are stored as JSON array so names containing separators survive
+func nullNames(names []string) (sql.NullString, error) {
+	if names == nil {
+		return sql.NullString{}, nil
+	}
+	data, err := json.Marshal(names)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	return sql.NullString{String: string(data), Valid: true}, nil
+}
+
+func namesOrNil(s sql.NullString) ([]string, error) {
+	if !s.Valid {
+		return nil, nil
+	}
+	names := []string{}
+	if err := json.Unmarshal([]byte(s.String), &names); err != nil {
+		return nil, err
+	}
+	return names, nil
+}
@@ -0,0 +1,102 @@
+package repo_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/bongofriend/bookplayer/backend/lib/data/repo"
+	"github.com/bongofriend/bookplayer/backend/lib/models"
+)
+
+func TestOverrideRepository(t *testing.T) {
+	prepare := func(t *testing.T) (*repo.AudiobookRepositoryService, *repo.OverrideRepositoryService, int64) {
+		config := prepareDatabase(t)
+		client, err := repo.NewDbClient(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		audiobookRepo := repo.NewAudiobookRepository(client)
+		model := getAudiobookModel()
+		model.RelativePath = "Sun Tzu/The Art of War.m4b"
+		model.Authors = []string{"Sun Tzu"}
+		id, err := audiobookRepo.UpsertAudiobook(context.Background(), *model)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return audiobookRepo, repo.NewOverrideRepository(client), id
+	}
+	title := "The Art of War"
+	series := "Classics"
+
+	t.Run("should apply and keep audiobook overrides", func(t *testing.T) {
+		audiobookRepo, overrideRepo, id := prepare(t)
+		context := context.Background()
+		if err := overrideRepo.SaveAudiobookOverride(context, id, models.AudiobookOverride{Title: &title, Authors: []string{"Sunzi", "Lionel Giles"}}); err != nil {
+			t.Fatal(err)
+		}
+		// Merged with the override saved before
+		if err := overrideRepo.SaveAudiobookOverride(context, id, models.AudiobookOverride{Series: &series}); err != nil {
+			t.Fatal(err)
+		}
+		audiobook, err := audiobookRepo.GetAudiobookById(context, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if audiobook.Title != title || audiobook.Author != "Sunzi, Lionel Giles" || len(audiobook.Authors) != 2 || audiobook.Series != series {
+			t.Fatalf("Unexpected audiobook %+v", audiobook.AudiobookCommon)
+		}
+		overrides, err := overrideRepo.GetOverridesBySource(context, "Sun Tzu/The Art of War.m4b")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if o := overrides.Audiobook; o.Title == nil || *o.Title != title || len(o.Authors) != 2 || o.Series == nil || o.Narrators != nil {
+			t.Fatalf("Unexpected overrides %+v", o)
+		}
+
+		if err := overrideRepo.DeleteOverrides(context, id); err != nil {
+			t.Fatal(err)
+		}
+		if overrides, err = overrideRepo.GetOverrides(context, id); err != nil {
+			t.Fatal(err)
+		}
+		if overrides.Audiobook.Title != nil || len(overrides.Chapters) > 0 {
+			t.Fatalf("Expected overrides to be removed; received: %+v", overrides)
+		}
+	})
+	t.Run("should apply chapter titles and keep boundaries", func(t *testing.T) {
+		audiobookRepo, overrideRepo, id := prepare(t)
+		context := context.Background()
+		endTime := float32(300)
+		if err := overrideRepo.SaveChapterOverrides(context, id, []models.ChapterOverride{{Numbering: 1, EndTime: &endTime}}); err != nil {
+			t.Fatal(err)
+		}
+		chapterTitle := "Laying Plans"
+		if err := overrideRepo.SaveChapterOverrides(context, id, []models.ChapterOverride{{Numbering: 1, Title: &chapterTitle}}); err != nil {
+			t.Fatal(err)
+		}
+		chapter, err := audiobookRepo.GetAudiobookChapter(context, id, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if chapter.Title != chapterTitle || chapter.EndTime == endTime {
+			t.Fatalf("Unexpected chapter %+v", chapter)
+		}
+		overrides, err := overrideRepo.GetOverrides(context, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(overrides.Chapters) != 1 || *overrides.Chapters[0].Title != chapterTitle || *overrides.Chapters[0].EndTime != endTime {
+			t.Fatalf("Unexpected chapter overrides %+v", overrides.Chapters)
+		}
+	})
+	t.Run("should not find overrides of missing audiobook", func(t *testing.T) {
+		_, overrideRepo, _ := prepare(t)
+		if _, err := overrideRepo.GetOverrides(context.Background(), 42); !errors.Is(err, repo.ErrNotFound) {
+			t.Fatalf("Expected ErrNotFound; received: %v", err)
+		}
+		if err := overrideRepo.SaveAudiobookOverride(context.Background(), 42, models.AudiobookOverride{Title: &title}); !errors.Is(err, repo.ErrNotFound) {
+			t.Fatalf("Expected ErrNotFound; received: %v", err)
+		}
+	})
+}
@@ -0,0 +1,88 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bongofriend/bookplayer/backend/lib/data/datasource"
+	"github.com/bongofriend/bookplayer/backend/lib/models"
+)
+
+type ProgressRepositoryService struct {
+	client *DbClient
+}
+
+type ProgressRepository interface {
+	GetProgress(context context.Context, userId int64, audiobookId int64) (*models.PlaybackProgress, error)
+	// All progress of a user, most recently updated first
+	GetUserProgress(context context.Context, userId int64) ([]models.PlaybackProgress, error)
+	/*
+		Store progress unless a more recent update was already stored, so devices syncing late don't overwrite newer positions.
+		Returns the stored progress afterwards and whether the given progress was applied
+	*/
+	SaveProgress(context context.Context, progress models.PlaybackProgress) (*models.PlaybackProgress, bool, error)
+}
+
+func NewProgressRepository(client *DbClient) *ProgressRepositoryService {
+	return &ProgressRepositoryService{client}
+}
+
+func (r *ProgressRepositoryService) GetProgress(context context.Context, userId int64, audiobookId int64) (*models.PlaybackProgress, error) {
+	row, err := r.client.queries.GetPlaybackProgress(context, datasource.GetPlaybackProgressParams{
+		UserID:      userId,
+		AudiobookID: audiobookId,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("progress for audiobook with id %d %w", audiobookId, ErrNotFound)
+		}
+		return nil, err
+	}
+	progress := progressAsModel(row)
+	return &progress, nil
+}
+
+func (r *ProgressRepositoryService) GetUserProgress(context context.Context, userId int64) ([]models.PlaybackProgress, error) {
+	rows, err := r.client.queries.GetUserPlaybackProgress(context, userId)
+	if err != nil {
+		return nil, err
+	}
+	progress := make([]models.PlaybackProgress, len(rows))
+	for idx, row := range rows {
+		progress[idx] = progressAsModel(row)
+	}
+	return progress, nil
+}
+
+func (r *ProgressRepositoryService) SaveProgress(context context.Context, progress models.PlaybackProgress) (*models.PlaybackProgress, bool, error) {
+	affected, err := r.client.queries.UpsertPlaybackProgress(context, datasource.UpsertPlaybackProgressParams{
+		UserID:           progress.UserId,
+		AudiobookID:      progress.AudiobookId,
+		ChapterNumbering: int64(progress.ChapterNumbering),
+		OffsetSeconds:    float64(progress.Offset),
+		Finished:         progress.Finished,
+		UpdatedAt:        progress.UpdatedAt.UnixMilli(),
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	stored, err := r.GetProgress(context, progress.UserId, progress.AudiobookId)
+	if err != nil {
+		return nil, false, err
+	}
+	return stored, affected > 0, nil
+}
+
+func progressAsModel(p datasource.PlaybackProgress) models.PlaybackProgress {
+	return models.PlaybackProgress{
+		UserId:           p.UserID,
+		AudiobookId:      p.AudiobookID,
+		ChapterNumbering: int(p.ChapterNumbering),
+		Offset:           float32(p.OffsetSeconds),
+		Finished:         p.Finished,
+		UpdatedAt:        time.UnixMilli(p.UpdatedAt),
+	}
+}
@@ -0,0 +1,80 @@
+package repo_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bongofriend/bookplayer/backend/lib/data/repo"
+	"github.com/bongofriend/bookplayer/backend/lib/models"
+)
+
+func TestProgressRepository(t *testing.T) {
+	t.Run("should keep most recent progress", func(t *testing.T) {
+		config := prepareDatabase(t)
+		client, err := repo.NewDbClient(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		context := context.Background()
+		progressRepo := repo.NewProgressRepository(client)
+		insertTestUsers(t, client, 1)
+		insertTestAudiobooks(t, client, 1)
+		now := time.Now()
+		newer := models.PlaybackProgress{UserId: 1, AudiobookId: 1, ChapterNumbering: 3, Offset: 42, UpdatedAt: now}
+		older := models.PlaybackProgress{UserId: 1, AudiobookId: 1, ChapterNumbering: 1, Offset: 7, UpdatedAt: now.Add(-time.Minute)}
+
+		if _, applied, err := progressRepo.SaveProgress(context, newer); err != nil || !applied {
+			t.Fatalf("Expected progress to be applied; error: %v", err)
+		}
+		stored, applied, err := progressRepo.SaveProgress(context, older)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if applied {
+			t.Fatal("Outdated progress was applied")
+		}
+		if stored.ChapterNumbering != 3 || stored.Offset != 42 {
+			t.Fatalf("Unexpected stored progress %+v", stored)
+		}
+
+		newest := models.PlaybackProgress{UserId: 1, AudiobookId: 1, ChapterNumbering: 4, Offset: 1, Finished: true, UpdatedAt: now.Add(time.Minute)}
+		if stored, applied, err = progressRepo.SaveProgress(context, newest); err != nil || !applied {
+			t.Fatalf("Expected progress to be applied; error: %v", err)
+		}
+		if !stored.Finished || stored.ChapterNumbering != 4 {
+			t.Fatalf("Unexpected stored progress %+v", stored)
+		}
+	})
+	t.Run("should separate progress of users", func(t *testing.T) {
+		config := prepareDatabase(t)
+		client, err := repo.NewDbClient(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		context := context.Background()
+		progressRepo := repo.NewProgressRepository(client)
+		insertTestUsers(t, client, 2)
+		insertTestAudiobooks(t, client, 2)
+		for _, p := range []models.PlaybackProgress{
+			{UserId: 1, AudiobookId: 1, UpdatedAt: time.Now()},
+			{UserId: 1, AudiobookId: 2, UpdatedAt: time.Now()},
+			{UserId: 2, AudiobookId: 1, UpdatedAt: time.Now()},
+		} {
+			if _, _, err := progressRepo.SaveProgress(context, p); err != nil {
+				t.Fatal(err)
+			}
+		}
+		progress, err := progressRepo.GetUserProgress(context, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(progress) != 2 {
+			t.Fatalf("Expected %d entries; received: %d", 2, len(progress))
+		}
+		if _, err := progressRepo.GetProgress(context, 2, 2); !errors.Is(err, repo.ErrNotFound) {
+			t.Fatalf("Expected ErrNotFound; received: %v", err)
+		}
+	})
+}
@@ -0,0 +1,65 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"unicode"
+
+	"github.com/bongofriend/bookplayer/backend/lib/data/datasource"
+	"github.com/bongofriend/bookplayer/backend/lib/models"
+)
+
+var ErrEmptySearchQuery = errors.New("search query must contain at least one word")
+
+/*
+Convert free text into a full-text query matching every word as prefix,
+so user input can't inject query syntax
+*/
+func buildMatchQuery(query string) string {
+	words := strings.FieldsFunc(query, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	terms := make([]string, len(words))
+	for idx, w := range words {
+		terms[idx] = `"` + w + `"*`
+	}
+	return strings.Join(terms, " ")
+}
+
+/*
+Search titles, authors, narrators, descriptions, genres and chapter titles.
+Returns a page of results ordered by relevance and the total number of matches
+*/
+func (r *AudiobookRepositoryService) SearchAudiobooks(context context.Context, query string, limit int64, offset int64) ([]models.AudiobookSearchResult, int64, error) {
+	match := buildMatchQuery(query)
+	if len(match) == 0 {
+		return nil, 0, ErrEmptySearchQuery
+	}
+	total, err := r.client.queries.CountSearchAudiobooks(context, match)
+	if err != nil {
+		return nil, 0, err
+	}
+	// Ranked by bm25 with matches in titles weighing most, followed by authors, narrators, genres and chapters, and descriptions
+	rows, err := r.client.queries.SearchAudiobooks(context, datasource.SearchAudiobooksParams{
+		Match:  match,
+		Limit:  limit,
+		Offset: offset,
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	results := make([]models.AudiobookSearchResult, len(rows))
+	for idx, row := range rows {
+		results[idx] = models.AudiobookSearchResult{
+			Audiobook: audiobookAsModel(row.Audiobook),
+			Snippet:   row.Snippet,
+			// bm25 is lower for better matches
+			Score: -row.Rank,
+		}
+		if err := loadContributors(context, &r.client.queries, &results[idx].Audiobook); err != nil {
+			return nil, 0, err
+		}
+	}
+	return results, total, nil
+}
@@ -0,0 +1,86 @@
+package repo_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/bongofriend/bookplayer/backend/lib/data/repo"
+	"github.com/bongofriend/bookplayer/backend/lib/models"
+)
+
+func TestSearchAudiobooks(t *testing.T) {
+	config := prepareDatabase(t)
+	client, err := repo.NewDbClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	context := context.Background()
+	audiobookRepo := repo.NewAudiobookRepository(client)
+	audiobooks := []models.AudiobookProcessed{
+		{AudiobookCommon: models.AudiobookCommon{Title: "On War", Author: "Carl von Clausewitz", Description: "A treatise on military strategy"}},
+		{AudiobookCommon: models.AudiobookCommon{Title: "The Strategy of Conflict", Author: "Thomas Schelling", Narrator: "Stephen Fry"}},
+		{
+			AudiobookCommon: models.AudiobookCommon{Title: "Le Petit Café", Author: "Anonymous"},
+			ProcessedChapters: []models.ProcessedChapter{
+				{ChapterCommon: models.ChapterCommon{Title: "Manœuvring in the Kitchen", Numbering: 0}},
+			},
+		},
+	}
+	for _, a := range audiobooks {
+		if _, err := audiobookRepo.InsertAudiobook(context, a); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("should rank title matches first", func(t *testing.T) {
+		results, total, err := audiobookRepo.SearchAudiobooks(context, "strategy", 10, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total != 2 {
+			t.Fatalf("Expected %d results; received: %d", 2, total)
+		}
+		if results[0].Audiobook.Title != "The Strategy of Conflict" {
+			t.Fatalf("Expected title match first; received: %s", results[0].Audiobook.Title)
+		}
+		if results[0].Score <= results[1].Score {
+			t.Fatalf("Expected descending scores; received: %f, %f", results[0].Score, results[1].Score)
+		}
+		if !strings.Contains(results[0].Snippet, models.SearchHighlightStart+"Strategy"+models.SearchHighlightEnd) {
+			t.Fatalf("Expected highlighted match in snippet %q", results[0].Snippet)
+		}
+	})
+	t.Run("should match prefixes, narrators, chapters and ignore diacritics", func(t *testing.T) {
+		for query, title := range map[string]string{
+			"clausew":     "On War",
+			"stephen fry": "The Strategy of Conflict",
+			"cafe":        "Le Petit Café",
+			"manœuvring":  "Le Petit Café",
+			"kitchen\"*(": "Le Petit Café",
+		} {
+			results, _, err := audiobookRepo.SearchAudiobooks(context, query, 10, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(results) != 1 || results[0].Audiobook.Title != title {
+				t.Fatalf("%s: expected %s; received: %+v", query, title, results)
+			}
+		}
+	})
+	t.Run("should paginate results", func(t *testing.T) {
+		results, total, err := audiobookRepo.SearchAudiobooks(context, "strategy", 1, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total != 2 || len(results) != 1 || results[0].Audiobook.Title != "On War" {
+			t.Fatalf("Unexpected page %+v", results)
+		}
+	})
+	t.Run("should reject empty queries", func(t *testing.T) {
+		if _, _, err := audiobookRepo.SearchAudiobooks(context, " \"* ", 10, 0); !errors.Is(err, repo.ErrEmptySearchQuery) {
+			t.Fatalf("Expected ErrEmptySearchQuery; received: %v", err)
+		}
+	})
+}
@@ -0,0 +1,315 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bongofriend/bookplayer/backend/lib/data/datasource"
+	"github.com/bongofriend/bookplayer/backend/lib/models"
+)
+
+type SourceFileRepositoryService struct {
+	client *DbClient
+}
+
+/*
+Scan state of the audio files in the library. Files are grouped by the audiobook source they belong to,
+which is the file itself or the folder of a multi-file audiobook
+*/
+type SourceFileRepository interface {
+	GetSourceFiles(context context.Context, sourcePath string) ([]models.SourceFile, error)
+	GetAllSourceFiles(context context.Context) ([]models.SourceFile, error)
+	GetAudiobookSourceFiles(context context.Context, audiobookId int64) ([]models.SourceFile, error)
+	// Replace the files of a source and mark them as pending
+	SaveSourceFiles(context context.Context, sourcePath string, files []models.SourceFile) error
+	// Record a new size and modification time of a file whose content did not change
+	UpdateSourceFileStat(context context.Context, file models.SourceFile) error
+	UpdateSourceStatus(context context.Context, sourcePath string, status string, lastError string) error
+	// Mark a source as processed into the audiobook with audiobookId
+	SetSourceAudiobook(context context.Context, sourcePath string, audiobookId int64) error
+	// Move the files of a processed source to newSourcePath and clear the missing state of its audiobook
+	RelinkSource(context context.Context, oldSourcePath string, newSourcePath string, audiobookId int64, files []models.SourceFile) error
+	// Mark a source as missing and its audiobook as missing since the given time, unless it already is
+	MarkSourceMissing(context context.Context, sourcePath string, since time.Time) error
+	// Forget a source together with its job
+	DeleteSource(context context.Context, sourcePath string) error
+	RecordSourceFailure(context context.Context, sourcePath string, failure models.SourceFailure) error
+	// Earliest retry of a failed source scheduled after the given time; ErrNotFound if there is none
+	GetNextSourceRetry(context context.Context, after time.Time) (time.Time, error)
+}
+
+func NewSourceFileRepository(client *DbClient) *SourceFileRepositoryService {
+	return &SourceFileRepositoryService{client}
+}
+
+func (r *SourceFileRepositoryService) GetSourceFiles(context context.Context, sourcePath string) ([]models.SourceFile, error) {
+	rows, err := r.client.queries.GetSourceFilesBySource(context, sourcePath)
+	if err != nil {
+		return nil, err
+	}
+	return sourceFilesAsModels(rows), nil
+}
+
+func (r *SourceFileRepositoryService) GetAllSourceFiles(context context.Context) ([]models.SourceFile, error) {
+	rows, err := r.client.queries.GetAllSourceFiles(context)
+	if err != nil {
+		return nil, err
+	}
+	return sourceFilesAsModels(rows), nil
+}
+
+func (r *SourceFileRepositoryService) GetAudiobookSourceFiles(context context.Context, audiobookId int64) ([]models.SourceFile, error) {
+	rows, err := r.client.queries.GetSourceFilesByAudiobook(context, sql.NullInt64{Int64: audiobookId, Valid: true})
+	if err != nil {
+		return nil, err
+	}
+	return sourceFilesAsModels(rows), nil
+}
+
+func (r *SourceFileRepositoryService) SaveSourceFiles(context context.Context, sourcePath string, files []models.SourceFile) error {
+	tx, err := r.client.db.Begin()
+	if err != nil {
+		return err
+	}
+	qtx := r.client.queries.WithTx(tx)
+	existing, err := qtx.GetSourceFilesBySource(context, sourcePath)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	current := make(map[string]struct{}, len(files))
+	updatedAt := time.Now().UnixMilli()
+	for _, f := range files {
+		current[f.Path] = struct{}{}
+		if err := qtx.UpsertSourceFile(context, datasource.UpsertSourceFileParams{
+			Path:       f.Path,
+			SourcePath: sourcePath,
+			Size:       f.Size,
+			ModTime:    f.ModTime.UnixNano(),
+			Hash:       f.Hash,
+			Status:     models.SourceStatusPending,
+			UpdatedAt:  updatedAt,
+		}); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	// Files removed from a multi-file audiobook
+	for _, e := range existing {
+		if _, ok := current[e.Path]; ok {
+			continue
+		}
+		if err := qtx.DeleteSourceFile(context, e.Path); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *SourceFileRepositoryService) UpdateSourceFileStat(context context.Context, file models.SourceFile) error {
+	return r.client.queries.UpdateSourceFileStat(context, datasource.UpdateSourceFileStatParams{
+		Size:    file.Size,
+		ModTime: file.ModTime.UnixNano(),
+		Path:    file.Path,
+	})
+}
+
+func (r *SourceFileRepositoryService) UpdateSourceStatus(context context.Context, sourcePath string, status string, lastError string) error {
+	affected, err := r.client.queries.UpdateSourceStatus(context, datasource.UpdateSourceStatusParams{
+		Status:     status,
+		LastError:  lastError,
+		UpdatedAt:  time.Now().UnixMilli(),
+		SourcePath: sourcePath,
+	})
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return fmt.Errorf("source %s %w", sourcePath, ErrNotFound)
+	}
+	return nil
+}
+
+func (r *SourceFileRepositoryService) SetSourceAudiobook(context context.Context, sourcePath string, audiobookId int64) error {
+	affected, err := r.client.queries.SetSourceAudiobook(context, datasource.SetSourceAudiobookParams{
+		Status:      models.SourceStatusProcessed,
+		AudiobookID: sql.NullInt64{Int64: audiobookId, Valid: true},
+		UpdatedAt:   time.Now().UnixMilli(),
+		SourcePath:  sourcePath,
+	})
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return fmt.Errorf("source %s %w", sourcePath, ErrNotFound)
+	}
+	return nil
+}
+
+func (r *SourceFileRepositoryService) RelinkSource(context context.Context, oldSourcePath string, newSourcePath string, audiobookId int64, files []models.SourceFile) error {
+	tx, err := r.client.db.Begin()
+	if err != nil {
+		return err
+	}
+	qtx := r.client.queries.WithTx(tx)
+	if err := qtx.DeleteSourceFilesBySource(context, oldSourcePath); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if oldSourcePath != newSourcePath {
+		if err := qtx.DeleteJobBySource(context, oldSourcePath); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	updatedAt := time.Now().UnixMilli()
+	for _, f := range files {
+		if err := qtx.UpsertSourceFile(context, datasource.UpsertSourceFileParams{
+			Path:       f.Path,
+			SourcePath: newSourcePath,
+			Size:       f.Size,
+			ModTime:    f.ModTime.UnixNano(),
+			Hash:       f.Hash,
+			Status:     models.SourceStatusProcessed,
+			UpdatedAt:  updatedAt,
+		}); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if _, err := qtx.SetSourceAudiobook(context, datasource.SetSourceAudiobookParams{
+		Status:      models.SourceStatusProcessed,
+		AudiobookID: sql.NullInt64{Int64: audiobookId, Valid: true},
+		UpdatedAt:   updatedAt,
+		SourcePath:  newSourcePath,
+	}); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := qtx.UpdateAudiobookRelativePath(context, datasource.UpdateAudiobookRelativePathParams{
+		RelativePath: newSourcePath,
+		ID:           audiobookId,
+	}); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *SourceFileRepositoryService) MarkSourceMissing(context context.Context, sourcePath string, since time.Time) error {
+	tx, err := r.client.db.Begin()
+	if err != nil {
+		return err
+	}
+	qtx := r.client.queries.WithTx(tx)
+	files, err := qtx.GetSourceFilesBySource(context, sourcePath)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if len(files) == 0 {
+		tx.Rollback()
+		return fmt.Errorf("source %s %w", sourcePath, ErrNotFound)
+	}
+	if _, err := qtx.UpdateSourceStatus(context, datasource.UpdateSourceStatusParams{
+		Status:     models.SourceStatusMissing,
+		UpdatedAt:  time.Now().UnixMilli(),
+		SourcePath: sourcePath,
+	}); err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, f := range files {
+		if !f.AudiobookID.Valid {
+			continue
+		}
+		if err := qtx.SetAudiobookMissing(context, datasource.SetAudiobookMissingParams{
+			MissingSince: sql.NullInt64{Int64: since.UnixMilli(), Valid: true},
+			ID:           f.AudiobookID.Int64,
+		}); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *SourceFileRepositoryService) DeleteSource(context context.Context, sourcePath string) error {
+	tx, err := r.client.db.Begin()
+	if err != nil {
+		return err
+	}
+	qtx := r.client.queries.WithTx(tx)
+	if err := qtx.DeleteJobBySource(context, sourcePath); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := qtx.DeleteSourceFilesBySource(context, sourcePath); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *SourceFileRepositoryService) RecordSourceFailure(context context.Context, sourcePath string, failure models.SourceFailure) error {
+	params := datasource.RecordSourceFailureParams{
+		Status:      models.SourceStatusQuarantined,
+		LastError:   failure.Error,
+		FailedStage: failure.Stage,
+		Attempts:    int64(failure.Attempts),
+		UpdatedAt:   time.Now().UnixMilli(),
+		SourcePath:  sourcePath,
+	}
+	if failure.RetryAt != nil {
+		params.Status = models.SourceStatusFailed
+		params.RetryAt = sql.NullInt64{Int64: failure.RetryAt.UnixMilli(), Valid: true}
+	}
+	affected, err := r.client.queries.RecordSourceFailure(context, params)
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return fmt.Errorf("source %s %w", sourcePath, ErrNotFound)
+	}
+	return nil
+}
+
+func (r *SourceFileRepositoryService) GetNextSourceRetry(context context.Context, after time.Time) (time.Time, error) {
+	retryAt, err := r.client.queries.GetNextSourceRetry(context, datasource.GetNextSourceRetryParams{
+		Status:  models.SourceStatusFailed,
+		RetryAt: sql.NullInt64{Int64: after.UnixMilli(), Valid: true},
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return time.Time{}, fmt.Errorf("retry %w", ErrNotFound)
+		}
+		return time.Time{}, err
+	}
+	return time.UnixMilli(retryAt.Int64), nil
+}
+
+func sourceFilesAsModels(rows []datasource.SourceFile) []models.SourceFile {
+	files := make([]models.SourceFile, len(rows))
+	for idx, row := range rows {
+		files[idx] = models.SourceFile{
+			Id:          row.ID,
+			Path:        row.Path,
+			SourcePath:  row.SourcePath,
+			Size:        row.Size,
+			ModTime:     time.Unix(0, row.ModTime),
+			Hash:        row.Hash,
+			AudiobookId: row.AudiobookID.Int64,
+			Status:      row.Status,
+			LastError:   row.LastError,
+			UpdatedAt:   time.UnixMilli(row.UpdatedAt),
+			Attempts:    int(row.Attempts),
+			FailedStage: row.FailedStage,
+			RetryAt:     nullTime(row.RetryAt),
+		}
+	}
+	return files
+}
@@ -0,0 +1,224 @@
+package repo_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bongofriend/bookplayer/backend/lib/data/repo"
+	"github.com/bongofriend/bookplayer/backend/lib/models"
+)
+
+func TestSourceFileRepository(t *testing.T) {
+	modTime := time.Date(2024, 5, 14, 19, 20, 36, 123456789, time.UTC)
+	files := []models.SourceFile{
+		{Path: "Author/Book/01.mp3", Size: 100, ModTime: modTime, Hash: "a"},
+		{Path: "Author/Book/02.mp3", Size: 200, ModTime: modTime, Hash: "b"},
+	}
+
+	t.Run("should save and replace the files of a source", func(t *testing.T) {
+		config := prepareDatabase(t)
+		client, err := repo.NewDbClient(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		context := context.Background()
+		sourceFileRepo := repo.NewSourceFileRepository(client)
+
+		if err := sourceFileRepo.SaveSourceFiles(context, "Author/Book", files); err != nil {
+			t.Fatal(err)
+		}
+		saved, err := sourceFileRepo.GetSourceFiles(context, "Author/Book")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(saved) != 2 {
+			t.Fatalf("Expected 2 files, got %d", len(saved))
+		}
+		if saved[0].Status != models.SourceStatusPending || !saved[0].ModTime.Equal(modTime) || saved[0].Hash != "a" {
+			t.Fatalf("Unexpected file %+v", saved[0])
+		}
+
+		if err := sourceFileRepo.SaveSourceFiles(context, "Author/Book", files[:1]); err != nil {
+			t.Fatal(err)
+		}
+		saved, err = sourceFileRepo.GetSourceFiles(context, "Author/Book")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(saved) != 1 || saved[0].Path != files[0].Path {
+			t.Fatalf("Expected removed file to be deleted, got %+v", saved)
+		}
+	})
+	t.Run("should track status through processing", func(t *testing.T) {
+		config := prepareDatabase(t)
+		client, err := repo.NewDbClient(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		context := context.Background()
+		sourceFileRepo := repo.NewSourceFileRepository(client)
+		audiobookRepo := repo.NewAudiobookRepository(client)
+
+		if err := sourceFileRepo.SaveSourceFiles(context, "Author/Book", files); err != nil {
+			t.Fatal(err)
+		}
+		if err := sourceFileRepo.UpdateSourceStatus(context, "Author/Book", models.SourceStatusFailed, "no audio stream"); err != nil {
+			t.Fatal(err)
+		}
+		saved, err := sourceFileRepo.GetSourceFiles(context, "Author/Book")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if saved[1].Status != models.SourceStatusFailed || saved[1].LastError != "no audio stream" {
+			t.Fatalf("Unexpected file %+v", saved[1])
+		}
+
+		id, err := audiobookRepo.InsertAudiobook(context, models.AudiobookProcessed{
+			AudiobookCommon: models.AudiobookCommon{Title: "Book"},
+			RelativePath:    "Author/Book",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := sourceFileRepo.SetSourceAudiobook(context, "Author/Book", id); err != nil {
+			t.Fatal(err)
+		}
+		linked, err := sourceFileRepo.GetAudiobookSourceFiles(context, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(linked) != 2 || linked[0].Status != models.SourceStatusProcessed || linked[0].LastError != "" {
+			t.Fatalf("Unexpected files %+v", linked)
+		}
+
+		if err := sourceFileRepo.UpdateSourceStatus(context, "Unknown", models.SourceStatusFailed, ""); !errors.Is(err, repo.ErrNotFound) {
+			t.Fatalf("Expected ErrNotFound, got %v", err)
+		}
+	})
+	t.Run("should mark missing, relink and purge audiobooks", func(t *testing.T) {
+		config := prepareDatabase(t)
+		client, err := repo.NewDbClient(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		context := context.Background()
+		sourceFileRepo := repo.NewSourceFileRepository(client)
+		audiobookRepo := repo.NewAudiobookRepository(client)
+		id, err := audiobookRepo.InsertAudiobook(context, models.AudiobookProcessed{
+			AudiobookCommon:   models.AudiobookCommon{Title: "Book", Authors: []string{"Author"}},
+			RelativePath:      "Author/Book",
+			ProcessedChapters: []models.ProcessedChapter{{ChapterCommon: models.ChapterCommon{Title: "One"}}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := sourceFileRepo.SaveSourceFiles(context, "Author/Book", files); err != nil {
+			t.Fatal(err)
+		}
+		if err := sourceFileRepo.SetSourceAudiobook(context, "Author/Book", id); err != nil {
+			t.Fatal(err)
+		}
+
+		missingSince := time.Now().Add(-time.Hour)
+		if err := sourceFileRepo.MarkSourceMissing(context, "Author/Book", missingSince); err != nil {
+			t.Fatal(err)
+		}
+		missing, err := audiobookRepo.GetMissingAudiobooks(context, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(missing) != 1 || missing[0].Id != id || len(missing[0].ProcessedChapters) != 1 || missing[0].MissingSince.UnixMilli() != missingSince.UnixMilli() {
+			t.Fatalf("Unexpected missing audiobooks %+v", missing)
+		}
+		if missing, _ := audiobookRepo.GetMissingAudiobooks(context, missingSince.Add(-time.Minute)); len(missing) != 0 {
+			t.Fatalf("Expected no audiobooks missing before %s", missingSince)
+		}
+
+		moved := []models.SourceFile{
+			{Path: "Other/Book/01.mp3", Size: 100, ModTime: modTime, Hash: "a"},
+			{Path: "Other/Book/02.mp3", Size: 200, ModTime: modTime, Hash: "b"},
+		}
+		if err := sourceFileRepo.RelinkSource(context, "Author/Book", "Other/Book", id, moved); err != nil {
+			t.Fatal(err)
+		}
+		if old, _ := sourceFileRepo.GetSourceFiles(context, "Author/Book"); len(old) != 0 {
+			t.Fatalf("Expected old files to be removed, got %+v", old)
+		}
+		fetched, err := audiobookRepo.GetAudiobookById(context, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fetched.RelativePath != "Other/Book" || fetched.MissingSince != nil {
+			t.Fatalf("Unexpected audiobook %+v", fetched)
+		}
+
+		if err := audiobookRepo.DeleteAudiobook(context, id); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := audiobookRepo.GetAudiobookById(context, id); !errors.Is(err, repo.ErrNotFound) {
+			t.Fatalf("Expected ErrNotFound, got %v", err)
+		}
+		if linked, _ := sourceFileRepo.GetAudiobookSourceFiles(context, id); len(linked) != 0 {
+			t.Fatalf("Expected source files to be deleted, got %+v", linked)
+		}
+		if authors, _ := repo.NewCatalogRepository(client).GetAuthors(context); len(authors) != 0 {
+			t.Fatalf("Expected authors of deleted audiobook to be unlinked, got %+v", authors)
+		}
+	})
+	t.Run("should record failures and schedule retries", func(t *testing.T) {
+		config := prepareDatabase(t)
+		client, err := repo.NewDbClient(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		context := context.Background()
+		sourceFileRepo := repo.NewSourceFileRepository(client)
+		if err := sourceFileRepo.SaveSourceFiles(context, "Author/Book", files); err != nil {
+			t.Fatal(err)
+		}
+		retryAt := time.Now().Add(time.Hour)
+		if err := sourceFileRepo.RecordSourceFailure(context, "Author/Book", models.SourceFailure{Stage: "metadata", Error: "invalid data", Attempts: 1, RetryAt: &retryAt}); err != nil {
+			t.Fatal(err)
+		}
+		next, err := sourceFileRepo.GetNextSourceRetry(context, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if next.UnixMilli() != retryAt.UnixMilli() {
+			t.Fatalf("Expected next retry at %s; received: %s", retryAt, next)
+		}
+		if _, err := sourceFileRepo.GetNextSourceRetry(context, retryAt); !errors.Is(err, repo.ErrNotFound) {
+			t.Fatalf("Expected ErrNotFound; received: %v", err)
+		}
+
+		// Retrying keeps the attempts, a changed file starts over
+		if err := sourceFileRepo.SaveSourceFiles(context, "Author/Book", files); err != nil {
+			t.Fatal(err)
+		}
+		changed := []models.SourceFile{files[0], files[1]}
+		changed[1].Hash = "c"
+		if err := sourceFileRepo.SaveSourceFiles(context, "Author/Book", changed); err != nil {
+			t.Fatal(err)
+		}
+		saved, err := sourceFileRepo.GetSourceFiles(context, "Author/Book")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if saved[0].Attempts != 1 || saved[0].FailedStage != "metadata" || saved[0].RetryAt != nil || saved[1].Attempts != 0 {
+			t.Fatalf("Unexpected files %+v", saved)
+		}
+
+		if err := sourceFileRepo.RecordSourceFailure(context, "Author/Book", models.SourceFailure{Stage: "chapters", Error: "ffmpeg failed", Attempts: 5}); err != nil {
+			t.Fatal(err)
+		}
+		saved, _ = sourceFileRepo.GetSourceFiles(context, "Author/Book")
+		if saved[0].Status != models.SourceStatusQuarantined || saved[0].Attempts != 5 {
+			t.Fatalf("Expected quarantined source; received: %+v", saved[0])
+		}
+		if err := sourceFileRepo.RecordSourceFailure(context, "Unknown", models.SourceFailure{}); !errors.Is(err, repo.ErrNotFound) {
+			t.Fatalf("Expected ErrNotFound; received: %v", err)
+		}
+	})
+}
@@ -0,0 +1,119 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bongofriend/bookplayer/backend/lib/data/datasource"
+	"github.com/bongofriend/bookplayer/backend/lib/models"
+)
+
+type UserRepositoryService struct {
+	client *DbClient
+}
+
+type UserRepository interface {
+	InsertUser(context context.Context, user models.User) (int64, error)
+	GetUserById(context context.Context, id int64) (*models.User, error)
+	GetUserByUsername(context context.Context, username string) (*models.User, error)
+	CountUsers(context context.Context) (int64, error)
+	InsertSession(context context.Context, session models.Session) error
+	GetSession(context context.Context, id string) (*models.Session, error)
+	DeleteSession(context context.Context, id string) error
+	// Remove all sessions that expired before the given point in time
+	DeleteExpiredSessions(context context.Context, before time.Time) error
+}
+
+func NewUserRepository(client *DbClient) *UserRepositoryService {
+	return &UserRepositoryService{client}
+}
+
+func (r *UserRepositoryService) InsertUser(context context.Context, user models.User) (int64, error) {
+	res, err := r.client.queries.InsertUser(context, datasource.InsertUserParams{
+		Username:     user.Username,
+		PasswordHash: user.PasswordHash,
+		IsAdmin:      user.IsAdmin,
+		CreatedAt:    user.CreatedAt.Unix(),
+	})
+	if err != nil {
+		if isUniqueConstraintError(err) {
+			return -1, fmt.Errorf("user %s %w", user.Username, ErrConflict)
+		}
+		return -1, err
+	}
+	return res.LastInsertId()
+}
+
+func (r *UserRepositoryService) GetUserById(context context.Context, id int64) (*models.User, error) {
+	row, err := r.client.queries.GetUserById(context, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("user with id %d %w", id, ErrNotFound)
+		}
+		return nil, err
+	}
+	user := userAsModel(row)
+	return &user, nil
+}
+
+func (r *UserRepositoryService) GetUserByUsername(context context.Context, username string) (*models.User, error) {
+	row, err := r.client.queries.GetUserByUsername(context, username)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("user %s %w", username, ErrNotFound)
+		}
+		return nil, err
+	}
+	user := userAsModel(row)
+	return &user, nil
+}
+
+func (r *UserRepositoryService) CountUsers(context context.Context) (int64, error) {
+	return r.client.queries.CountUsers(context)
+}
+
+func (r *UserRepositoryService) InsertSession(context context.Context, session models.Session) error {
+	return r.client.queries.InsertSession(context, datasource.InsertSessionParams{
+		ID:        session.Id,
+		UserID:    session.UserId,
+		CreatedAt: session.CreatedAt.Unix(),
+		ExpiresAt: session.ExpiresAt.Unix(),
+	})
+}
+
+func (r *UserRepositoryService) GetSession(context context.Context, id string) (*models.Session, error) {
+	row, err := r.client.queries.GetSession(context, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("session %w", ErrNotFound)
+		}
+		return nil, err
+	}
+	return &models.Session{
+		Id:        row.ID,
+		UserId:    row.UserID,
+		CreatedAt: time.Unix(row.CreatedAt, 0),
+		ExpiresAt: time.Unix(row.ExpiresAt, 0),
+	}, nil
+}
+
+func (r *UserRepositoryService) DeleteSession(context context.Context, id string) error {
+	return r.client.queries.DeleteSession(context, id)
+}
+
+func (r *UserRepositoryService) DeleteExpiredSessions(context context.Context, before time.Time) error {
+	return r.client.queries.DeleteExpiredSessions(context, before.Unix())
+}
+
+func userAsModel(u datasource.User) models.User {
+	return models.User{
+		Id:           u.ID,
+		Username:     u.Username,
+		PasswordHash: u.PasswordHash,
+		IsAdmin:      u.IsAdmin,
+		CreatedAt:    time.Unix(u.CreatedAt, 0),
+	}
+}
@@ -0,0 +1,69 @@
+package repo_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bongofriend/bookplayer/backend/lib/data/repo"
+	"github.com/bongofriend/bookplayer/backend/lib/models"
+)
+
+func TestUserRepository(t *testing.T) {
+	t.Run("should insert and fetch User", func(t *testing.T) {
+		config := prepareDatabase(t)
+		client, err := repo.NewDbClient(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		context := context.Background()
+		userRepo := repo.NewUserRepository(client)
+		id, err := userRepo.InsertUser(context, models.User{Username: "listener", PasswordHash: "hash", CreatedAt: time.Now()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		user, err := userRepo.GetUserByUsername(context, "listener")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.Id != id || user.PasswordHash != "hash" {
+			t.Fatalf("Unexpected user %+v", user)
+		}
+		if _, err := userRepo.InsertUser(context, models.User{Username: "listener", PasswordHash: "other"}); !errors.Is(err, repo.ErrConflict) {
+			t.Fatalf("Expected ErrConflict; received: %v", err)
+		}
+	})
+	t.Run("should delete expired Sessions", func(t *testing.T) {
+		config := prepareDatabase(t)
+		client, err := repo.NewDbClient(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		context := context.Background()
+		userRepo := repo.NewUserRepository(client)
+		id, err := userRepo.InsertUser(context, models.User{Username: "listener", PasswordHash: "hash", CreatedAt: time.Now()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		now := time.Now()
+		sessions := []models.Session{
+			{Id: "expired", UserId: id, CreatedAt: now.Add(-2 * time.Hour), ExpiresAt: now.Add(-time.Hour)},
+			{Id: "valid", UserId: id, CreatedAt: now, ExpiresAt: now.Add(time.Hour)},
+		}
+		for _, s := range sessions {
+			if err := userRepo.InsertSession(context, s); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := userRepo.DeleteExpiredSessions(context, now); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := userRepo.GetSession(context, "expired"); !errors.Is(err, repo.ErrNotFound) {
+			t.Fatalf("Expected ErrNotFound; received: %v", err)
+		}
+		if _, err := userRepo.GetSession(context, "valid"); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
@@ -9,6 +9,7 @@ import (
 )
 
 func ApplyDatabaseMigrations(dbConfig config.DatabaseConfig) error {
+	// Without foreign keys, so tables rebuilt by migrations don't take linked rows with them when dropped
 	database, err := sql.Open(dbConfig.Driver, dbConfig.Path)
 	if err != nil {
 		return err
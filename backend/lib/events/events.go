@@ -0,0 +1,120 @@
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// What happened to an audiobook source
+const (
+	TypeDiscovered = "discovered"
+	TypeProbing    = "probing"
+	// Published repeatedly while ffmpeg splits chapters, with the share of work done as Progress
+	TypeSplitting = "splitting"
+	TypeStored    = "stored"
+	TypeFailed    = "failed"
+)
+
+// Events a subscriber may lag behind before it misses events
+const subscriberBufferSize = 64
+
+type Event struct {
+	// Increasing with every published event; clients pick up after the last Id they received
+	Id         int64     `json:"Id"`
+	Type       string    `json:"Type"`
+	SourcePath string    `json:"SourcePath"`
+	Progress   float64   `json:"Progress"`
+	Message    string    `json:"Message,omitempty"`
+	Time       time.Time `json:"Time"`
+}
+
+/*
+Fans out processing events to subscribers and keeps the most recent ones as history.
+A nil Bus discards published events, so stages do not need one when events are of no interest, e.g. in tests
+*/
+type Bus struct {
+	mu          sync.Mutex
+	lastId      int64
+	history     []Event
+	historySize int
+	subscribers map[chan Event]struct{}
+	closed      bool
+}
+
+func NewBus(historySize int) *Bus {
+	return &Bus{
+		history:     make([]Event, 0, historySize),
+		historySize: historySize,
+		subscribers: make(map[chan Event]struct{}),
+	}
+}
+
+// Record event and pass it on to subscribers; subscribers not keeping up miss it
+func (b *Bus) Publish(event Event) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	b.lastId++
+	event.Id = b.lastId
+	event.Time = time.Now()
+	if len(b.history) == b.historySize {
+		b.history = append(b.history[:0], b.history[1:]...)
+	}
+	b.history = append(b.history, event)
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// Receive events published from now on until unsubscribe is called; the channel is closed by unsubscribe and Close
+func (b *Bus) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBufferSize)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	b.subscribers[ch] = struct{}{}
+	unsubscribe := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subscribers[ch]; ok {
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+	return ch, unsubscribe
+}
+
+// Recorded events with an Id greater than after, oldest first
+func (b *Bus) History(after int64) []Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	events := []Event{}
+	for _, e := range b.history {
+		if e.Id > after {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+// End all subscriptions and discard events published afterwards
+func (b *Bus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for ch := range b.subscribers {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
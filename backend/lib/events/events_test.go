@@ -0,0 +1,73 @@
+package events_test
+
+import (
+	"testing"
+
+	"github.com/bongofriend/bookplayer/backend/lib/events"
+)
+
+func TestBus(t *testing.T) {
+	t.Run("should pass events to subscribers", func(t *testing.T) {
+		bus := events.NewBus(10)
+		first, unsubscribeFirst := bus.Subscribe()
+		second, unsubscribeSecond := bus.Subscribe()
+		defer unsubscribeSecond()
+
+		bus.Publish(events.Event{Type: events.TypeDiscovered, SourcePath: "Author/Book"})
+		for _, ch := range []<-chan events.Event{first, second} {
+			if event := <-ch; event.Id != 1 || event.Type != events.TypeDiscovered || event.Time.IsZero() {
+				t.Fatalf("Unexpected event %+v", event)
+			}
+		}
+
+		unsubscribeFirst()
+		if _, ok := <-first; ok {
+			t.Fatal("Expected channel to be closed after unsubscribing")
+		}
+		bus.Publish(events.Event{Type: events.TypeProbing, SourcePath: "Author/Book"})
+		if event := <-second; event.Id != 2 {
+			t.Fatalf("Unexpected event %+v", event)
+		}
+	})
+	t.Run("should keep most recent events", func(t *testing.T) {
+		bus := events.NewBus(3)
+		for i := 0; i < 5; i++ {
+			bus.Publish(events.Event{Type: events.TypeSplitting, Progress: float64(i) / 4})
+		}
+		history := bus.History(0)
+		if len(history) != 3 || history[0].Id != 3 || history[2].Id != 5 {
+			t.Fatalf("Unexpected history %+v", history)
+		}
+		if history := bus.History(4); len(history) != 1 || history[0].Id != 5 {
+			t.Fatalf("Unexpected history after 4: %+v", history)
+		}
+	})
+	t.Run("should not block on slow subscribers", func(t *testing.T) {
+		bus := events.NewBus(10)
+		slow, unsubscribe := bus.Subscribe()
+		defer unsubscribe()
+		for i := 0; i < 1000; i++ {
+			bus.Publish(events.Event{Type: events.TypeSplitting})
+		}
+		if event := <-slow; event.Id != 1 {
+			t.Fatalf("Unexpected event %+v", event)
+		}
+	})
+	t.Run("should end subscriptions on close", func(t *testing.T) {
+		bus := events.NewBus(10)
+		ch, unsubscribe := bus.Subscribe()
+		bus.Close()
+		unsubscribe()
+		if _, ok := <-ch; ok {
+			t.Fatal("Expected channel to be closed")
+		}
+		bus.Publish(events.Event{Type: events.TypeStored})
+		if history := bus.History(0); len(history) != 0 {
+			t.Fatalf("Expected events after close to be discarded; received: %+v", history)
+		}
+	})
+	t.Run("should discard events published to nil bus", func(t *testing.T) {
+		var bus *events.Bus
+		bus.Publish(events.Event{Type: events.TypeFailed})
+	})
+}
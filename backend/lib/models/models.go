@@ -1,5 +1,11 @@
 package models
 
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
 type AudiobookCommon struct {
 	Title       string  `json:"Title"`
 	Author      string  `json:"Author"`
@@ -7,6 +13,13 @@ type AudiobookCommon struct {
 	Description string  `json:"Description"`
 	Genre       string  `json:"Genre"`
 	Duration    float32 `json:"Duration"`
+	// Individual names parsed from Author, Narrator and Genre
+	Authors   []string `json:"Authors"`
+	Narrators []string `json:"Narrators"`
+	Genres    []string `json:"Genres"`
+	// Name of the series and position within; empty if the audiobook is not part of a series
+	Series         string `json:"Series"`
+	SeriesPosition string `json:"SeriesPosition"`
 }
 
 type ChapterCommon struct {
@@ -16,6 +29,8 @@ type ChapterCommon struct {
 	//Start     int     `json:"Start"`
 	//End       int     `json:"End"`
 	Numbering int `json:"Numbering"`
+	// Proposed at a long silence as the source has no chapter markers; boundaries and titles may need editing
+	AutoDetected bool `json:"AutoDetected"`
 }
 
 type Chapter struct {
@@ -28,12 +43,315 @@ type Audiobook struct {
 }
 
 type AudiobookProcessed struct {
+	Id int64
 	AudiobookCommon
-	FilePath          string
+	// Absolute path of the source while the audiobook is processed; not stored
+	FilePath string
+	// Path of the source relative to the library root
+	RelativePath      string
 	ProcessedChapters []ProcessedChapter
+	// Embedded cover art and thumbnails generated from it
+	Images []AudiobookImage
+	// Measured loudness; nil unless loudness measurement is enabled
+	Loudness *Loudness
+	// Set while the source is gone from the library; nil otherwise
+	MissingSince *time.Time
 }
 
 type ProcessedChapter struct {
+	Id int64
 	ChapterCommon
 	FilePath string
 }
+
+const (
+	ImageKindCover  = "cover"
+	ImageKindSmall  = "small"
+	ImageKindMedium = "medium"
+)
+
+type AudiobookImage struct {
+	Kind        string `json:"Kind"`
+	FilePath    string `json:"-"`
+	ContentType string `json:"ContentType"`
+	Width       int    `json:"Width"`
+	Height      int    `json:"Height"`
+}
+
+type Loudness struct {
+	// Integrated loudness in LUFS and true peak in dBTP, measured over all chapters before any gain is applied
+	IntegratedLufs float64 `json:"IntegratedLufs"`
+	TruePeak       float64 `json:"TruePeak"`
+	// In dB, reaching the configured target loudness without clipping; players apply it unless Normalized
+	Gain float64 `json:"Gain"`
+	// Set if Gain is already applied to the chapter files
+	Normalized bool `json:"Normalized"`
+}
+
+// Book fields edited by users; nil fields keep the values extracted from the source
+type AudiobookOverride struct {
+	Title          *string  `json:"Title,omitempty"`
+	Authors        []string `json:"Authors,omitempty"`
+	Narrators      []string `json:"Narrators,omitempty"`
+	Description    *string  `json:"Description,omitempty"`
+	Genres         []string `json:"Genres,omitempty"`
+	Series         *string  `json:"Series,omitempty"`
+	SeriesPosition *string  `json:"SeriesPosition,omitempty"`
+}
+
+// Chapter edited by users; nil fields keep the values extracted from the source
+type ChapterOverride struct {
+	Numbering int     `json:"Numbering"`
+	Title     *string `json:"Title,omitempty"`
+	// End of the chapter and start of the next one; takes effect once the source is split again
+	EndTime *float32 `json:"EndTime,omitempty"`
+}
+
+// Everything edited by users for one audiobook, kept apart from the extracted values so processing again does not lose it
+type Overrides struct {
+	Audiobook AudiobookOverride `json:"Audiobook"`
+	Chapters  []ChapterOverride `json:"Chapters"`
+}
+
+// Fields set in other replace those of o
+func (o AudiobookOverride) Merge(other AudiobookOverride) AudiobookOverride {
+	if other.Title != nil {
+		o.Title = other.Title
+	}
+	if other.Authors != nil {
+		o.Authors = other.Authors
+	}
+	if other.Narrators != nil {
+		o.Narrators = other.Narrators
+	}
+	if other.Description != nil {
+		o.Description = other.Description
+	}
+	if other.Genres != nil {
+		o.Genres = other.Genres
+	}
+	if other.Series != nil {
+		o.Series = other.Series
+	}
+	if other.SeriesPosition != nil {
+		o.SeriesPosition = other.SeriesPosition
+	}
+	return o
+}
+
+// Replace the fields of a set in o; names are joined like tags with several names are
+func (o AudiobookOverride) Apply(a *AudiobookCommon) {
+	if o.Title != nil {
+		a.Title = *o.Title
+	}
+	if o.Authors != nil {
+		a.Authors = o.Authors
+		a.Author = strings.Join(o.Authors, ", ")
+	}
+	if o.Narrators != nil {
+		a.Narrators = o.Narrators
+		a.Narrator = strings.Join(o.Narrators, ", ")
+	}
+	if o.Description != nil {
+		a.Description = *o.Description
+	}
+	if o.Genres != nil {
+		a.Genres = o.Genres
+		a.Genre = strings.Join(o.Genres, ", ")
+	}
+	if o.Series != nil {
+		a.Series = *o.Series
+	}
+	if o.SeriesPosition != nil {
+		a.SeriesPosition = *o.SeriesPosition
+	}
+}
+
+// Apply o to the book fields and chapters of a; a moved chapter end also moves the start of the next chapter
+func (o Overrides) Apply(a *Audiobook) {
+	o.Audiobook.Apply(&a.AudiobookCommon)
+	for _, override := range o.Chapters {
+		for idx := range a.Chapters {
+			if a.Chapters[idx].Numbering != override.Numbering {
+				continue
+			}
+			if override.Title != nil {
+				a.Chapters[idx].Title = *override.Title
+			}
+			if override.EndTime != nil {
+				a.Chapters[idx].EndTime = *override.EndTime
+				if idx+1 < len(a.Chapters) {
+					a.Chapters[idx+1].StartTime = *override.EndTime
+				}
+			}
+		}
+	}
+}
+
+type User struct {
+	Id           int64     `json:"Id"`
+	Username     string    `json:"Username"`
+	PasswordHash string    `json:"-"`
+	IsAdmin      bool      `json:"IsAdmin"`
+	CreatedAt    time.Time `json:"CreatedAt"`
+}
+
+type Session struct {
+	Id        string
+	UserId    int64
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+// Position where a user stopped listening to an audiobook; Offset is relative to the start of the chapter
+type PlaybackProgress struct {
+	UserId           int64     `json:"-"`
+	AudiobookId      int64     `json:"AudiobookId"`
+	ChapterNumbering int       `json:"ChapterNumbering"`
+	Offset           float32   `json:"Offset"`
+	Finished         bool      `json:"Finished"`
+	UpdatedAt        time.Time `json:"UpdatedAt"`
+}
+
+// Named position within an audiobook; Offset is relative to the start of the chapter
+type Bookmark struct {
+	Id               int64     `json:"Id"`
+	UserId           int64     `json:"-"`
+	AudiobookId      int64     `json:"AudiobookId"`
+	ChapterNumbering int       `json:"ChapterNumbering"`
+	Offset           float32   `json:"Offset"`
+	Name             string    `json:"Name"`
+	Note             string    `json:"Note"`
+	CreatedAt        time.Time `json:"CreatedAt"`
+	UpdatedAt        time.Time `json:"UpdatedAt"`
+}
+
+type AudiobookSearchResult struct {
+	Audiobook AudiobookProcessed
+	// Excerpt of the best matching field; matched terms are enclosed by SearchHighlightStart and SearchHighlightEnd
+	Snippet string
+	// Relevance of the match, higher is better
+	Score float64
+}
+
+const (
+	SearchHighlightStart = "\x02"
+	SearchHighlightEnd   = "\x03"
+)
+
+// Author, narrator or series with the number of audiobooks linked to it
+type CatalogEntry struct {
+	Id             int64  `json:"Id"`
+	Name           string `json:"Name"`
+	AudiobookCount int64  `json:"AudiobookCount"`
+}
+
+const (
+	// Found by DirectoryWatcher and waiting to be processed
+	SourceStatusPending   = "pending"
+	SourceStatusProcessed = "processed"
+	SourceStatusFailed    = "failed"
+	// Removed from the library; the audiobook is kept until MissingGracePeriod passed
+	SourceStatusMissing = "missing"
+	// Failed MaxAttempts times; not retried until the file changes
+	SourceStatusQuarantined = "quarantined"
+	// Processing was canceled; not processed again until the file changes or its job is retried
+	SourceStatusCanceled = "canceled"
+)
+
+// Audio file in the library and how far it got through processing
+type SourceFile struct {
+	Id int64 `json:"Id"`
+	// Relative to the library root
+	Path       string    `json:"Path"`
+	SourcePath string    `json:"SourcePath"`
+	Size       int64     `json:"Size"`
+	ModTime    time.Time `json:"ModTime"`
+	Hash       string    `json:"Hash"`
+	// 0 until the audiobook was added to the library
+	AudiobookId int64     `json:"AudiobookId"`
+	Status      string    `json:"Status"`
+	LastError   string    `json:"LastError"`
+	UpdatedAt   time.Time `json:"UpdatedAt"`
+	// Failed processing attempts since the file last changed and the stage of the last failure
+	Attempts    int    `json:"Attempts"`
+	FailedStage string `json:"FailedStage"`
+	// Next retry of a failed source; nil if none is scheduled
+	RetryAt *time.Time `json:"RetryAt,omitempty"`
+}
+
+// Failed attempt to process a source; it is retried at RetryAt or quarantined if RetryAt is nil
+type SourceFailure struct {
+	Stage    string
+	Error    string
+	Attempts int
+	RetryAt  *time.Time
+}
+
+// Stages of a job in the order they are completed
+const (
+	JobStageDiscovered = "discovered"
+	JobStageProbed     = "probed"
+	JobStageSplit      = "split"
+	JobStageStored     = "stored"
+)
+
+var JobStages = []string{JobStageDiscovered, JobStageProbed, JobStageSplit, JobStageStored}
+
+const (
+	// Waiting for or in processing
+	JobStateActive   = "active"
+	JobStateFailed   = "failed"
+	JobStateCanceled = "canceled"
+	JobStateDone     = "done"
+)
+
+// Processing of an audiobook source; interrupted jobs are resumed after their last completed stage
+type Job struct {
+	Id         int64  `json:"Id"`
+	SourcePath string `json:"SourcePath"`
+	// Last completed stage
+	Stage     string    `json:"Stage"`
+	State     string    `json:"State"`
+	Error     string    `json:"Error"`
+	CreatedAt time.Time `json:"CreatedAt"`
+	UpdatedAt time.Time `json:"UpdatedAt"`
+	// Results of the completed stages as JSON to resume from
+	Results map[string]json.RawMessage `json:"-"`
+}
+
+// Commands the processing pipeline can be asked to carry out
+const (
+	// Pick up changes in the library
+	CommandScan = "scan"
+	// Process every audiobook in the library again
+	CommandRescan = "rescan"
+	// Probe and split one audiobook source again
+	CommandReprocess = "reprocess"
+	// Hash files again instead of trusting unchanged size and modification time, for the whole library or one source
+	CommandRehash = "rehash"
+	// Stop starting work on new inputs until resumed; inputs already in progress are finished
+	CommandPause  = "pause"
+	CommandResume = "resume"
+	// Write edited tags and chapters into the file of one audiobook source, which is then processed again
+	CommandWriteBack = "write-back"
+)
+
+const (
+	CommandStateQueued  = "queued"
+	CommandStateRunning = "running"
+	CommandStateDone    = "done"
+	CommandStateFailed  = "failed"
+)
+
+// Command sent to the processing pipeline; its state is updated as the pipeline carries it out
+type Command struct {
+	Id   int64  `json:"Id"`
+	Type string `json:"Type"`
+	// Audiobook source the command is limited to, if any
+	SourcePath string    `json:"SourcePath,omitempty"`
+	State      string    `json:"State"`
+	Error      string    `json:"Error"`
+	CreatedAt  time.Time `json:"CreatedAt"`
+	UpdatedAt  time.Time `json:"UpdatedAt"`
+}
@@ -0,0 +1,669 @@
+// Reads tags, chapters and cover art of MP4 files like m4b audiobooks without decoding any audio
+package mp4
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// Largest box read into memory; boxes holding metadata are far smaller, media data is never read
+const maxBoxSize = 16 * 1024 * 1024
+
+var ErrNotMp4 = errors.New("not an MP4 file")
+
+type File struct {
+	// Seconds, from the movie header
+	Duration float64
+	// Tags by the names ffprobe reports them under, e.g. title, album_artist or track
+	Tags     map[string]string
+	Chapters []Chapter
+	// Embedded cover art; nil if there is none
+	Cover *Cover
+}
+
+type Chapter struct {
+	Title string
+	// Seconds from the start of the file
+	Start float64
+	End   float64
+}
+
+// Location of embedded cover art; only read on demand as it is usually the largest part of the metadata
+type Cover struct {
+	ContentType string
+	Offset      int64
+	Size        int64
+}
+
+// Image data of the cover in r, the file the cover was found in
+func (c Cover) Reader(r io.ReaderAt) io.Reader {
+	return io.NewSectionReader(r, c.Offset, c.Size)
+}
+
+type box struct {
+	typ string
+	// Start and length of the content after the box header
+	offset int64
+	size   int64
+}
+
+// Names ffmpeg gives the text tags of the iTunes metadata list
+var tagNames = map[string]string{
+	"\xa9nam": "title",
+	"\xa9ART": "artist",
+	"aART":    "album_artist",
+	"\xa9alb": "album",
+	"\xa9wrt": "composer",
+	"\xa9cmt": "comment",
+	"\xa9gen": "genre",
+	"\xa9grp": "grouping",
+	"\xa9day": "date",
+	"\xa9too": "encoder",
+	"\xa9lyr": "lyrics",
+	"desc":    "description",
+	"ldes":    "synopsis",
+	"cprt":    "copyright",
+}
+
+// Data types of values in the metadata list besides UTF-8 text and integers
+const (
+	typeUtf16 = 2
+	typeJpeg  = 13
+	typePng   = 14
+)
+
+func ReadFile(p string) (*File, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if stat.IsDir() {
+		return nil, fmt.Errorf("%s is not a file", p)
+	}
+	return Read(f, stat.Size())
+}
+
+// Read the MP4 file of size bytes in r
+func Read(r io.ReaderAt, size int64) (*File, error) {
+	top, err := readBoxes(r, 0, size)
+	if err != nil || len(top) == 0 {
+		return nil, ErrNotMp4
+	}
+	moov, ok := find(top, "moov")
+	if !ok {
+		return nil, fmt.Errorf("no movie box: %w", ErrNotMp4)
+	}
+	file := &File{Tags: map[string]string{}, Chapters: []Chapter{}}
+	if ftyp, ok := find(top, "ftyp"); ok {
+		if err := readFileType(r, ftyp, file.Tags); err != nil {
+			return nil, err
+		}
+	}
+	children, err := readBoxes(r, moov.offset, moov.size)
+	if err != nil {
+		return nil, err
+	}
+	if mvhd, ok := find(children, "mvhd"); ok {
+		if file.Duration, err = readDuration(r, mvhd); err != nil {
+			return nil, err
+		}
+	}
+	if udta, ok := find(children, "udta"); ok {
+		if err := readUserData(r, udta, file); err != nil {
+			return nil, err
+		}
+	}
+	// Players show the chapter track rather than Nero chapters if a file has both
+	chapters, err := readChapterTrack(r, children)
+	if err != nil {
+		return nil, err
+	}
+	if len(chapters) > 0 {
+		file.Chapters = chapters
+	}
+	for idx := range file.Chapters {
+		if idx+1 < len(file.Chapters) {
+			file.Chapters[idx].End = file.Chapters[idx+1].Start
+		} else if file.Chapters[idx].End == 0 {
+			file.Chapters[idx].End = file.Duration
+		}
+	}
+	return file, nil
+}
+
+// Boxes in the size bytes of r starting at offset; bytes too few for another box header are ignored
+func readBoxes(r io.ReaderAt, offset int64, size int64) ([]box, error) {
+	boxes := []box{}
+	end := offset + size
+	header := make([]byte, 16)
+	for offset+8 <= end {
+		if _, err := r.ReadAt(header[:8], offset); err != nil {
+			return nil, err
+		}
+		boxSize := int64(binary.BigEndian.Uint32(header))
+		headerSize := int64(8)
+		switch boxSize {
+		case 0:
+			// Extends to the end of its parent
+			boxSize = end - offset
+		case 1:
+			if _, err := r.ReadAt(header[8:16], offset+8); err != nil {
+				return nil, err
+			}
+			boxSize = int64(binary.BigEndian.Uint64(header[8:16]))
+			headerSize = 16
+		}
+		if boxSize < headerSize || boxSize > end-offset {
+			return nil, fmt.Errorf("box %q at %d exceeds its parent", header[4:8], offset)
+		}
+		boxes = append(boxes, box{typ: string(header[4:8]), offset: offset + headerSize, size: boxSize - headerSize})
+		offset += boxSize
+	}
+	return boxes, nil
+}
+
+func find(boxes []box, typ string) (box, bool) {
+	for _, b := range boxes {
+		if b.typ == typ {
+			return b, true
+		}
+	}
+	return box{}, false
+}
+
+// Boxes nested along path below parent, e.g. "mdia", "minf", "stbl"
+func findPath(r io.ReaderAt, parent box, path ...string) (box, bool, error) {
+	current := parent
+	for _, typ := range path {
+		children, err := readBoxes(r, current.offset, current.size)
+		if err != nil {
+			return box{}, false, err
+		}
+		next, ok := find(children, typ)
+		if !ok {
+			return box{}, false, nil
+		}
+		current = next
+	}
+	return current, true, nil
+}
+
+func readContent(r io.ReaderAt, b box) ([]byte, error) {
+	if b.size > maxBoxSize {
+		return nil, fmt.Errorf("box %q of %d bytes is too large", b.typ, b.size)
+	}
+	data := make([]byte, b.size)
+	if _, err := r.ReadAt(data, b.offset); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Brands as ffprobe reports them, e.g. major_brand "M4B "
+func readFileType(r io.ReaderAt, ftyp box, tags map[string]string) error {
+	data, err := readContent(r, ftyp)
+	if err != nil {
+		return err
+	}
+	if len(data) < 8 {
+		return fmt.Errorf("file type box of %d bytes is too short", len(data))
+	}
+	tags["major_brand"] = string(data[0:4])
+	tags["minor_version"] = strconv.FormatUint(uint64(binary.BigEndian.Uint32(data[4:8])), 10)
+	tags["compatible_brands"] = string(data[8:])
+	return nil
+}
+
+// Timescale and duration of movie or media headers, which share their layout
+func readHeader(r io.ReaderAt, header box) (uint32, uint64, error) {
+	data, err := readContent(r, header)
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(data) >= 32 && data[0] == 1 {
+		return binary.BigEndian.Uint32(data[20:24]), binary.BigEndian.Uint64(data[24:32]), nil
+	}
+	if len(data) >= 20 && data[0] == 0 {
+		return binary.BigEndian.Uint32(data[12:16]), uint64(binary.BigEndian.Uint32(data[16:20])), nil
+	}
+	return 0, 0, fmt.Errorf("unsupported %q box", header.typ)
+}
+
+func readDuration(r io.ReaderAt, mvhd box) (float64, error) {
+	timescale, duration, err := readHeader(r, mvhd)
+	if err != nil || timescale == 0 {
+		return 0, err
+	}
+	return float64(duration) / float64(timescale), nil
+}
+
+func readUserData(r io.ReaderAt, udta box, file *File) error {
+	children, err := readBoxes(r, udta.offset, udta.size)
+	if err != nil {
+		return err
+	}
+	if chpl, ok := find(children, "chpl"); ok {
+		if file.Chapters, err = readNeroChapters(r, chpl); err != nil {
+			return err
+		}
+	}
+	meta, ok := find(children, "meta")
+	if !ok {
+		return nil
+	}
+	// A full box with version and flags in MP4, a plain box in QuickTime files
+	head := make([]byte, 8)
+	if meta.size < int64(len(head)) {
+		return nil
+	}
+	if _, err := r.ReadAt(head, meta.offset); err != nil {
+		return err
+	}
+	if string(head[4:8]) != "hdlr" {
+		meta.offset += 4
+		meta.size -= 4
+	}
+	ilst, ok, err := findPath(r, meta, "ilst")
+	if err != nil || !ok {
+		return err
+	}
+	items, err := readBoxes(r, ilst.offset, ilst.size)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		if err := readItem(r, item, file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// One entry of the metadata list; entries of unknown types are skipped
+func readItem(r io.ReaderAt, item box, file *File) error {
+	children, err := readBoxes(r, item.offset, item.size)
+	if err != nil {
+		return err
+	}
+	data, ok := find(children, "data")
+	if !ok || data.size < 8 {
+		return nil
+	}
+	head := make([]byte, 8)
+	if _, err := r.ReadAt(head, data.offset); err != nil {
+		return err
+	}
+	dataType := binary.BigEndian.Uint32(head[0:4]) & 0xffffff
+	value := box{typ: item.typ, offset: data.offset + 8, size: data.size - 8}
+
+	if item.typ == "covr" {
+		if file.Cover == nil {
+			file.Cover, err = readCover(r, value, dataType)
+		}
+		return err
+	}
+	content, err := readContent(r, value)
+	if err != nil {
+		return err
+	}
+	switch item.typ {
+	case "trkn":
+		file.Tags["track"] = readPosition(content)
+	case "disk":
+		file.Tags["disc"] = readPosition(content)
+	case "stik":
+		if len(content) > 0 {
+			file.Tags["media_type"] = strconv.Itoa(int(content[0]))
+		}
+	case "----":
+		// Freeform tags are named by a name box, e.g. SERIES written by audiobook taggers
+		name, ok := find(children, "name")
+		if !ok || name.size < 4 {
+			return nil
+		}
+		nameContent, err := readContent(r, name)
+		if err != nil {
+			return err
+		}
+		file.Tags[strings.ToLower(string(nameContent[4:]))] = readText(content, dataType)
+	default:
+		if name, ok := tagNames[item.typ]; ok {
+			file.Tags[name] = readText(content, dataType)
+		}
+	}
+	return nil
+}
+
+func readText(content []byte, dataType uint32) string {
+	if dataType == typeUtf16 {
+		units := make([]uint16, len(content)/2)
+		for idx := range units {
+			units[idx] = binary.BigEndian.Uint16(content[idx*2:])
+		}
+		return string(utf16.Decode(units))
+	}
+	return strings.TrimRight(string(content), "\x00")
+}
+
+// Track or disc number like ffprobe reports it, e.g. "3/12", or "3" without total
+func readPosition(content []byte) string {
+	if len(content) < 6 {
+		return ""
+	}
+	number := binary.BigEndian.Uint16(content[2:4])
+	total := binary.BigEndian.Uint16(content[4:6])
+	if total == 0 {
+		return strconv.Itoa(int(number))
+	}
+	return fmt.Sprintf("%d/%d", number, total)
+}
+
+func readCover(r io.ReaderAt, value box, dataType uint32) (*Cover, error) {
+	if value.size == 0 {
+		return nil, nil
+	}
+	cover := &Cover{Offset: value.offset, Size: value.size}
+	switch dataType {
+	case typeJpeg:
+		cover.ContentType = "image/jpeg"
+	case typePng:
+		cover.ContentType = "image/png"
+	default:
+		head := make([]byte, min(value.size, 512))
+		if _, err := r.ReadAt(head, value.offset); err != nil {
+			return nil, err
+		}
+		cover.ContentType = http.DetectContentType(head)
+	}
+	return cover, nil
+}
+
+// Chapters in the chpl box written by Nero and most audiobook tools; starts are in units of 100ns
+func readNeroChapters(r io.ReaderAt, chpl box) ([]Chapter, error) {
+	data, err := readContent(r, chpl)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 5 {
+		return nil, errors.New("chapter list is too short")
+	}
+	pos := 4
+	if data[0] > 0 {
+		pos += 4
+	}
+	if pos >= len(data) {
+		return nil, errors.New("chapter list is too short")
+	}
+	count := int(data[pos])
+	pos++
+	chapters := make([]Chapter, 0, count)
+	for idx := 0; idx < count; idx++ {
+		if pos+9 > len(data) {
+			return nil, errors.New("chapter list is truncated")
+		}
+		start := binary.BigEndian.Uint64(data[pos : pos+8])
+		length := int(data[pos+8])
+		pos += 9
+		if pos+length > len(data) {
+			return nil, errors.New("chapter list is truncated")
+		}
+		chapters = append(chapters, Chapter{
+			Title: string(data[pos : pos+length]),
+			Start: float64(start) / 1e7,
+		})
+		pos += length
+	}
+	return chapters, nil
+}
+
+// Ids of the tracks holding chapter titles, referenced by other tracks with a chap reference
+func chapterTrackIds(r io.ReaderAt, traks []box) (map[uint32]bool, error) {
+	ids := map[uint32]bool{}
+	for _, trak := range traks {
+		chap, ok, err := findPath(r, trak, "tref", "chap")
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		data, err := readContent(r, chap)
+		if err != nil {
+			return nil, err
+		}
+		for pos := 0; pos+4 <= len(data); pos += 4 {
+			ids[binary.BigEndian.Uint32(data[pos:])] = true
+		}
+	}
+	return ids, nil
+}
+
+func trackId(r io.ReaderAt, trak box) (uint32, error) {
+	tkhd, ok, err := findPath(r, trak, "tkhd")
+	if err != nil || !ok {
+		return 0, err
+	}
+	data, err := readContent(r, tkhd)
+	if err != nil {
+		return 0, err
+	}
+	if len(data) >= 24 && data[0] == 1 {
+		return binary.BigEndian.Uint32(data[20:24]), nil
+	}
+	if len(data) >= 16 {
+		return binary.BigEndian.Uint32(data[12:16]), nil
+	}
+	return 0, errors.New("track header is too short")
+}
+
+// Chapters of the QuickTime chapter track, a text track with one sample per chapter; empty if there is none
+func readChapterTrack(r io.ReaderAt, moovChildren []box) ([]Chapter, error) {
+	traks := []box{}
+	for _, b := range moovChildren {
+		if b.typ == "trak" {
+			traks = append(traks, b)
+		}
+	}
+	ids, err := chapterTrackIds(r, traks)
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+	for _, trak := range traks {
+		id, err := trackId(r, trak)
+		if err != nil {
+			return nil, err
+		}
+		if ids[id] {
+			return readTextSamples(r, trak)
+		}
+	}
+	return nil, nil
+}
+
+// Sample tables of a track needed to locate and time its samples
+type sampleTable struct {
+	timescale uint32
+	durations []uint32
+	sizes     []uint32
+	offsets   []int64
+}
+
+func readTextSamples(r io.ReaderAt, trak box) ([]Chapter, error) {
+	table, err := readSampleTable(r, trak)
+	if err != nil {
+		return nil, err
+	}
+	chapters := make([]Chapter, 0, len(table.offsets))
+	var time uint64
+	for idx, offset := range table.offsets {
+		size := table.sizes[idx]
+		if size > 64*1024 {
+			return nil, fmt.Errorf("chapter title of %d bytes is too large", size)
+		}
+		sample := make([]byte, size)
+		if _, err := r.ReadAt(sample, offset); err != nil {
+			return nil, err
+		}
+		var duration uint32
+		if idx < len(table.durations) {
+			duration = table.durations[idx]
+		}
+		chapters = append(chapters, Chapter{
+			Title: sampleText(sample),
+			Start: float64(time) / float64(table.timescale),
+			End:   float64(time+uint64(duration)) / float64(table.timescale),
+		})
+		time += uint64(duration)
+	}
+	return chapters, nil
+}
+
+// Text samples start with the length of the text; UTF-16 text is marked by a byte order mark
+func sampleText(sample []byte) string {
+	if len(sample) < 2 {
+		return ""
+	}
+	length := int(binary.BigEndian.Uint16(sample[0:2]))
+	text := sample[2:min(2+length, len(sample))]
+	if len(text) >= 2 && text[0] == 0xfe && text[1] == 0xff {
+		return readText(text[2:], typeUtf16)
+	}
+	return string(text)
+}
+
+func readSampleTable(r io.ReaderAt, trak box) (sampleTable, error) {
+	table := sampleTable{}
+	mdhd, ok, err := findPath(r, trak, "mdia", "mdhd")
+	if err != nil {
+		return table, err
+	}
+	if !ok {
+		return table, errors.New("chapter track has no media header")
+	}
+	if table.timescale, _, err = readHeader(r, mdhd); err != nil {
+		return table, err
+	}
+	if table.timescale == 0 {
+		return table, errors.New("chapter track has no timescale")
+	}
+	stbl, ok, err := findPath(r, trak, "mdia", "minf", "stbl")
+	if err != nil {
+		return table, err
+	}
+	if !ok {
+		return table, errors.New("chapter track has no sample table")
+	}
+	children, err := readBoxes(r, stbl.offset, stbl.size)
+	if err != nil {
+		return table, err
+	}
+	read := func(typ string) ([]byte, error) {
+		b, ok := find(children, typ)
+		if !ok {
+			return nil, fmt.Errorf("chapter track has no %q box", typ)
+		}
+		data, err := readContent(r, b)
+		if err != nil {
+			return nil, err
+		}
+		if len(data) < 8 {
+			return nil, fmt.Errorf("%q box is too short", typ)
+		}
+		return data, nil
+	}
+
+	// Time to sample: runs of samples with the same duration
+	stts, err := read("stts")
+	if err != nil {
+		return table, err
+	}
+	for _, entry := range entries(stts[8:], binary.BigEndian.Uint32(stts[4:8]), 8) {
+		for n := binary.BigEndian.Uint32(entry[0:4]); n > 0 && len(table.durations) < 1<<16; n-- {
+			table.durations = append(table.durations, binary.BigEndian.Uint32(entry[4:8]))
+		}
+	}
+
+	// Sample sizes: one size for all samples or a size per sample
+	stsz, err := read("stsz")
+	if err != nil {
+		return table, err
+	}
+	if len(stsz) < 12 {
+		return table, errors.New("sample size box is too short")
+	}
+	sampleSize := binary.BigEndian.Uint32(stsz[4:8])
+	sampleCount := min(binary.BigEndian.Uint32(stsz[8:12]), 1<<16)
+	if sampleSize == 0 {
+		for _, entry := range entries(stsz[12:], sampleCount, 4) {
+			table.sizes = append(table.sizes, binary.BigEndian.Uint32(entry))
+		}
+	} else {
+		for n := uint32(0); n < sampleCount; n++ {
+			table.sizes = append(table.sizes, sampleSize)
+		}
+	}
+
+	// Chunk offsets, 32 or 64 bit
+	chunkOffsets := []int64{}
+	if _, ok := find(children, "co64"); ok {
+		co64, err := read("co64")
+		if err != nil {
+			return table, err
+		}
+		for _, entry := range entries(co64[8:], binary.BigEndian.Uint32(co64[4:8]), 8) {
+			chunkOffsets = append(chunkOffsets, int64(binary.BigEndian.Uint64(entry)))
+		}
+	} else {
+		stco, err := read("stco")
+		if err != nil {
+			return table, err
+		}
+		for _, entry := range entries(stco[8:], binary.BigEndian.Uint32(stco[4:8]), 4) {
+			chunkOffsets = append(chunkOffsets, int64(binary.BigEndian.Uint32(entry)))
+		}
+	}
+
+	// Sample to chunk: runs of chunks with the same number of samples, starting at their first chunk
+	stsc, err := read("stsc")
+	if err != nil {
+		return table, err
+	}
+	runs := entries(stsc[8:], binary.BigEndian.Uint32(stsc[4:8]), 12)
+	sample := 0
+	for chunk := range chunkOffsets {
+		perChunk := uint32(0)
+		for _, run := range runs {
+			if int(binary.BigEndian.Uint32(run[0:4])) <= chunk+1 {
+				perChunk = binary.BigEndian.Uint32(run[4:8])
+			}
+		}
+		offset := chunkOffsets[chunk]
+		for n := uint32(0); n < perChunk && sample < len(table.sizes); n++ {
+			table.offsets = append(table.offsets, offset)
+			offset += int64(table.sizes[sample])
+			sample++
+		}
+	}
+	return table, nil
+}
+
+// Up to count entries of size bytes each in data; fewer if data is truncated
+func entries(data []byte, count uint32, size int) [][]byte {
+	result := [][]byte{}
+	for idx := 0; uint32(idx) < count && (idx+1)*size <= len(data); idx++ {
+		result = append(result, data[idx*size:(idx+1)*size])
+	}
+	return result
+}
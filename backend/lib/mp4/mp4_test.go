@@ -0,0 +1,188 @@
+package mp4_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bongofriend/bookplayer/backend/lib/mp4"
+)
+
+// Minimal JPEG header, enough to be recognized as cover art
+var coverData = []byte{0xff, 0xd8, 0xff, 0xe0, 0x00, 0x10, 'J', 'F', 'I', 'F', 0x00}
+
+func box(typ string, content ...[]byte) []byte {
+	data := bytes.Join(content, nil)
+	header := binary.BigEndian.AppendUint32(nil, uint32(8+len(data)))
+	return append(append(header, typ...), data...)
+}
+
+func u32(values ...uint32) []byte {
+	data := []byte{}
+	for _, v := range values {
+		data = binary.BigEndian.AppendUint32(data, v)
+	}
+	return data
+}
+
+func item(typ string, dataType uint32, value []byte) []byte {
+	return box(typ, box("data", u32(dataType, 0), value))
+}
+
+// Text sample of a QuickTime chapter track
+func chapterSample(title string) []byte {
+	return append(binary.BigEndian.AppendUint16(nil, uint16(len(title))), title...)
+}
+
+func neroChapters(titles []string, starts []uint64) []byte {
+	data := []byte{1, 0, 0, 0, 0, 0, 0, 0, byte(len(titles))}
+	for idx, title := range titles {
+		data = binary.BigEndian.AppendUint64(data, starts[idx])
+		data = append(append(data, byte(len(title))), title...)
+	}
+	return box("chpl", data)
+}
+
+/*
+Audiobook of 30 seconds with tags, cover art and Nero chapters; with a chapter track if withChapterTrack is set.
+Titles in the chapter track differ from the Nero chapters to tell them apart
+*/
+func writeFixture(t *testing.T, withChapterTrack bool) string {
+	ftyp := box("ftyp", []byte("M4B "), u32(512), []byte("M4B mp42isom"))
+	samples := [][]byte{chapterSample("Opening Credits"), chapterSample("Laying Plans")}
+	mdat := box("mdat", bytes.Join(samples, nil))
+	// Samples follow the headers of ftyp and mdat
+	chunkOffset := uint32(len(ftyp) + 8)
+
+	mvhd := box("mvhd", u32(0, 0, 0, 1000, 30000), make([]byte, 80))
+	soundTrack := box("trak",
+		box("tkhd", u32(0, 0, 0, 1), make([]byte, 68)),
+		box("tref", box("chap", u32(2))),
+		box("mdia",
+			box("mdhd", u32(0, 0, 0, 44100, 1323000), make([]byte, 4)),
+			box("hdlr", u32(0, 0), []byte("soun"), make([]byte, 13)),
+		),
+	)
+	chapterTrack := box("trak",
+		box("tkhd", u32(0, 0, 0, 2), make([]byte, 68)),
+		box("mdia",
+			box("mdhd", u32(0, 0, 0, 1000, 30000), make([]byte, 4)),
+			box("hdlr", u32(0, 0), []byte("text"), make([]byte, 13)),
+			box("minf", box("stbl",
+				box("stts", u32(0, 2, 1, 12500, 1, 17500)),
+				box("stsz", u32(0, 0, 2, uint32(len(samples[0])), uint32(len(samples[1])))),
+				box("stsc", u32(0, 1, 1, 2, 1)),
+				box("stco", u32(0, 1, chunkOffset)),
+			)),
+		),
+	)
+	ilst := box("ilst",
+		item("\xa9nam", 1, []byte("The Art of War")),
+		item("\xa9ART", 1, []byte("Sun Tzu")),
+		item("\xa9wrt", 1, []byte("Aidan Gillen")),
+		item("\xa9gen", 1, []byte("Philosophy")),
+		item("trkn", 0, []byte{0, 0, 0, 3, 0, 12, 0, 0}),
+		box("----",
+			box("mean", u32(0), []byte("com.apple.iTunes")),
+			box("name", u32(0), []byte("SERIES")),
+			box("data", u32(1, 0), []byte("Classics")),
+		),
+		item("covr", 13, coverData),
+	)
+	udta := box("udta",
+		neroChapters([]string{"Prelude", "Chapter 1"}, []uint64{0, 100_000_000}),
+		box("meta", u32(0), box("hdlr", u32(0, 0), []byte("mdir"), make([]byte, 13)), ilst),
+	)
+	moov := [][]byte{mvhd, soundTrack}
+	if withChapterTrack {
+		moov = append(moov, chapterTrack)
+	}
+	moov = append(moov, udta)
+
+	p := filepath.Join(t.TempDir(), "The Art of War.m4b")
+	if err := os.WriteFile(p, bytes.Join([][]byte{ftyp, mdat, box("moov", moov...)}, nil), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestReadFile(t *testing.T) {
+	t.Run("should read tags and cover", func(t *testing.T) {
+		p := writeFixture(t, true)
+		file, err := mp4.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if file.Duration != 30 {
+			t.Fatalf("Unexpected duration %f", file.Duration)
+		}
+		expected := map[string]string{
+			"major_brand": "M4B ",
+			"title":       "The Art of War",
+			"artist":      "Sun Tzu",
+			"composer":    "Aidan Gillen",
+			"genre":       "Philosophy",
+			"track":       "3/12",
+			"series":      "Classics",
+		}
+		for key, value := range expected {
+			if file.Tags[key] != value {
+				t.Fatalf("Expected %s %q; received: %q", key, value, file.Tags[key])
+			}
+		}
+		if file.Cover == nil || file.Cover.ContentType != "image/jpeg" {
+			t.Fatalf("Unexpected cover %+v", file.Cover)
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		data, err := io.ReadAll(file.Cover.Reader(f))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, coverData) {
+			t.Fatalf("Unexpected cover data %v", data)
+		}
+	})
+	t.Run("should prefer chapter track", func(t *testing.T) {
+		file, err := mp4.ReadFile(writeFixture(t, true))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := []mp4.Chapter{
+			{Title: "Opening Credits", Start: 0, End: 12.5},
+			{Title: "Laying Plans", Start: 12.5, End: 30},
+		}
+		if len(file.Chapters) != len(expected) || file.Chapters[0] != expected[0] || file.Chapters[1] != expected[1] {
+			t.Fatalf("Unexpected chapters %+v", file.Chapters)
+		}
+	})
+	t.Run("should read Nero chapters", func(t *testing.T) {
+		file, err := mp4.ReadFile(writeFixture(t, false))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := []mp4.Chapter{
+			{Title: "Prelude", Start: 0, End: 10},
+			{Title: "Chapter 1", Start: 10, End: 30},
+		}
+		if len(file.Chapters) != len(expected) || file.Chapters[0] != expected[0] || file.Chapters[1] != expected[1] {
+			t.Fatalf("Unexpected chapters %+v", file.Chapters)
+		}
+	})
+	t.Run("should reject other files", func(t *testing.T) {
+		p := filepath.Join(t.TempDir(), "notes.txt")
+		if err := os.WriteFile(p, []byte("Hello, this is not a movie"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := mp4.ReadFile(p); !errors.Is(err, mp4.ErrNotMp4) {
+			t.Fatalf("Expected %s; received: %v", mp4.ErrNotMp4, err)
+		}
+	})
+}
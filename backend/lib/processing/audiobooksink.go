@@ -2,20 +2,31 @@ package processing
 
 import (
 	"context"
+	"errors"
 	"log"
+	"slices"
 
+	"github.com/bongofriend/bookplayer/backend/lib/config"
 	"github.com/bongofriend/bookplayer/backend/lib/data/repo"
+	"github.com/bongofriend/bookplayer/backend/lib/events"
 	"github.com/bongofriend/bookplayer/backend/lib/models"
+	"github.com/bongofriend/bookplayer/backend/lib/transcode"
 )
 
 // TODO Implement PipelineHandler interface
 type AudiobookSink struct {
-	audiobookRepo repo.AudiobookRepository
+	config         config.Config
+	audiobookRepo  repo.AudiobookRepository
+	sourceFileRepo repo.SourceFileRepository
+	eventBus       *events.Bus
 }
 
-func NewAudiobookSink(audiobookRepository repo.AudiobookRepository) AudiobookSink {
+func NewAudiobookSink(config config.Config, audiobookRepository repo.AudiobookRepository, sourceFileRepository repo.SourceFileRepository, eventBus *events.Bus) AudiobookSink {
 	return AudiobookSink{
-		audiobookRepo: audiobookRepository,
+		config:         config,
+		audiobookRepo:  audiobookRepository,
+		sourceFileRepo: sourceFileRepository,
+		eventBus:       eventBus,
 	}
 }
 
@@ -24,9 +35,32 @@ func (a AudiobookSink) Shutdown() {
 }
 
 func (a AudiobookSink) ProcessInput(input models.AudiobookProcessed, outputChan chan struct{}) error {
-	_, err := a.audiobookRepo.InsertAudiobook(context.Background(), input)
-	outputChan <- struct{}{}
-	return err
+	defer func() {
+		outputChan <- struct{}{}
+	}()
+	previous, err := a.audiobookRepo.GetAudiobookBySource(context.Background(), input.RelativePath)
+	if err != nil && !errors.Is(err, repo.ErrNotFound) {
+		return newSourceError(StageSink, input.RelativePath, err)
+	}
+	id, err := a.audiobookRepo.UpsertAudiobook(context.Background(), input)
+	if err != nil {
+		return newSourceError(StageSink, input.RelativePath, err)
+	}
+	if previous != nil {
+		// Chapters of an earlier split that are not overwritten, e.g. when the audiobook got fewer chapters
+		current := processedFiles(input)
+		stale := slices.DeleteFunc(processedFiles(*previous), func(p string) bool {
+			return slices.Contains(current, p)
+		})
+		removeProcessedFiles(a.config.ProcessedAudiobookPath, stale)
+		removeProcessedFiles(a.config.TranscodedChapterPath, transcode.CachedPaths(a.config, stale))
+	}
+	// Link the source files so they are not processed again
+	if err := a.sourceFileRepo.SetSourceAudiobook(context.Background(), input.RelativePath, id); err != nil && !errors.Is(err, repo.ErrNotFound) {
+		return newSourceError(StageSink, input.RelativePath, err)
+	}
+	a.eventBus.Publish(events.Event{Type: events.TypeStored, SourcePath: input.RelativePath, Message: input.Title})
+	return nil
 }
 
 func (a AudiobookSink) CommandsToReceive() []PipelineCommandType {
@@ -4,8 +4,13 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/bongofriend/bookplayer/backend/lib/config"
+	"github.com/bongofriend/bookplayer/backend/lib/data/repo"
 	"github.com/bongofriend/bookplayer/backend/lib/models"
 	"github.com/bongofriend/bookplayer/backend/lib/processing"
 )
@@ -31,6 +36,90 @@ func (a *audiobookMockRepository) InsertAudiobook(context context.Context, audio
 	return a.currentId, nil
 }
 
+func (a *audiobookMockRepository) UpsertAudiobook(context context.Context, audiobook models.AudiobookProcessed) (int64, error) {
+	if existing, err := a.GetAudiobookBySource(context, audiobook.RelativePath); err == nil {
+		a.data[existing.Id] = audiobook
+		return existing.Id, nil
+	}
+	return a.InsertAudiobook(context, audiobook)
+}
+
+func (a audiobookMockRepository) GetAudiobookBySource(context context.Context, relativePath string) (*models.AudiobookProcessed, error) {
+	for id, audiobook := range a.data {
+		if audiobook.RelativePath == relativePath {
+			audiobook.Id = id
+			return &audiobook, nil
+		}
+	}
+	return nil, fmt.Errorf("Audiobook from %s %w", relativePath, repo.ErrNotFound)
+}
+
+func (a audiobookMockRepository) GetAudiobooks(context context.Context, limit int64, offset int64) ([]models.AudiobookProcessed, error) {
+	audiobooks := []models.AudiobookProcessed{}
+	for _, audiobook := range a.data {
+		audiobooks = append(audiobooks, audiobook)
+	}
+	return audiobooks, nil
+}
+
+func (a audiobookMockRepository) CountAudiobooks(context context.Context) (int64, error) {
+	return int64(len(a.data)), nil
+}
+
+func (a audiobookMockRepository) GetAudiobookChapters(context context.Context, audiobookId int64) ([]models.ProcessedChapter, error) {
+	audiobook, err := a.GetAudiobookById(context, audiobookId)
+	if err != nil {
+		return nil, err
+	}
+	return audiobook.ProcessedChapters, nil
+}
+
+func (a audiobookMockRepository) GetAudiobookChapter(context context.Context, audiobookId int64, numbering int) (*models.ProcessedChapter, error) {
+	audiobook, err := a.GetAudiobookById(context, audiobookId)
+	if err != nil {
+		return nil, err
+	}
+	for _, ch := range audiobook.ProcessedChapters {
+		if ch.Numbering == numbering {
+			return &ch, nil
+		}
+	}
+	return nil, fmt.Errorf("Chapter %d of audiobook with Id %d not found", numbering, audiobookId)
+}
+
+func (a audiobookMockRepository) SearchAudiobooks(context context.Context, query string, limit int64, offset int64) ([]models.AudiobookSearchResult, int64, error) {
+	return []models.AudiobookSearchResult{}, 0, nil
+}
+
+func (a audiobookMockRepository) GetAudiobookImage(context context.Context, audiobookId int64, kind string) (*models.AudiobookImage, error) {
+	audiobook, ok := a.data[audiobookId]
+	if !ok {
+		return nil, fmt.Errorf("Audiobook with Id %d not found", audiobookId)
+	}
+	for _, image := range audiobook.Images {
+		if image.Kind == kind {
+			return &image, nil
+		}
+	}
+	return nil, fmt.Errorf("%s image of audiobook with Id %d not found", kind, audiobookId)
+}
+
+func (a audiobookMockRepository) GetMissingAudiobooks(context context.Context, missingBefore time.Time) ([]models.AudiobookProcessed, error) {
+	audiobooks := []models.AudiobookProcessed{}
+	for id, audiobook := range a.data {
+		if audiobook.MissingSince != nil && !audiobook.MissingSince.After(missingBefore) {
+			audiobook.Id = id
+			audiobooks = append(audiobooks, audiobook)
+		}
+	}
+	return audiobooks, nil
+}
+
+func (a audiobookMockRepository) DeleteAudiobook(context context.Context, id int64) error {
+	delete(a.data, id)
+	return nil
+}
+
 func TestAudiobookSink(t *testing.T) {
 	mockRepo := audiobookMockRepository{
 		currentId: 0,
@@ -40,7 +129,7 @@ func TestAudiobookSink(t *testing.T) {
 	if err := json.Unmarshal([]byte(testAudiobook), &audiobook); err != nil {
 		t.Fatal(err)
 	}
-	sinkHandler := processing.NewAudiobookSink(&mockRepo)
+	sinkHandler := processing.NewAudiobookSink(config.Config{}, &mockRepo, newSourceFileMockRepository(), nil)
 	sink := processing.NewPipelineStage(sinkHandler)
 	context, cancel := context.WithCancel(context.Background())
 
@@ -76,3 +165,44 @@ func TestAudiobookSink(t *testing.T) {
 		t.Fatal("No audiobook was inserted")
 	}
 }
+
+func TestAudiobookSinkUpdatesAudiobook(t *testing.T) {
+	testConfig := config.Config{ProcessedAudiobookPath: t.TempDir()}
+	mockRepo := audiobookMockRepository{data: map[int64]models.AudiobookProcessed{}}
+	sinkHandler := processing.NewAudiobookSink(testConfig, &mockRepo, newSourceFileMockRepository(), nil)
+	dirPath := filepath.Join(testConfig.ProcessedAudiobookPath, "Sun Tzu", "The Art of War.m4b")
+	if err := os.MkdirAll(dirPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	withChapters := func(count int) models.AudiobookProcessed {
+		audiobook := models.AudiobookProcessed{RelativePath: "Sun Tzu/The Art of War.m4b"}
+		for idx := 0; idx < count; idx++ {
+			p := filepath.Join(dirPath, fmt.Sprintf("%d.m4b", idx))
+			if err := os.WriteFile(p, []byte("chapter"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			audiobook.ProcessedChapters = append(audiobook.ProcessedChapters, models.ProcessedChapter{
+				ChapterCommon: models.ChapterCommon{Numbering: idx},
+				FilePath:      p,
+			})
+		}
+		return audiobook
+	}
+	outputChan := make(chan struct{}, 2)
+	if err := sinkHandler.ProcessInput(withChapters(3), outputChan); err != nil {
+		t.Fatal(err)
+	}
+	if err := sinkHandler.ProcessInput(withChapters(2), outputChan); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(mockRepo.data) != 1 {
+		t.Fatalf("Expected 1 audiobook; received: %d", len(mockRepo.data))
+	}
+	if _, err := os.Stat(filepath.Join(dirPath, "2.m4b")); !os.IsNotExist(err) {
+		t.Fatal("Expected stale chapter file to be removed")
+	}
+	if _, err := os.Stat(filepath.Join(dirPath, "1.m4b")); err != nil {
+		t.Fatal(err)
+	}
+}
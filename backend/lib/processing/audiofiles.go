@@ -0,0 +1,108 @@
+package processing
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Extensions of audio files recognized as (part of) an audiobook
+var audioExtensions = []string{".m4b", ".m4a", ".mp4", ".mp3", ".flac", ".opus", ".ogg", ".oga", ".aac", ".wav"}
+
+// Subdirectories of a multi-disc audiobook, e.g. "CD 1" or "Disc02"
+var discDirectory = regexp.MustCompile(`(?i)^(cd|disc|disk|part)\s*\d+$`)
+
+func isAudioFile(name string) bool {
+	return slices.Contains(audioExtensions, strings.ToLower(filepath.Ext(name)))
+}
+
+/*
+Compare strings treating runs of digits as numbers, so "2 - Intro.mp3" sorts before "10 - End.mp3".
+Returns a negative number if a sorts before b, a positive number if after and 0 if equal
+*/
+func naturalCompare(a string, b string) int {
+	a, b = strings.ToLower(a), strings.ToLower(b)
+	for len(a) > 0 && len(b) > 0 {
+		if isDigit(a[0]) && isDigit(b[0]) {
+			numA, restA := splitDigits(a)
+			numB, restB := splitDigits(b)
+			if c := compareNumbers(numA, numB); c != 0 {
+				return c
+			}
+			a, b = restA, restB
+			continue
+		}
+		if a[0] != b[0] {
+			return int(a[0]) - int(b[0])
+		}
+		a, b = a[1:], b[1:]
+	}
+	return len(a) - len(b)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func splitDigits(s string) (string, string) {
+	idx := 0
+	for idx < len(s) && isDigit(s[idx]) {
+		idx++
+	}
+	return s[:idx], s[idx:]
+}
+
+// Compare digit strings of arbitrary length without overflowing
+func compareNumbers(a string, b string) int {
+	a = strings.TrimLeft(a, "0")
+	b = strings.TrimLeft(b, "0")
+	if len(a) != len(b) {
+		return len(a) - len(b)
+	}
+	return strings.Compare(a, b)
+}
+
+/*
+Collect audio files of the audiobook in dirPath, including files in disc subdirectories.
+Files are ordered by disc directory and natural filename order
+*/
+func audioFilesInDirectory(dirPath string) ([]string, error) {
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		return nil, err
+	}
+	files := []string{}
+	discs := []string{}
+	for _, e := range entries {
+		name := e.Name()
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+		if e.IsDir() {
+			if discDirectory.MatchString(name) {
+				discs = append(discs, name)
+			}
+			continue
+		}
+		if isAudioFile(name) {
+			files = append(files, name)
+		}
+	}
+	slices.SortFunc(files, naturalCompare)
+	slices.SortFunc(discs, naturalCompare)
+
+	paths := make([]string, 0, len(files))
+	for _, f := range files {
+		paths = append(paths, filepath.Join(dirPath, f))
+	}
+	for _, d := range discs {
+		discFiles, err := audioFilesInDirectory(filepath.Join(dirPath, d))
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, discFiles...)
+	}
+	return paths, nil
+}
@@ -0,0 +1,81 @@
+package processing
+
+import (
+	"context"
+	"slices"
+
+	"github.com/bongofriend/bookplayer/backend/lib/config"
+)
+
+/*
+Pipeline stages connected output to input. Chains are assembled with NewStageChain and Append, which only accept a
+stage whose input matches the output of the chain so far; optional stages are left out by not appending them
+*/
+type StageChain[Input any, Output any] struct {
+	// Input of the first stage
+	InputChan chan Input
+	// Output of the last stage
+	OutputChan chan Output
+
+	commandChans []chan PipelineCommand
+	doneChans    []chan struct{}
+	starters     []func(ctx context.Context, errorChan chan error)
+	// Shared by all stages so the whole chain pauses at once
+	gate *pauseGate
+}
+
+// Chain starting with the stage of handler
+func NewStageChain[Input any, Output any](handler PipelineStageHandler[Input, Output], stageConfig config.StageConfig) StageChain[Input, Output] {
+	stage := NewConcurrentPipelineStage(handler, stageConfig)
+	stage.gate = &pauseGate{}
+	return StageChain[Input, Output]{
+		InputChan:    stage.InputChan,
+		OutputChan:   stage.OutputChan,
+		commandChans: []chan PipelineCommand{stage.CommandChan},
+		doneChans:    []chan struct{}{stage.DoneChan},
+		starters:     []func(ctx context.Context, errorChan chan error){stage.Start},
+		gate:         stage.gate,
+	}
+}
+
+// Chain with the stage of handler processing the output of chain
+func Append[Input any, Via any, Output any](chain StageChain[Input, Via], handler PipelineStageHandler[Via, Output], stageConfig config.StageConfig) StageChain[Input, Output] {
+	stage := NewConcurrentPipelineStage(handler, stageConfig)
+	stage.gate = chain.gate
+	from := chain.OutputChan
+	connect := func(ctx context.Context, _ chan error) {
+		connectStages(ctx, from, stage.InputChan)
+	}
+	// Clipped so chains appended to the same chain do not share their stages
+	return StageChain[Input, Output]{
+		InputChan:    chain.InputChan,
+		OutputChan:   stage.OutputChan,
+		commandChans: append(slices.Clip(chain.commandChans), stage.CommandChan),
+		doneChans:    append(slices.Clip(chain.doneChans), stage.DoneChan),
+		starters:     append(slices.Clip(chain.starters), stage.Start, connect),
+		gate:         chain.gate,
+	}
+}
+
+// Start all stages of chain; each stage reports on its DoneChan after ctx is canceled
+func (c StageChain[Input, Output]) Start(ctx context.Context, errorChan chan error) {
+	for _, start := range c.starters {
+		go start(ctx, errorChan)
+	}
+}
+
+// Let stages finish the inputs they are processing but not start on new ones until Resume
+func (c StageChain[Input, Output]) Pause() {
+	c.gate.pause()
+}
+
+func (c StageChain[Input, Output]) Resume() {
+	c.gate.resume()
+}
+
+// Wait until all stages are shut down
+func (c StageChain[Input, Output]) Wait() {
+	for _, ch := range c.doneChans {
+		<-ch
+	}
+}
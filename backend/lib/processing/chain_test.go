@@ -0,0 +1,159 @@
+package processing_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bongofriend/bookplayer/backend/lib/config"
+	"github.com/bongofriend/bookplayer/backend/lib/processing"
+)
+
+// Handler applying process to every input
+type funcPipelineHandler[Input any, Output any] struct {
+	process    func(Input) (Output, error)
+	isShutdown atomic.Bool
+}
+
+func newFuncPipelineHandler[Input any, Output any](process func(Input) (Output, error)) *funcPipelineHandler[Input, Output] {
+	return &funcPipelineHandler[Input, Output]{process: process}
+}
+
+func (f *funcPipelineHandler[Input, Output]) Shutdown() {
+	f.isShutdown.Store(true)
+}
+
+func (f *funcPipelineHandler[Input, Output]) ProcessInput(input Input, output chan Output) error {
+	result, err := f.process(input)
+	if err != nil {
+		return err
+	}
+	output <- result
+	return nil
+}
+
+func (f *funcPipelineHandler[Input, Output]) CommandsToReceive() []processing.PipelineCommandType {
+	return []processing.PipelineCommandType{}
+}
+
+func (f *funcPipelineHandler[Input, Output]) ProcessCommand(cmd processing.PipelineCommand, inputChan chan Input, outputChan chan Output) error {
+	return nil
+}
+
+func TestStageChain(t *testing.T) {
+	stageConfig := config.StageConfig{Workers: 2, BufferSize: 4}
+	parse := newFuncPipelineHandler(func(input string) (int, error) {
+		return strconv.Atoi(input)
+	})
+	double := newFuncPipelineHandler(func(input int) (int, error) {
+		return 2 * input, nil
+	})
+	format := newFuncPipelineHandler(func(input int) (string, error) {
+		return "#" + strconv.Itoa(input), nil
+	})
+
+	t.Run("should pass results through all stages", func(t *testing.T) {
+		chain := processing.Append(processing.Append(processing.NewStageChain(parse, stageConfig), double, stageConfig), format, stageConfig)
+		context, cancel := context.WithCancel(context.Background())
+		errChan := make(chan error, 1)
+		chain.Start(context, errChan)
+
+		chain.InputChan <- "21"
+		select {
+		case result := <-chain.OutputChan:
+			if result != "#42" {
+				t.Fatalf("Expected #42; received: %s", result)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Received no output")
+		}
+
+		chain.InputChan <- "not a number"
+		select {
+		case err := <-errChan:
+			var numErr *strconv.NumError
+			if !errors.As(err, &numErr) {
+				t.Fatalf("Unexpected error %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Received no error")
+		}
+
+		cancel()
+		chain.Wait()
+		if !parse.isShutdown.Load() || !double.isShutdown.Load() || !format.isShutdown.Load() {
+			t.Fatal("Stages did not shutdown properly")
+		}
+	})
+	t.Run("should not start on new inputs while paused", func(t *testing.T) {
+		chain := processing.Append(processing.NewStageChain(parse, stageConfig), format, stageConfig)
+		context, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		chain.Start(context, make(chan error, 1))
+
+		chain.Pause()
+		chain.InputChan <- "7"
+		select {
+		case result := <-chain.OutputChan:
+			t.Fatalf("Expected no output while paused; received: %s", result)
+		case <-time.After(100 * time.Millisecond):
+		}
+		chain.Resume()
+		select {
+		case result := <-chain.OutputChan:
+			if result != "#7" {
+				t.Fatalf("Expected #7; received: %s", result)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Received no output after resuming")
+		}
+	})
+	t.Run("should leave out stages not appended", func(t *testing.T) {
+		parsed := processing.NewStageChain(parse, stageConfig)
+		// A second chain from the same stages must not change the first one
+		_ = processing.Append(parsed, double, stageConfig)
+		chain := processing.Append(parsed, format, stageConfig)
+		context, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		chain.Start(context, make(chan error, 1))
+
+		chain.InputChan <- "21"
+		select {
+		case result := <-chain.OutputChan:
+			if result != "#21" {
+				t.Fatalf("Expected #21; received: %s", result)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Received no output")
+		}
+	})
+	t.Run("should shut down while output is unread", func(t *testing.T) {
+		processed := make(chan struct{}, 1)
+		notify := newFuncPipelineHandler(func(input int) (string, error) {
+			processed <- struct{}{}
+			return "#" + strconv.Itoa(input), nil
+		})
+		chain := processing.Append(processing.NewStageChain(parse, stageConfig), notify, stageConfig)
+		context, cancel := context.WithCancel(context.Background())
+		chain.Start(context, make(chan error, 1))
+
+		chain.InputChan <- "1"
+		chain.InputChan <- "2"
+		<-processed
+		<-processed
+		cancel()
+		done := make(chan struct{})
+		go func() {
+			chain.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("Chain did not shut down")
+		}
+	})
+}
@@ -1,24 +1,30 @@
 package processing
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
 	"os"
 	"os/exec"
 	"path"
+	"path/filepath"
 	"strconv"
 	"strings"
 
 	"github.com/bongofriend/bookplayer/backend/lib/config"
+	"github.com/bongofriend/bookplayer/backend/lib/events"
 	"github.com/bongofriend/bookplayer/backend/lib/models"
+	"github.com/bongofriend/bookplayer/backend/lib/transcode"
 )
 
 type ChapterSplitter struct {
-	config config.Config
+	config     config.Config
+	eventBus   *events.Bus
+	transcoder *transcode.Transcoder
 }
 
-func NewChapterSplitter(config config.Config) (*ChapterSplitter, error) {
+func NewChapterSplitter(config config.Config, eventBus *events.Bus) (*ChapterSplitter, error) {
 	if !ffmpegIsAvailable() {
 		return nil, errors.New("ffmpeg is not available")
 	}
@@ -27,7 +33,9 @@ func NewChapterSplitter(config config.Config) (*ChapterSplitter, error) {
 	}
 
 	return &ChapterSplitter{
-		config: config,
+		config:     config,
+		eventBus:   eventBus,
+		transcoder: transcode.NewTranscoder(config),
 	}, nil
 }
 
@@ -36,19 +44,38 @@ func ffmpegIsAvailable() bool {
 	return err == nil
 }
 
-func getChapterOutputPathFormat(dirPath string) string {
-	return path.Join(dirPath, "%d.m4b")
+// Chapters keep the container of their source so audio can be copied without transcoding
+func chapterExtension(input AudiobookMetadataResult) string {
+	if len(input.Files) == 0 {
+		return ".m4b"
+	}
+	return strings.ToLower(filepath.Ext(input.Files[0]))
+}
+
+// Folder for chapters and images of an audiobook; mirrors the location of its source in the library
+func processedDirectory(c config.Config, relativePath string, title string) string {
+	if len(relativePath) == 0 {
+		return path.Join(c.ProcessedAudiobookPath, title)
+	}
+	return path.Join(c.ProcessedAudiobookPath, relativePath)
+}
+
+func getChapterOutputPathFormat(dirPath string, extension string) string {
+	return path.Join(dirPath, "%d"+extension)
 }
 
 func getArgs(input AudiobookMetadataResult, outputPath string) []string {
 	audiobook := input.Audiobook
-	filePath := string(input.FilePath)
+	filePath := input.FilePath
+	if len(input.Files) > 0 {
+		filePath = input.Files[0]
+	}
 	endTimes := make([]string, len(audiobook.Chapters))
 	for idx, ch := range audiobook.Chapters {
 		endTimes[idx] = strconv.FormatFloat(float64(ch.EndTime), 'f', -1, 32)
 	}
 	endTimeArgs := strings.Join(endTimes, ",")
-	outputPathFormat := getChapterOutputPathFormat(outputPath)
+	outputPathFormat := getChapterOutputPathFormat(outputPath, chapterExtension(input))
 
 	return []string{
 		"-i",
@@ -69,9 +96,22 @@ func getArgs(input AudiobookMetadataResult, outputPath string) []string {
 	}
 }
 
-func extendAudiobook(a models.Audiobook, splitChapterDirPath string, audiobookFilePath string) (*models.AudiobookProcessed, error) {
+// Arguments for copying the audio of a single file that already is exactly one chapter
+func getCopyArgs(filePath string, outputPath string) []string {
+	return []string{
+		"-y",
+		"-i",
+		filePath,
+		"-vn",
+		"-acodec",
+		"copy",
+		outputPath,
+	}
+}
+
+func extendAudiobook(a models.Audiobook, splitChapterDirPath string, extension string, audiobookFilePath string, relativePath string) (*models.AudiobookProcessed, error) {
 	processedChapters := make([]models.ProcessedChapter, 0)
-	outputPathFormat := getChapterOutputPathFormat(splitChapterDirPath)
+	outputPathFormat := getChapterOutputPathFormat(splitChapterDirPath, extension)
 	for _, ch := range a.Chapters {
 		chapterPath := fmt.Sprintf(outputPathFormat, ch.Numbering)
 		stat, err := os.Stat(chapterPath)
@@ -91,6 +131,7 @@ func extendAudiobook(a models.Audiobook, splitChapterDirPath string, audiobookFi
 	return &models.AudiobookProcessed{
 		AudiobookCommon:   a.AudiobookCommon,
 		FilePath:          audiobookFilePath,
+		RelativePath:      relativePath,
 		ProcessedChapters: processedChapters,
 	}, nil
 }
@@ -100,37 +141,89 @@ func (c ChapterSplitter) Shutdown() {
 }
 
 func (c ChapterSplitter) ProcessInput(input AudiobookMetadataResult, outputChan chan models.AudiobookProcessed) error {
-	p := input.FilePath
-	audiobook := input.Audiobook
-	stat, err := os.Stat(p)
+	processedAudiobook, err := c.split(input)
 	if err != nil {
-		return err
+		return newSourceError(StageChapters, input.RelativePath, err)
 	}
-	if stat.IsDir() {
-		return fmt.Errorf("%s is not file", p)
+	// Normalizing rewrites the chapters, so they are transcoded once that is done
+	if !normalizesLoudness(c.config) {
+		pretranscode(c.transcoder, *processedAudiobook)
 	}
+	outputChan <- *processedAudiobook
+	return nil
+}
 
-	procesedAudiobookPath := path.Join(c.config.ProcessedAudiobookPath, audiobook.Title)
+// Fill the transcoding cache for profiles that ask for it; chapters failing here are transcoded on their first request instead
+func pretranscode(transcoder *transcode.Transcoder, audiobook models.AudiobookProcessed) {
+	for _, profile := range transcoder.Profiles() {
+		if !profile.Pretranscode {
+			continue
+		}
+		for _, ch := range audiobook.ProcessedChapters {
+			if _, err := transcoder.Transcode(context.Background(), profile, ch.FilePath); err != nil {
+				log.Println(err)
+			}
+		}
+	}
+}
 
-	if err = os.Mkdir(procesedAudiobookPath, 0755); err != nil {
-		if os.IsExist(err) {
-			log.Printf("Found same audiobook at %s; skipping", procesedAudiobookPath)
-		} else {
-			return err
+func (c ChapterSplitter) split(input AudiobookMetadataResult) (*models.AudiobookProcessed, error) {
+	audiobook := input.Audiobook
+	if len(input.Files) == 0 {
+		input.Files = []string{input.FilePath}
+	}
+	for _, p := range input.Files {
+		stat, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if stat.IsDir() {
+			return nil, fmt.Errorf("%s is not file", p)
 		}
 	}
+	if len(input.Files) > 1 && len(input.Files) != len(audiobook.Chapters) {
+		return nil, fmt.Errorf("expected one file per chapter for %s; found %d files and %d chapters", input.FilePath, len(input.Files), len(audiobook.Chapters))
+	}
+
+	procesedAudiobookPath := processedDirectory(c.config, input.RelativePath, audiobook.Title)
+	// Chapters of an earlier run are overwritten; leftovers are removed by AudiobookSink once the audiobook is updated
+	if err := os.MkdirAll(procesedAudiobookPath, 0755); err != nil {
+		return nil, err
+	}
 
-	args := getArgs(input, procesedAudiobookPath)
-	cmd := exec.Command("ffmpeg", args...)
-	if _, err = cmd.Output(); err != nil {
-		return err
+	extension := chapterExtension(input)
+	progress := newSplitProgress(c.eventBus, input.RelativePath)
+	progress.report(0)
+	var duration float64
+	if len(audiobook.Chapters) > 0 {
+		duration = float64(audiobook.Chapters[len(audiobook.Chapters)-1].EndTime)
 	}
-	processedAudiobook, err := extendAudiobook(audiobook, procesedAudiobookPath, input.FilePath)
-	if err != nil {
-		return err
+	reportPosition := func(offset float64) func(float64) {
+		return func(seconds float64) {
+			if duration > 0 {
+				progress.report((offset + seconds) / duration)
+			}
+		}
 	}
-	outputChan <- *processedAudiobook
-	return nil
+	if len(input.Files) > 1 || len(audiobook.Chapters) == 1 {
+		// Every file already is one chapter
+		outputPathFormat := getChapterOutputPathFormat(procesedAudiobookPath, extension)
+		for idx, f := range input.Files {
+			chapter := audiobook.Chapters[idx]
+			args := getCopyArgs(f, fmt.Sprintf(outputPathFormat, chapter.Numbering))
+			if err := runFfmpegWithProgress(args, reportPosition(float64(chapter.StartTime))); err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		// Timestamps are copied, so ffmpeg reports positions within the whole audiobook
+		args := getArgs(input, procesedAudiobookPath)
+		if err := runFfmpegWithProgress(args, reportPosition(0)); err != nil {
+			return nil, err
+		}
+	}
+	progress.report(1)
+	return extendAudiobook(audiobook, procesedAudiobookPath, extension, input.FilePath, input.RelativePath)
 }
 
 func (c ChapterSplitter) CommandsToReceive() []PipelineCommandType {
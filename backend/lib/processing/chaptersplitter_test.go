@@ -24,7 +24,7 @@ func TestChapterSplitter(t *testing.T) {
 	config := config.Config{
 		ApplicationDirectory: t.TempDir(),
 	}
-	handler, err := processing.NewChapterSplitter(config)
+	handler, err := processing.NewChapterSplitter(config, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
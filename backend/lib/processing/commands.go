@@ -0,0 +1,175 @@
+package processing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bongofriend/bookplayer/backend/lib/data/repo"
+	"github.com/bongofriend/bookplayer/backend/lib/models"
+)
+
+// Commands kept for callers to follow; older ones are forgotten
+const trackedCommands = 100
+
+var ErrPipelineStopped = errors.New("pipeline is not running")
+
+var commandTypes = map[string]PipelineCommandType{
+	models.CommandScan:      Scan,
+	models.CommandRescan:    Rescan,
+	models.CommandReprocess: Reprocess,
+	models.CommandRehash:    Rehash,
+	models.CommandPause:     Pause,
+	models.CommandResume:    Resume,
+	models.CommandWriteBack: WriteBack,
+}
+
+// Audiobook source the command is limited to; empty for the whole library
+func (c PipelineCommand) sourcePath() string {
+	sourcePath, _ := c.Payload.(string)
+	return sourcePath
+}
+
+// Mark command as being carried out
+func (c PipelineCommand) started() {
+	if c.tracker != nil {
+		c.tracker.update(c.Id, models.CommandStateRunning, nil)
+	}
+}
+
+// Mark command as done, or as failed if err is not nil
+func (c PipelineCommand) finished(err error) {
+	if c.tracker == nil {
+		return
+	}
+	state := models.CommandStateDone
+	if err != nil {
+		state = models.CommandStateFailed
+	}
+	c.tracker.update(c.Id, state, err)
+}
+
+// State of recently dispatched commands
+type commandTracker struct {
+	mu       sync.Mutex
+	lastId   int64
+	commands map[int64]models.Command
+}
+
+func newCommandTracker() *commandTracker {
+	return &commandTracker{
+		commands: make(map[int64]models.Command),
+	}
+}
+
+func (t *commandTracker) add(commandType string, sourcePath string) models.Command {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.lastId++
+	now := time.Now()
+	command := models.Command{
+		Id:         t.lastId,
+		Type:       commandType,
+		SourcePath: sourcePath,
+		State:      models.CommandStateQueued,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	t.commands[command.Id] = command
+	delete(t.commands, command.Id-trackedCommands)
+	return command
+}
+
+func (t *commandTracker) update(id int64, state string, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	command, ok := t.commands[id]
+	if !ok {
+		return
+	}
+	command.State = state
+	if err != nil {
+		command.Error = err.Error()
+	}
+	command.UpdatedAt = time.Now()
+	t.commands[id] = command
+}
+
+func (t *commandTracker) get(id int64) (models.Command, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	command, ok := t.commands[id]
+	return command, ok
+}
+
+// Send a command to the pipeline; the returned command can be followed with GetCommand
+func (p *Pipeline) DispatchCommand(context context.Context, commandType string, sourcePath string) (*models.Command, error) {
+	cmdType, ok := commandTypes[commandType]
+	if !ok {
+		return nil, fmt.Errorf("unknown pipeline command %s", commandType)
+	}
+	command := p.commands.add(commandType, sourcePath)
+	select {
+	case p.PipelineCommandChan <- PipelineCommand{Id: command.Id, CmdType: cmdType, Payload: sourcePath, tracker: p.commands}:
+		return &command, nil
+	case <-p.stopped:
+		p.commands.update(command.Id, models.CommandStateFailed, ErrPipelineStopped)
+		return nil, ErrPipelineStopped
+	case <-context.Done():
+		p.commands.update(command.Id, models.CommandStateFailed, context.Err())
+		return nil, context.Err()
+	}
+}
+
+func (p *Pipeline) GetCommand(id int64) (*models.Command, error) {
+	command, ok := p.commands.get(id)
+	if !ok {
+		return nil, fmt.Errorf("command %d %w", id, repo.ErrNotFound)
+	}
+	return &command, nil
+}
+
+// Holds stage workers back while the pipeline is paused
+type pauseGate struct {
+	mu sync.Mutex
+	// Closed on resume; nil while not paused
+	resumed chan struct{}
+}
+
+func (g *pauseGate) pause() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.resumed == nil {
+		g.resumed = make(chan struct{})
+	}
+}
+
+func (g *pauseGate) resume() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.resumed != nil {
+		close(g.resumed)
+		g.resumed = nil
+	}
+}
+
+// Block while paused; false if ctx was canceled in the meantime. A nil gate is never paused
+func (g *pauseGate) wait(ctx context.Context) bool {
+	if g == nil {
+		return true
+	}
+	g.mu.Lock()
+	resumed := g.resumed
+	g.mu.Unlock()
+	if resumed == nil {
+		return true
+	}
+	select {
+	case <-ctx.Done():
+		return false
+	case <-resumed:
+		return true
+	}
+}
@@ -0,0 +1,320 @@
+package processing
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/bongofriend/bookplayer/backend/lib/config"
+	"github.com/bongofriend/bookplayer/backend/lib/models"
+	"github.com/bongofriend/bookplayer/backend/lib/mp4"
+)
+
+// Extracts embedded cover art next to the split chapters and generates thumbnails from it
+type CoverExtractor struct {
+	config config.Config
+}
+
+type Stream struct {
+	Index       int    `json:"index"`
+	CodecName   string `json:"codec_name"`
+	CodecType   string `json:"codec_type"`
+	Disposition struct {
+		AttachedPic int `json:"attached_pic"`
+	} `json:"disposition"`
+}
+
+type streamsOutput struct {
+	Streams []Stream `json:"streams"`
+}
+
+// Preferred names of cover images stored alongside audio files
+var folderImageNames = []string{"cover", "folder", "front"}
+
+// Cover formats that can be copied out of the container as is
+var coverFormats = map[string]struct {
+	extension   string
+	contentType string
+}{
+	"mjpeg": {".jpg", "image/jpeg"},
+	"png":   {".png", "image/png"},
+}
+
+func NewCoverExtractor(config config.Config) (*CoverExtractor, error) {
+	if !ffmpegIsAvailable() {
+		return nil, errors.New("ffmpeg is not available")
+	}
+	return &CoverExtractor{
+		config: config,
+	}, nil
+}
+
+// Pick the attached picture, falling back to any video stream
+func findCoverStream(streams []Stream) (Stream, bool) {
+	var fallback *Stream
+	for idx, s := range streams {
+		if s.CodecType != "video" {
+			continue
+		}
+		if s.Disposition.AttachedPic == 1 {
+			return s, true
+		}
+		if fallback == nil {
+			fallback = &streams[idx]
+		}
+	}
+	if fallback != nil {
+		return *fallback, true
+	}
+	return Stream{}, false
+}
+
+func probeStreams(filePath string) ([]Stream, error) {
+	cmd := exec.Command("ffprobe", "-v", "error", "-print_format", "json", "-show_streams", filePath)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	result := streamsOutput{}
+	if err := json.Unmarshal(output, &result); err != nil {
+		return nil, err
+	}
+	return result.Streams, nil
+}
+
+// Copy the cover stream into dirPath; covers in unknown formats are converted to PNG
+func extractCover(filePath string, stream Stream, dirPath string) (string, string, error) {
+	codec := "copy"
+	format, ok := coverFormats[stream.CodecName]
+	if !ok {
+		codec = "png"
+		format = coverFormats["png"]
+	}
+	coverPath := path.Join(dirPath, models.ImageKindCover+format.extension)
+	args := []string{
+		"-y",
+		"-v",
+		"error",
+		"-i",
+		filePath,
+		"-map",
+		fmt.Sprintf("0:%d", stream.Index),
+		"-frames:v",
+		"1",
+		"-c:v",
+		codec,
+		"-f",
+		"image2",
+		coverPath,
+	}
+	if _, err := exec.Command("ffmpeg", args...).Output(); err != nil {
+		return "", "", err
+	}
+	return coverPath, format.contentType, nil
+}
+
+/*
+Copy cover art of MP4 files straight out of the container into dirPath.
+False for other files and covers in formats needing conversion, which are left to ffmpeg
+*/
+func extractMp4Cover(filePath string, dirPath string) (string, string, bool, error) {
+	if !(Mp4Reader{}).Supports(filePath) {
+		return "", "", false, nil
+	}
+	file, err := mp4.ReadFile(filePath)
+	if err != nil || file.Cover == nil {
+		return "", "", false, nil
+	}
+	var extension string
+	for _, format := range coverFormats {
+		if format.contentType == file.Cover.ContentType {
+			extension = format.extension
+		}
+	}
+	if len(extension) == 0 {
+		return "", "", false, nil
+	}
+	in, err := os.Open(filePath)
+	if err != nil {
+		return "", "", false, err
+	}
+	defer in.Close()
+	coverPath := path.Join(dirPath, models.ImageKindCover+extension)
+	out, err := os.Create(coverPath)
+	if err != nil {
+		return "", "", false, err
+	}
+	defer out.Close()
+	if _, err := io.Copy(out, file.Cover.Reader(in)); err != nil {
+		return "", "", false, err
+	}
+	return coverPath, file.Cover.ContentType, true, out.Close()
+}
+
+// Decode an extracted cover and write thumbnails for all configured sizes next to it
+func CreateCoverImages(coverPath string, contentType string) ([]models.AudiobookImage, error) {
+	file, err := os.Open(coverPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return nil, err
+	}
+	images := []models.AudiobookImage{{
+		Kind:        models.ImageKindCover,
+		FilePath:    coverPath,
+		ContentType: contentType,
+		Width:       img.Bounds().Dx(),
+		Height:      img.Bounds().Dy(),
+	}}
+	dirPath := path.Dir(coverPath)
+	for kind, size := range thumbnailSizes {
+		thumbnailPath := path.Join(dirPath, fmt.Sprintf("%s_%s.jpg", models.ImageKindCover, kind))
+		width, height, err := writeThumbnail(img, thumbnailPath, size)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, models.AudiobookImage{
+			Kind:        kind,
+			FilePath:    thumbnailPath,
+			ContentType: "image/jpeg",
+			Width:       width,
+			Height:      height,
+		})
+	}
+	return images, nil
+}
+
+func (c CoverExtractor) Shutdown() {
+	log.Println("Shutting down CoverExtractor")
+}
+
+// A missing or broken cover never stops an audiobook from being added to the library
+func (c CoverExtractor) ProcessInput(input models.AudiobookProcessed, outputChan chan models.AudiobookProcessed) error {
+	images, err := c.processCover(input)
+	if err != nil {
+		log.Printf("Could not extract cover of %s: %s", input.FilePath, err)
+	}
+	input.Images = images
+	outputChan <- input
+	return nil
+}
+
+func (c CoverExtractor) processCover(input models.AudiobookProcessed) ([]models.AudiobookImage, error) {
+	dirPath := processedDirectory(c.config, input.RelativePath, input.Title)
+	stat, err := os.Stat(input.FilePath)
+	if err != nil {
+		return nil, err
+	}
+	audioFile := input.FilePath
+	if stat.IsDir() {
+		// Folders of audio files usually come with the cover as separate image
+		if imagePath, contentType, ok := findFolderImage(input.FilePath); ok {
+			coverPath := path.Join(dirPath, models.ImageKindCover+strings.ToLower(filepath.Ext(imagePath)))
+			if err := copyFile(imagePath, coverPath); err != nil {
+				return nil, err
+			}
+			return CreateCoverImages(coverPath, contentType)
+		}
+		files, err := audioFilesInDirectory(input.FilePath)
+		if err != nil || len(files) == 0 {
+			return nil, err
+		}
+		audioFile = files[0]
+	}
+	coverPath, contentType, ok, err := extractMp4Cover(audioFile, dirPath)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return CreateCoverImages(coverPath, contentType)
+	}
+	streams, err := probeStreams(audioFile)
+	if err != nil {
+		return nil, err
+	}
+	stream, ok := findCoverStream(streams)
+	if !ok {
+		return nil, nil
+	}
+	coverPath, contentType, err = extractCover(audioFile, stream, dirPath)
+	if err != nil {
+		return nil, err
+	}
+	return CreateCoverImages(coverPath, contentType)
+}
+
+// Image in dirPath preferring conventional names like cover.jpg or folder.png over any other image
+func findFolderImage(dirPath string) (string, string, bool) {
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		return "", "", false
+	}
+	found := ""
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || folderImageContentType(name) == "" {
+			continue
+		}
+		if slices.Contains(folderImageNames, strings.ToLower(baseName(name))) {
+			found = name
+			break
+		}
+		if found == "" {
+			found = name
+		}
+	}
+	if found == "" {
+		return "", "", false
+	}
+	return filepath.Join(dirPath, found), folderImageContentType(found), true
+}
+
+func folderImageContentType(name string) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".jpg", ".jpeg":
+		return "image/jpeg"
+	case ".png":
+		return "image/png"
+	default:
+		return ""
+	}
+}
+
+func copyFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	if _, err := io.Copy(out, in); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+func (c CoverExtractor) CommandsToReceive() []PipelineCommandType {
+	return []PipelineCommandType{}
+}
+
+func (c CoverExtractor) ProcessCommand(cmd PipelineCommand, inputChan chan models.AudiobookProcessed, outputChan chan models.AudiobookProcessed) error {
+	return nil
+}
@@ -0,0 +1,69 @@
+package processing_test
+
+import (
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/bongofriend/bookplayer/backend/lib/models"
+	"github.com/bongofriend/bookplayer/backend/lib/processing"
+)
+
+func TestCreateCoverImages(t *testing.T) {
+	coverPath := path.Join(t.TempDir(), "cover.png")
+	cover := image.NewNRGBA(image.Rect(0, 0, 1000, 600))
+	for y := 0; y < 600; y++ {
+		for x := 0; x < 1000; x++ {
+			cover.Set(x, y, color.NRGBA{R: 200, A: 0xff})
+		}
+	}
+	file, err := os.Create(coverPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(file, cover); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	images, err := processing.CreateCoverImages(coverPath, "image/png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string][2]int{
+		models.ImageKindCover:  {1000, 600},
+		models.ImageKindSmall:  {160, 96},
+		models.ImageKindMedium: {480, 288},
+	}
+	if len(images) != len(expected) {
+		t.Fatalf("Expected %d images; received: %d", len(expected), len(images))
+	}
+	for _, img := range images {
+		size, ok := expected[img.Kind]
+		if !ok {
+			t.Fatalf("Unexpected image kind %s", img.Kind)
+		}
+		if img.Width != size[0] || img.Height != size[1] {
+			t.Fatalf("Expected %s image of %dx%d; received: %dx%d", img.Kind, size[0], size[1], img.Width, img.Height)
+		}
+		if img.Kind == models.ImageKindCover {
+			continue
+		}
+		thumbnailFile, err := os.Open(img.FilePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		thumbnail, err := jpeg.Decode(thumbnailFile)
+		thumbnailFile.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r, _, _, _ := thumbnail.At(img.Width/2, img.Height/2).RGBA(); r>>8 < 190 || r>>8 > 210 {
+			t.Fatalf("Expected thumbnail to keep cover colors; received red value %d", r>>8)
+		}
+	}
+}
@@ -2,41 +2,66 @@ package processing
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha1"
 	"encoding/gob"
 	"encoding/hex"
+	"errors"
+	"fmt"
 	"io"
 	"log"
 	"os"
 	"path"
 	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/bongofriend/bookplayer/backend/lib/config"
+	"github.com/bongofriend/bookplayer/backend/lib/data/repo"
+	"github.com/bongofriend/bookplayer/backend/lib/events"
+	"github.com/bongofriend/bookplayer/backend/lib/models"
 )
 
-const saveFileName = "seen_files"
+// Scan state of earlier versions, only read to avoid processing known audiobooks again
+const legacySaveFileName = "seen_files"
 
 type DirectoryWatcher struct {
-	config     config.Config
-	fileHashes map[string]string
+	config         config.Config
+	sourceFileRepo repo.SourceFileRepository
+	audiobookRepo  repo.AudiobookRepository
+	jobRepo        repo.JobRepository
+	eventBus       *events.Bus
+	legacyHashes   map[string]string
+	// Sources sent down the pipeline since startup; pending sources not in here were interrupted and are sent again
+	emitted map[string]struct{}
+	// Commands carried out by the next scan
+	commandsMu sync.Mutex
+	commands   []PipelineCommand
 }
 
-func NewDirectoryWatcher(c config.Config) (*DirectoryWatcher, error) {
+func NewDirectoryWatcher(c config.Config, sourceFileRepo repo.SourceFileRepository, audiobookRepo repo.AudiobookRepository, jobRepo repo.JobRepository, eventBus *events.Bus) (*DirectoryWatcher, error) {
 	if err := os.MkdirAll(c.AudiobookDirectory, 0777); err != nil {
 		return nil, err
 	}
-	audiobooks, err := loadSeenAudiobooks(c)
+	legacyHashes, err := loadLegacySeenAudiobooks(c)
 	if err != nil {
 		return nil, err
 	}
 	return &DirectoryWatcher{
-		fileHashes: audiobooks,
-		config:     c,
+		config:         c,
+		sourceFileRepo: sourceFileRepo,
+		audiobookRepo:  audiobookRepo,
+		jobRepo:        jobRepo,
+		eventBus:       eventBus,
+		legacyHashes:   legacyHashes,
+		emitted:        make(map[string]struct{}),
 	}, nil
 }
 
-func loadSeenAudiobooks(c config.Config) (map[string]string, error) {
-	saveFilePath := path.Join(c.ApplicationDirectory, saveFileName)
+func loadLegacySeenAudiobooks(c config.Config) (map[string]string, error) {
+	saveFilePath := path.Join(c.ApplicationDirectory, legacySaveFileName)
 	_, err := os.Stat(saveFilePath)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -56,17 +81,6 @@ func loadSeenAudiobooks(c config.Config) (map[string]string, error) {
 	return seenAudiobooks, nil
 }
 
-func saveSeenAudiobooks(c config.Config, audiobookFiles map[string]string) error {
-	buf := bytes.Buffer{}
-	enc := gob.NewEncoder(&buf)
-	if err := enc.Encode(audiobookFiles); err != nil {
-		return err
-	}
-	saveFilePath := path.Join(c.ApplicationDirectory, saveFileName)
-	err := os.WriteFile(saveFilePath, buf.Bytes(), 0777)
-	return err
-}
-
 func fileCheckSum(p string) (string, error) {
 	file, err := os.Open(p)
 	if err != nil {
@@ -82,47 +96,345 @@ func fileCheckSum(p string) (string, error) {
 	return hex.EncodeToString(hash.Sum(nil)), nil
 }
 
-func (d *DirectoryWatcher) ProcessInput(input struct{}, outputChan chan string) error {
-	paths, err := os.ReadDir(d.config.AudiobookDirectory)
+// Checksum over all files of a multi-file audiobook; the checksum of the file itself otherwise
+func combinedCheckSum(source AudiobookSource, files []models.SourceFile) (string, error) {
+	if len(source.Files) == 1 && source.Files[0] == source.Path {
+		return files[0].Hash, nil
+	}
+	hash := sha1.New()
+	for idx, f := range source.Files {
+		rel, err := filepath.Rel(source.Path, f)
+		if err != nil {
+			return "", err
+		}
+		io.WriteString(hash, rel+"\x00"+files[idx].Hash+"\n")
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+/*
+Compare the files of source with their recorded state. Files are only hashed if size or modification time changed.
+Returns the current state of all files, whether anything changed and false if a file was modified within WatchDebounce and might still be copied
+*/
+func (d *DirectoryWatcher) checkSource(context context.Context, source AudiobookSource, rehash bool) ([]models.SourceFile, bool, bool, error) {
+	known, err := d.sourceFileRepo.GetSourceFiles(context, source.RelativePath)
+	if err != nil {
+		return nil, false, false, err
+	}
+	knownByPath := make(map[string]models.SourceFile, len(known))
+	for _, k := range known {
+		knownByPath[k.Path] = k
+	}
+	changed := len(known) != len(source.Files)
+	files := make([]models.SourceFile, len(source.Files))
+	for idx, f := range source.Files {
+		stat, err := os.Stat(f)
+		if err != nil {
+			return nil, false, false, err
+		}
+		if d.config.WatchDebounce > 0 && time.Since(stat.ModTime()) < d.config.WatchDebounce {
+			return nil, false, false, nil
+		}
+		rel, err := filepath.Rel(d.config.AudiobookDirectory, f)
+		if err != nil {
+			return nil, false, false, err
+		}
+		file := models.SourceFile{
+			Path:       filepath.ToSlash(rel),
+			SourcePath: source.RelativePath,
+			Size:       stat.Size(),
+			ModTime:    stat.ModTime(),
+		}
+		k, found := knownByPath[file.Path]
+		if found && !rehash && k.Size == file.Size && k.ModTime.Equal(file.ModTime) {
+			file.Hash = k.Hash
+		} else if file.Hash, err = fileCheckSum(f); err != nil {
+			return nil, false, false, err
+		}
+		if !found || k.Hash != file.Hash {
+			changed = true
+		} else if k.Size != file.Size || !k.ModTime.Equal(file.ModTime) {
+			// Touched without changing the content; remember the new state to avoid hashing again
+			if err := d.sourceFileRepo.UpdateSourceFileStat(context, file); err != nil {
+				return nil, false, false, err
+			}
+		}
+		files[idx] = file
+	}
+	if len(known) > 0 && d.isDue(source.RelativePath, known[0]) {
+		changed = true
+	}
+	return files, changed, true, nil
+}
+
+// Whether an unchanged source has to be sent down the pipeline again: it was interrupted before being processed or its retry is due
+func (d *DirectoryWatcher) isDue(sourcePath string, file models.SourceFile) bool {
+	switch file.Status {
+	case models.SourceStatusPending:
+		_, ok := d.emitted[sourcePath]
+		return !ok
+	case models.SourceStatusFailed:
+		return file.RetryAt == nil || !file.RetryAt.After(time.Now())
+	default:
+		return false
+	}
+}
+
+// Containers holding a whole audiobook with chapters; several of them in one folder are separate audiobooks
+func isChapteredContainer(name string) bool {
+	return strings.ToLower(filepath.Ext(name)) == ".m4b"
+}
+
+func (d *DirectoryWatcher) newSource(p string, files []string) (AudiobookSource, error) {
+	rel, err := filepath.Rel(d.config.AudiobookDirectory, p)
 	if err != nil {
-		return err
+		return AudiobookSource{}, err
 	}
-	for _, p := range paths {
-		if p.IsDir() {
+	return AudiobookSource{Path: p, RelativePath: filepath.ToSlash(rel), Files: files}, nil
+}
+
+/*
+Walk dirPath recursively and collect audiobooks. Leaf folders without subfolders other than disc folders are a single audiobook;
+audio files in any other folder, like the library root, are audiobooks on their own. Several m4b files are always separate audiobooks
+*/
+func (d *DirectoryWatcher) scanDirectory(dirPath string, sources []AudiobookSource) ([]AudiobookSource, error) {
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		return nil, err
+	}
+	directFiles := []string{}
+	subdirectories := []string{}
+	isLeaf := filepath.Clean(dirPath) != filepath.Clean(d.config.AudiobookDirectory)
+	for _, e := range entries {
+		name := e.Name()
+		if strings.HasPrefix(name, ".") {
 			continue
 		}
-		name := p.Name()
-		if ext := filepath.Ext(name); ext != ".m4b" {
+		if e.IsDir() {
+			if !discDirectory.MatchString(name) {
+				isLeaf = false
+			}
+			subdirectories = append(subdirectories, name)
 			continue
 		}
-		pathToFile := filepath.Join(d.config.AudiobookDirectory, name)
-		fileHash, found := d.fileHashes[name]
-		hash, err := fileCheckSum(pathToFile)
+		if isAudioFile(name) {
+			directFiles = append(directFiles, filepath.Join(dirPath, name))
+		}
+	}
+	slices.SortFunc(directFiles, naturalCompare)
+	allChaptered := len(directFiles) > 1 && !slices.ContainsFunc(directFiles, func(f string) bool { return !isChapteredContainer(f) })
+
+	if isLeaf && !allChaptered {
+		files, err := audioFilesInDirectory(dirPath)
 		if err != nil {
-			return err
+			return nil, err
+		}
+		if len(files) == 0 {
+			return sources, nil
 		}
-		if !found || hash != fileHash {
-			d.fileHashes[name] = hash
-			outputChan <- pathToFile
+		source, err := d.newSource(dirPath, files)
+		if err != nil {
+			return nil, err
 		}
+		// Disc folders are part of this audiobook and not scanned on their own
+		return append(sources, source), nil
 	}
-	return nil
+
+	for _, f := range directFiles {
+		source, err := d.newSource(f, []string{f})
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, source)
+	}
+	for _, name := range subdirectories {
+		if sources, err = d.scanDirectory(filepath.Join(dirPath, name), sources); err != nil {
+			return nil, err
+		}
+	}
+	return sources, nil
+}
+
+// What a scan does beyond picking up changes, as requested by pipeline commands
+type scanOptions struct {
+	reprocessAll bool
+	reprocess    map[string]bool
+	rehashAll    bool
+	rehash       map[string]bool
+	writeBack    map[string]bool
+	// Why writing back into a source failed; only the write-back commands for it fail
+	writeBackErrs map[string]error
+}
+
+func newScanOptions(commands []PipelineCommand) scanOptions {
+	options := scanOptions{
+		reprocess:     map[string]bool{},
+		rehash:        map[string]bool{},
+		writeBack:     map[string]bool{},
+		writeBackErrs: map[string]error{},
+	}
+	for _, cmd := range commands {
+		switch cmd.CmdType {
+		case Rescan:
+			options.reprocessAll = true
+		case Reprocess:
+			options.reprocess[cmd.sourcePath()] = true
+		case Rehash:
+			if len(cmd.sourcePath()) == 0 {
+				options.rehashAll = true
+			} else {
+				options.rehash[cmd.sourcePath()] = true
+			}
+		case WriteBack:
+			options.writeBack[cmd.sourcePath()] = true
+		}
+	}
+	return options
+}
+
+func (o scanOptions) reprocesses(sourcePath string) bool {
+	return o.reprocessAll || o.reprocess[sourcePath]
+}
+
+func (o scanOptions) rehashes(sourcePath string) bool {
+	return o.rehashAll || o.rehash[sourcePath]
+}
+
+func (d *DirectoryWatcher) takeCommands() []PipelineCommand {
+	d.commandsMu.Lock()
+	defer d.commandsMu.Unlock()
+	commands := d.commands
+	d.commands = nil
+	return commands
+}
+
+func (d *DirectoryWatcher) ProcessInput(input struct{}, outputChan chan AudiobookSource) error {
+	commands := d.takeCommands()
+	for _, cmd := range commands {
+		cmd.started()
+	}
+	options := newScanOptions(commands)
+	found, err := d.scan(options, outputChan)
+	for _, cmd := range commands {
+		if sourcePath := cmd.sourcePath(); err == nil && len(sourcePath) > 0 && !found[sourcePath] {
+			cmd.finished(fmt.Errorf("source %s not found in %s", sourcePath, d.config.AudiobookDirectory))
+			continue
+		}
+		if writeBackErr := options.writeBackErrs[cmd.sourcePath()]; err == nil && cmd.CmdType == WriteBack && writeBackErr != nil {
+			cmd.finished(writeBackErr)
+			continue
+		}
+		cmd.finished(err)
+	}
+	return err
+}
+
+// Scan library and send new, changed and due sources down the pipeline; returns the sources found
+func (d *DirectoryWatcher) scan(options scanOptions, outputChan chan AudiobookSource) (map[string]bool, error) {
+	context := context.Background()
+	sources, err := d.scanDirectory(d.config.AudiobookDirectory, []AudiobookSource{})
+	if err != nil {
+		return nil, err
+	}
+	knownFiles, err := d.sourceFileRepo.GetAllSourceFiles(context)
+	if err != nil {
+		return nil, err
+	}
+	known := groupBySource(knownFiles)
+	// Sources recorded in the database but not found by this scan
+	missing := make(map[string][]models.SourceFile, len(known))
+	for sourcePath, files := range known {
+		missing[sourcePath] = files
+	}
+	found := make(map[string]bool, len(sources))
+	for _, source := range sources {
+		delete(missing, source.RelativePath)
+		found[source.RelativePath] = true
+	}
+
+	for _, source := range sources {
+		if options.writeBack[source.RelativePath] {
+			// The rewritten source is processed again like any changed file once it settled
+			if err := d.writeBack(context, source); err != nil {
+				log.Printf("Could not write tags back into %s: %s", source.Path, err)
+				options.writeBackErrs[source.RelativePath] = err
+			}
+		}
+		files, changed, settled, err := d.checkSource(context, source, options.rehashes(source.RelativePath))
+		if err != nil {
+			return nil, err
+		}
+		if !settled {
+			log.Printf("%s is still being written; skipping for now", source.Path)
+			continue
+		}
+		reprocess := options.reprocesses(source.RelativePath)
+		relinked, err := d.relinkSource(context, source, files, changed || reprocess, known, missing)
+		if err != nil {
+			return nil, err
+		}
+		if relinked || !(changed || reprocess) {
+			continue
+		}
+		if err := d.sourceFileRepo.SaveSourceFiles(context, source.RelativePath, files); err != nil {
+			return nil, err
+		}
+		if legacyHash, ok := d.legacyHashes[source.RelativePath]; ok && !reprocess {
+			delete(d.legacyHashes, source.RelativePath)
+			if hash, err := combinedCheckSum(source, files); err == nil && hash == legacyHash {
+				// Processed before scan state was stored in the database
+				if err := d.sourceFileRepo.UpdateSourceStatus(context, source.RelativePath, models.SourceStatusProcessed, ""); err != nil {
+					return nil, err
+				}
+				continue
+			}
+		}
+		queueJob := d.jobRepo.QueueJob
+		if reprocess {
+			// Probed and split again instead of resuming from earlier results
+			queueJob = d.jobRepo.RestartJob
+		}
+		if err := queueJob(context, source.RelativePath, contentKey(files)); err != nil {
+			return nil, err
+		}
+		d.emitted[source.RelativePath] = struct{}{}
+		d.eventBus.Publish(events.Event{Type: events.TypeDiscovered, SourcePath: source.RelativePath})
+		outputChan <- source
+	}
+
+	now := time.Now()
+	if len(sources) == 0 && len(missing) > 0 {
+		// Rather an unmounted or inaccessible library than every audiobook removed at once
+		log.Printf("No audiobooks found in %s; not marking %d sources as missing", d.config.AudiobookDirectory, len(missing))
+	} else if err := d.markMissingSources(context, missing, now); err != nil {
+		return nil, err
+	}
+	return found, d.purgeMissingAudiobooks(context, now)
 }
 
-func (d DirectoryWatcher) Shutdown() {
+func (d *DirectoryWatcher) Shutdown() {
 	log.Println("Shutting down DirectoryWatcher")
-	saveSeenAudiobooks(d.config, d.fileHashes)
 }
 
-func (d DirectoryWatcher) CommandsToReceive() []PipelineCommandType {
+func (d *DirectoryWatcher) CommandsToReceive() []PipelineCommandType {
 	return []PipelineCommandType{
 		Scan,
+		Rescan,
+		Reprocess,
+		Rehash,
+		WriteBack,
 	}
 }
 
-func (d DirectoryWatcher) ProcessCommand(cmd PipelineCommand, inputChan chan struct{}, outputChan chan string) error {
-	if cmd.CmdType != Scan {
+func (d *DirectoryWatcher) ProcessCommand(cmd PipelineCommand, inputChan chan struct{}, outputChan chan AudiobookSource) error {
+	if (cmd.CmdType == Reprocess || cmd.CmdType == WriteBack) && len(cmd.sourcePath()) == 0 {
+		cmd.finished(errors.New("no source given for command"))
 		return nil
 	}
-	return d.ProcessInput(struct{}{}, outputChan)
+	d.commandsMu.Lock()
+	d.commands = append(d.commands, cmd)
+	d.commandsMu.Unlock()
+	// Scan on a worker instead of next to one
+	requestScan(inputChan)
+	return nil
 }
@@ -5,13 +5,177 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"slices"
 	"testing"
 	"time"
 
 	"github.com/bongofriend/bookplayer/backend/lib/config"
+	"github.com/bongofriend/bookplayer/backend/lib/data/repo"
+	"github.com/bongofriend/bookplayer/backend/lib/models"
 	"github.com/bongofriend/bookplayer/backend/lib/processing"
 )
 
+type sourceFileMockRepository struct {
+	files map[string]models.SourceFile
+	// Audiobooks marked as missing or relinked; may be nil
+	audiobooks *audiobookMockRepository
+}
+
+func newSourceFileMockRepository() *sourceFileMockRepository {
+	return &sourceFileMockRepository{files: map[string]models.SourceFile{}}
+}
+
+func (s *sourceFileMockRepository) GetAllSourceFiles(context context.Context) ([]models.SourceFile, error) {
+	files := []models.SourceFile{}
+	for _, f := range s.files {
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+func (s *sourceFileMockRepository) RelinkSource(context context.Context, oldSourcePath string, newSourcePath string, audiobookId int64, files []models.SourceFile) error {
+	s.DeleteSource(context, oldSourcePath)
+	for _, f := range files {
+		f.SourcePath = newSourcePath
+		f.AudiobookId = audiobookId
+		f.Status = models.SourceStatusProcessed
+		s.files[f.Path] = f
+	}
+	if s.audiobooks != nil {
+		audiobook := s.audiobooks.data[audiobookId]
+		audiobook.RelativePath = newSourcePath
+		audiobook.MissingSince = nil
+		s.audiobooks.data[audiobookId] = audiobook
+	}
+	return nil
+}
+
+func (s *sourceFileMockRepository) MarkSourceMissing(context context.Context, sourcePath string, since time.Time) error {
+	for p, f := range s.files {
+		if f.SourcePath != sourcePath {
+			continue
+		}
+		f.Status = models.SourceStatusMissing
+		s.files[p] = f
+		if audiobook, ok := s.audiobooks.data[f.AudiobookId]; ok && audiobook.MissingSince == nil {
+			audiobook.MissingSince = &since
+			s.audiobooks.data[f.AudiobookId] = audiobook
+		}
+	}
+	return nil
+}
+
+func (s *sourceFileMockRepository) RecordSourceFailure(context context.Context, sourcePath string, failure models.SourceFailure) error {
+	for p, f := range s.files {
+		if f.SourcePath != sourcePath {
+			continue
+		}
+		f.Status = models.SourceStatusQuarantined
+		if failure.RetryAt != nil {
+			f.Status = models.SourceStatusFailed
+		}
+		f.LastError = failure.Error
+		f.FailedStage = failure.Stage
+		f.Attempts = failure.Attempts
+		f.RetryAt = failure.RetryAt
+		s.files[p] = f
+	}
+	return nil
+}
+
+func (s *sourceFileMockRepository) GetNextSourceRetry(context context.Context, after time.Time) (time.Time, error) {
+	var next time.Time
+	for _, f := range s.files {
+		if f.Status == models.SourceStatusFailed && f.RetryAt != nil && f.RetryAt.After(after) && (next.IsZero() || f.RetryAt.Before(next)) {
+			next = *f.RetryAt
+		}
+	}
+	if next.IsZero() {
+		return next, repo.ErrNotFound
+	}
+	return next, nil
+}
+
+func (s *sourceFileMockRepository) DeleteSource(context context.Context, sourcePath string) error {
+	for p, f := range s.files {
+		if f.SourcePath == sourcePath {
+			delete(s.files, p)
+		}
+	}
+	return nil
+}
+
+func (s *sourceFileMockRepository) GetSourceFiles(context context.Context, sourcePath string) ([]models.SourceFile, error) {
+	files := []models.SourceFile{}
+	for _, f := range s.files {
+		if f.SourcePath == sourcePath {
+			files = append(files, f)
+		}
+	}
+	return files, nil
+}
+
+func (s *sourceFileMockRepository) GetAudiobookSourceFiles(context context.Context, audiobookId int64) ([]models.SourceFile, error) {
+	files := []models.SourceFile{}
+	for _, f := range s.files {
+		if f.AudiobookId == audiobookId {
+			files = append(files, f)
+		}
+	}
+	return files, nil
+}
+
+func (s *sourceFileMockRepository) SaveSourceFiles(context context.Context, sourcePath string, files []models.SourceFile) error {
+	previous := map[string]models.SourceFile{}
+	for p, f := range s.files {
+		if f.SourcePath == sourcePath {
+			previous[p] = f
+			delete(s.files, p)
+		}
+	}
+	for _, f := range files {
+		f.SourcePath = sourcePath
+		f.Status = models.SourceStatusPending
+		f.AudiobookId = previous[f.Path].AudiobookId
+		if previous[f.Path].Hash == f.Hash {
+			f.Attempts = previous[f.Path].Attempts
+			f.FailedStage = previous[f.Path].FailedStage
+		}
+		s.files[f.Path] = f
+	}
+	return nil
+}
+
+func (s *sourceFileMockRepository) UpdateSourceFileStat(context context.Context, file models.SourceFile) error {
+	f := s.files[file.Path]
+	f.Size = file.Size
+	f.ModTime = file.ModTime
+	s.files[file.Path] = f
+	return nil
+}
+
+func (s *sourceFileMockRepository) UpdateSourceStatus(context context.Context, sourcePath string, status string, lastError string) error {
+	for p, f := range s.files {
+		if f.SourcePath == sourcePath {
+			f.Status = status
+			f.LastError = lastError
+			s.files[p] = f
+		}
+	}
+	return nil
+}
+
+func (s *sourceFileMockRepository) SetSourceAudiobook(context context.Context, sourcePath string, audiobookId int64) error {
+	for p, f := range s.files {
+		if f.SourcePath == sourcePath {
+			f.Status = models.SourceStatusProcessed
+			f.AudiobookId = audiobookId
+			s.files[p] = f
+		}
+	}
+	return nil
+}
+
 func TestDirectoryWatcherObserve(t *testing.T) {
 	context, cancel := context.WithCancel(context.Background())
 	testDir := t.TempDir()
@@ -20,11 +184,11 @@ func TestDirectoryWatcherObserve(t *testing.T) {
 		ApplicationDirectory: path.Join(testDir),
 		ScanInterval:         2 * time.Second,
 	}
-	handler, err := processing.NewDirectoryWatcher(testConfig)
+	handler, err := processing.NewDirectoryWatcher(testConfig, newSourceFileMockRepository(), &audiobookMockRepository{data: map[int64]models.AudiobookProcessed{}}, newJobMockRepository(), nil)
 	if err != nil {
 		t.Fatal(err)
 	}
-	watcher := processing.NewPipelineStage[struct{}, string](handler)
+	watcher := processing.NewPipelineStage[struct{}, processing.AudiobookSource](handler)
 	doneConsumer := make(chan struct{})
 	errChan := make(chan error)
 	ticker := time.NewTicker(testConfig.ScanInterval)
@@ -57,7 +221,7 @@ func TestDirectoryWatcherObserve(t *testing.T) {
 		case <-context.Done():
 			return
 		case p := <-output:
-			if p == testFilePath {
+			if p.Path == testFilePath {
 				expectedFilePathReceived = true
 			}
 		}
@@ -82,11 +246,11 @@ func TestDirectoryWatcherUniqueFiles(t *testing.T) {
 		ApplicationDirectory: path.Join(testDir),
 		ScanInterval:         2 * time.Second,
 	}
-	handler, err := processing.NewDirectoryWatcher(testConfig)
+	handler, err := processing.NewDirectoryWatcher(testConfig, newSourceFileMockRepository(), &audiobookMockRepository{data: map[int64]models.AudiobookProcessed{}}, newJobMockRepository(), nil)
 	if err != nil {
 		t.Fatal(err)
 	}
-	watcher := processing.NewPipelineStage[struct{}, string](handler)
+	watcher := processing.NewPipelineStage[struct{}, processing.AudiobookSource](handler)
 	doneCh := make(chan struct{})
 	errChan := make(chan error)
 	ticker := time.NewTicker(testConfig.ScanInterval)
@@ -119,7 +283,7 @@ func TestDirectoryWatcherUniqueFiles(t *testing.T) {
 			case <-context.Done():
 				return
 			case p := <-output:
-				if p == testFilePath {
+				if p.Path == testFilePath {
 					filePathReceivedCount += 1
 				}
 			}
@@ -140,3 +304,384 @@ func TestDirectoryWatcherUniqueFiles(t *testing.T) {
 		t.Fatalf("Expected %d emissions; received: %d", 2, filePathReceivedCount)
 	}
 }
+
+func TestDirectoryWatcherMultiFileAudiobooks(t *testing.T) {
+	testDir := t.TempDir()
+	testConfig := config.Config{
+		AudiobookDirectory:   path.Join(testDir, "audiobooks"),
+		ApplicationDirectory: path.Join(testDir),
+	}
+	handler, err := processing.NewDirectoryWatcher(testConfig, newSourceFileMockRepository(), &audiobookMockRepository{data: map[int64]models.AudiobookProcessed{}}, newJobMockRepository(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bookDir := filepath.Join(testConfig.AudiobookDirectory, "Dune")
+	files := []string{"10 - Epilogue.mp3", "2 - Prophecy.mp3", "1 - Prologue.mp3", "cover.jpg", "notes.txt", filepath.Join("CD 2", "1 - Arrakis.mp3")}
+	for _, f := range append(files, "Single.opus") {
+		p := filepath.Join(bookDir, f)
+		if f == "Single.opus" {
+			p = filepath.Join(testConfig.AudiobookDirectory, f)
+		}
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(f), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	outputChan := make(chan processing.AudiobookSource, 10)
+	if err := handler.ProcessInput(struct{}{}, outputChan); err != nil {
+		t.Fatal(err)
+	}
+	close(outputChan)
+	sources := map[string]processing.AudiobookSource{}
+	for s := range outputChan {
+		sources[filepath.Base(s.Path)] = s
+	}
+	if len(sources) != 2 {
+		t.Fatalf("Expected 2 audiobooks; received: %v", sources)
+	}
+	expectedFiles := []string{
+		filepath.Join(bookDir, "1 - Prologue.mp3"),
+		filepath.Join(bookDir, "2 - Prophecy.mp3"),
+		filepath.Join(bookDir, "10 - Epilogue.mp3"),
+		filepath.Join(bookDir, "CD 2", "1 - Arrakis.mp3"),
+	}
+	if dune := sources["Dune"]; !slices.Equal(dune.Files, expectedFiles) || !dune.IsMultiFile() {
+		t.Fatalf("Expected files %v; received: %v", expectedFiles, dune.Files)
+	}
+	if single := sources["Single.opus"]; single.IsMultiFile() || len(single.Files) != 1 {
+		t.Fatalf("Expected single file audiobook; received: %v", single)
+	}
+
+	// Unchanged audiobooks are not emitted again
+	outputChan = make(chan processing.AudiobookSource, 10)
+	if err := handler.ProcessInput(struct{}{}, outputChan); err != nil {
+		t.Fatal(err)
+	}
+	if len(outputChan) != 0 {
+		t.Fatalf("Expected no emissions for unchanged audiobooks; received: %d", len(outputChan))
+	}
+}
+
+func TestDirectoryWatcherRecursiveScan(t *testing.T) {
+	testDir := t.TempDir()
+	testConfig := config.Config{
+		AudiobookDirectory:   path.Join(testDir, "audiobooks"),
+		ApplicationDirectory: path.Join(testDir),
+	}
+	handler, err := processing.NewDirectoryWatcher(testConfig, newSourceFileMockRepository(), &audiobookMockRepository{data: map[int64]models.AudiobookProcessed{}}, newJobMockRepository(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := []string{
+		"Frank Herbert/Dune Chronicles/01 - Dune/Dune.m4b",
+		"Frank Herbert/Dune Chronicles/02 - Dune Messiah/1.mp3",
+		"Frank Herbert/Dune Chronicles/02 - Dune Messiah/2.mp3",
+		"Frank Herbert/The Dosadi Experiment.m4b",
+		"Frank Herbert/Short Stories/A.m4b",
+		"Frank Herbert/Short Stories/B.m4b",
+		"Stephen King/The Stand/Disc 1/1.mp3",
+		"Stephen King/The Stand/Disc 2/1.mp3",
+		"Stephen King/.hidden/1.mp3",
+	}
+	for _, f := range files {
+		p := filepath.Join(testConfig.AudiobookDirectory, f)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(f), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	outputChan := make(chan processing.AudiobookSource, 10)
+	if err := handler.ProcessInput(struct{}{}, outputChan); err != nil {
+		t.Fatal(err)
+	}
+	close(outputChan)
+	sources := map[string]int{}
+	for s := range outputChan {
+		sources[s.RelativePath] = len(s.Files)
+	}
+	expected := map[string]int{
+		"Frank Herbert/Dune Chronicles/01 - Dune":         1,
+		"Frank Herbert/Dune Chronicles/02 - Dune Messiah": 2,
+		"Frank Herbert/The Dosadi Experiment.m4b":         1,
+		"Frank Herbert/Short Stories/A.m4b":               1,
+		"Frank Herbert/Short Stories/B.m4b":               1,
+		"Stephen King/The Stand":                          2,
+	}
+	if len(sources) != len(expected) {
+		t.Fatalf("Expected audiobooks %v; received: %v", expected, sources)
+	}
+	for relativePath, count := range expected {
+		if sources[relativePath] != count {
+			t.Fatalf("Expected %d files for %s; received: %v", count, relativePath, sources)
+		}
+	}
+}
+
+func TestDirectoryWatcherChangeDetection(t *testing.T) {
+	testDir := t.TempDir()
+	testConfig := config.Config{
+		AudiobookDirectory:   path.Join(testDir, "audiobooks"),
+		ApplicationDirectory: path.Join(testDir),
+	}
+	handler, err := processing.NewDirectoryWatcher(testConfig, newSourceFileMockRepository(), &audiobookMockRepository{data: map[int64]models.AudiobookProcessed{}}, newJobMockRepository(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testFilePath := filepath.Join(testConfig.AudiobookDirectory, "test.m4b")
+	if err := os.WriteFile(testFilePath, []byte("Hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stat, err := os.Stat(testFilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scan := func() int {
+		outputChan := make(chan processing.AudiobookSource, 10)
+		if err := handler.ProcessInput(struct{}{}, outputChan); err != nil {
+			t.Fatal(err)
+		}
+		return len(outputChan)
+	}
+	if count := scan(); count != 1 {
+		t.Fatalf("Expected 1 emission; received: %d", count)
+	}
+
+	// Same size and modification time: the file is not read again
+	if err := os.WriteFile(testFilePath, []byte("World"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(testFilePath, stat.ModTime(), stat.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	if count := scan(); count != 0 {
+		t.Fatalf("Expected no emission for unchanged size and modification time; received: %d", count)
+	}
+
+	if err := os.Chtimes(testFilePath, stat.ModTime(), stat.ModTime().Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if count := scan(); count != 1 {
+		t.Fatalf("Expected 1 emission for modified file; received: %d", count)
+	}
+}
+
+func TestDirectoryWatcherSkipsFilesBeingCopied(t *testing.T) {
+	testDir := t.TempDir()
+	testConfig := config.Config{
+		AudiobookDirectory:   path.Join(testDir, "audiobooks"),
+		ApplicationDirectory: path.Join(testDir),
+		WatchDebounce:        time.Hour,
+	}
+	handler, err := processing.NewDirectoryWatcher(testConfig, newSourceFileMockRepository(), &audiobookMockRepository{data: map[int64]models.AudiobookProcessed{}}, newJobMockRepository(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(testConfig.AudiobookDirectory, "test.m4b"), []byte("Hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	outputChan := make(chan processing.AudiobookSource, 10)
+	if err := handler.ProcessInput(struct{}{}, outputChan); err != nil {
+		t.Fatal(err)
+	}
+	if len(outputChan) != 0 {
+		t.Fatalf("Expected recently modified file to be skipped; received: %d", len(outputChan))
+	}
+}
+
+func TestDirectoryWatcherReconcile(t *testing.T) {
+	testDir := t.TempDir()
+	testConfig := config.Config{
+		AudiobookDirectory:   path.Join(testDir, "audiobooks"),
+		ApplicationDirectory: path.Join(testDir),
+		MissingGracePeriod:   time.Hour,
+	}
+	audiobookRepo := &audiobookMockRepository{data: map[int64]models.AudiobookProcessed{}}
+	sourceFileRepo := newSourceFileMockRepository()
+	sourceFileRepo.audiobooks = audiobookRepo
+	handler, err := processing.NewDirectoryWatcher(testConfig, sourceFileRepo, audiobookRepo, newJobMockRepository(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scan := func(handler *processing.DirectoryWatcher) []processing.AudiobookSource {
+		outputChan := make(chan processing.AudiobookSource, 10)
+		if err := handler.ProcessInput(struct{}{}, outputChan); err != nil {
+			t.Fatal(err)
+		}
+		close(outputChan)
+		sources := []processing.AudiobookSource{}
+		for s := range outputChan {
+			sources = append(sources, s)
+		}
+		return sources
+	}
+	writeFile := func(name string, content string) {
+		p := filepath.Join(testConfig.AudiobookDirectory, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile("Sun Tzu/The Art of War.m4b", "Hello")
+	writeFile("other.m4b", "Other")
+
+	sources := scan(handler)
+	if len(sources) != 2 {
+		t.Fatalf("Expected 2 sources; received: %d", len(sources))
+	}
+	for _, source := range sources {
+		id, _ := audiobookRepo.InsertAudiobook(context.Background(), models.AudiobookProcessed{RelativePath: source.RelativePath})
+		sourceFileRepo.SetSourceAudiobook(context.Background(), source.RelativePath, id)
+	}
+	id := sourceFileRepo.files["Sun Tzu/The Art of War.m4b"].AudiobookId
+
+	t.Run("should relink moved file", func(t *testing.T) {
+		if err := os.Rename(filepath.Join(testConfig.AudiobookDirectory, "Sun Tzu"), filepath.Join(testConfig.AudiobookDirectory, "Sunzi")); err != nil {
+			t.Fatal(err)
+		}
+		if sources := scan(handler); len(sources) != 0 {
+			t.Fatalf("Expected moved file not to be processed again; received: %+v", sources)
+		}
+		moved, ok := sourceFileRepo.files["Sunzi/The Art of War.m4b"]
+		if !ok || moved.AudiobookId != id || moved.Status != models.SourceStatusProcessed {
+			t.Fatalf("Expected moved file to be linked to audiobook %d; received: %+v", id, moved)
+		}
+		if audiobookRepo.data[id].RelativePath != "Sunzi" {
+			t.Fatalf("Unexpected relative path %s", audiobookRepo.data[id].RelativePath)
+		}
+	})
+	t.Run("should mark removed file as missing and restore it", func(t *testing.T) {
+		movedPath := filepath.Join(testConfig.AudiobookDirectory, "Sunzi", "The Art of War.m4b")
+		if err := os.Rename(movedPath, filepath.Join(testDir, "backup.m4b")); err != nil {
+			t.Fatal(err)
+		}
+		scan(handler)
+		if audiobookRepo.data[id].MissingSince == nil || sourceFileRepo.files["Sunzi/The Art of War.m4b"].Status != models.SourceStatusMissing {
+			t.Fatal("Expected audiobook to be marked as missing")
+		}
+		if err := os.Rename(filepath.Join(testDir, "backup.m4b"), movedPath); err != nil {
+			t.Fatal(err)
+		}
+		if sources := scan(handler); len(sources) != 0 {
+			t.Fatalf("Expected restored file not to be processed again; received: %+v", sources)
+		}
+		if audiobookRepo.data[id].MissingSince != nil {
+			t.Fatal("Expected audiobook to be no longer missing")
+		}
+	})
+	t.Run("should purge missing audiobook after grace period", func(t *testing.T) {
+		if err := os.RemoveAll(filepath.Join(testConfig.AudiobookDirectory, "Sunzi")); err != nil {
+			t.Fatal(err)
+		}
+		scan(handler)
+		if _, ok := audiobookRepo.data[id]; !ok {
+			t.Fatal("Expected audiobook to be kept within grace period")
+		}
+		purgeConfig := testConfig
+		purgeConfig.MissingGracePeriod = time.Nanosecond
+		purgeHandler, err := processing.NewDirectoryWatcher(purgeConfig, sourceFileRepo, audiobookRepo, newJobMockRepository(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		scan(purgeHandler)
+		if _, ok := audiobookRepo.data[id]; ok {
+			t.Fatal("Expected audiobook to be purged")
+		}
+		if len(audiobookRepo.data) != 1 {
+			t.Fatalf("Expected other audiobook to be kept; received: %d audiobooks", len(audiobookRepo.data))
+		}
+	})
+}
+
+func TestDirectoryWatcherCommands(t *testing.T) {
+	testDir := t.TempDir()
+	testConfig := config.Config{
+		AudiobookDirectory:   path.Join(testDir, "audiobooks"),
+		ApplicationDirectory: path.Join(testDir),
+	}
+	sourceFileRepo := newSourceFileMockRepository()
+	jobRepo := newJobMockRepository()
+	handler, err := processing.NewDirectoryWatcher(testConfig, sourceFileRepo, &audiobookMockRepository{data: map[int64]models.AudiobookProcessed{}}, jobRepo, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scan := func(commands ...processing.PipelineCommand) []string {
+		inputChan := make(chan struct{}, 1)
+		outputChan := make(chan processing.AudiobookSource, 10)
+		for _, cmd := range commands {
+			if err := handler.ProcessCommand(cmd, inputChan, outputChan); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := handler.ProcessInput(struct{}{}, outputChan); err != nil {
+			t.Fatal(err)
+		}
+		close(outputChan)
+		sources := []string{}
+		for s := range outputChan {
+			sources = append(sources, s.RelativePath)
+		}
+		slices.Sort(sources)
+		return sources
+	}
+	artOfWar := filepath.Join(testConfig.AudiobookDirectory, "Sun Tzu", "The Art of War.m4b")
+	if err := os.MkdirAll(filepath.Dir(artOfWar), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(artOfWar, []byte("Hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(testConfig.AudiobookDirectory, "other.m4b"), []byte("Other"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for idx, sourcePath := range scan() {
+		if err := sourceFileRepo.SetSourceAudiobook(context.Background(), sourcePath, int64(idx+1)); err != nil {
+			t.Fatal(err)
+		}
+		jobRepo.AdvanceJob(context.Background(), sourcePath, models.JobStageProbed, "probed")
+	}
+
+	t.Run("should reprocess source from the start", func(t *testing.T) {
+		sources := scan(processing.PipelineCommand{CmdType: processing.Reprocess, Payload: "Sun Tzu"})
+		if !slices.Equal(sources, []string{"Sun Tzu"}) {
+			t.Fatalf("Unexpected sources: %v", sources)
+		}
+		if job := jobRepo.jobs["Sun Tzu"]; job.Stage != models.JobStageDiscovered || len(job.Results) != 0 {
+			t.Fatalf("Expected job to start over; received: %+v", job)
+		}
+	})
+	t.Run("should reprocess whole library", func(t *testing.T) {
+		if sources := scan(processing.PipelineCommand{CmdType: processing.Rescan}); len(sources) != 2 {
+			t.Fatalf("Unexpected sources: %v", sources)
+		}
+		if sources := scan(); len(sources) != 0 {
+			t.Fatalf("Expected commands to apply to one scan only; received: %v", sources)
+		}
+	})
+	t.Run("should hash files again", func(t *testing.T) {
+		stat, err := os.Stat(artOfWar)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Same size and modification time, so only noticed when hashing
+		if err := os.WriteFile(artOfWar, []byte("Howdy"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(artOfWar, stat.ModTime(), stat.ModTime()); err != nil {
+			t.Fatal(err)
+		}
+		if sources := scan(); len(sources) != 0 {
+			t.Fatalf("Expected unchanged stat not to be hashed; received: %v", sources)
+		}
+		if sources := scan(processing.PipelineCommand{CmdType: processing.Rehash}); !slices.Equal(sources, []string{"Sun Tzu"}) {
+			t.Fatalf("Unexpected sources: %v", sources)
+		}
+	})
+}
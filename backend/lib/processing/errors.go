@@ -0,0 +1,33 @@
+package processing
+
+import "fmt"
+
+// Stages an audiobook may fail in
+const (
+	StageMetadata = "metadata"
+	StageChapters = "chapters"
+	StageSink     = "sink"
+)
+
+// Failure to process a single audiobook; the pipeline records it, retries it later and carries on with other audiobooks
+type SourceError struct {
+	// Source of the audiobook relative to the library root
+	RelativePath string
+	Stage        string
+	Err          error
+}
+
+func (e *SourceError) Error() string {
+	return fmt.Sprintf("%s failed in %s stage: %s", e.RelativePath, e.Stage, e.Err)
+}
+
+func (e *SourceError) Unwrap() error {
+	return e.Err
+}
+
+func newSourceError(stage string, relativePath string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &SourceError{RelativePath: relativePath, Stage: stage, Err: err}
+}
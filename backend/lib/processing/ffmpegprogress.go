@@ -0,0 +1,88 @@
+package processing
+
+import (
+	"bufio"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/bongofriend/bookplayer/backend/lib/events"
+)
+
+// Smallest change in splitting progress worth publishing
+const progressStep = 0.01
+
+// Bytes of ffmpeg's error output kept for error messages
+const maxFfmpegErrorOutput = 4096
+
+// Keeps the last limit bytes written, which is where ffmpeg explains why it failed
+type tailBuffer struct {
+	data  []byte
+	limit int
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.data = append(t.data, p...)
+	if len(t.data) > t.limit {
+		t.data = t.data[len(t.data)-t.limit:]
+	}
+	return len(p), nil
+}
+
+// Run ffmpeg and pass the position written so far in seconds, parsed from its -progress output, to onProgress
+func runFfmpegWithProgress(args []string, onProgress func(seconds float64)) error {
+	cmd := exec.Command("ffmpeg", append([]string{"-progress", "pipe:1", "-nostats"}, args...)...)
+	stderr := &tailBuffer{limit: maxFfmpegErrorOutput}
+	cmd.Stderr = stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		if seconds, ok := parseProgressLine(scanner.Text()); ok {
+			onProgress(seconds)
+		}
+	}
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("ffmpeg failed: %w: %s", err, strings.TrimSpace(string(stderr.data)))
+	}
+	return nil
+}
+
+// ffmpeg reports the position as out_time_us and, despite its name, in microseconds as out_time_ms
+func parseProgressLine(line string) (float64, bool) {
+	key, value, found := strings.Cut(strings.TrimSpace(line), "=")
+	if !found || (key != "out_time_us" && key != "out_time_ms") {
+		return 0, false
+	}
+	microseconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || microseconds < 0 {
+		return 0, false
+	}
+	return float64(microseconds) / 1e6, true
+}
+
+// Publishes splitting progress of a source whenever it advanced by at least progressStep
+type splitProgress struct {
+	eventBus   *events.Bus
+	sourcePath string
+	last       float64
+}
+
+func newSplitProgress(eventBus *events.Bus, sourcePath string) *splitProgress {
+	return &splitProgress{eventBus: eventBus, sourcePath: sourcePath, last: -1}
+}
+
+func (s *splitProgress) report(progress float64) {
+	progress = min(max(progress, 0), 1)
+	if progress-s.last < progressStep && (progress < 1 || s.last == 1) {
+		return
+	}
+	s.last = progress
+	s.eventBus.Publish(events.Event{Type: events.TypeSplitting, SourcePath: s.sourcePath, Progress: progress})
+}
@@ -0,0 +1,71 @@
+package processing
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/bongofriend/bookplayer/backend/lib/config"
+)
+
+var errFileWatchingUnsupported = errors.New("filesystem events are not supported")
+
+// Notifies about changes below a directory once they have settled
+type FileWatcher interface {
+	// Receives after changes stopped for the debounce duration
+	Changes() <-chan struct{}
+	Close() error
+}
+
+/*
+Collapse bursts of raw events into a single notification sent after no event arrived for debounce.
+Copying a large file causes many events; the scan only starts once the copy finished
+*/
+func debounceEvents(context context.Context, events <-chan struct{}, debounce time.Duration) <-chan struct{} {
+	changes := make(chan struct{}, 1)
+	go func() {
+		defer close(changes)
+		timer := time.NewTimer(debounce)
+		timer.Stop()
+		defer timer.Stop()
+		for {
+			select {
+			case <-context.Done():
+				return
+			case _, ok := <-events:
+				if !ok {
+					return
+				}
+				timer.Reset(debounce)
+			case <-timer.C:
+				select {
+				case changes <- struct{}{}:
+				default:
+					// A scan is already pending
+				}
+			}
+		}
+	}()
+	return changes
+}
+
+/*
+Start watching the library for changes if configured; returns nil if the library has to be polled instead.
+The returned watcher reports once right away so the library is scanned on startup
+*/
+func WatchLibrary(context context.Context, c config.Config) FileWatcher {
+	if c.WatchMode != config.WatchModeInotify {
+		return nil
+	}
+	if isNetworkFilesystem(c.AudiobookDirectory) {
+		log.Printf("%s is on a network filesystem; falling back to scanning every %s", c.AudiobookDirectory, c.ScanInterval)
+		return nil
+	}
+	watcher, err := newFileWatcher(context, c.AudiobookDirectory, c.WatchDebounce)
+	if err != nil {
+		log.Printf("Could not watch %s: %s; falling back to scanning every %s", c.AudiobookDirectory, err, c.ScanInterval)
+		return nil
+	}
+	return watcher
+}
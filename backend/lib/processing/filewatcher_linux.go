@@ -0,0 +1,185 @@
+//go:build linux
+
+package processing
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	inotifyMask       = unix.IN_CREATE | unix.IN_CLOSE_WRITE | unix.IN_MOVED_TO | unix.IN_MOVED_FROM | unix.IN_DELETE | unix.IN_DELETE_SELF
+	inotifyBufferSize = 64 * 1024
+	// How often the reader checks whether it should stop
+	inotifyPollTimeout = 500
+)
+
+// Filesystems where inotify does not see changes made by other hosts
+var networkFilesystems = map[int64]string{
+	0x6969:     "nfs",
+	0x517b:     "smb",
+	0xff534d42: "cifs",
+	0xfe534d42: "smb2",
+	0x01021997: "9p",
+}
+
+type inotifyWatcher struct {
+	fd       int
+	mutex    sync.Mutex
+	watches  map[int]string
+	events   chan struct{}
+	changes  <-chan struct{}
+	cancel   context.CancelFunc
+	doneChan chan struct{}
+}
+
+func isNetworkFilesystem(p string) bool {
+	var stat unix.Statfs_t
+	if err := unix.Statfs(p, &stat); err != nil {
+		return false
+	}
+	_, ok := networkFilesystems[int64(stat.Type)]
+	return ok
+}
+
+func newFileWatcher(appContext context.Context, root string, debounce time.Duration) (FileWatcher, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+	context, cancel := context.WithCancel(appContext)
+	w := &inotifyWatcher{
+		fd:       fd,
+		watches:  map[int]string{},
+		events:   make(chan struct{}, 1),
+		cancel:   cancel,
+		doneChan: make(chan struct{}),
+	}
+	if err := w.addRecursive(root); err != nil {
+		cancel()
+		unix.Close(fd)
+		return nil, err
+	}
+	w.changes = debounceEvents(context, w.events, debounce)
+	// Initial scan on startup
+	w.events <- struct{}{}
+	go w.read(context)
+	return w, nil
+}
+
+func (w *inotifyWatcher) Changes() <-chan struct{} {
+	return w.changes
+}
+
+func (w *inotifyWatcher) Close() error {
+	w.cancel()
+	<-w.doneChan
+	return unix.Close(w.fd)
+}
+
+// Watch dir and all directories below it; inotify itself is not recursive
+func (w *inotifyWatcher) addRecursive(dir string) error {
+	return filepath.WalkDir(dir, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			// Directory vanished while walking
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if p != dir && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		wd, err := unix.InotifyAddWatch(w.fd, p, inotifyMask)
+		if err != nil {
+			return err
+		}
+		w.mutex.Lock()
+		w.watches[wd] = p
+		w.mutex.Unlock()
+		return nil
+	})
+}
+
+func (w *inotifyWatcher) notify() {
+	select {
+	case w.events <- struct{}{}:
+	default:
+	}
+}
+
+func (w *inotifyWatcher) read(context context.Context) {
+	defer close(w.doneChan)
+	defer close(w.events)
+	buf := make([]byte, inotifyBufferSize)
+	fds := []unix.PollFd{{Fd: int32(w.fd), Events: unix.POLLIN}}
+	for {
+		if context.Err() != nil {
+			return
+		}
+		n, err := unix.Poll(fds, inotifyPollTimeout)
+		if err != nil && !errors.Is(err, unix.EINTR) {
+			log.Println(err)
+			return
+		}
+		if n <= 0 {
+			continue
+		}
+		read, err := unix.Read(w.fd, buf)
+		if err != nil {
+			if errors.Is(err, unix.EAGAIN) || errors.Is(err, unix.EINTR) {
+				continue
+			}
+			log.Println(err)
+			return
+		}
+		w.handleEvents(buf[:read])
+	}
+}
+
+func (w *inotifyWatcher) handleEvents(buf []byte) {
+	for offset := 0; offset+unix.SizeofInotifyEvent <= len(buf); {
+		event := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+		nameBytes := buf[offset+unix.SizeofInotifyEvent : offset+unix.SizeofInotifyEvent+int(event.Len)]
+		name := strings.TrimRight(string(nameBytes), "\x00")
+		offset += unix.SizeofInotifyEvent + int(event.Len)
+
+		switch {
+		case event.Mask&unix.IN_Q_OVERFLOW != 0:
+			// Events were lost; a scan picks up whatever changed
+			w.notify()
+			continue
+		case event.Mask&unix.IN_IGNORED != 0:
+			w.mutex.Lock()
+			delete(w.watches, int(event.Wd))
+			w.mutex.Unlock()
+			continue
+		}
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+		if event.Mask&unix.IN_ISDIR != 0 && event.Mask&(unix.IN_CREATE|unix.IN_MOVED_TO) != 0 {
+			w.mutex.Lock()
+			dir, ok := w.watches[int(event.Wd)]
+			w.mutex.Unlock()
+			if ok {
+				if err := w.addRecursive(filepath.Join(dir, name)); err != nil {
+					log.Println(err)
+				}
+			}
+		}
+		w.notify()
+	}
+}
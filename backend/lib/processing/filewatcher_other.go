@@ -0,0 +1,16 @@
+//go:build !linux
+
+package processing
+
+import (
+	"context"
+	"time"
+)
+
+func newFileWatcher(context context.Context, root string, debounce time.Duration) (FileWatcher, error) {
+	return nil, errFileWatchingUnsupported
+}
+
+func isNetworkFilesystem(p string) bool {
+	return false
+}
@@ -0,0 +1,65 @@
+package processing_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/bongofriend/bookplayer/backend/lib/config"
+	"github.com/bongofriend/bookplayer/backend/lib/processing"
+)
+
+func TestWatchLibrary(t *testing.T) {
+	t.Run("should poll if not configured", func(t *testing.T) {
+		testConfig := config.Config{AudiobookDirectory: t.TempDir(), WatchMode: config.WatchModePoll}
+		if watcher := processing.WatchLibrary(context.Background(), testConfig); watcher != nil {
+			watcher.Close()
+			t.Fatal("Expected no watcher in poll mode")
+		}
+	})
+	t.Run("should report debounced changes", func(t *testing.T) {
+		if runtime.GOOS != "linux" {
+			t.Skip("inotify is only available on linux")
+		}
+		testConfig := config.Config{
+			AudiobookDirectory: t.TempDir(),
+			WatchMode:          config.WatchModeInotify,
+			WatchDebounce:      100 * time.Millisecond,
+		}
+		watcher := processing.WatchLibrary(context.Background(), testConfig)
+		if watcher == nil {
+			t.Fatal("Expected watcher in inotify mode")
+		}
+		defer watcher.Close()
+
+		waitForChange := func(description string) {
+			select {
+			case <-watcher.Changes():
+			case <-time.After(5 * time.Second):
+				t.Fatalf("No change reported %s", description)
+			}
+		}
+		waitForChange("on startup")
+
+		// Files in directories created after the watcher started are seen as well
+		bookDir := filepath.Join(testConfig.AudiobookDirectory, "Author", "Title")
+		if err := os.MkdirAll(bookDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		waitForChange("for new directory")
+		for idx := 0; idx < 5; idx++ {
+			if err := os.WriteFile(filepath.Join(bookDir, "1.mp3"), []byte("chunk"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		waitForChange("for new file")
+		select {
+		case <-watcher.Changes():
+			t.Fatal("Expected burst of writes to be reported once")
+		case <-time.After(300 * time.Millisecond):
+		}
+	})
+}
@@ -0,0 +1,85 @@
+package processing
+
+import (
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/bongofriend/bookplayer/backend/lib/models"
+)
+
+// Metadata derived from the location of an audiobook organized as Author/Series/NN - Title
+type FolderMetadata struct {
+	Author         string
+	Series         string
+	SeriesPosition string
+	Title          string
+}
+
+// Leading number of a title like "01 - Title", "Book 2. Title" or "1.5 - Title"
+var numberedTitle = regexp.MustCompile(`^(?i:(?:book|vol(?:ume)?|part)\s*)?(\d+(?:\.\d+)?)\s*[-.:)]\s+(.+)$`)
+
+/*
+Derive metadata from the path of an audiobook relative to the library root:
+"Title", "Author/Title" and "Author/Series/NN - Title" are recognized.
+Leading numbers are stripped from the title and used as position within the series
+*/
+func ParseFolderMetadata(relativePath string) FolderMetadata {
+	parts := []string{}
+	for _, p := range strings.Split(path.Clean(filepath.ToSlash(relativePath)), "/") {
+		if p != "" && p != "." && p != ".." {
+			parts = append(parts, strings.TrimSpace(p))
+		}
+	}
+	if len(parts) == 0 {
+		return FolderMetadata{}
+	}
+	title := parts[len(parts)-1]
+	if isAudioFile(title) {
+		title = baseName(title)
+	}
+	metadata := FolderMetadata{Title: title}
+	position := ""
+	if match := numberedTitle.FindStringSubmatch(title); match != nil {
+		position = trimLeadingZeros(match[1])
+		metadata.Title = strings.TrimSpace(match[2])
+	}
+	switch {
+	case len(parts) >= 3:
+		metadata.Author = parts[len(parts)-3]
+		metadata.Series = parts[len(parts)-2]
+		metadata.SeriesPosition = position
+	case len(parts) == 2:
+		metadata.Author = parts[0]
+	}
+	return metadata
+}
+
+func trimLeadingZeros(number string) string {
+	trimmed := strings.TrimLeft(number, "0")
+	if trimmed == "" || strings.HasPrefix(trimmed, ".") {
+		return "0" + trimmed
+	}
+	return trimmed
+}
+
+// Fill in title, author and series missing from tags with metadata from the folder structure
+func applyFolderMetadata(audiobook *models.Audiobook, source AudiobookSource) {
+	relativePath := source.RelativePath
+	if relativePath == "" {
+		relativePath = filepath.Base(source.Path)
+	}
+	folder := ParseFolderMetadata(relativePath)
+	if strings.TrimSpace(audiobook.Title) == "" {
+		audiobook.Title = folder.Title
+	}
+	if len(audiobook.Authors) == 0 && folder.Author != "" {
+		audiobook.Authors = []string{folder.Author}
+		audiobook.Author = folder.Author
+	}
+	if audiobook.Series == "" && folder.Series != "" {
+		audiobook.Series = folder.Series
+		audiobook.SeriesPosition = folder.SeriesPosition
+	}
+}
@@ -0,0 +1,28 @@
+package processing_test
+
+import (
+	"testing"
+
+	"github.com/bongofriend/bookplayer/backend/lib/processing"
+)
+
+func TestParseFolderMetadata(t *testing.T) {
+	cases := []struct {
+		relativePath string
+		expected     processing.FolderMetadata
+	}{
+		{"Dune.m4b", processing.FolderMetadata{Title: "Dune"}},
+		{"Frank Herbert/Dune", processing.FolderMetadata{Author: "Frank Herbert", Title: "Dune"}},
+		{"Frank Herbert/Dune Chronicles/01 - Dune", processing.FolderMetadata{Author: "Frank Herbert", Series: "Dune Chronicles", SeriesPosition: "1", Title: "Dune"}},
+		{"Terry Pratchett/Discworld/Book 8. Guards! Guards!", processing.FolderMetadata{Author: "Terry Pratchett", Series: "Discworld", SeriesPosition: "8", Title: "Guards! Guards!"}},
+		{"Library/James S. A. Corey/The Expanse/2.5 - Gods of Risk.mp3", processing.FolderMetadata{Author: "James S. A. Corey", Series: "The Expanse", SeriesPosition: "2.5", Title: "Gods of Risk"}},
+		{"Stephen King/11.22.63", processing.FolderMetadata{Author: "Stephen King", Title: "11.22.63"}},
+		{"George Orwell/1984", processing.FolderMetadata{Author: "George Orwell", Title: "1984"}},
+		{"", processing.FolderMetadata{}},
+	}
+	for _, c := range cases {
+		if metadata := processing.ParseFolderMetadata(c.relativePath); metadata != c.expected {
+			t.Fatalf("Expected %+v for %q; received: %+v", c.expected, c.relativePath, metadata)
+		}
+	}
+}
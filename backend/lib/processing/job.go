@@ -0,0 +1,88 @@
+package processing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"slices"
+
+	"github.com/bongofriend/bookplayer/backend/lib/data/repo"
+	"github.com/bongofriend/bookplayer/backend/lib/models"
+)
+
+/*
+Handler recording the result of a stage in the job of the processed source. Inputs whose job already completed the
+stage are answered with the recorded result instead, so an interrupted job resumes after its last completed stage.
+Inputs of canceled jobs are dropped. The wrapped handler must send exactly one output for every input it processed without error
+*/
+type JobStage[Input any, Output any] struct {
+	handler  PipelineStageHandler[Input, Output]
+	jobRepo  repo.JobRepository
+	stage    string
+	sourceOf func(Input) string
+}
+
+func NewJobStage[Input any, Output any](handler PipelineStageHandler[Input, Output], jobRepo repo.JobRepository, stage string, sourceOf func(Input) string) *JobStage[Input, Output] {
+	return &JobStage[Input, Output]{
+		handler:  handler,
+		jobRepo:  jobRepo,
+		stage:    stage,
+		sourceOf: sourceOf,
+	}
+}
+
+func (j *JobStage[Input, Output]) ProcessInput(input Input, outputChan chan Output) error {
+	context := context.Background()
+	sourcePath := j.sourceOf(input)
+	job, err := j.jobRepo.GetJobBySource(context, sourcePath)
+	if err != nil {
+		return err
+	}
+	if job.State == models.JobStateCanceled {
+		log.Printf("Processing of %s was canceled", sourcePath)
+		return nil
+	}
+	if result, ok := job.Results[j.stage]; ok && stageCompleted(job.Stage, j.stage) {
+		var output Output
+		err := json.Unmarshal(result, &output)
+		if err == nil {
+			log.Printf("Resuming %s after stage %s", sourcePath, j.stage)
+			outputChan <- output
+			return nil
+		}
+		log.Printf("Could not resume %s after stage %s: %s", sourcePath, j.stage, err)
+	}
+
+	results := make(chan Output, 1)
+	if err := j.handler.ProcessInput(input, results); err != nil {
+		return err
+	}
+	output := <-results
+	if err := j.jobRepo.AdvanceJob(context, sourcePath, j.stage, output); err != nil {
+		if errors.Is(err, repo.ErrNotFound) {
+			log.Printf("Processing of %s was canceled", sourcePath)
+			return nil
+		}
+		return err
+	}
+	outputChan <- output
+	return nil
+}
+
+func (j *JobStage[Input, Output]) Shutdown() {
+	j.handler.Shutdown()
+}
+
+func (j *JobStage[Input, Output]) CommandsToReceive() []PipelineCommandType {
+	return j.handler.CommandsToReceive()
+}
+
+func (j *JobStage[Input, Output]) ProcessCommand(cmd PipelineCommand, inputChan chan Input, outputChan chan Output) error {
+	return j.handler.ProcessCommand(cmd, inputChan, outputChan)
+}
+
+// Whether a job that last completed current got past stage
+func stageCompleted(current string, stage string) bool {
+	return slices.Index(models.JobStages, current) >= slices.Index(models.JobStages, stage)
+}
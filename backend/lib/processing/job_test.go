@@ -0,0 +1,181 @@
+package processing_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/bongofriend/bookplayer/backend/lib/data/repo"
+	"github.com/bongofriend/bookplayer/backend/lib/models"
+	"github.com/bongofriend/bookplayer/backend/lib/processing"
+)
+
+type jobMockRepository struct {
+	jobs map[string]models.Job
+}
+
+func newJobMockRepository() *jobMockRepository {
+	return &jobMockRepository{jobs: map[string]models.Job{}}
+}
+
+func (j *jobMockRepository) GetJobs(context context.Context) ([]models.Job, error) {
+	jobs := []models.Job{}
+	for _, job := range j.jobs {
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+func (j *jobMockRepository) GetJob(context context.Context, id int64) (*models.Job, error) {
+	for _, job := range j.jobs {
+		if job.Id == id {
+			return &job, nil
+		}
+	}
+	return nil, fmt.Errorf("job with id %d %w", id, repo.ErrNotFound)
+}
+
+func (j *jobMockRepository) GetJobBySource(context context.Context, sourcePath string) (*models.Job, error) {
+	job, ok := j.jobs[sourcePath]
+	if !ok {
+		return nil, fmt.Errorf("job for %s %w", sourcePath, repo.ErrNotFound)
+	}
+	return &job, nil
+}
+
+// Progress is kept for every queued job as the mock does not track content
+func (j *jobMockRepository) QueueJob(context context.Context, sourcePath string, contentKey string) error {
+	job, ok := j.jobs[sourcePath]
+	if !ok || job.State == models.JobStateDone {
+		job = models.Job{
+			Id:         int64(len(j.jobs) + 1),
+			SourcePath: sourcePath,
+			Stage:      models.JobStageDiscovered,
+			Results:    map[string]json.RawMessage{},
+		}
+	}
+	job.State = models.JobStateActive
+	j.jobs[sourcePath] = job
+	return nil
+}
+
+func (j *jobMockRepository) RestartJob(context context.Context, sourcePath string, contentKey string) error {
+	id := int64(len(j.jobs) + 1)
+	if job, ok := j.jobs[sourcePath]; ok {
+		id = job.Id
+	}
+	j.jobs[sourcePath] = models.Job{
+		Id:         id,
+		SourcePath: sourcePath,
+		Stage:      models.JobStageDiscovered,
+		State:      models.JobStateActive,
+		Results:    map[string]json.RawMessage{},
+	}
+	return nil
+}
+
+func (j *jobMockRepository) AdvanceJob(context context.Context, sourcePath string, stage string, result any) error {
+	job, ok := j.jobs[sourcePath]
+	if !ok || job.State != models.JobStateActive {
+		return fmt.Errorf("active job for %s %w", sourcePath, repo.ErrNotFound)
+	}
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	job.Stage = stage
+	job.Results[stage] = encoded
+	if stage == models.JobStageStored {
+		job.State = models.JobStateDone
+	}
+	j.jobs[sourcePath] = job
+	return nil
+}
+
+func (j *jobMockRepository) FailJob(context context.Context, sourcePath string, message string) error {
+	job, ok := j.jobs[sourcePath]
+	if !ok || job.State != models.JobStateActive {
+		return fmt.Errorf("active job for %s %w", sourcePath, repo.ErrNotFound)
+	}
+	job.State = models.JobStateFailed
+	job.Error = message
+	j.jobs[sourcePath] = job
+	return nil
+}
+
+func (j *jobMockRepository) RetryJob(context context.Context, id int64) error {
+	return j.setState(id, models.JobStateActive)
+}
+
+func (j *jobMockRepository) CancelJob(context context.Context, id int64) error {
+	return j.setState(id, models.JobStateCanceled)
+}
+
+func (j *jobMockRepository) setState(id int64, state string) error {
+	job, err := j.GetJob(context.Background(), id)
+	if err != nil {
+		return err
+	}
+	job.State = state
+	j.jobs[job.SourcePath] = *job
+	return nil
+}
+
+func TestJobStage(t *testing.T) {
+	jobRepo := newJobMockRepository()
+	calls := 0
+	parse := newFuncPipelineHandler(func(input string) (int, error) {
+		calls++
+		return strconv.Atoi(input)
+	})
+	stage := processing.NewJobStage(parse, jobRepo, models.JobStageProbed, func(input string) string {
+		return input
+	})
+	output := make(chan int, 1)
+	context := context.Background()
+
+	t.Run("should record result of completed stage", func(t *testing.T) {
+		jobRepo.QueueJob(context, "42", "")
+		if err := stage.ProcessInput("42", output); err != nil {
+			t.Fatal(err)
+		}
+		if result := <-output; result != 42 || calls != 1 {
+			t.Fatalf("Expected 42 from one call; received: %d from %d calls", result, calls)
+		}
+		if job := jobRepo.jobs["42"]; job.Stage != models.JobStageProbed || string(job.Results[models.JobStageProbed]) != "42" {
+			t.Fatalf("Unexpected job %+v", job)
+		}
+	})
+	t.Run("should resume after completed stage", func(t *testing.T) {
+		jobRepo.QueueJob(context, "42", "")
+		if err := stage.ProcessInput("42", output); err != nil {
+			t.Fatal(err)
+		}
+		if result := <-output; result != 42 || calls != 1 {
+			t.Fatalf("Expected recorded 42 without another call; received: %d from %d calls", result, calls)
+		}
+	})
+	t.Run("should drop input of canceled job", func(t *testing.T) {
+		jobRepo.QueueJob(context, "7", "")
+		if err := jobRepo.CancelJob(context, jobRepo.jobs["7"].Id); err != nil {
+			t.Fatal(err)
+		}
+		if err := stage.ProcessInput("7", output); err != nil {
+			t.Fatal(err)
+		}
+		if len(output) != 0 || calls != 1 {
+			t.Fatalf("Expected canceled job not to be processed; %d calls", calls)
+		}
+	})
+	t.Run("should not advance failed stage", func(t *testing.T) {
+		jobRepo.QueueJob(context, "NaN", "")
+		if err := stage.ProcessInput("NaN", output); err == nil {
+			t.Fatal("Expected error")
+		}
+		if job := jobRepo.jobs["NaN"]; job.Stage != models.JobStageDiscovered || len(output) != 0 {
+			t.Fatalf("Unexpected job %+v", job)
+		}
+	})
+}
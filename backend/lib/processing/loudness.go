@@ -0,0 +1,218 @@
+package processing
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/bongofriend/bookplayer/backend/lib/config"
+	"github.com/bongofriend/bookplayer/backend/lib/models"
+	"github.com/bongofriend/bookplayer/backend/lib/transcode"
+)
+
+// Highest true peak in dBTP the gain may raise an audiobook to, leaving headroom for lossy encoding
+const maxTruePeak = -1.0
+
+// Measures the integrated loudness of split chapters and, depending on the configured mode, applies the gain to them
+type LoudnessAnalyzer struct {
+	config     config.LoudnessConfig
+	transcoder *transcode.Transcoder
+}
+
+// Summary loudnorm prints as JSON after analyzing its input; values are strings and may be -inf for silence
+type loudnormOutput struct {
+	InputI  string `json:"input_i"`
+	InputTp string `json:"input_tp"`
+}
+
+func NewLoudnessAnalyzer(config config.Config) (*LoudnessAnalyzer, error) {
+	if !ffmpegIsAvailable() {
+		return nil, errors.New("ffmpeg is not available")
+	}
+	return &LoudnessAnalyzer{
+		config:     config.Loudness,
+		transcoder: transcode.NewTranscoder(config),
+	}, nil
+}
+
+func normalizesLoudness(c config.Config) bool {
+	return c.Loudness.Enabled && c.Loudness.Mode == config.LoudnessModeNormalize
+}
+
+// Parse integrated loudness and true peak from the output of ffmpeg's loudnorm filter with print_format=json
+func ParseLoudnormOutput(output []byte) (float64, float64, error) {
+	start := bytes.LastIndexByte(output, '{')
+	end := bytes.LastIndexByte(output, '}')
+	if start < 0 || end < start {
+		return 0, 0, errors.New("no loudness measurement in ffmpeg output")
+	}
+	result := loudnormOutput{}
+	if err := json.Unmarshal(output[start:end+1], &result); err != nil {
+		return 0, 0, err
+	}
+	integrated, err := strconv.ParseFloat(strings.TrimSpace(result.InputI), 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	truePeak, err := strconv.ParseFloat(strings.TrimSpace(result.InputTp), 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	if math.IsInf(integrated, 0) || math.IsInf(truePeak, 0) {
+		return 0, 0, errors.New("audio is too quiet to be measured")
+	}
+	return integrated, truePeak, nil
+}
+
+// Gain in dB bringing integratedLufs to targetLufs, lowered where it would push truePeak above maxTruePeak
+func LoudnessGain(integratedLufs float64, truePeak float64, targetLufs float64) float64 {
+	gain := min(targetLufs-integratedLufs, maxTruePeak-truePeak)
+	return math.Round(gain*100) / 100
+}
+
+func (l LoudnessAnalyzer) Shutdown() {
+	log.Println("Shutting down LoudnessAnalyzer")
+}
+
+// Like missing covers, a failed measurement never stops an audiobook from being added to the library
+func (l LoudnessAnalyzer) ProcessInput(input models.AudiobookProcessed, outputChan chan models.AudiobookProcessed) error {
+	loudness, err := l.analyze(input)
+	if err != nil {
+		log.Printf("Could not measure loudness of %s: %s", input.FilePath, err)
+	}
+	input.Loudness = loudness
+	if l.config.Mode == config.LoudnessModeNormalize {
+		pretranscode(l.transcoder, input)
+	}
+	outputChan <- input
+	return nil
+}
+
+func (l LoudnessAnalyzer) analyze(input models.AudiobookProcessed) (*models.Loudness, error) {
+	chapterPaths := make([]string, len(input.ProcessedChapters))
+	for idx, ch := range input.ProcessedChapters {
+		chapterPaths[idx] = ch.FilePath
+	}
+	if len(chapterPaths) == 0 {
+		return nil, nil
+	}
+	integrated, truePeak, err := measureLoudness(chapterPaths, l.config.TargetLufs)
+	if err != nil {
+		return nil, err
+	}
+	loudness := &models.Loudness{
+		IntegratedLufs: integrated,
+		TruePeak:       truePeak,
+		Gain:           LoudnessGain(integrated, truePeak, l.config.TargetLufs),
+	}
+	if l.config.Mode != config.LoudnessModeNormalize {
+		return loudness, nil
+	}
+	// Players can still apply the gain themselves if the chapters could not be normalized
+	if err := applyGain(chapterPaths, loudness.Gain); err != nil {
+		return loudness, err
+	}
+	loudness.Normalized = true
+	return loudness, nil
+}
+
+// First pass: loudnorm analyzes all chapters as one stream, so the whole audiobook gets a single gain
+func measureLoudness(chapterPaths []string, targetLufs float64) (float64, float64, error) {
+	list, err := os.CreateTemp("", "loudness-*.txt")
+	if err != nil {
+		return 0, 0, err
+	}
+	defer os.Remove(list.Name())
+	for _, p := range chapterPaths {
+		// Quoted for the concat demuxer, with quotes in the path escaped
+		if _, err := fmt.Fprintf(list, "file '%s'\n", strings.ReplaceAll(p, "'", `'\''`)); err != nil {
+			list.Close()
+			return 0, 0, err
+		}
+	}
+	if err := list.Close(); err != nil {
+		return 0, 0, err
+	}
+	args := []string{
+		"-hide_banner",
+		"-nostats",
+		"-f",
+		"concat",
+		"-safe",
+		"0",
+		"-i",
+		list.Name(),
+		"-vn",
+		"-af",
+		fmt.Sprintf("loudnorm=I=%g:TP=%g:print_format=json", targetLufs, maxTruePeak),
+		"-f",
+		"null",
+		"-",
+	}
+	// loudnorm prints its summary to stderr
+	output, err := exec.Command("ffmpeg", args...).CombinedOutput()
+	if err != nil {
+		return 0, 0, err
+	}
+	return ParseLoudnormOutput(output)
+}
+
+// Second pass: re-encode every chapter with gain; chapters are only replaced once all of them are written
+func applyGain(chapterPaths []string, gain float64) error {
+	normalized := make([]string, 0, len(chapterPaths))
+	removeNormalized := func() {
+		for _, p := range normalized {
+			os.Remove(p)
+		}
+	}
+	for _, p := range chapterPaths {
+		// Keeps the extension so ffmpeg picks the container and codec of the chapter
+		tmp, err := os.CreateTemp(filepath.Dir(p), ".normalizing-*"+filepath.Ext(p))
+		if err != nil {
+			removeNormalized()
+			return err
+		}
+		tmp.Close()
+		normalized = append(normalized, tmp.Name())
+		args := []string{
+			"-y",
+			"-v",
+			"error",
+			"-i",
+			p,
+			"-vn",
+			"-map_metadata",
+			"0",
+			"-af",
+			fmt.Sprintf("volume=%.2fdB", gain),
+			tmp.Name(),
+		}
+		if _, err := exec.Command("ffmpeg", args...).Output(); err != nil {
+			removeNormalized()
+			return fmt.Errorf("normalizing %s failed: %w", p, err)
+		}
+	}
+	for idx, p := range chapterPaths {
+		if err := os.Rename(normalized[idx], p); err != nil {
+			removeNormalized()
+			return err
+		}
+	}
+	return nil
+}
+
+func (l LoudnessAnalyzer) CommandsToReceive() []PipelineCommandType {
+	return []PipelineCommandType{}
+}
+
+func (l LoudnessAnalyzer) ProcessCommand(cmd PipelineCommand, inputChan chan models.AudiobookProcessed, outputChan chan models.AudiobookProcessed) error {
+	return nil
+}
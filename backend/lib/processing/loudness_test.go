@@ -0,0 +1,56 @@
+package processing_test
+
+import (
+	"testing"
+
+	"github.com/bongofriend/bookplayer/backend/lib/processing"
+)
+
+func TestParseLoudnormOutput(t *testing.T) {
+	output := []byte(`Input #0, concat, from '/tmp/loudness-123.txt':
+  Duration: N/A, start: 0.000000, bitrate: 63 kb/s
+[Parsed_loudnorm_0 @ 0x55d0c8f0a2c0]
+{
+	"input_i" : "-23.61",
+	"input_tp" : "-4.47",
+	"input_lra" : "6.50",
+	"input_thresh" : "-34.11",
+	"output_i" : "-18.28",
+	"output_tp" : "-1.00",
+	"output_lra" : "5.40",
+	"output_thresh" : "-28.70",
+	"normalization_type" : "dynamic",
+	"target_offset" : "0.28"
+}
+`)
+	integrated, truePeak, err := processing.ParseLoudnormOutput(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if integrated != -23.61 || truePeak != -4.47 {
+		t.Fatalf("Unexpected loudness %g LUFS with true peak %g dBTP", integrated, truePeak)
+	}
+	if _, _, err := processing.ParseLoudnormOutput([]byte(`{"input_i" : "-inf", "input_tp" : "-inf"}`)); err == nil {
+		t.Fatal("Expected error for silence")
+	}
+	if _, _, err := processing.ParseLoudnormOutput([]byte("Conversion failed!")); err == nil {
+		t.Fatal("Expected error for missing measurement")
+	}
+}
+
+func TestLoudnessGain(t *testing.T) {
+	for _, c := range []struct {
+		integrated float64
+		truePeak   float64
+		expected   float64
+	}{
+		{integrated: -23.6, truePeak: -8, expected: 5.6},
+		// Limited to keep the true peak below -1 dBTP
+		{integrated: -23.6, truePeak: -4, expected: 3},
+		{integrated: -14, truePeak: -0.5, expected: -4},
+	} {
+		if gain := processing.LoudnessGain(c.integrated, c.truePeak, -18); gain != c.expected {
+			t.Fatalf("Expected gain of %g dB for %g LUFS; received: %g", c.expected, c.integrated, gain)
+		}
+	}
+}
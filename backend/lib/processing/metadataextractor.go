@@ -2,17 +2,29 @@ package processing
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"slices"
 	"strconv"
+	"strings"
 
+	"github.com/bongofriend/bookplayer/backend/lib/config"
+	"github.com/bongofriend/bookplayer/backend/lib/data/repo"
+	"github.com/bongofriend/bookplayer/backend/lib/events"
 	"github.com/bongofriend/bookplayer/backend/lib/models"
 )
 
 type MetadataExtractor struct {
+	readers      []MetadataReader
+	overrideRepo repo.OverrideRepository
+	eventBus     *events.Bus
+	detection    config.ChapterDetectionConfig
 }
 
 type Chapter struct {
@@ -53,6 +65,13 @@ type Tags struct {
 	Comment          string `json:"comment"`
 	Genre            string `json:"genre"`
 	MediaType        string `json:"media_type"`
+	AlbumArtist      string `json:"album_artist"`
+	Grouping         string `json:"grouping"`
+	Series           string `json:"series"`
+	SeriesPart       string `json:"series-part"`
+	// Position of a file within a multi-file audiobook, e.g. "3" or "3/12"
+	Track string `json:"track"`
+	Disc  string `json:"disc"`
 }
 
 type AudiobookMetadata struct {
@@ -60,15 +79,21 @@ type AudiobookMetadata struct {
 	Format   Format    `json:"format"`
 }
 
-func NewMetadataExtractor() (*MetadataExtractor, error) {
-	if !ffprobeIsAvailable() {
-		return nil, errors.New("ffmpeg is not installed or found")
-	}
-	return &MetadataExtractor{}, nil
+/*
+Values edited by users are applied from overrideRepo over the extracted ones unless it is nil.
+MP4 files are read natively; other formats need ffprobe
+*/
+func NewMetadataExtractor(config config.Config, overrideRepo repo.OverrideRepository, eventBus *events.Bus) (*MetadataExtractor, error) {
+	return &MetadataExtractor{
+		readers:      availableReaders(),
+		overrideRepo: overrideRepo,
+		eventBus:     eventBus,
+		detection:    config.ChapterDetection,
+	}, nil
 }
 
 func ffprobeIsAvailable() bool {
-	_, err := exec.LookPath("ffmpeg")
+	_, err := exec.LookPath("ffprobe")
 	return err == nil
 }
 
@@ -88,14 +113,27 @@ func (a AudiobookMetadata) AsModel() (models.Audiobook, error) {
 		chapters[idx] = data
 	}
 
+	authors := splitNames(tags.Artist)
+	if len(authors) == 0 {
+		authors = splitNames(tags.AlbumArtist)
+	}
+	narrators := splitNames(tags.Composer)
+	genres := splitGenres(tags.Genre)
+	series, seriesPosition := parseSeries(tags)
+
 	return models.Audiobook{
 		AudiobookCommon: models.AudiobookCommon{
-			Title:       tags.Title,
-			Author:      tags.Artist,
-			Narrator:    tags.Composer,
-			Description: tags.Comment,
-			Genre:       tags.Genre,
-			Duration:    float32(audiobookDuration),
+			Title:          tags.Title,
+			Author:         strings.Join(authors, ", "),
+			Narrator:       strings.Join(narrators, ", "),
+			Description:    tags.Comment,
+			Genre:          strings.Join(genres, ", "),
+			Duration:       float32(audiobookDuration),
+			Authors:        authors,
+			Narrators:      narrators,
+			Genres:         genres,
+			Series:         series,
+			SeriesPosition: seriesPosition,
 		},
 		Chapters: chapters,
 	}, nil
@@ -123,38 +161,204 @@ func (c Chapter) asModel() (models.Chapter, error) {
 	}, nil
 }
 
-func (m MetadataExtractor) ProcessInput(path string, outputChan chan AudiobookMetadataResult) error {
-	filePath := string(path)
-	if stat, err := os.Stat(string(filePath)); err != nil || stat.IsDir() {
+func probeFile(filePath string) (AudiobookMetadata, error) {
+	if stat, err := os.Stat(filePath); err != nil || stat.IsDir() {
 		if err != nil {
-			return err
+			return AudiobookMetadata{}, err
 		}
+		return AudiobookMetadata{}, fmt.Errorf("%s is not a file", filePath)
 	}
 	ffprobeArgs := []string{"-print_format", "json", "-show_format", "-show_chapters", filePath}
 	cmd := exec.Command("ffprobe", ffprobeArgs...)
 	output, err := cmd.Output()
 	if err != nil {
-		return err
+		return AudiobookMetadata{}, err
 	}
 	ffprobeOutput := AudiobookMetadata{}
 	outputBuffer := bytes.Buffer{}
 	if err := json.Compact(&outputBuffer, output); err != nil {
-		return err
+		return AudiobookMetadata{}, err
 	}
 	if err := json.Unmarshal(outputBuffer.Bytes(), &ffprobeOutput); err != nil {
-		return err
+		return AudiobookMetadata{}, err
+	}
+	return ffprobeOutput, nil
+}
+
+// Name of a file or directory without extension
+func baseName(p string) string {
+	return strings.TrimSuffix(filepath.Base(p), filepath.Ext(p))
+}
+
+// Leading number of a track or disc tag like "3/12"; false if there is none
+func parsePosition(value string) (int, bool) {
+	digits, _ := splitDigits(strings.TrimSpace(value))
+	if digits == "" {
+		return 0, false
+	}
+	n, err := strconv.Atoi(digits)
+	return n, err == nil
+}
+
+/*
+Build the metadata of an audiobook stored as one file per chapter from the metadata of each file.
+Files are reordered by disc and track tags if every file has a track number; otherwise the order of source.Files is kept.
+Each file becomes one chapter; book level tags are taken from the first file
+*/
+func MergeTrackMetadata(source AudiobookSource, tracks []AudiobookMetadata) (AudiobookMetadataResult, error) {
+	if len(tracks) == 0 || len(tracks) != len(source.Files) {
+		return AudiobookMetadataResult{}, fmt.Errorf("expected metadata for %d files of %s; received: %d", len(source.Files), source.Path, len(tracks))
+	}
+	type track struct {
+		file     string
+		metadata AudiobookMetadata
+		disc     int
+		number   int
+	}
+	ordered := make([]track, len(tracks))
+	allNumbered := true
+	for idx, t := range tracks {
+		number, ok := parsePosition(t.Format.Tags.Track)
+		allNumbered = allNumbered && ok
+		disc, _ := parsePosition(t.Format.Tags.Disc)
+		ordered[idx] = track{file: source.Files[idx], metadata: t, disc: disc, number: number}
+	}
+	if allNumbered {
+		slices.SortStableFunc(ordered, func(a track, b track) int {
+			if a.disc != b.disc {
+				return a.disc - b.disc
+			}
+			return a.number - b.number
+		})
 	}
-	model, err := ffprobeOutput.AsModel()
+
+	audiobook, err := ordered[0].metadata.AsModel()
 	if err != nil {
-		return err
+		return AudiobookMetadataResult{}, err
+	}
+	audiobook.Title = ordered[0].metadata.Format.Tags.Album
+	applyFolderMetadata(&audiobook, source)
+
+	files := make([]string, len(ordered))
+	chapters := make([]models.Chapter, len(ordered))
+	var startTime float64
+	for idx, t := range ordered {
+		duration, err := strconv.ParseFloat(t.metadata.Format.Duration, 32)
+		if err != nil {
+			return AudiobookMetadataResult{}, fmt.Errorf("duration of %s: %w", t.file, err)
+		}
+		title := strings.TrimSpace(t.metadata.Format.Tags.Title)
+		if title == "" {
+			title = baseName(t.file)
+		}
+		files[idx] = t.file
+		chapters[idx] = models.Chapter{
+			ChapterCommon: models.ChapterCommon{
+				Title:     title,
+				StartTime: float32(startTime),
+				EndTime:   float32(startTime + duration),
+				Numbering: idx,
+			},
+		}
+		startTime += duration
+	}
+	audiobook.Chapters = chapters
+	audiobook.Duration = float32(startTime)
+	return AudiobookMetadataResult{
+		Audiobook:    audiobook,
+		FilePath:     source.Path,
+		RelativePath: source.RelativePath,
+		Files:        files,
+	}, nil
+}
+
+// Metadata of an audiobook in a single file; files without chapters are treated as one chapter
+func singleFileMetadata(source AudiobookSource, metadata AudiobookMetadata) (AudiobookMetadataResult, error) {
+	audiobook, err := metadata.AsModel()
+	if err != nil {
+		return AudiobookMetadataResult{}, err
+	}
+	if audiobook.Title == "" {
+		audiobook.Title = metadata.Format.Tags.Album
+	}
+	applyFolderMetadata(&audiobook, source)
+	if len(audiobook.Chapters) == 0 {
+		audiobook.Chapters = []models.Chapter{{
+			ChapterCommon: models.ChapterCommon{
+				Title:     audiobook.Title,
+				StartTime: 0,
+				EndTime:   audiobook.Duration,
+				Numbering: 0,
+			},
+		}}
+	}
+	return AudiobookMetadataResult{
+		Audiobook:    audiobook,
+		FilePath:     source.Path,
+		RelativePath: source.RelativePath,
+		Files:        source.Files,
+	}, nil
+}
+
+func (m MetadataExtractor) ProcessInput(source AudiobookSource, outputChan chan AudiobookMetadataResult) error {
+	m.eventBus.Publish(events.Event{Type: events.TypeProbing, SourcePath: source.RelativePath})
+	result, err := extractMetadata(m.readers, source, m.detection)
+	if err != nil {
+		return newSourceError(StageMetadata, source.RelativePath, err)
+	}
+	if err := m.applyOverrides(&result); err != nil {
+		return newSourceError(StageMetadata, source.RelativePath, err)
+	}
+	outputChan <- result
+	return nil
+}
+
+// Apply values edited by users, so chapters are split at edited boundaries and edits survive processing again
+func (m MetadataExtractor) applyOverrides(result *AudiobookMetadataResult) error {
+	if m.overrideRepo == nil {
+		return nil
+	}
+	overrides, err := m.overrideRepo.GetOverridesBySource(context.Background(), result.RelativePath)
+	if errors.Is(err, repo.ErrNotFound) {
+		// Not processed before, so nothing could be edited yet
+		return nil
 	}
-	outputChan <- AudiobookMetadataResult{
-		Audiobook: model,
-		FilePath:  path,
+	if err != nil {
+		return err
 	}
+	overrides.Apply(&result.Audiobook)
 	return nil
 }
 
+func extractMetadata(readers []MetadataReader, source AudiobookSource, detection config.ChapterDetectionConfig) (AudiobookMetadataResult, error) {
+	if len(source.Files) == 0 {
+		return AudiobookMetadataResult{}, fmt.Errorf("no audio files found in %s", source.Path)
+	}
+	tracks := make([]AudiobookMetadata, len(source.Files))
+	for idx, f := range source.Files {
+		metadata, err := readMetadata(readers, f)
+		if err != nil {
+			return AudiobookMetadataResult{}, err
+		}
+		tracks[idx] = metadata
+	}
+	if source.IsMultiFile() {
+		return MergeTrackMetadata(source, tracks)
+	}
+	result, err := singleFileMetadata(source, tracks[0])
+	if err != nil || len(tracks[0].Chapters) > 0 || detection.Disabled {
+		return result, err
+	}
+	// Without chapter markers the whole file would be a single chapter; a failed detection leaves it at that
+	chapters, err := detectChapters(source.Files[0], float64(result.Audiobook.Duration), detection)
+	if err != nil {
+		log.Printf("Could not detect chapters of %s: %s", source.Path, err)
+	} else if len(chapters) > 0 {
+		result.Audiobook.Chapters = chapters
+	}
+	return result, nil
+}
+
 func (m MetadataExtractor) Shutdown() {
 	log.Println("Shutting down MetadataExtractor")
 }
@@ -163,6 +367,6 @@ func (m MetadataExtractor) CommandsToReceive() []PipelineCommandType {
 	return []PipelineCommandType{}
 }
 
-func (m MetadataExtractor) ProcessCommand(cmd PipelineCommand, inputChan chan string, outputChan chan AudiobookMetadataResult) error {
+func (m MetadataExtractor) ProcessCommand(cmd PipelineCommand, inputChan chan AudiobookSource, outputChan chan AudiobookMetadataResult) error {
 	return nil
 }
@@ -3,9 +3,11 @@ package processing_test
 import (
 	"context"
 	"log"
+	"slices"
 	"testing"
 	"time"
 
+	"github.com/bongofriend/bookplayer/backend/lib/config"
 	"github.com/bongofriend/bookplayer/backend/lib/models"
 	"github.com/bongofriend/bookplayer/backend/lib/processing"
 )
@@ -15,14 +17,14 @@ const (
 )
 
 func TestNewMetadataExtractor(t *testing.T) {
-	if _, err := processing.NewMetadataExtractor(); err != nil {
+	if _, err := processing.NewMetadataExtractor(config.Config{}, nil, nil); err != nil {
 		t.Fatal(err)
 	}
 }
 
 func TestMetaDataExtractorProcess(t *testing.T) {
-	extractorHandler, _ := processing.NewMetadataExtractor()
-	extractor := processing.NewPipelineStage[string, processing.AudiobookMetadataResult](extractorHandler)
+	extractorHandler, _ := processing.NewMetadataExtractor(config.Config{}, nil, nil)
+	extractor := processing.NewPipelineStage[processing.AudiobookSource, processing.AudiobookMetadataResult](extractorHandler)
 	context, cancel := context.WithTimeout(context.Background(), 60*time.Second)
 	doneConsumer := make(chan struct{})
 	errChan := make(chan error)
@@ -39,7 +41,7 @@ func TestMetaDataExtractorProcess(t *testing.T) {
 	}()
 
 	go extractor.Start(context, errChan)
-	extractor.InputChan <- testfilePath
+	extractor.InputChan <- processing.AudiobookSource{Path: testfilePath, Files: []string{testfilePath}}
 
 	var audiobook *models.Audiobook
 	go func() {
@@ -63,3 +65,86 @@ func TestMetaDataExtractorProcess(t *testing.T) {
 		log.Fatal("No data received from MetadataExtractor")
 	}
 }
+
+func TestMergeTrackMetadata(t *testing.T) {
+	track := func(title string, trackTag string, disc string, duration string) processing.AudiobookMetadata {
+		return processing.AudiobookMetadata{Format: processing.Format{
+			Duration: duration,
+			Tags: processing.Tags{
+				Title:  title,
+				Album:  "Dune",
+				Artist: "Frank Herbert",
+				Track:  trackTag,
+				Disc:   disc,
+			},
+		}}
+	}
+	source := processing.AudiobookSource{
+		Path:  "/audiobooks/Dune",
+		Files: []string{"/audiobooks/Dune/a.mp3", "/audiobooks/Dune/b.mp3", "/audiobooks/Dune/c.mp3"},
+	}
+
+	t.Run("should order files by disc and track", func(t *testing.T) {
+		result, err := processing.MergeTrackMetadata(source, []processing.AudiobookMetadata{
+			track("Part Two", "1/2", "2", "20"),
+			track("", "2/2", "1", "5.5"),
+			track("Opening", "1/2", "1", "10"),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectedFiles := []string{"/audiobooks/Dune/c.mp3", "/audiobooks/Dune/b.mp3", "/audiobooks/Dune/a.mp3"}
+		if !slices.Equal(result.Files, expectedFiles) {
+			t.Fatalf("Expected files %v; received: %v", expectedFiles, result.Files)
+		}
+		audiobook := result.Audiobook
+		if audiobook.Title != "Dune" || audiobook.Author != "Frank Herbert" || audiobook.Duration != 35.5 {
+			t.Fatalf("Unexpected audiobook %+v", audiobook.AudiobookCommon)
+		}
+		if len(audiobook.Chapters) != 3 {
+			t.Fatalf("Expected 3 chapters; received: %d", len(audiobook.Chapters))
+		}
+		second := audiobook.Chapters[1]
+		if second.Title != "b" || second.StartTime != 10 || second.EndTime != 15.5 || second.Numbering != 1 {
+			t.Fatalf("Unexpected chapter %+v", second)
+		}
+	})
+	t.Run("should keep file order without track numbers", func(t *testing.T) {
+		result, err := processing.MergeTrackMetadata(source, []processing.AudiobookMetadata{
+			track("First", "", "", "1"),
+			track("Second", "3", "", "1"),
+			track("Third", "", "", "1"),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(result.Files, source.Files) || result.Audiobook.Chapters[2].Title != "Third" {
+			t.Fatalf("Expected original order; received: %v", result.Files)
+		}
+	})
+	t.Run("should fall back to folder metadata", func(t *testing.T) {
+		untagged := processing.AudiobookSource{
+			Path:         "/audiobooks/Frank Herbert/Dune Chronicles/02 - Dune Messiah",
+			RelativePath: "Frank Herbert/Dune Chronicles/02 - Dune Messiah",
+			Files:        []string{"/audiobooks/Frank Herbert/Dune Chronicles/02 - Dune Messiah/1.mp3"},
+		}
+		result, err := processing.MergeTrackMetadata(untagged, []processing.AudiobookMetadata{
+			{Format: processing.Format{Duration: "1"}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		audiobook := result.Audiobook
+		if audiobook.Title != "Dune Messiah" || audiobook.Author != "Frank Herbert" || audiobook.Series != "Dune Chronicles" || audiobook.SeriesPosition != "2" {
+			t.Fatalf("Unexpected audiobook %+v", audiobook.AudiobookCommon)
+		}
+		if result.RelativePath != untagged.RelativePath {
+			t.Fatalf("Expected relative path %s; received: %s", untagged.RelativePath, result.RelativePath)
+		}
+	})
+	t.Run("should fail for missing metadata", func(t *testing.T) {
+		if _, err := processing.MergeTrackMetadata(source, nil); err == nil {
+			t.Fatal("Expected error for missing metadata")
+		}
+	})
+}
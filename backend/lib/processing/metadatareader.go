@@ -0,0 +1,121 @@
+package processing
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/bongofriend/bookplayer/backend/lib/mp4"
+)
+
+// Reads duration, tags and chapters of a single audio file
+type MetadataReader interface {
+	// Whether the reader understands filePath, judged by its name
+	Supports(filePath string) bool
+	Read(filePath string) (AudiobookMetadata, error)
+}
+
+// Reads any format known to ffmpeg by running ffprobe
+type FfprobeReader struct{}
+
+func (FfprobeReader) Supports(filePath string) bool {
+	return true
+}
+
+func (FfprobeReader) Read(filePath string) (AudiobookMetadata, error) {
+	return probeFile(filePath)
+}
+
+// Extensions of MP4 containers read by Mp4Reader
+var mp4Extensions = []string{".m4b", ".m4a", ".mp4"}
+
+// Reads MP4 containers like m4b by parsing their boxes, which is much faster than starting ffprobe for every file
+type Mp4Reader struct{}
+
+func (Mp4Reader) Supports(filePath string) bool {
+	return slices.Contains(mp4Extensions, strings.ToLower(filepath.Ext(filePath)))
+}
+
+// Metadata as ffprobe would report it, so both readers can be used interchangeably
+func (Mp4Reader) Read(filePath string) (AudiobookMetadata, error) {
+	file, err := mp4.ReadFile(filePath)
+	if err != nil {
+		return AudiobookMetadata{}, err
+	}
+	tags := file.Tags
+	metadata := AudiobookMetadata{
+		Chapters: make([]Chapter, len(file.Chapters)),
+		Format: Format{
+			Filename: filePath,
+			Duration: formatSeconds(file.Duration),
+			Tags: Tags{
+				MajorBrand:       tags["major_brand"],
+				MinorVersion:     tags["minor_version"],
+				CompatibleBrands: tags["compatible_brands"],
+				Title:            tags["title"],
+				Artist:           tags["artist"],
+				Composer:         tags["composer"],
+				Album:            tags["album"],
+				Encoder:          tags["encoder"],
+				Comment:          tags["comment"],
+				Genre:            tags["genre"],
+				MediaType:        tags["media_type"],
+				AlbumArtist:      tags["album_artist"],
+				Grouping:         tags["grouping"],
+				Series:           tags["series"],
+				SeriesPart:       tags["series-part"],
+				Track:            tags["track"],
+				Disc:             tags["disc"],
+			},
+		},
+	}
+	for idx, ch := range file.Chapters {
+		metadata.Chapters[idx] = Chapter{
+			ID:        idx,
+			TimeBase:  "1/1000",
+			Start:     int(ch.Start * 1000),
+			StartTime: formatSeconds(ch.Start),
+			End:       int(ch.End * 1000),
+			EndTime:   formatSeconds(ch.End),
+		}
+		metadata.Chapters[idx].Tags.Title = ch.Title
+	}
+	return metadata, nil
+}
+
+// Seconds with the precision ffprobe prints them in
+func formatSeconds(seconds float64) string {
+	return strconv.FormatFloat(seconds, 'f', 6, 64)
+}
+
+// Readers available in this environment; ffprobe is only needed for formats other than MP4
+func availableReaders() []MetadataReader {
+	readers := []MetadataReader{Mp4Reader{}}
+	if ffprobeIsAvailable() {
+		readers = append(readers, FfprobeReader{})
+	} else {
+		log.Println("ffprobe not found; only MP4 files can be read")
+	}
+	return readers
+}
+
+// Metadata of filePath from the first reader supporting it; the next one is tried if a reader fails
+func readMetadata(readers []MetadataReader, filePath string) (AudiobookMetadata, error) {
+	err := fmt.Errorf("no metadata reader supports %s", filePath)
+	for idx, reader := range readers {
+		if !reader.Supports(filePath) {
+			continue
+		}
+		var metadata AudiobookMetadata
+		if metadata, err = reader.Read(filePath); err == nil {
+			return metadata, nil
+		}
+		if idx+1 < len(readers) {
+			log.Printf("Could not read metadata of %s with %T; trying next reader: %s", filePath, reader, err)
+		}
+	}
+	return AudiobookMetadata{}, err
+}
@@ -0,0 +1,67 @@
+package processing_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bongofriend/bookplayer/backend/lib/mp4"
+	"github.com/bongofriend/bookplayer/backend/lib/processing"
+)
+
+func mp4Box(typ string, content ...[]byte) []byte {
+	data := bytes.Join(content, nil)
+	header := binary.BigEndian.AppendUint32(nil, uint32(8+len(data)))
+	return append(append(header, typ...), data...)
+}
+
+func TestMp4Reader(t *testing.T) {
+	reader := processing.Mp4Reader{}
+	testDir := t.TempDir()
+
+	t.Run("should support MP4 containers", func(t *testing.T) {
+		if !reader.Supports("Dune/Dune.M4B") || reader.Supports("Dune/01.mp3") {
+			t.Fatal("Unexpected supported files")
+		}
+	})
+	t.Run("should read metadata like ffprobe", func(t *testing.T) {
+		// 20 seconds with two Nero chapters and a title
+		chpl := []byte{0, 0, 0, 0, 2}
+		chpl = append(binary.BigEndian.AppendUint64(chpl, 0), append([]byte{5}, "Intro"...)...)
+		chpl = append(binary.BigEndian.AppendUint64(chpl, 75_000_000), append([]byte{4}, "Dune"...)...)
+		title := mp4Box("\xa9nam", mp4Box("data", []byte{0, 0, 0, 1, 0, 0, 0, 0}, []byte("Dune")))
+		mvhd := mp4Box("mvhd", []byte{0, 0, 0, 0}, make([]byte, 8), binary.BigEndian.AppendUint32(nil, 1000), binary.BigEndian.AppendUint32(nil, 20000))
+		moov := mp4Box("moov", mvhd, mp4Box("udta", mp4Box("chpl", chpl), mp4Box("meta", make([]byte, 4), mp4Box("ilst", title))))
+		p := filepath.Join(testDir, "Dune.m4b")
+		if err := os.WriteFile(p, append(mp4Box("ftyp", []byte("M4B "), make([]byte, 4)), moov...), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		metadata, err := reader.Read(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		audiobook, err := metadata.AsModel()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if audiobook.Title != "Dune" || audiobook.Duration != 20 || len(audiobook.Chapters) != 2 {
+			t.Fatalf("Unexpected audiobook %+v", audiobook)
+		}
+		if ch := audiobook.Chapters[1]; ch.Title != "Dune" || ch.StartTime != 7.5 || ch.EndTime != 20 || ch.Numbering != 1 {
+			t.Fatalf("Unexpected chapter %+v", ch)
+		}
+	})
+	t.Run("should reject files that are no MP4", func(t *testing.T) {
+		p := filepath.Join(testDir, "broken.m4b")
+		if err := os.WriteFile(p, []byte("not an audiobook"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := reader.Read(p); !errors.Is(err, mp4.ErrNotMp4) {
+			t.Fatalf("Expected %s; received: %v", mp4.ErrNotMp4, err)
+		}
+	})
+}
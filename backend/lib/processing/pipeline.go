@@ -2,12 +2,16 @@ package processing
 
 import (
 	"context"
+	"errors"
 	"log"
 	"slices"
+	"sync"
 	"time"
 
 	"github.com/bongofriend/bookplayer/backend/lib/config"
 	"github.com/bongofriend/bookplayer/backend/lib/data/repo"
+	"github.com/bongofriend/bookplayer/backend/lib/events"
+	"github.com/bongofriend/bookplayer/backend/lib/models"
 )
 
 // Struct that represents processing pipeline
@@ -17,6 +21,11 @@ type Pipeline struct {
 	errChan               chan error
 	stageCommandPipelines []chan PipelineCommand
 	doneChans             []chan struct{}
+	eventBus              *events.Bus
+	commands              *commandTracker
+	gate                  *pauseGate
+	// Closed once the pipeline shuts down; commands dispatched from then on fail
+	stopped chan struct{}
 }
 
 // A stage in the pipeline
@@ -32,13 +41,23 @@ type PipelineStage[Input any, Output any] struct {
 
 	// Stage specfic logic
 	handler PipelineStageHandler[Input, Output]
+	workers int
+	// Holds workers back while the pipeline is paused; nil for stages that are never paused
+	gate *pauseGate
 }
 
+// Stage processing one input at a time
 func NewPipelineStage[Input any, Output any](handler PipelineStageHandler[Input, Output]) PipelineStage[Input, Output] {
+	return NewConcurrentPipelineStage(handler, config.StageConfig{Workers: 1})
+}
+
+// Stage processing up to Workers inputs at the same time, in no particular order; handler has to be safe for concurrent use
+func NewConcurrentPipelineStage[Input any, Output any](handler PipelineStageHandler[Input, Output], stageConfig config.StageConfig) PipelineStage[Input, Output] {
 	return PipelineStage[Input, Output]{
 		handler:     handler,
+		workers:     max(stageConfig.Workers, 1),
 		CommandChan: make(chan PipelineCommand),
-		InputChan:   make(chan Input),
+		InputChan:   make(chan Input, stageConfig.BufferSize),
 		OutputChan:  make(chan Output),
 		DoneChan:    make(chan struct{}),
 	}
@@ -46,36 +65,103 @@ func NewPipelineStage[Input any, Output any](handler PipelineStageHandler[Input,
 
 // Start stage for processing
 func (p PipelineStage[Input, Output]) Start(ctx context.Context, errorChan chan error) {
+	// Input and command channels are left open as senders may still try to deliver while the stage shuts down
+	workers := sync.WaitGroup{}
 	defer func() {
+		// Results are discarded once the pipeline shuts down so workers blocked on sending them can return
+		workersDone := make(chan struct{})
+		go func() {
+			workers.Wait()
+			close(workersDone)
+		}()
+		for drained := false; !drained; {
+			select {
+			case <-workersDone:
+				drained = true
+			case <-p.OutputChan:
+			}
+		}
 		p.handler.Shutdown()
 		p.DoneChan <- struct{}{}
-		close(p.CommandChan)
-		close(p.InputChan)
 		close(p.OutputChan)
 	}()
 	cmds := p.handler.CommandsToReceive()
+	for idx := 0; idx < p.workers; idx++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			p.work(ctx, errorChan)
+		}()
+	}
 	for {
 		select {
 		// Shutdown by context cancelation fpr whole pipeline
 		case <-ctx.Done():
 			return
-		// Process from input channel
-		case input := <-p.InputChan:
-			if err := p.handler.ProcessInput(input, p.OutputChan); err != nil {
-				errorChan <- err
-			}
 		// React to external commands
 		case cmd := <-p.CommandChan:
 			if !slices.Contains(cmds, cmd.CmdType) {
 				continue
 			}
 			if err := p.handler.ProcessCommand(cmd, p.InputChan, p.OutputChan); err != nil {
-				errorChan <- err
+				reportError(ctx, errorChan, err)
+			}
+		}
+	}
+}
+
+// Process from input channel until the pipeline shuts down
+func (p PipelineStage[Input, Output]) work(ctx context.Context, errorChan chan error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case input := <-p.InputChan:
+			if !p.gate.wait(ctx) {
+				return
+			}
+			if err := p.handler.ProcessInput(input, p.OutputChan); err != nil {
+				reportError(ctx, errorChan, err)
 			}
 		}
 	}
 }
 
+func reportError(ctx context.Context, errorChan chan error, err error) {
+	select {
+	case <-ctx.Done():
+		log.Println(err)
+	case errorChan <- err:
+	}
+}
+
+// Forward results of one stage to the next so a busy stage only holds up the stages in front of it
+func connectStages[T any](ctx context.Context, from chan T, to chan T) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case item, ok := <-from:
+			if !ok {
+				return
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case to <- item:
+			}
+		}
+	}
+}
+
+// Request a scan unless one is already waiting
+func requestScan(inputChan chan struct{}) {
+	select {
+	case inputChan <- struct{}{}:
+	default:
+	}
+}
+
 type PipelineStageHandler[Input any, Output any] interface {
 	// Handle shutdown
 	Shutdown()
@@ -89,112 +175,199 @@ type PipelineStageHandler[Input any, Output any] interface {
 
 // Command to be dispatched to pipeline stages
 type PipelineCommand struct {
+	// Id of the command followed by callers; 0 for commands sent by the pipeline itself
+	Id      int64
 	CmdType PipelineCommandType
 	Payload interface{}
+
+	tracker *commandTracker
 }
 
 type PipelineCommandType int8
 
 const (
 	Scan PipelineCommandType = iota + 1
+	Rescan
+	// Payload is the relative path of the source
+	Reprocess
+	// Payload is the relative path of the source or empty for the whole library
+	Rehash
+	Pause
+	Resume
+	// Payload is the relative path of the source
+	WriteBack
 )
 
-func NewPipeline() Pipeline {
+func NewPipeline(eventBus *events.Bus) Pipeline {
 	return Pipeline{
 		PipelineCommandChan:   make(chan PipelineCommand),
-		errChan:               make(chan error),
+		errChan:               make(chan error, 16),
 		stageCommandPipelines: []chan PipelineCommand{},
 		doneChans:             []chan struct{}{},
+		eventBus:              eventBus,
+		commands:              newCommandTracker(),
+		stopped:               make(chan struct{}),
 	}
 
 }
 
+// Dispatch commands to stages until the pipeline shuts down; the command channel is left open as callers may still try to send
 func (p Pipeline) initCommandPipeline(context context.Context) {
-	defer func() {
-		close(p.PipelineCommandChan)
-	}()
-
 	for {
 		select {
 		case <-context.Done():
 			return
 		case cmd := <-p.PipelineCommandChan:
-			for _, ch := range p.stageCommandPipelines {
-				ch <- cmd
+			switch cmd.CmdType {
+			case Pause:
+				p.gate.pause()
+				cmd.finished(nil)
+			case Resume:
+				p.gate.resume()
+				cmd.finished(nil)
+			default:
+				for _, ch := range p.stageCommandPipelines {
+					select {
+					case <-context.Done():
+						cmd.finished(ErrPipelineStopped)
+						return
+					case ch <- cmd:
+					}
+				}
 			}
 		}
 	}
 }
 
 // Assemble and start audiobook processing pipeline
-func (p *Pipeline) Start(appContext context.Context, appConfig config.Config, appDoneChan chan struct{}, audiobookRepo repo.AudiobookRepository) {
+// appDoneChan receives the error of a stage failing to start, or nil once the pipeline stopped
+func (p *Pipeline) Start(appContext context.Context, appConfig config.Config, appDoneChan chan error, audiobookRepo repo.AudiobookRepository, sourceFileRepo repo.SourceFileRepository, jobRepo repo.JobRepository, overrideRepo repo.OverrideRepository) {
 	context, cancel := context.WithCancel(appContext)
+	var startErr error
 	defer func() {
 		cancel()
+		close(p.stopped)
 		for _, ch := range p.doneChans {
 			<-ch
 		}
-		appDoneChan <- struct{}{}
+		appDoneChan <- startErr
 	}()
 
 	// Stage 1: Watch for directory changes every n seconds (as specfied in config)
-	watcherHandler, err := NewDirectoryWatcher(appConfig)
+	watcherHandler, err := NewDirectoryWatcher(appConfig, sourceFileRepo, audiobookRepo, jobRepo, p.eventBus)
 	if err != nil {
-		p.errChan <- err
+		startErr = err
 		return
 	}
-	watcherPipelineStage := NewPipelineStage(watcherHandler)
-	p.stageCommandPipelines = append(p.stageCommandPipelines, watcherPipelineStage.CommandChan)
-	p.doneChans = append(p.doneChans, watcherPipelineStage.DoneChan)
-	go watcherPipelineStage.Start(context, p.errChan)
+	// A single worker with room for one queued scan; further requests while scanning are merged into it
+	sources := NewStageChain(watcherHandler, config.StageConfig{Workers: 1, BufferSize: 1})
 
 	// Stage 2: Extract meta from audiobook file
-	metadataExtractorHandler, err := NewMetadataExtractor()
+	metadataExtractorHandler, err := NewMetadataExtractor(appConfig, overrideRepo, p.eventBus)
 	if err != nil {
-		p.errChan <- err
+		startErr = err
 		return
 	}
-	metadataExtractorPipelineStage := NewPipelineStage(metadataExtractorHandler)
-	p.stageCommandPipelines = append(p.stageCommandPipelines, metadataExtractorPipelineStage.CommandChan)
-	p.doneChans = append(p.doneChans, metadataExtractorPipelineStage.DoneChan)
-	go metadataExtractorPipelineStage.Start(context, p.errChan)
+	metadata := Append(sources, NewJobStage(metadataExtractorHandler, jobRepo, models.JobStageProbed, func(s AudiobookSource) string {
+		return s.RelativePath
+	}), appConfig.Pipeline.Metadata)
 
 	// Stage 3: Split audiobook into seperate chapter files
-	chapterSplitterHandler, err := NewChapterSplitter(appConfig)
+	chapterSplitterHandler, err := NewChapterSplitter(appConfig, p.eventBus)
 	if err != nil {
-		p.errChan <- err
+		startErr = err
 		return
 	}
-	chapterSplitterPipelineStage := NewPipelineStage(chapterSplitterHandler)
-	p.stageCommandPipelines = append(p.stageCommandPipelines, chapterSplitterPipelineStage.CommandChan)
-	p.doneChans = append(p.doneChans, chapterSplitterPipelineStage.DoneChan)
-	go chapterSplitterPipelineStage.Start(context, p.errChan)
+	processed := Append(metadata, NewJobStage(chapterSplitterHandler, jobRepo, models.JobStageSplit, func(m AudiobookMetadataResult) string {
+		return m.RelativePath
+	}), appConfig.Pipeline.Chapters)
 
-	// Stage 4: Insert processed audiobook information to database
-	audiobookSinkHandler := NewAudiobookSink(audiobookRepo)
-	audiobookSinkPipelineStage := NewPipelineStage(audiobookSinkHandler)
-	p.stageCommandPipelines = append(p.stageCommandPipelines, audiobookSinkPipelineStage.CommandChan)
-	p.doneChans = append(p.doneChans, audiobookSinkPipelineStage.DoneChan)
-	go audiobookSinkPipelineStage.Start(context, p.errChan)
-	go p.initCommandPipeline(appContext)
+	// Stage 4 (optional): Measure loudness and normalize chapters
+	if appConfig.Loudness.Enabled {
+		loudnessAnalyzerHandler, err := NewLoudnessAnalyzer(appConfig)
+		if err != nil {
+			startErr = err
+			return
+		}
+		processed = Append(processed, loudnessAnalyzerHandler, appConfig.Pipeline.Loudness)
+	}
 
+	// Stage 5 (optional): Extract cover art and generate thumbnails
+	if !appConfig.Pipeline.Covers.Disabled {
+		coverExtractorHandler, err := NewCoverExtractor(appConfig)
+		if err != nil {
+			startErr = err
+			return
+		}
+		processed = Append(processed, coverExtractorHandler, appConfig.Pipeline.Covers)
+	}
+
+	// Stage 6: Insert processed audiobook information to database, one at a time to avoid competing writes
+	audiobookSinkHandler := NewAudiobookSink(appConfig, audiobookRepo, sourceFileRepo, p.eventBus)
+	pipeline := Append(processed, NewJobStage(audiobookSinkHandler, jobRepo, models.JobStageStored, func(a models.AudiobookProcessed) string {
+		return a.RelativePath
+	}), config.StageConfig{Workers: 1, BufferSize: config.DefaultStageBufferSize})
+
+	p.stageCommandPipelines = pipeline.commandChans
+	p.doneChans = pipeline.doneChans
+	p.gate = pipeline.gate
+	pipeline.Start(context, p.errChan)
+	go p.initCommandPipeline(context)
+
+	// Scan on filesystem events if possible and every ScanInterval otherwise
 	ticker := time.NewTicker(appConfig.ScanInterval)
+	defer ticker.Stop()
+	scanTicks := ticker.C
+	var libraryChanges <-chan struct{}
+	if libraryWatcher := WatchLibrary(context, appConfig); libraryWatcher != nil {
+		defer libraryWatcher.Close()
+		ticker.Stop()
+		scanTicks = nil
+		libraryChanges = libraryWatcher.Changes()
+	}
+	retries := newRetryTimer()
+	defer retries.stop()
+	retries.scheduleNext(context, sourceFileRepo, time.Now())
 	for {
 		select {
 		case <-context.Done():
 			return
 		case err := <-p.errChan:
+			// Errors only affect the audiobook they occurred for; the pipeline carries on with others
 			log.Println(err)
-			return
-		case <-ticker.C:
-			watcherPipelineStage.InputChan <- struct{}{}
-		case path := <-watcherPipelineStage.OutputChan:
-			metadataExtractorPipelineStage.InputChan <- path
-		case metaData := <-metadataExtractorPipelineStage.OutputChan:
-			chapterSplitterPipelineStage.InputChan <- metaData
-		case processedAudiobook := <-chapterSplitterPipelineStage.OutputChan:
-			audiobookSinkPipelineStage.InputChan <- processedAudiobook
-		case <-audiobookSinkPipelineStage.OutputChan:
+			var sourceErr *SourceError
+			if !errors.As(err, &sourceErr) {
+				continue
+			}
+			p.eventBus.Publish(events.Event{Type: events.TypeFailed, SourcePath: sourceErr.RelativePath, Message: sourceErr.Error()})
+			if err := jobRepo.FailJob(context, sourceErr.RelativePath, sourceErr.Error()); err != nil && !errors.Is(err, repo.ErrNotFound) {
+				log.Println(err)
+			}
+			retryAt, retrying, err := RecordSourceFailure(context, appConfig, sourceFileRepo, sourceErr, time.Now())
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+			if retrying {
+				retries.schedule(retryAt)
+			}
+		case <-retries.timer.C:
+			// Due sources are sent down the pipeline again by the next scan
+			retries.fired()
+			requestScan(pipeline.InputChan)
+			retries.scheduleNext(context, sourceFileRepo, time.Now())
+		case <-scanTicks:
+			requestScan(pipeline.InputChan)
+		case _, ok := <-libraryChanges:
+			if !ok {
+				log.Printf("Watching %s for changes stopped; scanning every %s instead", appConfig.AudiobookDirectory, appConfig.ScanInterval)
+				libraryChanges = nil
+				ticker.Reset(appConfig.ScanInterval)
+				scanTicks = ticker.C
+				continue
+			}
+			requestScan(pipeline.InputChan)
+		case <-pipeline.OutputChan:
 			continue
 		}
 	}
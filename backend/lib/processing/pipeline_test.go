@@ -2,10 +2,17 @@ package processing_test
 
 import (
 	"context"
+	"errors"
 	"log"
+	"os"
+	"path/filepath"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/bongofriend/bookplayer/backend/lib/config"
+	"github.com/bongofriend/bookplayer/backend/lib/data/repo"
+	"github.com/bongofriend/bookplayer/backend/lib/models"
 	"github.com/bongofriend/bookplayer/backend/lib/processing"
 )
 
@@ -101,7 +108,176 @@ func TestPipelineStageProcessCommand(t *testing.T) {
 	}
 }
 
+// Blocks every input until released to observe how many are processed at the same time
+type blockingPipelineHandler struct {
+	mockPipelineHandler
+	active  atomic.Int32
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingPipelineHandler) ProcessInput(input struct{}, output chan struct{}) error {
+	b.active.Add(1)
+	b.started <- struct{}{}
+	<-b.release
+	output <- struct{}{}
+	return nil
+}
+
+func TestConcurrentPipelineStage(t *testing.T) {
+	handler := &blockingPipelineHandler{
+		started: make(chan struct{}, 5),
+		release: make(chan struct{}),
+	}
+	stage := processing.NewConcurrentPipelineStage[struct{}, struct{}](handler, config.StageConfig{Workers: 3, BufferSize: 5})
+	context, cancel := context.WithCancel(context.Background())
+	errChan := make(chan error)
+	go stage.Start(context, errChan)
+
+	// Buffered inputs do not wait for a worker
+	for i := 0; i < 5; i++ {
+		stage.InputChan <- struct{}{}
+	}
+	for i := 0; i < 3; i++ {
+		select {
+		case <-handler.started:
+		case <-time.After(time.Second):
+			t.Fatalf("Expected 3 inputs to be processed at the same time; %d started", i)
+		}
+	}
+	select {
+	case <-handler.started:
+		t.Fatal("Expected no more than 3 inputs to be processed at the same time")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(handler.release)
+	for i := 0; i < 5; i++ {
+		<-stage.OutputChan
+	}
+	cancel()
+	<-stage.DoneChan
+
+	if handler.active.Load() != 5 {
+		t.Fatalf("Expected 5 processed inputs; received: %d", handler.active.Load())
+	}
+	if !handler.IsShutdown {
+		t.Fatal("PipelineComponent did not shutdown properly")
+	}
+}
+
 // TODO Implement
 func TestAudiobookProcessingPipeline(t *testing.T) {
 	t.SkipNow()
 }
+
+type failingAudiobookRepository struct {
+	audiobookMockRepository
+}
+
+func (f *failingAudiobookRepository) UpsertAudiobook(context context.Context, audiobook models.AudiobookProcessed) (int64, error) {
+	return 0, errors.New("database is locked")
+}
+
+func TestPipelineStageSourceError(t *testing.T) {
+	testConfig := config.Config{MaxAttempts: 3, RetryBackoff: time.Minute}
+	sourceRepo := newSourceFileMockRepository()
+	sourceRepo.SaveSourceFiles(context.Background(), "Dune", []models.SourceFile{{Path: "Dune/Dune.m4b"}})
+	sink := processing.NewPipelineStage(processing.NewAudiobookSink(config.Config{}, &failingAudiobookRepository{}, sourceRepo, nil))
+	context, cancel := context.WithCancel(context.Background())
+	errChan := make(chan error)
+	go sink.Start(context, errChan)
+	go func() {
+		<-sink.OutputChan
+	}()
+
+	sink.InputChan <- models.AudiobookProcessed{RelativePath: "Dune"}
+	err := <-errChan
+	cancel()
+	<-sink.DoneChan
+
+	// Start records errors of a single source and carries on with others
+	var sourceErr *processing.SourceError
+	if !errors.As(err, &sourceErr) {
+		t.Fatalf("Expected source error; received: %v", err)
+	}
+	if _, retrying, err := processing.RecordSourceFailure(context, testConfig, sourceRepo, sourceErr, time.Now()); err != nil || !retrying {
+		t.Fatalf("Expected source to be retried; error: %v", err)
+	}
+	if f := sourceRepo.files["Dune/Dune.m4b"]; f.Status != models.SourceStatusFailed || f.FailedStage != processing.StageSink || f.LastError != "database is locked" {
+		t.Fatalf("Unexpected source file %+v", f)
+	}
+}
+
+func TestPipelineDispatchCommand(t *testing.T) {
+	pipeline := processing.NewPipeline(nil)
+	if _, err := pipeline.DispatchCommand(context.Background(), "defragment", ""); err == nil {
+		t.Fatal("Expected error for unknown command")
+	}
+	// Not started, so nothing receives the command
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := pipeline.DispatchCommand(canceled, models.CommandScan, ""); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled; received: %v", err)
+	}
+	command, err := pipeline.GetCommand(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if command.Type != models.CommandScan || command.State != models.CommandStateFailed {
+		t.Fatalf("Unexpected command %+v", command)
+	}
+	if _, err := pipeline.GetCommand(2); !errors.Is(err, repo.ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound; received: %v", err)
+	}
+}
+
+// A file in place of the library directory fails the pipeline right at the start
+func brokenLibraryConfig(t *testing.T) config.Config {
+	testDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(testDir, "library"), []byte{}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return config.Config{
+		AudiobookDirectory:   filepath.Join(testDir, "library", "audiobooks"),
+		ApplicationDirectory: testDir,
+	}
+}
+
+func TestPipelineStartFailure(t *testing.T) {
+	pipeline := processing.NewPipeline(nil)
+	doneChan := make(chan error)
+	go pipeline.Start(context.Background(), brokenLibraryConfig(t), doneChan, nil, nil, nil, nil)
+	select {
+	case err := <-doneChan:
+		if err == nil {
+			t.Fatal("Expected error of failed stage to be reported")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Pipeline with a failing stage did not stop")
+	}
+}
+
+func TestPipelineDispatchCommandAfterShutdown(t *testing.T) {
+	pipeline := processing.NewPipeline(nil)
+	doneChan := make(chan error)
+	go pipeline.Start(context.Background(), brokenLibraryConfig(t), doneChan, nil, nil, nil, nil)
+	<-doneChan
+
+	dispatched := make(chan error)
+	go func() {
+		_, err := pipeline.DispatchCommand(context.Background(), models.CommandScan, "")
+		dispatched <- err
+	}()
+	select {
+	case err := <-dispatched:
+		if !errors.Is(err, processing.ErrPipelineStopped) {
+			t.Fatalf("Expected ErrPipelineStopped; received: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Dispatching a command to a stopped pipeline did not return")
+	}
+	if command, err := pipeline.GetCommand(1); err != nil || command.State != models.CommandStateFailed {
+		t.Fatalf("Expected failed command; received: %+v, %v", command, err)
+	}
+}
@@ -0,0 +1,146 @@
+package processing
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bongofriend/bookplayer/backend/lib/models"
+	"github.com/bongofriend/bookplayer/backend/lib/transcode"
+)
+
+// Files recorded in the database grouped by source
+func groupBySource(files []models.SourceFile) map[string][]models.SourceFile {
+	groups := make(map[string][]models.SourceFile)
+	for _, f := range files {
+		groups[f.SourcePath] = append(groups[f.SourcePath], f)
+	}
+	return groups
+}
+
+// Identify the content of a source independent of its location
+func contentKey(files []models.SourceFile) string {
+	hashes := make([]string, len(files))
+	for idx, f := range files {
+		hashes[idx] = f.Hash
+	}
+	slices.Sort(hashes)
+	return strings.Join(hashes, "\n")
+}
+
+func linkedAudiobook(files []models.SourceFile) int64 {
+	for _, f := range files {
+		if f.AudiobookId != 0 {
+			return f.AudiobookId
+		}
+	}
+	return 0
+}
+
+/*
+Link source to an existing audiobook instead of processing it again. This is the case if source reappeared unchanged
+after it went missing, or if it has the same content as a missing source and was therefore renamed or moved
+*/
+func (d *DirectoryWatcher) relinkSource(context context.Context, source AudiobookSource, files []models.SourceFile, changed bool, known map[string][]models.SourceFile, missing map[string][]models.SourceFile) (bool, error) {
+	if previous, ok := known[source.RelativePath]; ok {
+		audiobookId := linkedAudiobook(previous)
+		if changed || audiobookId == 0 || previous[0].Status != models.SourceStatusMissing {
+			return false, nil
+		}
+		log.Printf("%s is back in the library", source.RelativePath)
+		return true, d.sourceFileRepo.RelinkSource(context, source.RelativePath, source.RelativePath, audiobookId, files)
+	}
+	key := contentKey(files)
+	for sourcePath, missingFiles := range missing {
+		audiobookId := linkedAudiobook(missingFiles)
+		if audiobookId == 0 || contentKey(missingFiles) != key {
+			continue
+		}
+		log.Printf("%s was moved to %s", sourcePath, source.RelativePath)
+		delete(missing, sourcePath)
+		return true, d.sourceFileRepo.RelinkSource(context, sourcePath, source.RelativePath, audiobookId, files)
+	}
+	return false, nil
+}
+
+// Mark audiobooks of sources that are gone as missing and forget sources that never made it into the library
+func (d *DirectoryWatcher) markMissingSources(context context.Context, missing map[string][]models.SourceFile, now time.Time) error {
+	for sourcePath, files := range missing {
+		if linkedAudiobook(files) == 0 {
+			if err := d.sourceFileRepo.DeleteSource(context, sourcePath); err != nil {
+				return err
+			}
+			continue
+		}
+		if files[0].Status == models.SourceStatusMissing {
+			continue
+		}
+		log.Printf("%s is missing from the library", sourcePath)
+		if err := d.sourceFileRepo.MarkSourceMissing(context, sourcePath, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete audiobooks missing for longer than MissingGracePeriod together with their processed files
+func (d *DirectoryWatcher) purgeMissingAudiobooks(context context.Context, now time.Time) error {
+	audiobooks, err := d.audiobookRepo.GetMissingAudiobooks(context, now.Add(-d.config.MissingGracePeriod))
+	if err != nil {
+		return err
+	}
+	for _, a := range audiobooks {
+		log.Printf("Purging %s after its source was missing since %s", a.Title, a.MissingSince.Format(time.RFC3339))
+		removeProcessedFiles(d.config.ProcessedAudiobookPath, processedFiles(a))
+		removeProcessedFiles(d.config.TranscodedChapterPath, transcode.CachedPaths(d.config, processedFiles(a)))
+		if err := d.audiobookRepo.DeleteAudiobook(context, a.Id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Chapter and image files of an audiobook
+func processedFiles(a models.AudiobookProcessed) []string {
+	paths := []string{}
+	for _, ch := range a.ProcessedChapters {
+		paths = append(paths, ch.FilePath)
+	}
+	for _, image := range a.Images {
+		paths = append(paths, image.FilePath)
+	}
+	return paths
+}
+
+// Remove files and the folders left empty; files outside of root are never touched
+func removeProcessedFiles(root string, paths []string) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	directories := []string{}
+	for _, p := range paths {
+		abs, err := filepath.Abs(p)
+		if err != nil || !strings.HasPrefix(abs, root+string(filepath.Separator)) {
+			log.Printf("Not removing %s outside of %s", p, root)
+			continue
+		}
+		if err := os.Remove(abs); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Println(err)
+		}
+		if dir := filepath.Dir(abs); dir != root && !slices.Contains(directories, dir) {
+			directories = append(directories, dir)
+		}
+	}
+	for _, dir := range directories {
+		// Stops at the first folder still holding files of other audiobooks
+		for ; dir != root && os.Remove(dir) == nil; dir = filepath.Dir(dir) {
+		}
+	}
+}
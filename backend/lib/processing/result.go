@@ -2,9 +2,27 @@ package processing
 
 import "github.com/bongofriend/bookplayer/backend/lib/models"
 
+// Audiobook found by DirectoryWatcher
+type AudiobookSource struct {
+	// Audio file or directory of audio files
+	Path string
+	// Path relative to the library root; stable if the library is moved
+	RelativePath string
+	// Audio files of the audiobook in playback order; a single file for chaptered containers like m4b
+	Files []string
+}
+
+// Whether the audiobook consists of one file per chapter
+func (s AudiobookSource) IsMultiFile() bool {
+	return len(s.Files) > 1
+}
+
 type AudiobookMetadataResult struct {
-	Audiobook models.Audiobook
-	FilePath  string
+	Audiobook    models.Audiobook
+	FilePath     string
+	RelativePath string
+	// Audio files of the audiobook; for multi-file audiobooks Files[i] holds chapter i
+	Files []string
 }
 
 type AudiobookChapterSplitResult struct {
@@ -0,0 +1,105 @@
+package processing
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/bongofriend/bookplayer/backend/lib/config"
+	"github.com/bongofriend/bookplayer/backend/lib/data/repo"
+	"github.com/bongofriend/bookplayer/backend/lib/models"
+	"github.com/sethvargo/go-retry"
+)
+
+const maxRetryDelay = 24 * time.Hour
+
+// Delay before retrying a source that failed the given number of times
+func retryDelay(c config.Config, attempts int) time.Duration {
+	backoff := retry.WithCappedDuration(maxRetryDelay, retry.NewExponential(c.RetryBackoff))
+	delay := c.RetryBackoff
+	for idx := 0; idx < attempts; idx++ {
+		delay, _ = backoff.Next()
+	}
+	return delay
+}
+
+/*
+Record a failed attempt to process a source. Returns when it is retried, or false if it failed
+MaxAttempts times and is quarantined
+*/
+func RecordSourceFailure(context context.Context, c config.Config, sourceFileRepo repo.SourceFileRepository, sourceErr *SourceError, now time.Time) (time.Time, bool, error) {
+	files, err := sourceFileRepo.GetSourceFiles(context, sourceErr.RelativePath)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	if len(files) == 0 {
+		return time.Time{}, false, nil
+	}
+	failure := models.SourceFailure{
+		Stage:    sourceErr.Stage,
+		Error:    sourceErr.Err.Error(),
+		Attempts: files[0].Attempts + 1,
+	}
+	if failure.Attempts < c.MaxAttempts {
+		retryAt := now.Add(retryDelay(c, failure.Attempts))
+		failure.RetryAt = &retryAt
+	}
+	if err := sourceFileRepo.RecordSourceFailure(context, sourceErr.RelativePath, failure); err != nil {
+		return time.Time{}, false, err
+	}
+	if failure.RetryAt == nil {
+		log.Printf("Quarantined %s after %d failed attempts", sourceErr.RelativePath, failure.Attempts)
+		return time.Time{}, false, nil
+	}
+	return *failure.RetryAt, true, nil
+}
+
+// Timer firing when the earliest scheduled retry is due
+type retryTimer struct {
+	timer *time.Timer
+	next  time.Time
+}
+
+func newRetryTimer() *retryTimer {
+	timer := time.NewTimer(maxRetryDelay)
+	timer.Stop()
+	return &retryTimer{timer: timer}
+}
+
+// Fire at retryAt unless an earlier retry is already scheduled
+func (t *retryTimer) schedule(retryAt time.Time) {
+	if !t.next.IsZero() && !retryAt.Before(t.next) {
+		return
+	}
+	t.stop()
+	t.next = retryAt
+	t.timer.Reset(time.Until(retryAt))
+}
+
+// Schedule the earliest retry after now recorded in the database, e.g. after a restart or once a retry fired
+func (t *retryTimer) scheduleNext(context context.Context, sourceFileRepo repo.SourceFileRepository, now time.Time) {
+	retryAt, err := sourceFileRepo.GetNextSourceRetry(context, now)
+	if err != nil {
+		if !errors.Is(err, repo.ErrNotFound) {
+			log.Println(err)
+		}
+		return
+	}
+	t.schedule(retryAt)
+}
+
+// Called after receiving from C
+func (t *retryTimer) fired() {
+	t.next = time.Time{}
+}
+
+func (t *retryTimer) stop() {
+	if !t.timer.Stop() {
+		select {
+		case <-t.timer.C:
+		default:
+		}
+	}
+	t.next = time.Time{}
+}
@@ -0,0 +1,94 @@
+package processing_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bongofriend/bookplayer/backend/lib/config"
+	"github.com/bongofriend/bookplayer/backend/lib/models"
+	"github.com/bongofriend/bookplayer/backend/lib/processing"
+)
+
+func TestRecordSourceFailure(t *testing.T) {
+	testConfig := config.Config{MaxAttempts: 3, RetryBackoff: time.Minute}
+	sourceFileRepo := newSourceFileMockRepository()
+	sourceFileRepo.files["broken.m4b"] = models.SourceFile{Path: "broken.m4b", SourcePath: "broken.m4b", Status: models.SourceStatusPending}
+	sourceErr := &processing.SourceError{RelativePath: "broken.m4b", Stage: processing.StageMetadata, Err: errors.New("invalid data")}
+	now := time.Now()
+
+	expectedDelays := []time.Duration{time.Minute, 2 * time.Minute}
+	for idx, delay := range expectedDelays {
+		retryAt, retrying, err := processing.RecordSourceFailure(context.Background(), testConfig, sourceFileRepo, sourceErr, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !retrying || !retryAt.Equal(now.Add(delay)) {
+			t.Fatalf("Expected retry of attempt %d after %s; received: %s", idx+1, delay, retryAt.Sub(now))
+		}
+	}
+	file := sourceFileRepo.files["broken.m4b"]
+	if file.Status != models.SourceStatusFailed || file.Attempts != 2 || file.FailedStage != processing.StageMetadata || file.LastError != "invalid data" {
+		t.Fatalf("Unexpected source file %+v", file)
+	}
+
+	if _, retrying, err := processing.RecordSourceFailure(context.Background(), testConfig, sourceFileRepo, sourceErr, now); err != nil || retrying {
+		t.Fatalf("Expected source to be quarantined; error: %v", err)
+	}
+	if file := sourceFileRepo.files["broken.m4b"]; file.Status != models.SourceStatusQuarantined || file.RetryAt != nil {
+		t.Fatalf("Unexpected source file %+v", file)
+	}
+}
+
+func TestDirectoryWatcherRetriesFailedSources(t *testing.T) {
+	testDir := t.TempDir()
+	testConfig := config.Config{
+		AudiobookDirectory:   path.Join(testDir, "audiobooks"),
+		ApplicationDirectory: testDir,
+		MaxAttempts:          2,
+		RetryBackoff:         time.Hour,
+	}
+	sourceFileRepo := newSourceFileMockRepository()
+	handler, err := processing.NewDirectoryWatcher(testConfig, sourceFileRepo, &audiobookMockRepository{data: map[int64]models.AudiobookProcessed{}}, newJobMockRepository(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(testConfig.AudiobookDirectory, "broken.m4b"), []byte("broken"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	scan := func() int {
+		outputChan := make(chan processing.AudiobookSource, 10)
+		if err := handler.ProcessInput(struct{}{}, outputChan); err != nil {
+			t.Fatal(err)
+		}
+		return len(outputChan)
+	}
+	sourceErr := &processing.SourceError{RelativePath: "broken.m4b", Stage: processing.StageChapters, Err: errors.New("ffmpeg failed")}
+	if count := scan(); count != 1 {
+		t.Fatalf("Expected 1 emission; received: %d", count)
+	}
+	if _, _, err := processing.RecordSourceFailure(context.Background(), testConfig, sourceFileRepo, sourceErr, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if count := scan(); count != 0 {
+		t.Fatalf("Expected no emission before retry is due; received: %d", count)
+	}
+
+	// Pretend the retry was scheduled two hours ago
+	if _, _, err := processing.RecordSourceFailure(context.Background(), config.Config{MaxAttempts: 3, RetryBackoff: time.Hour}, sourceFileRepo, sourceErr, time.Now().Add(-2*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if count := scan(); count != 1 {
+		t.Fatalf("Expected 1 emission for due retry; received: %d", count)
+	}
+	if _, _, err := processing.RecordSourceFailure(context.Background(), testConfig, sourceFileRepo, sourceErr, time.Now().Add(-2*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if count := scan(); count != 0 {
+		t.Fatalf("Expected no emission for quarantined source; received: %d", count)
+	}
+}
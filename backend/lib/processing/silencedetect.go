@@ -0,0 +1,145 @@
+package processing
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"math"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/bongofriend/bookplayer/backend/lib/config"
+	"github.com/bongofriend/bookplayer/backend/lib/models"
+)
+
+// Silence reported by ffmpeg's silencedetect filter, in seconds from the start of the file
+type Silence struct {
+	Start float64
+	End   float64
+}
+
+// Chapters start in the middle of a silence so neither side is cut off
+func (s Silence) middle() float64 {
+	return (s.Start + s.End) / 2
+}
+
+/*
+Parse the silences silencedetect logs as pairs of lines like
+"[silencedetect @ 0x55d0] silence_start: 1200.5" and "[silencedetect @ 0x55d0] silence_end: 1203.1 | silence_duration: 2.6".
+A silence lasting until the end of the file has no end and is left out
+*/
+func ParseSilencedetectOutput(output []byte) []Silence {
+	silences := []Silence{}
+	start := -1.0
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if value, ok := silenceValue(line, "silence_start:"); ok {
+			start = value
+		} else if value, ok := silenceValue(line, "silence_end:"); ok && start >= 0 {
+			silences = append(silences, Silence{Start: start, End: value})
+			start = -1
+		}
+	}
+	return silences
+}
+
+func silenceValue(line string, key string) (float64, bool) {
+	_, rest, found := strings.Cut(line, key)
+	if !found {
+		return 0, false
+	}
+	value, _, _ := strings.Cut(strings.TrimSpace(rest), " ")
+	seconds, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, false
+	}
+	return max(seconds, 0), true
+}
+
+/*
+Chapters of an audiobook lasting duration seconds, split at the silences closest to every targetLength seconds.
+Boundaries are only placed where the chapters before and after last at least half of targetLength; without a silence
+within half of targetLength around the ideal boundary, the next silence after it is used
+*/
+func ProposeChapters(silences []Silence, duration float64, targetLength float64) []models.Chapter {
+	boundaries := []float64{}
+	last := 0.0
+	next := 0
+	for targetLength > 0 && duration-last >= targetLength*1.5 && next < len(silences) {
+		ideal := last + targetLength
+		best := -1
+		for ; next < len(silences); next++ {
+			at := silences[next].middle()
+			if at < last+targetLength/2 {
+				continue
+			}
+			if at > ideal+targetLength/2 || duration-at < targetLength/2 {
+				break
+			}
+			if best < 0 || math.Abs(at-ideal) < math.Abs(silences[best].middle()-ideal) {
+				best = next
+			}
+		}
+		if best < 0 {
+			if next == len(silences) || duration-silences[next].middle() < targetLength/2 {
+				break
+			}
+			best = next
+		}
+		last = silences[best].middle()
+		boundaries = append(boundaries, last)
+		next = best + 1
+	}
+
+	chapters := make([]models.Chapter, len(boundaries)+1)
+	start := 0.0
+	for idx := range chapters {
+		end := duration
+		if idx < len(boundaries) {
+			end = boundaries[idx]
+		}
+		chapters[idx] = models.Chapter{
+			ChapterCommon: models.ChapterCommon{
+				Title:        fmt.Sprintf("Chapter %d", idx+1),
+				StartTime:    float32(start),
+				EndTime:      float32(end),
+				Numbering:    idx,
+				AutoDetected: true,
+			},
+		}
+		start = end
+	}
+	return chapters
+}
+
+// Propose chapters for a file without chapter markers; nil if it is too short to be split
+func detectChapters(filePath string, duration float64, detection config.ChapterDetectionConfig) ([]models.Chapter, error) {
+	targetLength := detection.TargetChapterLength.Seconds()
+	if duration < targetLength*1.5 {
+		return nil, nil
+	}
+	args := []string{
+		"-hide_banner",
+		"-nostats",
+		"-i",
+		filePath,
+		"-vn",
+		"-af",
+		fmt.Sprintf("silencedetect=noise=%gdB:d=%g", detection.SilenceThreshold, detection.MinSilence.Seconds()),
+		"-f",
+		"null",
+		"-",
+	}
+	// silencedetect logs to stderr
+	output, err := exec.Command("ffmpeg", args...).CombinedOutput()
+	if err != nil {
+		return nil, err
+	}
+	chapters := ProposeChapters(ParseSilencedetectOutput(output), duration, targetLength)
+	if len(chapters) < 2 {
+		return nil, nil
+	}
+	return chapters, nil
+}
@@ -0,0 +1,63 @@
+package processing_test
+
+import (
+	"testing"
+
+	"github.com/bongofriend/bookplayer/backend/lib/processing"
+)
+
+func TestParseSilencedetectOutput(t *testing.T) {
+	output := []byte(`Input #0, mp3, from 'book.mp3':
+  Duration: 02:10:04.13, start: 0.025057, bitrate: 64 kb/s
+[silencedetect @ 0x55d0c8f0a2c0] silence_start: 1198.52
+[silencedetect @ 0x55d0c8f0a2c0] silence_end: 1201.48 | silence_duration: 2.96
+[silencedetect @ 0x55d0c8f0a2c0] silence_start: 2405
+[silencedetect @ 0x55d0c8f0a2c0] silence_end: 2408 | silence_duration: 3
+[silencedetect @ 0x55d0c8f0a2c0] silence_start: 7800.1
+size=N/A time=02:10:04.13 bitrate=N/A speed= 512x
+`)
+	silences := processing.ParseSilencedetectOutput(output)
+	expected := []processing.Silence{{Start: 1198.52, End: 1201.48}, {Start: 2405, End: 2408}}
+	if len(silences) != len(expected) {
+		t.Fatalf("Expected %d silences; received: %+v", len(expected), silences)
+	}
+	for idx, s := range silences {
+		if s != expected[idx] {
+			t.Fatalf("Expected silence %+v; received: %+v", expected[idx], s)
+		}
+	}
+}
+
+func TestProposeChapters(t *testing.T) {
+	t.Run("should split at silences closest to target length", func(t *testing.T) {
+		silences := []processing.Silence{{Start: 300, End: 302}, {Start: 1100, End: 1102}, {Start: 1190, End: 1192}, {Start: 2500, End: 2502}, {Start: 3500, End: 3502}}
+		chapters := processing.ProposeChapters(silences, 3600, 1200)
+		expected := [][2]float32{{0, 1191}, {1191, 2501}, {2501, 3600}}
+		if len(chapters) != len(expected) {
+			t.Fatalf("Expected %d chapters; received: %+v", len(expected), chapters)
+		}
+		for idx, ch := range chapters {
+			if ch.StartTime != expected[idx][0] || ch.EndTime != expected[idx][1] {
+				t.Fatalf("Unexpected boundaries of chapter %d: %+v", idx, ch)
+			}
+			if ch.Numbering != idx || !ch.AutoDetected {
+				t.Fatalf("Unexpected chapter %+v", ch)
+			}
+		}
+		if chapters[1].Title != "Chapter 2" {
+			t.Fatalf("Unexpected title %s", chapters[1].Title)
+		}
+	})
+	t.Run("should fall back to next silence after target length", func(t *testing.T) {
+		chapters := processing.ProposeChapters([]processing.Silence{{Start: 2000, End: 2004}}, 4000, 1200)
+		if len(chapters) != 2 || chapters[0].EndTime != 2002 {
+			t.Fatalf("Unexpected chapters %+v", chapters)
+		}
+	})
+	t.Run("should keep short audiobook in one chapter", func(t *testing.T) {
+		chapters := processing.ProposeChapters([]processing.Silence{{Start: 600, End: 602}}, 1500, 1200)
+		if len(chapters) != 1 || chapters[0].StartTime != 0 || chapters[0].EndTime != 1500 {
+			t.Fatalf("Unexpected chapters %+v", chapters)
+		}
+	})
+}
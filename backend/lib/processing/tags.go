@@ -0,0 +1,89 @@
+package processing
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	// Separators between entries of multi-valued tags like "Stephen Fry; Jim Dale"
+	listSeparator = regexp.MustCompile(`\s*[;/]\s*`)
+	// Separators which may also be part of a single name like "Fry, Stephen" or "Simon & Schuster"
+	nameSeparator = regexp.MustCompile(`\s*[,&]\s*|\s+(?i:and)\s+`)
+	// Genres like "Science Fiction & Fantasy" or "Children and Young Adults" are only split on punctuation
+	genreSeparator = regexp.MustCompile(`\s*[;/,]\s*`)
+	// Series with optional position like "Discworld, Book 5" or "The Expanse #2.5"
+	seriesWithPosition = regexp.MustCompile(`^(.+?)(?:\s*[,:\-]?\s*(?i:book|vol\.?|volume|part|#)\s*(\d+(?:\.\d+)?))?\s*$`)
+)
+
+// Split a tag into its individual names, dropping duplicates and empty entries
+func splitNames(value string) []string {
+	names := []string{}
+	for _, entry := range listSeparator.Split(value, -1) {
+		names = append(names, splitEntry(entry)...)
+	}
+	return uniqueNames(names)
+}
+
+// Split a tag into its individual genres, dropping duplicates and empty entries
+func splitGenres(value string) []string {
+	return uniqueNames(genreSeparator.Split(value, -1))
+}
+
+// Names in entry like "Stephen Fry & Jim Dale", kept as a whole unless every part is a full name on its own
+func splitEntry(entry string) []string {
+	parts := nameSeparator.Split(entry, -1)
+	for _, part := range parts {
+		if !isFullName(part) {
+			return []string{entry}
+		}
+	}
+	return parts
+}
+
+// At least two words not ending in an initial, ruling out parts of "Fry, Stephen" or "Le Guin, Ursula K."
+func isFullName(name string) bool {
+	words := strings.Fields(name)
+	if len(words) < 2 {
+		return false
+	}
+	last := words[len(words)-1]
+	return len(last) > 1 && !strings.HasSuffix(last, ".")
+}
+
+func uniqueNames(values []string) []string {
+	names := []string{}
+	seen := map[string]bool{}
+	for _, name := range values {
+		name = strings.TrimSpace(name)
+		key := strings.ToLower(name)
+		if len(name) == 0 || seen[key] {
+			continue
+		}
+		seen[key] = true
+		names = append(names, name)
+	}
+	return names
+}
+
+/*
+Series name and position from series/series-part tags,
+falling back to grouping which is commonly used for series by audiobook tools
+*/
+func parseSeries(tags Tags) (string, string) {
+	series, position := strings.TrimSpace(tags.Series), strings.TrimSpace(tags.SeriesPart)
+	if len(series) == 0 {
+		series = strings.TrimSpace(tags.Grouping)
+	}
+	if len(series) == 0 {
+		return "", ""
+	}
+	if len(position) > 0 {
+		return series, position
+	}
+	match := seriesWithPosition.FindStringSubmatch(series)
+	if match == nil {
+		return series, ""
+	}
+	return strings.TrimSpace(match[1]), match[2]
+}
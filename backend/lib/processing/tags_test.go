@@ -0,0 +1,96 @@
+package processing_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/bongofriend/bookplayer/backend/lib/processing"
+)
+
+func TestMetadataTagParsing(t *testing.T) {
+	t.Run("should split multi-valued tags", func(t *testing.T) {
+		metadata := processing.AudiobookMetadata{
+			Format: processing.Format{
+				Duration: "120.5",
+				Tags: processing.Tags{
+					Title:    "Harry Potter and the Philosopher's Stone",
+					Artist:   "J. K. Rowling",
+					Composer: "Stephen Fry; Jim Dale & Stephen Fry",
+					Genre:    "Fantasy, Children and Young Adults",
+				},
+			},
+		}
+		model, err := metadata.AsModel()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(model.Authors, []string{"J. K. Rowling"}) {
+			t.Fatalf("Unexpected authors %v", model.Authors)
+		}
+		if !slices.Equal(model.Narrators, []string{"Stephen Fry", "Jim Dale"}) {
+			t.Fatalf("Unexpected narrators %v", model.Narrators)
+		}
+		if !slices.Equal(model.Genres, []string{"Fantasy", "Children and Young Adults"}) {
+			t.Fatalf("Unexpected genres %v", model.Genres)
+		}
+		if model.Narrator != "Stephen Fry, Jim Dale" {
+			t.Fatalf("Unexpected narrator %s", model.Narrator)
+		}
+	})
+	t.Run("should keep names containing separators", func(t *testing.T) {
+		cases := []struct {
+			tags      processing.Tags
+			authors   []string
+			narrators []string
+			genres    []string
+		}{
+			{processing.Tags{Artist: "Fry, Stephen", Composer: "Dale, Jim"}, []string{"Fry, Stephen"}, []string{"Dale, Jim"}, []string{}},
+			{processing.Tags{Artist: "Tolkien, J.R.R.", Composer: "Simon & Schuster"}, []string{"Tolkien, J.R.R."}, []string{"Simon & Schuster"}, []string{}},
+			{processing.Tags{Artist: "Le Guin, Ursula K.", Composer: "Fry, Stephen / Dale, Jim"}, []string{"Le Guin, Ursula K."}, []string{"Fry, Stephen", "Dale, Jim"}, []string{}},
+			{processing.Tags{Artist: "Terry Pratchett and Neil Gaiman", Genre: "Science Fiction & Fantasy/Horror"}, []string{"Terry Pratchett", "Neil Gaiman"}, []string{}, []string{"Science Fiction & Fantasy", "Horror"}},
+		}
+		for _, c := range cases {
+			metadata := processing.AudiobookMetadata{Format: processing.Format{Duration: "1", Tags: c.tags}}
+			model, err := metadata.AsModel()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(model.Authors, c.authors) || !slices.Equal(model.Narrators, c.narrators) || !slices.Equal(model.Genres, c.genres) {
+				t.Fatalf("Expected %v/%v/%v; received: %v/%v/%v", c.authors, c.narrators, c.genres, model.Authors, model.Narrators, model.Genres)
+			}
+		}
+	})
+	t.Run("should read series from tags", func(t *testing.T) {
+		cases := []struct {
+			tags     processing.Tags
+			series   string
+			position string
+		}{
+			{processing.Tags{Series: "Discworld", SeriesPart: "5"}, "Discworld", "5"},
+			{processing.Tags{Grouping: "The Expanse, Book 2.5"}, "The Expanse", "2.5"},
+			{processing.Tags{Grouping: "Mistborn #3"}, "Mistborn", "3"},
+			{processing.Tags{Grouping: "Standalone"}, "Standalone", ""},
+			{processing.Tags{}, "", ""},
+		}
+		for _, c := range cases {
+			metadata := processing.AudiobookMetadata{Format: processing.Format{Duration: "1", Tags: c.tags}}
+			model, err := metadata.AsModel()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if model.Series != c.series || model.SeriesPosition != c.position {
+				t.Fatalf("Expected %q/%q; received: %q/%q", c.series, c.position, model.Series, model.SeriesPosition)
+			}
+		}
+	})
+	t.Run("should fall back to album artist", func(t *testing.T) {
+		metadata := processing.AudiobookMetadata{Format: processing.Format{Duration: "1", Tags: processing.Tags{AlbumArtist: "Sun Tzu"}}}
+		model, err := metadata.AsModel()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if model.Author != "Sun Tzu" {
+			t.Fatalf("Unexpected author %s", model.Author)
+		}
+	})
+}
@@ -0,0 +1,89 @@
+package processing
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"os"
+
+	"github.com/bongofriend/bookplayer/backend/lib/models"
+)
+
+const thumbnailQuality = 85
+
+// Longest edge in pixels of each generated thumbnail
+var thumbnailSizes = map[string]int{
+	models.ImageKindSmall:  160,
+	models.ImageKindMedium: 480,
+}
+
+// Flatten img onto an opaque white background so transparent covers look sane as JPEG
+func flattenImage(img image.Image) *image.RGBA {
+	bounds := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), img, bounds.Min, draw.Over)
+	return dst
+}
+
+// Dimensions fitting width x height into a square of maxSize while keeping the aspect ratio; never upscales
+func thumbnailDimensions(width int, height int, maxSize int) (int, int) {
+	if width <= maxSize && height <= maxSize {
+		return width, height
+	}
+	if width >= height {
+		return maxSize, max(1, height*maxSize/width)
+	}
+	return max(1, width*maxSize/height), maxSize
+}
+
+/*
+Scale img down to width x height by averaging all source pixels covered by each target pixel.
+Good enough for cover art and does not need anything beyond the standard library
+*/
+func resizeImage(img image.Image, width int, height int) *image.RGBA {
+	src := flattenImage(img)
+	srcWidth, srcHeight := src.Bounds().Dx(), src.Bounds().Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0 := y * srcHeight / height
+		y1 := max(y0+1, (y+1)*srcHeight/height)
+		for x := 0; x < width; x++ {
+			x0 := x * srcWidth / width
+			x1 := max(x0+1, (x+1)*srcWidth/width)
+			var r, g, b, count int
+			for sy := y0; sy < y1; sy++ {
+				offset := src.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					r += int(src.Pix[offset])
+					g += int(src.Pix[offset+1])
+					b += int(src.Pix[offset+2])
+					offset += 4
+					count++
+				}
+			}
+			d := dst.PixOffset(x, y)
+			dst.Pix[d] = uint8(r / count)
+			dst.Pix[d+1] = uint8(g / count)
+			dst.Pix[d+2] = uint8(b / count)
+			dst.Pix[d+3] = 0xff
+		}
+	}
+	return dst
+}
+
+// Write a JPEG thumbnail of img with its longest edge limited to maxSize; returns the actual dimensions
+func writeThumbnail(img image.Image, p string, maxSize int) (int, int, error) {
+	width, height := thumbnailDimensions(img.Bounds().Dx(), img.Bounds().Dy(), maxSize)
+	thumbnail := resizeImage(img, width, height)
+	file, err := os.Create(p)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+	if err := jpeg.Encode(file, thumbnail, &jpeg.Options{Quality: thumbnailQuality}); err != nil {
+		return 0, 0, err
+	}
+	return width, height, file.Close()
+}
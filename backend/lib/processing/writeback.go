@@ -0,0 +1,131 @@
+package processing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/bongofriend/bookplayer/backend/lib/models"
+)
+
+// Containers ffmpeg can write tags and chapters into without re-encoding
+var writableContainers = map[string]bool{
+	".m4b": true,
+	".m4a": true,
+	".mp4": true,
+	".mp3": true,
+}
+
+// Escape characters with a meaning in ffmetadata files
+var ffmetadataEscaper = strings.NewReplacer(`\`, `\\`, "=", `\=`, ";", `\;`, "#", `\#`, "\n", "\\\n")
+
+/*
+Tags and chapters of audiobook in ffmpeg's metadata file format. The series is written as grouping,
+from which the metadata extractor reads it again
+*/
+func FfmetadataFile(audiobook models.AudiobookProcessed) string {
+	var b strings.Builder
+	b.WriteString(";FFMETADATA1\n")
+	writeTag := func(key string, value string) {
+		if len(value) > 0 {
+			fmt.Fprintf(&b, "%s=%s\n", key, ffmetadataEscaper.Replace(value))
+		}
+	}
+	writeTag("title", audiobook.Title)
+	writeTag("album", audiobook.Title)
+	writeTag("artist", audiobook.Author)
+	writeTag("album_artist", audiobook.Author)
+	writeTag("composer", audiobook.Narrator)
+	writeTag("genre", audiobook.Genre)
+	writeTag("comment", audiobook.Description)
+	if len(audiobook.Series) > 0 && len(audiobook.SeriesPosition) > 0 {
+		writeTag("grouping", audiobook.Series+" #"+audiobook.SeriesPosition)
+	} else {
+		writeTag("grouping", audiobook.Series)
+	}
+	for _, ch := range audiobook.ProcessedChapters {
+		b.WriteString("\n[CHAPTER]\nTIMEBASE=1/1000\n")
+		fmt.Fprintf(&b, "START=%d\nEND=%d\n", milliseconds(ch.StartTime), milliseconds(ch.EndTime))
+		writeTag("title", ch.Title)
+	}
+	return b.String()
+}
+
+func milliseconds(seconds float32) int64 {
+	return int64(math.Round(float64(seconds) * 1000))
+}
+
+/*
+Replace tags and chapters of the single file source with those of its audiobook as stored, including edits.
+The file is written next to the source under a hidden name, which scans skip, and only replaces it once complete
+*/
+func (d *DirectoryWatcher) writeBack(context context.Context, source AudiobookSource) error {
+	if len(source.Files) != 1 || source.Files[0] != source.Path {
+		return fmt.Errorf("%s is not a single file; tags can only be written back into single files", source.RelativePath)
+	}
+	ext := strings.ToLower(filepath.Ext(source.Path))
+	if !writableContainers[ext] {
+		return fmt.Errorf("tags cannot be written back into %s files", ext)
+	}
+	if !ffmpegIsAvailable() {
+		return errors.New("ffmpeg is not available")
+	}
+	audiobook, err := d.audiobookRepo.GetAudiobookBySource(context, source.RelativePath)
+	if err != nil {
+		return err
+	}
+
+	metadata, err := os.CreateTemp("", "ffmetadata-*.txt")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(metadata.Name())
+	if _, err := metadata.WriteString(FfmetadataFile(*audiobook)); err != nil {
+		metadata.Close()
+		return err
+	}
+	if err := metadata.Close(); err != nil {
+		return err
+	}
+
+	// Keeps the extension so ffmpeg picks the container of the source
+	tmp, err := os.CreateTemp(filepath.Dir(source.Path), ".writeback-*"+filepath.Ext(source.Path))
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	args := []string{
+		"-y",
+		"-v",
+		"error",
+		"-i",
+		source.Path,
+		"-f",
+		"ffmetadata",
+		"-i",
+		metadata.Name(),
+		"-map",
+		"0",
+		"-map_metadata",
+		"1",
+		"-map_chapters",
+		"1",
+		"-c",
+		"copy",
+		tmp.Name(),
+	}
+	if _, err := exec.Command("ffmpeg", args...).Output(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("writing tags into %s failed: %w", source.Path, err)
+	}
+	if err := os.Rename(tmp.Name(), source.Path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package processing_test
+
+import (
+	"testing"
+
+	"github.com/bongofriend/bookplayer/backend/lib/models"
+	"github.com/bongofriend/bookplayer/backend/lib/processing"
+)
+
+func TestFfmetadataFile(t *testing.T) {
+	audiobook := models.AudiobookProcessed{
+		AudiobookCommon: models.AudiobookCommon{
+			Title:          "The Art of War",
+			Author:         "Sun Tzu",
+			Narrator:       "Aidan Gillen",
+			Description:    "Ancient treatise; on strategy\nand tactics",
+			Series:         "Classics",
+			SeriesPosition: "1",
+		},
+		ProcessedChapters: []models.ProcessedChapter{
+			{ChapterCommon: models.ChapterCommon{Title: "Laying Plans", StartTime: 0, EndTime: 10.5, Numbering: 0}},
+			{ChapterCommon: models.ChapterCommon{Title: "Waging War = #2", StartTime: 10.5, EndTime: 30, Numbering: 1}},
+		},
+	}
+	expected := `;FFMETADATA1
+title=The Art of War
+album=The Art of War
+artist=Sun Tzu
+album_artist=Sun Tzu
+composer=Aidan Gillen
+comment=Ancient treatise\; on strategy\
+and tactics
+grouping=Classics \#1
+
+[CHAPTER]
+TIMEBASE=1/1000
+START=0
+END=10500
+title=Laying Plans
+
+[CHAPTER]
+TIMEBASE=1/1000
+START=10500
+END=30000
+title=Waging War \= \#2
+`
+	if metadata := processing.FfmetadataFile(audiobook); metadata != expected {
+		t.Fatalf("Unexpected metadata file:\n%s", metadata)
+	}
+}
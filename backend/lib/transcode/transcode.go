@@ -0,0 +1,184 @@
+package transcode
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/bongofriend/bookplayer/backend/lib/config"
+)
+
+type container struct {
+	// ffmpeg muxer, given explicitly as files are written under a temporary name
+	muxer       string
+	extension   string
+	contentType string
+}
+
+var containers = map[string]container{
+	"ogg": {muxer: "ogg", extension: ".opus", contentType: "audio/ogg"},
+	"mp3": {muxer: "mp3", extension: ".mp3", contentType: "audio/mpeg"},
+	"m4a": {muxer: "ipod", extension: ".m4a", contentType: "audio/mp4"},
+	"aac": {muxer: "adts", extension: ".aac", contentType: "audio/aac"},
+}
+
+var encoders = map[string]string{
+	config.CodecOpus: "libopus",
+	config.CodecMp3:  "libmp3lame",
+	config.CodecAac:  "aac",
+}
+
+func ContentType(profile config.TranscodingProfile) string {
+	return containers[profile.Container].contentType
+}
+
+// Arguments for transcoding the audio of inputPath with profile
+func Args(profile config.TranscodingProfile, inputPath string, outputPath string) []string {
+	args := []string{"-y", "-i", inputPath, "-vn", "-map_metadata", "0", "-c:a", encoders[profile.Codec]}
+	if profile.Bitrate > 0 {
+		args = append(args, "-b:a", fmt.Sprintf("%dk", profile.Bitrate))
+	}
+	if profile.Channels > 0 {
+		args = append(args, "-ac", strconv.Itoa(profile.Channels))
+	}
+	if profile.SampleRate > 0 {
+		args = append(args, "-ar", strconv.Itoa(profile.SampleRate))
+	}
+	if profile.Container == "m4a" {
+		// Index in front so playback can start before the whole file is loaded
+		args = append(args, "-movflags", "+faststart")
+	}
+	return append(args, "-f", containers[profile.Container].muxer, outputPath)
+}
+
+// Folder of the files transcoded with profile; changing the settings of a profile starts a new cache instead of serving files encoded with the old ones
+func cacheFolder(profile config.TranscodingProfile) string {
+	settings := fmt.Sprintf("%s:%s:%d:%d:%d", profile.Codec, profile.Container, profile.Bitrate, profile.SampleRate, profile.Channels)
+	hash := sha256.Sum256([]byte(settings))
+	return profile.Name + "-" + hex.EncodeToString(hash[:4])
+}
+
+// Where chapterPath transcoded with profile is cached; mirrors the location of the chapter in ProcessedAudiobookPath
+func CachePath(c config.Config, profile config.TranscodingProfile, chapterPath string) (string, error) {
+	rel, err := filepath.Rel(filepath.Clean(c.ProcessedAudiobookPath), filepath.Clean(chapterPath))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) || filepath.IsAbs(rel) {
+		return "", fmt.Errorf("%s is not a processed chapter", chapterPath)
+	}
+	return filepath.Join(c.TranscodedChapterPath, cacheFolder(profile), strings.TrimSuffix(rel, filepath.Ext(rel))+containers[profile.Container].extension), nil
+}
+
+// Cached files of chapterPaths for all profiles, e.g. to remove them along with their chapters
+func CachedPaths(c config.Config, chapterPaths []string) []string {
+	paths := []string{}
+	for _, profile := range c.Transcoding.Profiles {
+		for _, p := range chapterPaths {
+			if cachePath, err := CachePath(c, profile, p); err == nil {
+				paths = append(paths, cachePath)
+			}
+		}
+	}
+	return paths
+}
+
+// Transcodes chapters on demand into a cache, at most once at a time per file
+type Transcoder struct {
+	config  config.Config
+	mu      sync.Mutex
+	running map[string]*transcoding
+}
+
+type transcoding struct {
+	done chan struct{}
+	err  error
+}
+
+func NewTranscoder(c config.Config) *Transcoder {
+	return &Transcoder{
+		config:  c,
+		running: make(map[string]*transcoding),
+	}
+}
+
+func (t *Transcoder) Profile(name string) (config.TranscodingProfile, bool) {
+	for _, profile := range t.config.Transcoding.Profiles {
+		if profile.Name == name {
+			return profile, true
+		}
+	}
+	return config.TranscodingProfile{}, false
+}
+
+func (t *Transcoder) Profiles() []config.TranscodingProfile {
+	return t.config.Transcoding.Profiles
+}
+
+/*
+Path of chapterPath transcoded with profile; transcoded first unless cached since the chapter was last written.
+Canceling ctx only stops waiting; the transcoding is finished and cached for the next request
+*/
+func (t *Transcoder) Transcode(ctx context.Context, profile config.TranscodingProfile, chapterPath string) (string, error) {
+	cachePath, err := CachePath(t.config, profile, chapterPath)
+	if err != nil {
+		return "", err
+	}
+	chapter, err := os.Stat(chapterPath)
+	if err != nil {
+		return "", err
+	}
+	if cached, err := os.Stat(cachePath); err == nil && !cached.ModTime().Before(chapter.ModTime()) {
+		return cachePath, nil
+	}
+
+	t.mu.Lock()
+	run, ok := t.running[cachePath]
+	if !ok {
+		run = &transcoding{done: make(chan struct{})}
+		t.running[cachePath] = run
+		go t.run(run, profile, chapterPath, cachePath)
+	}
+	t.mu.Unlock()
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case <-run.done:
+		return cachePath, run.err
+	}
+}
+
+func (t *Transcoder) run(run *transcoding, profile config.TranscodingProfile, chapterPath string, cachePath string) {
+	defer func() {
+		t.mu.Lock()
+		delete(t.running, cachePath)
+		t.mu.Unlock()
+		close(run.done)
+	}()
+	run.err = transcodeFile(profile, chapterPath, cachePath)
+}
+
+// Transcode into a temporary file first so an interrupted run never leaves a partial file in the cache
+func transcodeFile(profile config.TranscodingProfile, chapterPath string, cachePath string) error {
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(cachePath), "."+filepath.Base(cachePath)+"-*")
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	if _, err := exec.Command("ffmpeg", Args(profile, chapterPath, tmp.Name())...).Output(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("transcoding %s with profile %s failed: %w", chapterPath, profile.Name, err)
+	}
+	if err := os.Rename(tmp.Name(), cachePath); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package transcode_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/bongofriend/bookplayer/backend/lib/config"
+	"github.com/bongofriend/bookplayer/backend/lib/transcode"
+)
+
+func TestArgs(t *testing.T) {
+	profile := config.TranscodingProfile{Name: "car", Codec: config.CodecAac, Container: "m4a", Bitrate: 64, Channels: 1, SampleRate: 22050}
+	args := transcode.Args(profile, "in.m4b", "out.tmp")
+	expected := []string{"-y", "-i", "in.m4b", "-vn", "-map_metadata", "0", "-c:a", "aac", "-b:a", "64k", "-ac", "1", "-ar", "22050", "-movflags", "+faststart", "-f", "ipod", "out.tmp"}
+	if !slices.Equal(args, expected) {
+		t.Fatalf("Unexpected arguments %v", args)
+	}
+	if contentType := transcode.ContentType(profile); contentType != "audio/mp4" {
+		t.Fatalf("Unexpected content type %s", contentType)
+	}
+}
+
+func TestTranscoder(t *testing.T) {
+	testDir := t.TempDir()
+	profile := config.TranscodingProfile{Name: "car", Codec: config.CodecMp3, Container: "mp3"}
+	testConfig := config.Config{
+		ProcessedAudiobookPath: filepath.Join(testDir, "processed"),
+		TranscodedChapterPath:  filepath.Join(testDir, "transcoded"),
+		Transcoding:            config.TranscodingConfig{Profiles: []config.TranscodingProfile{profile}},
+	}
+	chapterPath := filepath.Join(testConfig.ProcessedAudiobookPath, "Sun Tzu", "The Art of War", "1.m4b")
+	// Profile name followed by a hash of its settings
+	cachePath := filepath.Join(testConfig.TranscodedChapterPath, "car-796d5f26", "Sun Tzu", "The Art of War", "1.mp3")
+	writeFile := func(p string, modTime time.Time) {
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte("Hello"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(p, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	transcoder := transcode.NewTranscoder(testConfig)
+
+	t.Run("should mirror chapter location in cache", func(t *testing.T) {
+		p, err := transcode.CachePath(testConfig, profile, chapterPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p != cachePath {
+			t.Fatalf("Unexpected cache path %s", p)
+		}
+		if _, err := transcode.CachePath(testConfig, profile, filepath.Join(testDir, "elsewhere.m4b")); err == nil {
+			t.Fatal("Expected error for file outside of processed audiobooks")
+		}
+		if paths := transcode.CachedPaths(testConfig, []string{chapterPath}); !slices.Equal(paths, []string{cachePath}) {
+			t.Fatalf("Unexpected cached paths %v", paths)
+		}
+		changed := profile
+		changed.Bitrate = 96
+		if p, err := transcode.CachePath(testConfig, changed, chapterPath); err != nil || p == cachePath {
+			t.Fatalf("Expected different cache path after changing profile; received: %s", p)
+		}
+	})
+	t.Run("should use cached file", func(t *testing.T) {
+		writeFile(chapterPath, time.Now().Add(-time.Hour))
+		writeFile(cachePath, time.Now())
+		p, err := transcoder.Transcode(context.Background(), profile, chapterPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p != cachePath {
+			t.Fatalf("Unexpected path %s", p)
+		}
+	})
+	t.Run("should not use cached file older than chapter", func(t *testing.T) {
+		writeFile(cachePath, time.Now().Add(-2*time.Hour))
+		// Not a valid chapter, so transcoding it again fails
+		if _, err := transcoder.Transcode(context.Background(), profile, chapterPath); err == nil {
+			t.Fatal("Expected error")
+		}
+	})
+}
@@ -2,17 +2,29 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
+	"github.com/bongofriend/bookplayer/backend/lib/api"
+	"github.com/bongofriend/bookplayer/backend/lib/auth"
 	"github.com/bongofriend/bookplayer/backend/lib/config"
 	"github.com/bongofriend/bookplayer/backend/lib/data/repo"
+	"github.com/bongofriend/bookplayer/backend/lib/events"
 	"github.com/bongofriend/bookplayer/backend/lib/processing"
 	_ "github.com/mattn/go-sqlite3"
 )
 
+const serverShutdownTimeout = 10 * time.Second
+
+// Processing events kept for clients asking for recent history
+const eventHistorySize = 500
+
 func main() {
 	/*envPath, err := config.GetEnvPathFromFlags()
 	if err != nil {
@@ -27,37 +39,92 @@ func main() {
 	if err := repo.ApplyDatabaseMigrations(config.Database); err != nil {
 		log.Fatal(err)
 	}
+	dbClient, err := repo.NewDbClient(config.Database)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer dbClient.Close()
+	audiobookRepo := repo.NewAudiobookRepository(dbClient)
+	if rewritten, err := audiobookRepo.RelativizeAudiobookPaths(context.Background(), config.AudiobookDirectory); err != nil {
+		log.Fatal(err)
+	} else if rewritten > 0 {
+		log.Printf("Located %d audiobooks stored with absolute paths relative to %s", rewritten, config.AudiobookDirectory)
+	}
+	sourceFileRepo := repo.NewSourceFileRepository(dbClient)
+	jobRepo := repo.NewJobRepository(dbClient)
+	overrideRepo := repo.NewOverrideRepository(dbClient)
+	authService, err := auth.NewService(*config, repo.NewUserRepository(dbClient))
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	//go-staticcheck:ignore
 	context, cancel := context.WithCancel(context.Background())
 
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGINT)
-	pipelineDoneCh, err := initProcessingPipeline(context, *config)
-	if err != nil {
-		log.Fatal(err)
-	}
+	eventBus := events.NewBus(eventHistorySize)
+	pipelineDoneCh, pipeline := initProcessingPipeline(context, *config, audiobookRepo, sourceFileRepo, jobRepo, overrideRepo, eventBus)
+	server, serverErrCh := startApiServer(*config, api.Services{
+		AudiobookRepo:  audiobookRepo,
+		ProgressRepo:   repo.NewProgressRepository(dbClient),
+		BookmarkRepo:   repo.NewBookmarkRepository(dbClient),
+		CatalogRepo:    repo.NewCatalogRepository(dbClient),
+		SourceFileRepo: sourceFileRepo,
+		JobRepo:        jobRepo,
+		OverrideRepo:   overrideRepo,
+		EventBus:       eventBus,
+		Auth:           authService,
+		Commands:       pipeline,
+	})
 
 	select {
 	case <-sigChan:
 		log.Println("Shutting down")
-		cancel()
-		<-pipelineDoneCh
-	case <-pipelineDoneCh:
+	case err := <-pipelineDoneCh:
+		shutdownApiServer(server)
+		if err != nil {
+			log.Fatalf("Processing pipeline could not be started: %s", err)
+		}
+		log.Println("Processing pipeline stopped; shutting down")
 		return
-
+	case err := <-serverErrCh:
+		log.Println(err)
 	}
+	shutdownApiServer(server)
+	cancel()
+	<-pipelineDoneCh
 }
 
-func initProcessingPipeline(context context.Context, config config.Config) (chan struct{}, error) {
-	doneChan := make(chan struct{})
-	dbClient, err := repo.NewDbClient(config.Database)
-	if err != nil {
-		doneChan <- struct{}{}
-		return doneChan, err
+func initProcessingPipeline(context context.Context, config config.Config, audiobookRepo repo.AudiobookRepository, sourceFileRepo repo.SourceFileRepository, jobRepo repo.JobRepository, overrideRepo repo.OverrideRepository, eventBus *events.Bus) (chan error, *processing.Pipeline) {
+	doneChan := make(chan error)
+	pipeline := processing.NewPipeline(eventBus)
+	go pipeline.Start(context, config, doneChan, audiobookRepo, sourceFileRepo, jobRepo, overrideRepo)
+	return doneChan, &pipeline
+}
+
+func startApiServer(config config.Config, services api.Services) (*http.Server, chan error) {
+	errChan := make(chan error, 1)
+	server := &http.Server{
+		Addr:    fmt.Sprintf(":%d", config.Port),
+		Handler: api.GetApiHandler(config, services),
 	}
-	repo := repo.NewAudiobookRepository(dbClient)
-	pipeline := processing.NewPipeline()
-	go pipeline.Start(context, config, doneChan, repo)
-	return doneChan, nil
+	// Event streams never finish on their own and would hold up shutdown
+	server.RegisterOnShutdown(services.EventBus.Close)
+	go func() {
+		log.Printf("Listening on %s", server.Addr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			errChan <- err
+		}
+	}()
+	return server, errChan
+}
 
+// Stop accepting new requests and wait for active ones to finish
+func shutdownApiServer(server *http.Server) {
+	ctx, cancel := context.WithTimeout(context.Background(), serverShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Println(err)
+	}
 }